@@ -1,20 +1,16 @@
 package main
 
 import (
-    "database/sql"
     "encoding/json"
     "net/http"
+    "strconv"
     "strings"
+
+    "metal-main/back/store"
 )
 
 // Article represents an article item
-type Article struct {
-    ID          int64  `json:"id"`
-    Title       string `json:"title"`
-    ShortText   string `json:"short_text"`
-    FullText    string `json:"full_text"`
-    PublishedAt string `json:"published_at"` // YYYY-MM-DD
-}
+type Article = store.Article
 
 // Seed default articles (id is auto). If an article with the same title exists, it is skipped.
 func seedDefaultArticles() error {
@@ -427,11 +423,10 @@ func seedDefaultArticles() error {
         },
     }
     for _, a := range seeds {
-        var c int
-        _ = articlesDB.QueryRow("SELECT COUNT(1) FROM articles WHERE title=?", a.Title).Scan(&c)
+        c, _ := st.Content.CountArticlesByTitle(a.Title)
         if c == 0 {
-            if _, err := articlesDB.Exec("INSERT INTO articles (title, short_text, full_text, published_at) VALUES (?,?,?,?)",
-                strings.TrimSpace(a.Title), a.ShortText, a.FullText, a.PublishedAt); err != nil {
+            a.Title = strings.TrimSpace(a.Title)
+            if err := st.Content.CreateArticle(&a); err != nil {
                 return err
             }
         }
@@ -446,21 +441,8 @@ func handleArticlesList(w http.ResponseWriter, r *http.Request) {
         return
     }
     year := strings.TrimSpace(r.URL.Query().Get("year"))
-    var rows *sql.Rows
-    var err error
-    if year == "" {
-        rows, err = articlesDB.Query("SELECT id, title, short_text, full_text, published_at FROM articles ORDER BY published_at DESC, id DESC")
-    } else {
-        rows, err = articlesDB.Query("SELECT id, title, short_text, full_text, published_at FROM articles WHERE strftime('%Y', published_at)=? ORDER BY published_at DESC, id DESC", year)
-    }
+    out, err := st.Content.ListArticles(year)
     if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
-    defer rows.Close()
-    var out []Article
-    for rows.Next() {
-        var a Article
-        if err := rows.Scan(&a.ID, &a.Title, &a.ShortText, &a.FullText, &a.PublishedAt); err != nil { http.Error(w, err.Error(), 500); return }
-        out = append(out, a)
-    }
     writeJSON(w, out)
 }
 
@@ -468,15 +450,8 @@ func handleArticlesList(w http.ResponseWriter, r *http.Request) {
 func adminArticlesHandler(w http.ResponseWriter, r *http.Request) {
     switch r.Method {
     case http.MethodGet:
-        rows, err := articlesDB.Query("SELECT id, title, short_text, full_text, published_at FROM articles ORDER BY published_at DESC, id DESC")
+        out, err := st.Content.ListArticles("")
         if err != nil { http.Error(w, err.Error(), 500); return }
-        defer rows.Close()
-        var out []Article
-        for rows.Next() {
-            var a Article
-            if err := rows.Scan(&a.ID, &a.Title, &a.ShortText, &a.FullText, &a.PublishedAt); err != nil { http.Error(w, err.Error(), 500); return }
-            out = append(out, a)
-        }
         writeJSON(w, out)
     case http.MethodPost:
         var a Article
@@ -486,30 +461,29 @@ func adminArticlesHandler(w http.ResponseWriter, r *http.Request) {
         a.FullText = strings.TrimSpace(a.FullText)
         if a.Title == "" || a.ShortText == "" || a.FullText == "" { http.Error(w, "title, short_text, full_text required", 400); return }
         if strings.TrimSpace(a.PublishedAt) == "" { http.Error(w, "published_at required", 400); return }
-        res, err := articlesDB.Exec("INSERT INTO articles (title, short_text, full_text, published_at) VALUES (?,?,?,?)", a.Title, a.ShortText, a.FullText, a.PublishedAt)
-        if err != nil { http.Error(w, err.Error(), 500); return }
-        id, _ := res.LastInsertId()
-        writeJSON(w, map[string]any{"id": id, "status": "ok"})
+        if err := st.Content.CreateArticle(&a); err != nil { http.Error(w, err.Error(), 500); return }
+        reindex(articleDoc(a))
+        writeJSON(w, map[string]any{"id": a.ID, "status": "ok"})
     case http.MethodPatch:
         var a Article
         if err := json.NewDecoder(r.Body).Decode(&a); err != nil { http.Error(w, err.Error(), 400); return }
         if a.ID == 0 { http.Error(w, "id required", 400); return }
-        fields := []string{}
-        args := []any{}
-        if strings.TrimSpace(a.Title) != "" { fields = append(fields, "title=?"); args = append(args, strings.TrimSpace(a.Title)) }
+        cur, err := st.Content.GetArticle(a.ID)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if strings.TrimSpace(a.Title) != "" { cur.Title = strings.TrimSpace(a.Title) }
         // allow clearing fields
-        if a.ShortText != "" || a.ShortText == "" { fields = append(fields, "short_text=?"); args = append(args, a.ShortText) }
-        if a.FullText != "" || a.FullText == "" { fields = append(fields, "full_text=?"); args = append(args, a.FullText) }
-        if strings.TrimSpace(a.PublishedAt) != "" { fields = append(fields, "published_at=?"); args = append(args, strings.TrimSpace(a.PublishedAt)) }
-        if len(fields) == 0 { writeJSON(w, map[string]string{"status":"ok"}); return }
-        args = append(args, a.ID)
-        q := "UPDATE articles SET " + strings.Join(fields, ",") + " WHERE id=?"
-        if _, err := articlesDB.Exec(q, args...); err != nil { http.Error(w, err.Error(), 500); return }
+        cur.ShortText = a.ShortText
+        cur.FullText = a.FullText
+        if strings.TrimSpace(a.PublishedAt) != "" { cur.PublishedAt = strings.TrimSpace(a.PublishedAt) }
+        if err := st.Content.UpdateArticle(cur); err != nil { http.Error(w, err.Error(), 500); return }
+        reindex(articleDoc(cur))
         writeJSON(w, map[string]string{"status":"ok"})
     case http.MethodDelete:
-        idStr := r.URL.Query().Get("id")
-        if idStr == "" { http.Error(w, "id required", 400); return }
-        if _, err := articlesDB.Exec("DELETE FROM articles WHERE id= ?", idStr); err != nil { http.Error(w, err.Error(), 500); return }
+        id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if id == 0 { http.Error(w, "id required", 400); return }
+        if err := st.Content.DeleteArticle(id); err != nil { http.Error(w, err.Error(), 500); return }
+        unindex(store.EntityArticle, id)
         writeJSON(w, map[string]string{"status":"ok"})
     default:
         http.Error(w, "method not allowed", 405)
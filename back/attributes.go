@@ -0,0 +1,390 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "log"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "metal-main/back/store"
+)
+
+// Product attributes: typed characteristics (class, steel grade, GOST, dimensions, coating) defined
+// per top-level category. Most products only carry them in the name and size text, so values are
+// parsed from there; values an admin sets by hand are marked manual and survive re-parsing.
+
+// attribute codes the parser fills
+const (
+    attrClass     = "class"
+    attrGrade     = "grade"
+    attrGOST      = "gost"
+    attrDiameter  = "diameter"
+    attrWall      = "wall"
+    attrWidth     = "width"
+    attrHeight    = "height"
+    attrThickness = "thickness"
+    attrCoating   = "coating"
+)
+
+// Go's \b is ASCII-only, so word edges are spelled out to work for Cyrillic too; the grade's
+// trailing edge is checked in parseGrade so that it does not swallow the next grade's leading one
+var (
+    reAttrClass = regexp.MustCompile(`(?:^|[^\p{L}\p{N}])(а(т)?)[\s-]?(\d{3}|[1-6]|iv|v|vi|i{1,3})(с|к)?(?:$|[^\p{L}\p{N}])`)
+    reAttrGrade = regexp.MustCompile(`(?:^|[^\p{L}\p{N}])(ст\.?\s?\d{1,2}(?:сп|пс|кп)?\d?|\d{2}[а-яё]{1,3}\d{0,2}(?:[а-яё]{1,3}\d{0,2})*)`)
+    reAttrGOST  = regexp.MustCompile(`гост\s*(р\s*)?(\d{3,5}(?:[.\-–]\d{1,4})*)`)
+    reAttrDims  = regexp.MustCompile(`(\d+(?:\.\d+)?)(?:\s*х\s*(\d+(?:\.\d+)?))?(?:\s*х\s*(\d+(?:\.\d+)?))?`)
+)
+
+// gradeUnits are number+letters tokens that look like a grade but are quantities or shape codes
+var gradeUnits = map[string]bool{"мм": true, "м": true, "см": true, "т": true, "кг": true, "шт": true, "п": true, "у": true}
+
+// foldAttrText lower-cases s and spells lookalike Latin letters in Cyrillic, so "A500C", "09Г2C"
+// and "40x20" read the same as their Cyrillic spelling; ×, * and decimal commas are unified too
+func foldAttrText(s string) string {
+    s = strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+    s = strings.NewReplacer("×", "х", "*", "х", ",", ".").Replace(s)
+    return strings.Map(func(r rune) rune {
+        if cyr, ok := latinLookalikes[r]; ok { return cyr }
+        return r
+    }, s)
+}
+
+func formatAttrNum(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+// parseClass finds a rebar class: А500С, А400, А1, Ат800
+func parseClass(text string) string {
+    m := reAttrClass.FindStringSubmatch(text)
+    if m == nil { return "" }
+    out := "А"
+    if m[2] != "" { out += "т" }
+    if n := m[3]; n[0] >= '0' && n[0] <= '9' { out += n } else { out += "-" + strings.ToUpper(n) }
+    return out + strings.ToUpper(m[4])
+}
+
+// gradeSpans returns where real steel grades are in text: the pattern also matches sizes (40х20)
+// and numbers with a unit (57мм), which are skipped
+func gradeSpans(text string) [][2]int {
+    var out [][2]int
+    for _, m := range reAttrGrade.FindAllStringSubmatchIndex(text, -1) {
+        if next, _ := utf8.DecodeRuneInString(text[m[1]:]); unicode.IsLetter(next) || unicode.IsDigit(next) { continue }
+        g := strings.NewReplacer(".", "", " ", "").Replace(text[m[2]:m[3]])
+        letters := strings.TrimFunc(strings.Map(func(r rune) rune {
+            if r >= '0' && r <= '9' { return -1 }
+            return r
+        }, g), func(r rune) bool { return r == 'х' })
+        if !strings.HasPrefix(g, "ст") && (letters == "" || gradeUnits[letters]) { continue }
+        out = append(out, [2]int{m[2], m[3]})
+    }
+    return out
+}
+
+// parseGrade finds a steel grade: Ст3сп, Ст20, 09Г2С, 10ХСНД
+func parseGrade(text string) string {
+    spans := gradeSpans(text)
+    if len(spans) == 0 { return "" }
+    g := strings.NewReplacer(".", "", " ", "").Replace(text[spans[0][0]:spans[0][1]])
+    if strings.HasPrefix(g, "ст") { return "Ст" + g[len("ст"):] }
+    return strings.ToUpper(g)
+}
+
+func parseGOST(text string) string {
+    m := reAttrGOST.FindStringSubmatch(text)
+    if m == nil { return "" }
+    out := "ГОСТ "
+    if m[1] != "" { out += "Р " }
+    return out + strings.ReplaceAll(m[2], "–", "-")
+}
+
+// parseDims returns the numbers of the first "A", "AxB" or "AxBxC" group of text
+func parseDims(text string) []float64 {
+    m := reAttrDims.FindStringSubmatch(text)
+    if m == nil { return nil }
+    var out []float64
+    for _, s := range m[1:] {
+        if s == "" { break }
+        v, err := strconv.ParseFloat(s, 64)
+        if err != nil { break }
+        out = append(out, v)
+    }
+    return out
+}
+
+func parseCoating(raw string) string {
+    switch {
+    case strings.Contains(raw, "оцинк") || strings.Contains(raw, "ocink") || strings.Contains(raw, "otsink"):
+        return "оцинкованное"
+    case strings.Contains(raw, "полимер") || strings.Contains(raw, "polimer") || strings.Contains(raw, "крашен") || strings.Contains(raw, "krashen"):
+        return "полимерное"
+    }
+    return ""
+}
+
+// parseAttributes reads attribute values out of a product's subtype, name and size. has tells
+// which codes the product's category defines: the same "40x20x2" is width, height and wall of a
+// profile pipe but thickness, width and length of a sheet.
+func parseAttributes(p ProductRow, has func(code string) bool) map[string]string {
+    raw := strings.ToLower(p.Subtype + " " + p.Name + " " + p.Size)
+    text := foldAttrText(raw)
+    out := map[string]string{}
+    if v := parseClass(text); v != "" { out[attrClass] = v }
+    if v := parseGrade(text); v != "" { out[attrGrade] = v }
+    if v := parseGOST(text); v != "" { out[attrGOST] = v }
+    if v := parseCoating(raw); v != "" { out[attrCoating] = v }
+
+    // dimensions come from the size, else from the name with grade, class and GOST cut out
+    dims := parseDims(foldAttrText(p.Size))
+    if len(dims) == 0 {
+        name := foldAttrText(p.Name)
+        // only real grades are cut: the grade pattern alone would take "40х20" and "57х3" too
+        spans := gradeSpans(name)
+        for i := len(spans) - 1; i >= 0; i-- { name = name[:spans[i][0]] + " " + name[spans[i][1]:] }
+        for _, re := range []*regexp.Regexp{reAttrGOST, reAttrClass} { name = re.ReplaceAllString(name, " ") }
+        dims = parseDims(name)
+    }
+    set := func(code string, v float64) { if v > 0 { out[code] = formatAttrNum(v) } }
+    // two numbers on a square shape are side and wall: 40x2 is a 40x40 pipe with a 2 mm wall
+    square := len(dims) == 2 && dims[1] <= 12 && dims[1] < dims[0]/2
+    switch {
+    case len(dims) == 0:
+    case has(attrWidth) && has(attrHeight) && (has(attrWall) || has(attrThickness)):
+        side := attrWall
+        if !has(attrWall) { side = attrThickness }
+        switch {
+        case len(dims) >= 3:
+            set(attrWidth, dims[0]); set(attrHeight, dims[1]); set(side, dims[2])
+        case square:
+            set(attrWidth, dims[0]); set(attrHeight, dims[0]); set(side, dims[1])
+        case len(dims) == 2:
+            set(attrWidth, dims[0]); set(attrHeight, dims[1])
+        }
+    case has(attrDiameter):
+        set(attrDiameter, dims[0])
+        if len(dims) >= 2 && has(attrWall) { set(attrWall, dims[1]) }
+    case has(attrThickness) && has(attrWidth):
+        set(attrThickness, dims[0])
+        if len(dims) >= 2 { set(attrWidth, dims[1]) }
+    case has(attrThickness):
+        // profiled sheet sizes also carry the profile height and sheet width; the gauge is the thin one
+        for _, d := range dims {
+            if d < 5 { set(attrThickness, d); break }
+        }
+    }
+    return out
+}
+
+// attributeDefsFor returns the definitions of the category of a product type
+func attributeDefsFor(productType string) ([]store.AttributeDef, error) {
+    c, ok := catalogTree().topCategory(normalizeTypeSlug(productType))
+    if !ok { return nil, nil }
+    return st.Attributes.Definitions(c.ID)
+}
+
+// parsedAttributeValues matches the parsed values of p to defs
+func parsedAttributeValues(p ProductRow, defs []store.AttributeDef) []store.AttributeValue {
+    byCode := map[string]store.AttributeDef{}
+    for _, d := range defs { byCode[d.Code] = d }
+    parsed := parseAttributes(p, func(code string) bool { _, ok := byCode[code]; return ok })
+    var out []store.AttributeValue
+    for _, d := range defs {
+        if v, ok := parsed[d.Code]; ok {
+            out = append(out, store.AttributeValue{AttributeID: d.ID, Code: d.Code, Kind: d.Kind, Value: v, Source: store.AttrParsed})
+        }
+    }
+    return out
+}
+
+// reparseAttributes refreshes the parsed values of one product after it was saved
+func reparseAttributes(p ProductRow) {
+    defs, err := attributeDefsFor(p.Type)
+    if err == nil { err = st.Attributes.ReplaceParsed(p.ID, parsedAttributeValues(p, defs)) }
+    if err != nil { log.Printf("parse attributes of product %d: %v", p.ID, err) }
+}
+
+// backfillAttributes re-parses every product; manual values are kept
+func backfillAttributes() (products, values int, err error) {
+    err = st.InTx(func(tx *store.Store) error {
+        rows, err := tx.Products.List("")
+        if err != nil { return err }
+        defsByCategory := map[int64][]store.AttributeDef{}
+        t := catalogTree()
+        for _, p := range rows {
+            var vals []store.AttributeValue
+            if c, ok := t.topCategory(normalizeTypeSlug(p.Type)); ok {
+                defs, seen := defsByCategory[c.ID]
+                if !seen {
+                    if defs, err = tx.Attributes.Definitions(c.ID); err != nil { return err }
+                    defsByCategory[c.ID] = defs
+                }
+                vals = parsedAttributeValues(p, defs)
+            }
+            if err := tx.Attributes.ReplaceParsed(p.ID, vals); err != nil { return err }
+            products++
+            values += len(vals)
+        }
+        return nil
+    })
+    return products, values, err
+}
+
+// productAttribute is one entry of the "attributes" list of a product in API responses
+type productAttribute struct {
+    Code  string `json:"code"`
+    Title string `json:"title"`
+    Unit  string `json:"unit,omitempty"`
+    Value string `json:"value"`
+}
+
+func productAttributesJSON(vals []store.AttributeValue) []productAttribute {
+    out := make([]productAttribute, 0, len(vals))
+    for _, v := range vals { out = append(out, productAttribute{Code: v.Code, Title: v.Title, Unit: v.Unit, Value: v.Value}) }
+    return out
+}
+
+// attrFiltersFromQuery reads attr.<code>=v1|v2, attr.<code>.min and attr.<code>.max for the
+// attributes in defs; a non-empty message means a bad request
+func attrFiltersFromQuery(q map[string][]string, defs []store.AttributeDef) ([]store.AttrFilter, string) {
+    var out []store.AttrFilter
+    for _, d := range defs {
+        af := store.AttrFilter{AttributeID: d.ID, Values: queryList(q, "attr."+d.Code)}
+        for _, end := range []string{"min", "max"} {
+            name := "attr." + d.Code + "." + end
+            s := ""
+            if vs := q[name]; len(vs) > 0 { s = strings.TrimSpace(strings.ReplaceAll(vs[0], ",", ".")) }
+            if s == "" { continue }
+            if d.Kind != store.AttrNumber { return nil, name + ": not a numeric attribute" }
+            v, err := strconv.ParseFloat(s, 64)
+            if err != nil { return nil, "bad " + name }
+            if end == "min" { af.Num.Min = &v } else { af.Num.Max = &v }
+        }
+        if len(af.Values) > 0 || af.Num.Min != nil || af.Num.Max != nil { out = append(out, af) }
+    }
+    return out, ""
+}
+
+// validateAttributeDef normalizes d and returns a client-facing error message or ""
+func validateAttributeDef(d *store.AttributeDef) string {
+    d.Code = strings.ToLower(strings.TrimSpace(d.Code))
+    d.Title = strings.TrimSpace(d.Title)
+    d.Unit = strings.TrimSpace(d.Unit)
+    if d.Kind == "" { d.Kind = store.AttrText }
+    if !validSlug(d.Code) { return "code must be lower-case latin letters, digits, '-' or '_'" }
+    if d.Title == "" { return "title required" }
+    if d.Kind != store.AttrText && d.Kind != store.AttrNumber { return "kind must be text or number" }
+    c, err := st.Categories.Get(d.CategoryID)
+    if err != nil { return "unknown category_id" }
+    if c.ParentID != 0 { return "attributes belong to top-level categories" }
+    return ""
+}
+
+// Admin CRUD for attribute definitions: GET ?category_id=, POST create, PATCH {id,...} update, DELETE ?id=
+func adminAttributesHandler(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        catID, _ := strconv.ParseInt(r.URL.Query().Get("category_id"), 10, 64)
+        out, err := st.Attributes.Definitions(catID)
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, out)
+    case http.MethodPost:
+        var d store.AttributeDef
+        if err := json.NewDecoder(r.Body).Decode(&d); err != nil { http.Error(w, "bad json", 400); return }
+        d.ID = 0
+        if msg := validateAttributeDef(&d); msg != "" { http.Error(w, msg, 400); return }
+        err := st.Attributes.CreateDefinition(&d)
+        if err == store.ErrConflict { http.Error(w, "code already used in this category", 409); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, d)
+    case http.MethodPatch:
+        // decode over the stored row so absent fields keep their value
+        body, err := io.ReadAll(r.Body)
+        if err != nil { http.Error(w, err.Error(), 400); return }
+        var probe struct{ ID int64 `json:"id"` }
+        if err := json.Unmarshal(body, &probe); err != nil { http.Error(w, "bad json", 400); return }
+        if probe.ID == 0 { http.Error(w, "id required", 400); return }
+        d, err := st.Attributes.GetDefinition(probe.ID)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if err := json.Unmarshal(body, &d); err != nil { http.Error(w, "bad json", 400); return }
+        d.ID = probe.ID
+        if msg := validateAttributeDef(&d); msg != "" { http.Error(w, msg, 400); return }
+        err = st.Attributes.UpdateDefinition(d)
+        if err == store.ErrConflict { http.Error(w, "code already used in this category", 409); return }
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, d)
+    case http.MethodDelete:
+        id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if id == 0 { http.Error(w, "id required", 400); return }
+        err := st.Attributes.DeleteDefinition(id)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, map[string]string{"status": "ok"})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
+
+// POST /api/admin/attributes/backfill re-parses the attributes of all products
+func adminAttributesBackfillHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+    products, values, err := backfillAttributes()
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    writeJSON(w, map[string]int{"products": products, "values": values})
+}
+
+// Admin values of one product: GET ?product_id= lists the category's definitions with the current
+// values; PUT {product_id, values: {code: value}} stores them as manual, an empty value removes one
+func adminProductAttributesHandler(w http.ResponseWriter, r *http.Request) {
+    var productID int64
+    var in struct {
+        ProductID int64             `json:"product_id"`
+        Values    map[string]string `json:"values"`
+    }
+    switch r.Method {
+    case http.MethodGet:
+        productID, _ = strconv.ParseInt(r.URL.Query().Get("product_id"), 10, 64)
+    case http.MethodPut:
+        if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+        productID = in.ProductID
+    default:
+        http.Error(w, "method not allowed", 405)
+        return
+    }
+    if productID == 0 { http.Error(w, "product_id required", 400); return }
+    p, err := st.Products.Get(productID)
+    if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    defs, err := attributeDefsFor(p.Type)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    if r.Method == http.MethodPut {
+        byCode := map[string]store.AttributeDef{}
+        for _, d := range defs { byCode[d.Code] = d }
+        err = st.InTx(func(tx *store.Store) error {
+            for code, v := range in.Values {
+                d, ok := byCode[code]
+                if !ok { return errBadAttribute(code) }
+                v = strings.TrimSpace(v)
+                if d.Kind == store.AttrNumber && v != "" {
+                    if _, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", "."), 64); err != nil { return errBadAttribute(code) }
+                    v = strings.ReplaceAll(v, ",", ".")
+                }
+                if err := tx.Attributes.SetValue(p.ID, store.AttributeValue{AttributeID: d.ID, Kind: d.Kind, Value: v, Source: store.AttrManual}); err != nil { return err }
+            }
+            return nil
+        })
+        if e, ok := err.(errBadAttribute); ok { http.Error(w, "bad value for attribute "+string(e), 400); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+    }
+    vals, err := st.Attributes.Values(p.ID)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    writeJSON(w, map[string]any{"product_id": p.ID, "definitions": defs, "values": vals[p.ID]})
+}
+
+// errBadAttribute names an unknown attribute code or a malformed value
+type errBadAttribute string
+
+func (e errBadAttribute) Error() string { return "bad attribute " + string(e) }
@@ -0,0 +1,62 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func attrCodes(codes ...string) func(string) bool {
+    set := map[string]bool{}
+    for _, c := range codes { set[c] = true }
+    return func(code string) bool { return set[code] }
+}
+
+func TestParseAttributes(t *testing.T) {
+    profilePipe := attrCodes(attrWidth, attrHeight, attrWall, attrGrade, attrGOST)
+    roundPipe := attrCodes(attrDiameter, attrWall, attrGrade, attrGOST)
+    rebar := attrCodes(attrDiameter, attrClass, attrGrade, attrGOST)
+    sheet := attrCodes(attrThickness, attrWidth, attrGrade, attrCoating)
+    profiled := attrCodes(attrThickness, attrCoating)
+    cases := []struct {
+        p    ProductRow
+        has  func(string) bool
+        want map[string]string
+    }{
+        // sizes in the name are not mistaken for grades and cut away
+        {ProductRow{Name: "Труба профильная 40х20х2"}, profilePipe, map[string]string{attrWidth: "40", attrHeight: "20", attrWall: "2"}},
+        {ProductRow{Name: "Труба 57х3.5"}, roundPipe, map[string]string{attrDiameter: "57", attrWall: "3.5"}},
+        {ProductRow{Name: "Труба 57х3,5 09Г2С ГОСТ 8732-78"}, roundPipe, map[string]string{attrDiameter: "57", attrWall: "3.5", attrGrade: "09Г2С", attrGOST: "ГОСТ 8732-78"}},
+        // a square pipe spelled side x wall, Latin x
+        {ProductRow{Name: "Труба профильная 40x2 ст3сп"}, profilePipe, map[string]string{attrWidth: "40", attrHeight: "40", attrWall: "2", attrGrade: "Ст3сп"}},
+        {ProductRow{Name: "Труба ВГП", Size: "32х3.2"}, roundPipe, map[string]string{attrDiameter: "32", attrWall: "3.2"}},
+        // class from the name or the subtype slug, Latin lookalikes included
+        {ProductRow{Name: "Арматура А500С 12 мм"}, rebar, map[string]string{attrClass: "А500С", attrDiameter: "12"}},
+        {ProductRow{Name: "Арматура", Size: "12", Subtype: "a500c"}, rebar, map[string]string{attrClass: "А500С", attrDiameter: "12"}},
+        {ProductRow{Name: "Арматура А-III 25Г2С 16"}, rebar, map[string]string{attrClass: "А-III", attrGrade: "25Г2С", attrDiameter: "16"}},
+        // the same three numbers are thickness and width of a sheet
+        {ProductRow{Name: "Лист оцинкованный", Size: "0.5х1250х2500"}, sheet, map[string]string{attrThickness: "0.5", attrWidth: "1250", attrCoating: "оцинкованное"}},
+        {ProductRow{Name: "Лист г/к 3х1500х6000 Ст3"}, sheet, map[string]string{attrThickness: "3", attrWidth: "1500", attrGrade: "Ст3"}},
+        // the gauge of profiled sheet is the thin number
+        {ProductRow{Name: "Профнастил С8 крашеный", Size: "8х1150х0.45"}, profiled, map[string]string{attrThickness: "0.45", attrCoating: "полимерное"}},
+    }
+    for _, c := range cases {
+        if got := parseAttributes(c.p, c.has); !reflect.DeepEqual(got, c.want) {
+            t.Errorf("parseAttributes(%q, %q) = %v, want %v", c.p.Name, c.p.Size, got, c.want)
+        }
+    }
+}
+
+func TestParseGrade(t *testing.T) {
+    cases := []struct{ in, want string }{
+        {"ст3сп", "Ст3сп"},
+        {"ст. 20", "Ст20"},
+        {"09г2с", "09Г2С"},
+        {"10хснд", "10ХСНД"},
+        {"40х20х2", ""},
+        {"57мм", ""},
+        {"12 м 09г2с", "09Г2С"},
+    }
+    for _, c := range cases {
+        if got := parseGrade(c.in); got != c.want { t.Errorf("parseGrade(%q) = %q, want %q", c.in, got, c.want) }
+    }
+}
@@ -1,46 +1,169 @@
 package main
 
 import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "net"
     "net/http"
-    "net/url"
+    "os"
+    "strconv"
+    "strings"
     "time"
+
+    "metal-main/back/store"
 )
 
 const sessionCookieName = "admin_session"
 const userSessionCookieName = "user_session"
 
-func setSession(w http.ResponseWriter, login string, isAdmin bool) {
-    if !isAdmin { return }
+// Admin sessions expire after 30 minutes of inactivity, user sessions live for a week
+const adminSessionIdleTTL = 30 * time.Minute
+const userSessionTTL = 7 * 24 * time.Hour
+
+// Session is a server-side login session (see store.Session)
+type Session = store.Session
+
+func hashSessionToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
+
+func newSessionToken() (string, error) {
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil { return "", err }
+    return hex.EncodeToString(buf), nil
+}
+
+func sessionKind(cookieName string) string {
+    if cookieName == sessionCookieName { return "admin" }
+    return "user"
+}
+
+// clientIP identifies the client for sessions and throttling. X-Forwarded-For is only honoured with
+// TRUST_PROXY=1, otherwise any client could forge the address stored on its session or dodge the
+// per-IP limit by sending a fresh header each time.
+func clientIP(r *http.Request) string {
+    if os.Getenv("TRUST_PROXY") == "1" {
+        if xf := strings.TrimSpace(r.Header.Get("X-Forwarded-For")); xf != "" {
+            if i := strings.Index(xf, ","); i >= 0 { xf = xf[:i] }
+            return strings.TrimSpace(xf)
+        }
+    }
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil { return r.RemoteAddr }
+    return host
+}
+
+// createSession stores a new session row and sets its cookie
+func createSession(w http.ResponseWriter, r *http.Request, cookieName string, userID int64) error {
+    token, err := newSessionToken()
+    if err != nil { return err }
+    ttl := userSessionTTL
+    if cookieName == sessionCookieName { ttl = adminSessionIdleTTL }
+    now := time.Now().UTC()
+    // drop expired rows opportunistically
+    _ = st.Users.DeleteExpiredSessions(now.Format(store.TimeLayout))
+    err = st.Users.CreateSession(Session{
+        ID: hashSessionToken(token), UserID: userID, Kind: sessionKind(cookieName), IP: clientIP(r), UserAgent: r.UserAgent(),
+        CreatedAt: now.Format(store.TimeLayout), LastSeenAt: now.Format(store.TimeLayout), ExpiresAt: now.Add(ttl).Format(store.TimeLayout),
+    })
+    if err != nil { return err }
     cookie := &http.Cookie{
-        Name: sessionCookieName,
-        Value: url.QueryEscape(login),
+        Name: cookieName,
+        Value: token,
         Path: "/",
         HttpOnly: true,
         SameSite: http.SameSiteLaxMode,
-        Expires: time.Now().Add(30*time.Minute),
     }
+    // admin cookie lives for the browser session; the server enforces the idle timeout
+    if cookieName == userSessionCookieName { cookie.Expires = now.Add(ttl) }
     http.SetCookie(w, cookie)
+    return nil
 }
 
-func clearSession(w http.ResponseWriter) {
+// sessionFromRequest resolves the cookie to a live session and touches last_seen_at
+func sessionFromRequest(r *http.Request, cookieName string) (*Session, bool) {
+    c, err := r.Cookie(cookieName)
+    if err != nil || c.Value == "" { return nil, false }
+    now := time.Now().UTC()
+    s, err := st.Users.LiveSession(hashSessionToken(c.Value), sessionKind(cookieName), now.Format(store.TimeLayout))
+    if err != nil { return nil, false }
+    // touch at most once a minute to keep writes cheap; admin sessions slide their expiry
+    if last, err := time.Parse(store.TimeLayout, s.LastSeenAt); err != nil || now.Sub(last) > time.Minute {
+        expires := s.ExpiresAt
+        if s.Kind == "admin" { expires = now.Add(adminSessionIdleTTL).Format(store.TimeLayout) }
+        _ = st.Users.TouchSession(s.ID, now.Format(store.TimeLayout), expires)
+    }
+    return &s, true
+}
+
+// currentUserLogin returns the login of the signed-in public user, if any
+func currentUserLogin(r *http.Request) string {
+    if s, ok := sessionFromRequest(r, userSessionCookieName); ok { return s.Login }
+    return ""
+}
+
+// currentAdminLogin is the login of the admin session, recorded in audit rows
+func currentAdminLogin(r *http.Request) string {
+    if s, ok := sessionFromRequest(r, sessionCookieName); ok { return s.Login }
+    return ""
+}
+
+func setSession(w http.ResponseWriter, r *http.Request, userID int64, isAdmin bool) error {
+    if !isAdmin { return nil }
+    return createSession(w, r, sessionCookieName, userID)
+}
+
+// revokeRequestSession deletes the session referenced by the request cookie
+func revokeRequestSession(r *http.Request, cookieName string) {
+    if c, err := r.Cookie(cookieName); err == nil && c.Value != "" {
+        _ = st.Users.DeleteSession(hashSessionToken(c.Value))
+    }
+}
+
+// revokeUserSessions kills every session of a user (password change, account removal)
+func revokeUserSessions(userID int64) error {
+    return st.Users.DeleteUserSessions(userID)
+}
+
+func clearSession(w http.ResponseWriter, r *http.Request) {
+    revokeRequestSession(r, sessionCookieName)
     http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", Expires: time.Unix(0,0)})
 }
 
 // Public user session helpers
-func setUserSession(w http.ResponseWriter, login string) {
-    cookie := &http.Cookie{
-        Name: userSessionCookieName,
-        Value: url.QueryEscape(login),
-        Path: "/",
-        HttpOnly: true,
-        SameSite: http.SameSiteLaxMode,
-        Expires: time.Now().Add(7*24*time.Hour),
-    }
-    http.SetCookie(w, cookie)
+func setUserSession(w http.ResponseWriter, r *http.Request, userID int64) error {
+    return createSession(w, r, userSessionCookieName, userID)
 }
 
-func clearUserSession(w http.ResponseWriter) {
+func clearUserSession(w http.ResponseWriter, r *http.Request) {
+    revokeRequestSession(r, userSessionCookieName)
     http.SetCookie(w, &http.Cookie{Name: userSessionCookieName, Value: "", Path: "/", Expires: time.Unix(0,0)})
 }
 
-
+// Admin GET/DELETE: /api/admin/sessions
+// GET lists active sessions (optionally ?user_id=), DELETE kills one (?id=) or all of a user (?user_id=)
+func adminSessionsHandler(w http.ResponseWriter, r *http.Request) {
+    userID, _ := strconv.ParseInt(r.URL.Query().Get("user_id"), 10, 64)
+    switch r.Method {
+    case http.MethodGet:
+        out, err := st.Users.ListSessions(userID, store.Now())
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, out)
+    case http.MethodDelete:
+        id := strings.TrimSpace(r.URL.Query().Get("id"))
+        var err error
+        if id != "" {
+            err = st.Users.DeleteSession(id)
+        } else if userID > 0 {
+            err = revokeUserSessions(userID)
+        } else {
+            http.Error(w, "id or user_id required", 400); return
+        }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, map[string]string{"status":"ok"})
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    }
+}
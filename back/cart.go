@@ -3,75 +3,54 @@ package main
 import (
     "encoding/json"
     "net/http"
+    "strconv"
     "strings"
+
+    "metal-main/back/store"
 )
 
 // cartHandler persists simple carts in SQLite keyed by anonymous cart_id cookie.
 // This enables cross-device continuity without requiring auth.
 func cartHandler(w http.ResponseWriter, r *http.Request) {
-    // Resolve cart id from cookie; create if missing
-    c, err := r.Cookie("cart_id")
-    cartID := ""
-    if err == nil { cartID = strings.TrimSpace(c.Value) }
-    if cartID == "" {
-        // use csrf token or random fallback
-        cartID = generateCSRFToken()
-        http.SetCookie(w, &http.Cookie{ Name: "cart_id", Value: cartID, Path: "/", MaxAge: 60*60*24*90 })
-    }
+    cartID := resolveCartID(w, r)
 
     switch r.Method {
     case http.MethodGet:
-        rows, err := cartDB.Query("SELECT item_id, title, price, image, qty FROM cart_items WHERE cart_id=?", cartID)
-        if err != nil { writeJSON(w, []any{}); return }
-        defer rows.Close()
-        type item struct{ ID, Title, Image string; Price float64; Qty int }
-        var out []item
-        for rows.Next() {
-            var it item
-            if err := rows.Scan(&it.ID, &it.Title, &it.Price, &it.Image, &it.Qty); err == nil { out = append(out, it) }
-        }
-        writeJSON(w, out)
+        writeCart(w, r, cartID)
     case http.MethodPost:
+        // title, price and image sent by the page are ignored; they come from the products table
         var p struct {
-            ID    string  `json:"id"`
-            Title string  `json:"title"`
-            Price float64 `json:"price"`
-            Image string  `json:"image"`
-            Qty   int     `json:"qty"`
+            ID   string  `json:"id"`
+            Qty  float64 `json:"qty"`
+            Unit string  `json:"unit"`
         }
         if err := json.NewDecoder(r.Body).Decode(&p); err != nil { http.Error(w, "bad json", 400); return }
         p.ID = strings.TrimSpace(p.ID)
         if p.ID == "" { http.Error(w, "id required", 400); return }
-        if p.Qty <= 0 { p.Qty = 1 }
-        // upsert
-        tx, _ := cartDB.Begin()
-        defer tx.Rollback()
-        var cur int
-        _ = tx.QueryRow("SELECT qty FROM cart_items WHERE cart_id=? AND item_id=?", cartID, p.ID).Scan(&cur)
-        if cur > 0 {
-            _, err = tx.Exec("UPDATE cart_items SET qty=qty+? WHERE cart_id=? AND item_id=?", p.Qty, cartID, p.ID)
-        } else {
-            _, err = tx.Exec("INSERT INTO cart_items(cart_id, item_id, title, price, image, qty) VALUES(?,?,?,?,?,?)", cartID, p.ID, p.Title, p.Price, p.Image, p.Qty)
-        }
+        rules, err := currentPriceRules(r)
         if err != nil { http.Error(w, err.Error(), 500); return }
-        _ = tx.Commit()
-        writeJSON(w, map[string]string{"status":"ok"})
+        line, err := priceLine(st.Products, rules, p.ID, p.Qty, p.Unit)
+        if err != nil { writePricingError(w, err); return }
+        it, err := cartItemFor(cartID, line)
+        if err != nil { writePricingError(w, err); return }
+        // upsert
+        if err := st.Cart.Add(cartID, it); err != nil { http.Error(w, err.Error(), 500); return }
+        writeCart(w, r, cartID)
     case http.MethodPatch:
-        var p struct { ID string `json:"id"`; Qty int `json:"qty"` }
+        var p struct { ID string `json:"id"`; Qty float64 `json:"qty"` }
         if err := json.NewDecoder(r.Body).Decode(&p); err != nil { http.Error(w, "bad json", 400); return }
         if strings.TrimSpace(p.ID) == "" { http.Error(w, "id required", 400); return }
         if p.Qty <= 0 { p.Qty = 1 }
-        _, err := cartDB.Exec("UPDATE cart_items SET qty=? WHERE cart_id=? AND item_id=?", p.Qty, cartID, p.ID)
-        if err != nil { http.Error(w, err.Error(), 500); return }
-        writeJSON(w, map[string]string{"status":"ok"})
+        if err := st.Cart.SetQty(cartID, p.ID, p.Qty); err != nil { http.Error(w, err.Error(), 500); return }
+        writeCart(w, r, cartID)
     case http.MethodDelete:
         id := strings.TrimSpace(r.URL.Query().Get("id"))
         all := strings.TrimSpace(r.URL.Query().Get("all"))
         var err error
         if id == "" && all == "1" {
-            _, err = cartDB.Exec("DELETE FROM cart_items WHERE cart_id=?", cartID)
+            err = st.Cart.Clear(cartID)
         } else if id != "" {
-            _, err = cartDB.Exec("DELETE FROM cart_items WHERE cart_id=? AND item_id=?", cartID, id)
+            err = st.Cart.Remove(cartID, id)
         } else {
             http.Error(w, "id or all=1 required", 400); return
         }
@@ -82,4 +61,67 @@ func cartHandler(w http.ResponseWriter, r *http.Request) {
     }
 }
 
+// resolveCartID returns the cart id from the cart_id cookie, issuing a new one if missing
+func resolveCartID(w http.ResponseWriter, r *http.Request) string {
+    c, err := r.Cookie("cart_id")
+    cartID := ""
+    if err == nil { cartID = strings.TrimSpace(c.Value) }
+    if cartID == "" {
+        // use csrf token or random fallback
+        cartID = generateCSRFToken()
+        http.SetCookie(w, &http.Cookie{ Name: "cart_id", Value: cartID, Path: "/", MaxAge: 60*60*24*90 })
+    }
+    return cartID
+}
 
+// cartItemFor turns a priced line into a cart item. A product already in the cart keeps the unit of
+// its line, so the added quantity is converted to that unit.
+func cartItemFor(cartID string, line pricedLine) (store.CartItem, error) {
+    it := store.CartItem{ID: strconv.FormatInt(line.Product.ID, 10), Title: line.Title, Price: line.Quote.UnitPrice, Image: line.Product.Img, Qty: line.Quote.Qty, Unit: line.Quote.Unit}
+    items, err := st.Cart.Items(cartID)
+    if err != nil { return it, err }
+    for _, cur := range items {
+        if cur.ID != it.ID { continue }
+        // lines stored before units existed are in the base unit
+        unit := cur.Unit
+        if unit == "" { unit = line.Quote.Units[0] }
+        if it.Qty, err = convertQty(line.Product, it.Qty, it.Unit, unit); err != nil { return it, err }
+        it.Unit = cur.Unit
+    }
+    return it, nil
+}
+
+// cartLine is a cart item re-priced against the current catalog
+type cartLine struct {
+    store.CartItem
+    WeightKg    float64      `json:"WeightKg,omitempty"`
+    Total       float64      `json:"Total"`
+    ListPrice   float64      `json:"ListPrice,omitempty"` // per Unit before Rule
+    Rule        *appliedRule `json:"Rule,omitempty"`
+    Unavailable bool         `json:"Unavailable,omitempty"` // product removed, out of stock or without a price; not counted in the total
+}
+
+// writeCart re-prices every stored line from the products table and the customer's pricing rules and
+// returns the cart with its total, so a price change in the admin is reflected in carts filled before it
+func writeCart(w http.ResponseWriter, r *http.Request, cartID string) {
+    items, err := st.Cart.Items(cartID)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    rules, err := currentPriceRules(r)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    lines := make([]cartLine, 0, len(items))
+    var total float64
+    for _, it := range items {
+        l := cartLine{CartItem: it}
+        pl, err := priceLine(st.Products, rules, it.ID, it.Qty, it.Unit)
+        if err != nil {
+            l.Unavailable = true
+        } else {
+            l.Title, l.Price, l.Image, l.Unit = pl.Title, pl.Quote.UnitPrice, pl.Product.Img, pl.Quote.Unit
+            l.WeightKg, l.Total = pl.Quote.WeightKg, pl.Quote.Total
+            l.ListPrice, l.Rule = pl.Quote.ListPrice, pl.Quote.Rule
+            total += pl.Quote.Total
+        }
+        lines = append(lines, l)
+    }
+    writeJSON(w, map[string]any{"items": lines, "total": roundKop(total)})
+}
@@ -2,32 +2,16 @@ package main
 
 import (
     "net/http"
+    "net/url"
     "os"
     "path/filepath"
+    "strconv"
     "strings"
-)
 
-// catalogSlugToTitle maps URL slugs to human-readable category titles
-var catalogSlugToTitle = map[string]string{
-    "armatura":                    "Арматура",
-    "truba-profilnaya":            "Труба профильная",
-    "sortovoy-prokat":             "Сортовой прокат",
-    "truba-kruglaya":              "Труба круглая",
-    "listovoy-prokat":             "Листовой прокат",
-    "profnastil":                  "Профнастил",
-    "kovanye-izdeliya":            "Кованые изделия",
-    "shtaketnik-metallicheskiy":   "Штакетник металлический",
-    "setka-metallicheskaia":       "Сетка металлическая",
-    "stroymaterialy":              "Стройматериалы",
-    "zabory":                      "Заборы",
-    "krepezh":                     "Крепеж",
-    "petli":                       "Петли",
-    "fitingi":                     "Фитинги",
-    "vintovye-svai":               "Винтовые сваи",
-    "zaglushki-dlya-profilnyh-trub": "Заглушки для профильных труб",
-}
+    "metal-main/back/store"
+)
 
-// registerCatalogRoutes wires handlers for /catalog/ and category pages /catalog/{slug}/
+// registerCatalogRoutes wires handlers for /catalog/, category pages /catalog/{slug}/ and item pages
 func registerCatalogRoutes(mux *http.ServeMux) {
     mux.HandleFunc("/catalog/", func(w http.ResponseWriter, r *http.Request) {
         // Serve catalog grid on exact /catalog/ (or /catalog)
@@ -50,15 +34,7 @@ func registerCatalogRoutes(mux *http.ServeMux) {
         parts := strings.Split(trimmed, "/")
         // if product deep route like /catalog/{type}/{sub}/{name}/{size}/ or /catalog/{type}/{name}/{size}/ -> serve item page html
         if len(parts) >= 3 {
-            p := filepath.Join(frontDirPath, "HTML", "catalog_item.html")
-            b, err := os.ReadFile(p)
-            if err != nil {
-                http.Error(w, "not found", http.StatusNotFound)
-                return
-            }
-            w.Header().Set("Content-Type", "text/html; charset=utf-8")
-            w.Header().Set("Cache-Control", "no-store")
-            _, _ = w.Write(b)
+            serveProductPage(w, r)
             return
         }
 
@@ -69,26 +45,195 @@ func registerCatalogRoutes(mux *http.ServeMux) {
         slug := parts[0]
         sub := ""
         if len(parts) == 2 { sub = parts[1] }
-        title, ok := catalogSlugToTitle[slug]
-        if !ok {
+        tree := catalogTree()
+        cat, ok := tree.topCategory(slug)
+        if !ok || cat.Slug != slug {
             http.NotFound(w, r)
             return
         }
-        // Serve shared HTML template catalog_list.html and inject title/slug placeholders
-        p := filepath.Join(frontDirPath, "HTML", "catalog_list.html")
-        b, err := os.ReadFile(p)
-        if err != nil {
-            http.Error(w, "not found", http.StatusNotFound)
-            return
+        var sc store.Category
+        if sub != "" {
+            if sc, ok = tree.subcategory(cat, sub); !ok {
+                // productURL drops an empty subtype and size, leaving /catalog/{type}/{name}/
+                serveProductPage(w, r)
+                return
+            }
         }
-        html := string(b)
-        html = strings.ReplaceAll(html, "{{CATEGORY_TITLE}}", title)
-        html = strings.ReplaceAll(html, "{{CATEGORY_SLUG}}", slug)
-        html = strings.ReplaceAll(html, "{{SUBCATEGORY_SLUG}}", sub)
-        w.Header().Set("Content-Type", "text/html; charset=utf-8")
-        w.Header().Set("Cache-Control", "no-store")
-        _, _ = w.Write([]byte(html))
+        renderCatalogPage(w, r, cat, sc)
     })
 }
 
+// serveProductPage renders the item page of a product deep route; unknown products answer 404
+// so dead links drop out of search engines
+func serveProductPage(w http.ResponseWriter, r *http.Request) {
+    p, err := resolveProductPath(productPathSegments(r.URL.EscapedPath()))
+    if err == store.ErrNotFound { http.NotFound(w, r); return }
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    rules, err := currentPriceRules(r)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    renderItemPage(w, p, rules)
+}
+
+// relatedLimit caps the related products of an item page
+const relatedLimit = 8
+
+// breadcrumb is one link of the item page trail
+type breadcrumb struct {
+    Title string `json:"title"`
+    URL   string `json:"url"`
+}
+
+// relatedProduct is a short product card linking to its own item page
+type relatedProduct struct {
+    ProductRow
+    Title     string  `json:"title"`
+    UnitPrice float64 `json:"unit_price"`
+    URL       string  `json:"url"`
+}
+
+// productDetail is everything the item page renders about one product. UnitPrice is the base-unit
+// price after the customer's pricing rules (PriceRule names the one that lowered it, ListPrice is
+// the price before it); PriceTiers are the rules offered on the product.
+type productDetail struct {
+    ProductRow
+    Title           string             `json:"title"`
+    UnitPrice       float64            `json:"unit_price"`
+    ListPrice       float64            `json:"list_price,omitempty"`
+    PriceRule       *appliedRule       `json:"price_rule,omitempty"`
+    PriceTiers      []priceTier        `json:"price_tiers"`
+    URL             string             `json:"url"` // canonical item page path
+    Attributes      []productAttribute `json:"attributes"`
+    TypeDescription string             `json:"type_description"`
+    Breadcrumbs     []breadcrumb       `json:"breadcrumbs"`
+    Related         []relatedProduct   `json:"related"`
+}
+
+// productPathSegments splits an escaped /catalog/... path into its unescaped segments; empty
+// segments are dropped because the list page links products without a subcategory as type//name
+func productPathSegments(escapedPath string) []string {
+    var out []string
+    for _, s := range strings.Split(strings.TrimPrefix(escapedPath, "/catalog/"), "/") {
+        if u, err := url.PathUnescape(s); err == nil { s = u }
+        if s = strings.TrimSpace(s); s != "" { out = append(out, s) }
+    }
+    return out
+}
+
+// resolveProductPath finds the product of an item page path {type}/[{sub}/]{name}[/{size}].
+// Three segments are read as sub/name first, then as name/size. The sub segment is either the
+// subcategory slug or the raw subtype and only picks among products sharing a name and size.
+func resolveProductPath(segs []string) (ProductRow, error) {
+    if len(segs) < 2 || len(segs) > 4 { return ProductRow{}, store.ErrNotFound }
+    typeSlug := categoryToTypeSlug(segs[0])
+    var tries [][3]string // sub, name, size
+    switch rest := segs[1:]; len(rest) {
+    case 1:
+        tries = [][3]string{{"", rest[0], ""}}
+    case 2:
+        tries = [][3]string{{rest[0], rest[1], ""}, {"", rest[0], rest[1]}}
+    case 3:
+        tries = [][3]string{{rest[0], rest[1], rest[2]}}
+    }
+    for _, t := range tries {
+        sub, name, size := t[0], t[1], t[2]
+        rows, err := st.Products.FindByName(typeSlug, name)
+        if err != nil { return ProductRow{}, err }
+        var matches []ProductRow
+        for _, p := range rows {
+            if strings.EqualFold(strings.TrimSpace(p.Size), size) { matches = append(matches, p) }
+        }
+        if len(matches) == 0 { continue }
+        if sub != "" {
+            label := subSlugToLabel(typeSlug, sub)
+            for _, p := range matches {
+                ps := strings.TrimSpace(p.Subtype)
+                if strings.EqualFold(ps, sub) || (label != "" && strings.EqualFold(ps, label)) { return p, nil }
+            }
+        }
+        return matches[0], nil
+    }
+    return ProductRow{}, store.ErrNotFound
+}
 
+// productBreadcrumbs is the trail catalog → category → subcategory of p
+func productBreadcrumbs(p ProductRow) []breadcrumb {
+    out := []breadcrumb{{Title: "Каталог", URL: "/catalog/"}}
+    t := catalogTree()
+    cat, ok := t.topCategory(normalizeTypeSlug(p.Type))
+    if !ok { return out }
+    out = append(out, breadcrumb{Title: cat.Title, URL: "/catalog/" + cat.Slug + "/"})
+    if c, ok := productSubcategory(t, cat, p); ok {
+        out = append(out, breadcrumb{Title: c.Title, URL: "/catalog/" + cat.Slug + "/" + c.Slug + "/"})
+    }
+    return out
+}
+
+// productSubcategory is the subcategory of cat that p's subtype names; older rows spell the
+// subtype as the subcategory title
+func productSubcategory(t *categoryTree, cat store.Category, p ProductRow) (store.Category, bool) {
+    sub := strings.TrimSpace(p.Subtype)
+    if sub == "" { return store.Category{}, false }
+    for _, c := range t.children[cat.ID] {
+        if strings.EqualFold(c.Slug, sub) || strings.EqualFold(c.Title, sub) { return c, true }
+    }
+    return store.Category{}, false
+}
+
+func buildProductDetail(p ProductRow, rules priceRules) (productDetail, error) {
+    d := productDetail{ProductRow: p, Title: productTitle(p), UnitPrice: unitPrice(p), URL: productURL(p), Breadcrumbs: productBreadcrumbs(p)}
+    // the price of one base unit, as a line of that size would get it
+    if q, err := quoteProduct(p, 1, ""); err == nil {
+        if q = rules.apply(p, q); q.Rule != nil { d.UnitPrice, d.ListPrice, d.PriceRule = q.UnitPrice, q.ListPrice, q.Rule }
+    }
+    d.PriceTiers = rules.tiers(p)
+    typeSlug := normalizeTypeSlug(p.Type)
+    attrs, err := st.Attributes.Values(p.ID)
+    if err != nil { return d, err }
+    d.Attributes = productAttributesJSON(attrs[p.ID])
+    d.TypeDescription, err = st.Products.TypeDescription(typeSlug)
+    if err != nil && err != store.ErrNotFound { return d, err }
+    related, err := st.Products.Related(typeSlug, p, relatedLimit)
+    if err != nil { return d, err }
+    d.Related = make([]relatedProduct, 0, len(related))
+    for _, rp := range related {
+        d.Related = append(d.Related, relatedProduct{ProductRow: rp, Title: productTitle(rp), UnitPrice: unitPrice(rp), URL: productURL(rp)})
+    }
+    return d, nil
+}
+
+// GET /api/catalog/products/{id} and /api/catalog/products/by-path?path=/catalog/... return one
+// product with its attributes, type description, breadcrumbs and related products;
+// /api/catalog/products/{id}/price-history is its price series when PUBLIC_PRICE_HISTORY is on
+func handleGetProduct(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if st == nil { http.NotFound(w, r); return }
+    rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/catalog/products/"), "/")
+    var p ProductRow
+    var err error
+    if rest == "by-path" {
+        path := r.URL.Query().Get("path")
+        if u, perr := url.Parse(path); perr == nil { path = u.EscapedPath() }
+        p, err = resolveProductPath(productPathSegments(path))
+    } else {
+        idPart, sub, _ := strings.Cut(rest, "/")
+        id, perr := strconv.ParseInt(idPart, 10, 64)
+        if perr != nil || id <= 0 || (sub != "" && (sub != "price-history" || !publicPriceHistory())) { http.NotFound(w, r); return }
+        p, err = st.Products.Get(id)
+        if err == nil && sub != "" {
+            series, err := priceSeries(p)
+            if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+            writeJSON(w, series)
+            return
+        }
+    }
+    if err == store.ErrNotFound { http.Error(w, "not found", http.StatusNotFound); return }
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    rules, err := currentPriceRules(r)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    d, err := buildProductDetail(p, rules)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    writeJSON(w, d)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+
+    "metal-main/back/store"
+)
+
+// The catalog tree lives in the categories table and is cached in memory: every catalog page and
+// product listing resolves slugs through it. Top-level slugs equal products.type, subcategory
+// slugs equal products.subtype. The cache is reloaded at startup and after admin changes.
+
+type categoryTree struct {
+    children map[int64][]store.Category // keyed by parent id, 0 for the top level; in display order
+}
+
+var (
+    categoriesMu  sync.RWMutex
+    categoriesCur = &categoryTree{children: map[int64][]store.Category{}}
+)
+
+// loadCategories refreshes the cache; on failure the previous tree stays in use
+func loadCategories() error {
+    list, err := st.Categories.List()
+    if err != nil { return err }
+    t := &categoryTree{children: map[int64][]store.Category{}}
+    for _, c := range list {
+        t.children[c.ParentID] = append(t.children[c.ParentID], c)
+    }
+    categoriesMu.Lock()
+    categoriesCur = t
+    categoriesMu.Unlock()
+    return nil
+}
+
+func catalogTree() *categoryTree {
+    categoriesMu.RLock()
+    defer categoriesMu.RUnlock()
+    return categoriesCur
+}
+
+// topCategory finds a top-level category by slug or by its old storefront alias
+func (t *categoryTree) topCategory(key string) (store.Category, bool) {
+    key = strings.ToLower(strings.TrimSpace(key))
+    if key == "" { return store.Category{}, false }
+    for _, c := range t.children[0] {
+        if c.Slug == key || (c.Alias != "" && c.Alias == key) { return c, true }
+    }
+    return store.Category{}, false
+}
+
+func (t *categoryTree) subcategory(parent store.Category, slug string) (store.Category, bool) {
+    for _, c := range t.children[parent.ID] {
+        if c.Slug == slug { return c, true }
+    }
+    return store.Category{}, false
+}
+
+// categoryToTypeSlug maps a category slug or alias to the products.type it lists;
+// unknown values are taken as a type slug already
+func categoryToTypeSlug(category string) string {
+    if c, ok := catalogTree().topCategory(category); ok { return c.Slug }
+    return category
+}
+
+// typeLabel is the title of the category of a product type
+func typeLabel(typeSlug string) string {
+    if c, ok := catalogTree().topCategory(typeSlug); ok { return c.Title }
+    return ""
+}
+
+// subSlugToLabel maps (category, subSlug) to the subcategory title, which is also how
+// older rows spell their subtype
+func subSlugToLabel(category, sub string) string {
+    t := catalogTree()
+    parent, ok := t.topCategory(category)
+    if !ok { return "" }
+    if c, ok := t.subcategory(parent, sub); ok { return c.Title }
+    return ""
+}
+
+// categoryNode is a category with its subcategories, as served to the storefront
+type categoryNode struct {
+    store.Category
+    URL      string         `json:"url"`
+    Children []categoryNode `json:"children,omitempty"`
+}
+
+func (t *categoryTree) nodes(parentID int64, prefix string) []categoryNode {
+    out := []categoryNode{}
+    for _, c := range t.children[parentID] {
+        url := prefix + c.Slug + "/"
+        n := categoryNode{Category: c, URL: url}
+        if kids := t.nodes(c.ID, url); len(kids) > 0 { n.Children = kids }
+        out = append(out, n)
+    }
+    return out
+}
+
+// GET /api/catalog/categories returns the category tree
+func handleGetCategories(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    writeJSON(w, catalogTree().nodes(0, "/catalog/"))
+}
+
+// validSlug allows the characters existing slugs use: lower-case Latin, digits, '-' and '_'
+func validSlug(s string) bool {
+    if s == "" { return false }
+    for _, c := range s {
+        if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') { return false }
+    }
+    return true
+}
+
+// validateCategory normalizes c and returns a client-facing error message or "".
+// The tree is two levels deep because products carry only a type and a subtype.
+func validateCategory(c *store.Category) string {
+    c.Slug = strings.ToLower(strings.TrimSpace(c.Slug))
+    c.Title = strings.TrimSpace(c.Title)
+    c.Alias = strings.ToLower(strings.TrimSpace(c.Alias))
+    c.Image = strings.TrimSpace(c.Image)
+    c.SEOTitle = strings.TrimSpace(c.SEOTitle)
+    c.SEODescription = strings.TrimSpace(c.SEODescription)
+    c.MatchCode = normalizeCode(c.MatchCode)
+    c.Keywords = strings.Join(store.Category{Keywords: strings.ToLower(c.Keywords)}.KeywordList(), ",")
+    if !validSlug(c.Slug) { return "slug must be lower-case latin letters, digits, '-' or '_'" }
+    if c.Title == "" { return "title required" }
+    if c.Alias != "" && !validSlug(c.Alias) { return "bad alias" }
+    if c.ParentID != 0 {
+        if c.ParentID == c.ID { return "category cannot be its own parent" }
+        parent, err := st.Categories.Get(c.ParentID)
+        if err != nil { return "unknown parent_id" }
+        if parent.ParentID != 0 { return "parent must be a top-level category" }
+        if c.ID != 0 && len(catalogTree().children[c.ID]) > 0 { return "a category with subcategories cannot be nested" }
+    }
+    return ""
+}
+
+// categoryTypeKeys lists the products.type values that list under c: the slug and alias of its
+// top-level category
+func categoryTypeKeys(c store.Category) []string {
+    if c.ParentID != 0 {
+        for _, top := range catalogTree().children[0] {
+            if top.ID == c.ParentID { c = top; break }
+        }
+    }
+    keys := []string{c.Slug}
+    if c.Alias != "" { keys = append(keys, c.Alias) }
+    return keys
+}
+
+// categoryChanged reloads everything derived from the tree. Product search documents carry the
+// category and subcategory titles, so the products of the types in typeKeys are re-analyzed too,
+// and their unit prices are refreshed: whether a type is sold by the sheet follows its slug.
+func categoryChanged(typeKeys ...string) {
+    if err := loadCategories(); err != nil { log.Printf("reload categories: %v", err) }
+    rebuildSuggestIndex()
+    if len(typeKeys) == 0 { return }
+    affected := map[string]bool{}
+    for _, k := range typeKeys { affected[k] = true }
+    products, err := st.Products.List("")
+    if err != nil { log.Printf("reindex category products: %v", err); return }
+    for _, p := range products {
+        if !affected[normalizeTypeSlug(p.Type)] { continue }
+        reindex(productDoc(p))
+        if v := unitPrice(p); v != p.UnitPrice {
+            if err := st.Products.SetUnitPrice(p.ID, v); err != nil { log.Printf("unit price of product %d: %v", p.ID, err) }
+        }
+    }
+}
+
+// Admin CRUD for categories: GET list, POST create, PATCH {id,...} update, DELETE ?id=
+func adminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        out, err := st.Categories.List()
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, out)
+    case http.MethodPost:
+        var c store.Category
+        if err := json.NewDecoder(r.Body).Decode(&c); err != nil { http.Error(w, "bad json", 400); return }
+        c.ID = 0
+        if msg := validateCategory(&c); msg != "" { http.Error(w, msg, 400); return }
+        err := st.Categories.Create(&c)
+        if err == store.ErrConflict { http.Error(w, "slug already used at this level", 409); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        categoryChanged(categoryTypeKeys(c)...)
+        writeJSON(w, c)
+    case http.MethodPatch:
+        // decode over the stored row so absent fields keep their value
+        body, err := io.ReadAll(r.Body)
+        if err != nil { http.Error(w, err.Error(), 400); return }
+        var probe struct{ ID int64 `json:"id"` }
+        if err := json.Unmarshal(body, &probe); err != nil { http.Error(w, "bad json", 400); return }
+        if probe.ID == 0 { http.Error(w, "id required", 400); return }
+        c, err := st.Categories.Get(probe.ID)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        old, keys := c, categoryTypeKeys(c)
+        if err := json.Unmarshal(body, &c); err != nil { http.Error(w, "bad json", 400); return }
+        c.ID = probe.ID
+        if msg := validateCategory(&c); msg != "" { http.Error(w, msg, 400); return }
+        // products.type and subtype hold the slug, so the products move along with the category
+        err = st.InTx(func(tx *store.Store) error {
+            if err := tx.Categories.Update(c); err != nil { return err }
+            if c.Slug == old.Slug && c.ParentID == old.ParentID { return nil }
+            return tx.Categories.MoveProducts(old, c)
+        })
+        if err == store.ErrConflict { http.Error(w, "slug already used at this level", 409); return }
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        categoryChanged(append(keys, categoryTypeKeys(c)...)...)
+        writeJSON(w, c)
+    case http.MethodDelete:
+        id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if id == 0 { http.Error(w, "id required", 400); return }
+        c, err := st.Categories.Get(id)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        // products listed under the category would drop out of the catalog
+        var inUse int
+        err = st.InTx(func(tx *store.Store) error {
+            n, err := tx.Categories.CountProducts(c)
+            if err != nil { return err }
+            if n > 0 { inUse = n; return nil }
+            return tx.Categories.Delete(id)
+        })
+        if err == nil && inUse > 0 { http.Error(w, fmt.Sprintf("category still lists %d product(s); move them first", inUse), 409); return }
+        if err == store.ErrConflict { http.Error(w, "delete the subcategories first", 409); return }
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        categoryChanged(categoryTypeKeys(c)...)
+        writeJSON(w, map[string]string{"status": "ok"})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "sort"
+
+    "metal-main/back/store"
+)
+
+const cliUsage = `usage:
+  metal                       start the HTTP server (applies pending migrations)
+  metal migrate up            apply pending migrations and exit
+  metal migrate status        list applied and pending migrations
+  metal import-legacy [dir]   copy data from the old per-entity *.db files in dir (default .)
+  metal attributes-backfill   re-parse product attributes from names and sizes (manual values are kept)
+
+The database file is metal.db in the working directory unless METAL_DB is set.`
+
+// runCLI handles maintenance subcommands and returns the process exit code
+func runCLI(args []string) int {
+    switch args[0] {
+    case "migrate":
+        sub := "up"
+        if len(args) > 1 { sub = args[1] }
+        if sub != "up" && sub != "status" {
+            fmt.Fprintln(os.Stderr, cliUsage)
+            return 2
+        }
+        if sub == "status" {
+            // status only reports: it neither creates the file nor applies anything
+            s, err := store.OpenReadOnly(dbPath())
+            if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+            defer s.Close()
+            states, err := s.MigrationStatus()
+            if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+            fmt.Println(dbPath())
+            for _, m := range states {
+                state := "pending"
+                if m.AppliedAt != "" { state = "applied " + m.AppliedAt }
+                fmt.Printf("  %3d  %-50s %s\n", m.Version, m.Name, state)
+            }
+            return 0
+        }
+        if err := openStore(); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+        defer st.Close()
+        return 0
+    case "import-legacy":
+        dir := "."
+        if len(args) > 1 { dir = args[1] }
+        s, err := store.Open(dbPath())
+        if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+        st = s
+        defer st.Close()
+        counts, err := st.ImportLegacy(dir)
+        if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+        if err := migrateStore(); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+        tables := make([]string, 0, len(counts))
+        for t := range counts { tables = append(tables, t) }
+        sort.Strings(tables)
+        for _, t := range tables { fmt.Printf("  %-22s %d rows\n", t, counts[t]) }
+        return 0
+    case "attributes-backfill":
+        if err := openStore(); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+        defer st.Close()
+        if err := loadCategories(); err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+        products, values, err := backfillAttributes()
+        if err != nil { fmt.Fprintln(os.Stderr, err); return 1 }
+        fmt.Printf("  %d attribute values from %d products\n", values, products)
+        return 0
+    default:
+        fmt.Fprintln(os.Stderr, cliUsage)
+        return 2
+    }
+}
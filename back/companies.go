@@ -0,0 +1,120 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "metal-main/back/store"
+)
+
+// Companies are the organisations most buyers order for. An admin keeps their requisites, price
+// group and credit terms and links accounts to them; an order placed from a linked account carries
+// the company's requisites for the invoice. Accounts without a company fall back to the requisites
+// typed into their profile.
+
+// validateCompany normalizes c and returns a client-facing error message or ""
+func validateCompany(c *store.Company) string {
+    for _, f := range []*string{&c.Name, &c.INN, &c.KPP, &c.OGRN, &c.LegalAddress, &c.BankName, &c.BIK, &c.BankAccount, &c.CorrAccount} {
+        *f = strings.TrimSpace(*f)
+    }
+    c.PriceGroup = normalizePriceGroup(c.PriceGroup)
+    if c.Name == "" { return "name required" }
+    if c.INN != "" && (!allDigits(c.INN) || (len(c.INN) != 10 && len(c.INN) != 12)) { return "inn must be 10 or 12 digits" }
+    if c.KPP != "" && (!allDigits(c.KPP) || len(c.KPP) != 9) { return "kpp must be 9 digits" }
+    if c.OGRN != "" && (!allDigits(c.OGRN) || (len(c.OGRN) != 13 && len(c.OGRN) != 15)) { return "ogrn must be 13 or 15 digits" }
+    if c.BIK != "" && (!allDigits(c.BIK) || len(c.BIK) != 9) { return "bik must be 9 digits" }
+    if c.BankAccount != "" && (!allDigits(c.BankAccount) || len(c.BankAccount) != 20) { return "bank_account must be 20 digits" }
+    if c.CorrAccount != "" && (!allDigits(c.CorrAccount) || len(c.CorrAccount) != 20) { return "corr_account must be 20 digits" }
+    if c.CreditLimit < 0 { return "credit_limit must not be negative" }
+    if c.PaymentDays < 0 || c.PaymentDays > 365 { return "payment_days must be between 0 and 365" }
+    return ""
+}
+
+// accountCompany is the company the account belongs to
+func accountCompany(u store.User) (store.Company, bool) {
+    if u.CompanyID == 0 { return store.Company{}, false }
+    c, err := st.Companies.Get(u.CompanyID)
+    return c, err == nil
+}
+
+// accountPriceGroup is the customer group an account buys at: its company's, or its own when the
+// company has none or the account has no company
+func accountPriceGroup(u store.User) string {
+    if c, ok := accountCompany(u); ok && c.PriceGroup != "" { return c.PriceGroup }
+    return normalizePriceGroup(u.PriceGroup)
+}
+
+// setOrderCompany copies the buyer's requisites onto o: the company of the account, else the
+// requisites of its profile
+func setOrderCompany(o *Order, u store.User) {
+    if c, ok := accountCompany(u); ok {
+        o.CompanyID, o.CompanyName, o.CompanyINN, o.CompanyKPP, o.CompanyAddress = c.ID, c.Name, c.INN, c.KPP, c.LegalAddress
+        o.PaymentDays = c.PaymentDays
+        return
+    }
+    o.CompanyName, o.CompanyINN, o.CompanyKPP, o.CompanyAddress = u.CompanyName, u.INN, u.KPP, u.CompanyAddress
+}
+
+// GET/POST/PATCH/DELETE /api/admin/companies manages companies; GET ?id= returns one company with
+// its accounts, PATCH keeps absent fields, DELETE unlinks the accounts
+func adminCompaniesHandler(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        if idStr := r.URL.Query().Get("id"); idStr != "" {
+            id, _ := strconv.ParseInt(idStr, 10, 64)
+            c, err := st.Companies.Get(id)
+            if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+            if err != nil { http.Error(w, err.Error(), 500); return }
+            all, err := st.Users.List()
+            if err != nil { http.Error(w, err.Error(), 500); return }
+            users := []store.User{}
+            for _, u := range all {
+                if u.CompanyID == id { users = append(users, u) }
+            }
+            writeJSON(w, map[string]any{"company": c, "users": users})
+            return
+        }
+        out, err := st.Companies.List()
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, out)
+    case http.MethodPost:
+        var c store.Company
+        if err := json.NewDecoder(r.Body).Decode(&c); err != nil { http.Error(w, "bad json", 400); return }
+        c.ID = 0
+        if msg := validateCompany(&c); msg != "" { http.Error(w, msg, 400); return }
+        err := st.Companies.Create(&c)
+        if err == store.ErrConflict { http.Error(w, "a company with this inn and kpp exists", 409); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, c)
+    case http.MethodPatch:
+        // decode over the stored row so absent fields keep their value
+        body, err := io.ReadAll(r.Body)
+        if err != nil { http.Error(w, err.Error(), 400); return }
+        var probe struct{ ID int64 `json:"id"` }
+        if err := json.Unmarshal(body, &probe); err != nil { http.Error(w, "bad json", 400); return }
+        if probe.ID == 0 { http.Error(w, "id required", 400); return }
+        c, err := st.Companies.Get(probe.ID)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if err := json.Unmarshal(body, &c); err != nil { http.Error(w, "bad json", 400); return }
+        c.ID = probe.ID
+        if msg := validateCompany(&c); msg != "" { http.Error(w, msg, 400); return }
+        err = st.Companies.Update(c)
+        if err == store.ErrConflict { http.Error(w, "a company with this inn and kpp exists", 409); return }
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, c)
+    case http.MethodDelete:
+        id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if id == 0 { http.Error(w, "id required", 400); return }
+        err := st.Companies.Delete(id)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, map[string]string{"status": "ok"})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+
+    "metal-main/back/store"
+)
+
+func TestValidateCompany(t *testing.T) {
+    valid := store.Company{Name: "ООО «Металл»", INN: "7707083893", KPP: "773601001", OGRN: "1027700132195", BIK: "044525225", BankAccount: "40702810938000000001", CorrAccount: "30101810400000000225", PaymentDays: 30}
+    cases := []struct {
+        name string
+        edit func(c *store.Company)
+        want string
+    }{
+        {"valid", func(c *store.Company) {}, ""},
+        {"only a name", func(c *store.Company) { *c = store.Company{Name: "ИП Иванов"} }, ""},
+        {"blank name", func(c *store.Company) { c.Name = "  " }, "name required"},
+        {"inn of a sole trader", func(c *store.Company) { c.INN, c.KPP, c.OGRN = "500100732259", "", "304500116000157" }, ""},
+        {"inn of 11 digits", func(c *store.Company) { c.INN = "77070838931" }, "inn must be 10 or 12 digits"},
+        {"inn with letters", func(c *store.Company) { c.INN = "77070838AB" }, "inn must be 10 or 12 digits"},
+        {"kpp of 8 digits", func(c *store.Company) { c.KPP = "77360100" }, "kpp must be 9 digits"},
+        {"ogrn of 14 digits", func(c *store.Company) { c.OGRN = "10277001321950" }, "ogrn must be 13 or 15 digits"},
+        {"bik with a space", func(c *store.Company) { c.BIK = "0445 25225" }, "bik must be 9 digits"},
+        {"short account", func(c *store.Company) { c.BankAccount = "4070281093800000000" }, "bank_account must be 20 digits"},
+        {"corr account with a dash", func(c *store.Company) { c.CorrAccount = "30101-810400000000225" }, "corr_account must be 20 digits"},
+        {"negative credit", func(c *store.Company) { c.CreditLimit = -1 }, "credit_limit must not be negative"},
+        {"deferral over a year", func(c *store.Company) { c.PaymentDays = 366 }, "payment_days must be between 0 and 365"},
+    }
+    for _, c := range cases {
+        co := valid
+        c.edit(&co)
+        if got := validateCompany(&co); got != c.want { t.Errorf("%s: %q, want %q", c.name, got, c.want) }
+    }
+
+    // requisites pasted with spaces around them are trimmed before the check
+    co := store.Company{Name: " ООО «Металл» ", INN: " 7707083893\t", PriceGroup: " Opt "}
+    if msg := validateCompany(&co); msg != "" || co.Name != "ООО «Металл»" || co.INN != "7707083893" || co.PriceGroup != "opt" { t.Errorf("normalized to %+v, %q", co, msg) }
+}
+
+// a company order is deferred while the unpaid deferred orders stay within the credit limit
+func TestPlaceOrderCreditLimit(t *testing.T) {
+    useTestStore(t)
+    c := store.Company{Name: "ООО «Металл»", CreditLimit: 1000, PaymentDays: 30}
+    if err := st.Companies.Create(&c); err != nil { t.Fatal(err) }
+    cookie := signIn(t, "buyer")
+    u, err := st.Users.GetByLogin("buyer")
+    if err != nil { t.Fatal(err) }
+    u.CompanyID = c.ID
+    if err := st.Users.Update(u); err != nil { t.Fatal(err) }
+    p := ProductRow{Type: "armatura", Name: "Арматура", Size: "12", Price: 100, InStock: true}
+    if err := st.Products.Create(&p); err != nil { t.Fatal(err) }
+
+    order := func(qty float64) Order {
+        t.Helper()
+        r := httptest.NewRequest(http.MethodPost, "/api/orders", nil)
+        r.AddCookie(cookie)
+        o, err := placeOrder(r, checkoutRequest{Name: "Иван", Phone: "+7 999", Items: []checkoutItem{{ItemID: strconv.FormatInt(p.ID, 10), Qty: qty}}})
+        if err != nil { t.Fatal(err) }
+        return o
+    }
+    steps := []struct {
+        name string
+        qty  float64
+        days int
+    }{
+        {"within the limit", 6, 30},
+        {"up to the limit", 4, 30},
+        {"past the limit", 1, 0},
+    }
+    var placed []Order
+    for _, s := range steps {
+        o := order(s.qty)
+        if o.CompanyID != c.ID || o.PaymentDays != s.days { t.Errorf("%s: company %d, deferral %d; want %d, %d", s.name, o.CompanyID, o.PaymentDays, c.ID, s.days) }
+        placed = append(placed, o)
+    }
+
+    // a paid order no longer holds the credit
+    if err := st.Orders.SetStatus(placed[0].ID, statusPaid); err != nil { t.Fatal(err) }
+    if o := order(6); o.PaymentDays != 30 { t.Errorf("after payment: deferral %d, want 30", o.PaymentDays) }
+    // cancelled orders and prepaid ones do not count either
+    if err := st.Orders.SetStatus(placed[1].ID, statusCancelled); err != nil { t.Fatal(err) }
+    if o := order(4); o.PaymentDays != 30 { t.Errorf("after cancelling: deferral %d, want 30", o.PaymentDays) }
+    if used, err := st.Orders.CreditUsed(c.ID, unpaidStatuses); err != nil || used != 1000 { t.Errorf("credit used = %v, %v; want 1000", used, err) }
+
+    // no credit limit means prepayment only
+    c.CreditLimit = 0
+    if err := st.Companies.Update(c); err != nil { t.Fatal(err) }
+    if o := order(1); o.PaymentDays != 0 { t.Errorf("without a limit: deferral %d, want 0", o.PaymentDays) }
+}
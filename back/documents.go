@@ -0,0 +1,490 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "metal-main/back/store"
+)
+
+// Sales documents: an invoice for payment (счёт на оплату) and a commercial offer (КП), issued
+// from an order or, for an offer, from the cart, and rendered to PDF. A document is numbered in
+// sequence within its kind and year when it is first issued and keeps its buyer and lines, so
+// every later download of an order's invoice is the same paper. Prices already include VAT; the
+// rate is VAT_RATE (20 by default, 0 for a seller not subject to VAT). The seller's requisites
+// come from the SELLER_* variables.
+
+var errEmptyCart = errors.New("cart is empty")
+
+// documentTitles name the kinds on the paper and in file names
+var documentTitles = map[string]struct{ title, file string }{
+    store.DocInvoice: {"Счёт на оплату", "schet"},
+    store.DocOffer:   {"Коммерческое предложение", "kp"},
+}
+
+// sellerInfo holds the requisites of the seller printed on documents
+type sellerInfo struct {
+    Name, INN, KPP, OGRN, Address, Phone, Email string
+    Bank, BIK, Account, CorrAccount             string
+    Director, Accountant                        string
+}
+
+func documentSeller() sellerInfo {
+    env := func(k string) string { return strings.TrimSpace(os.Getenv(k)) }
+    return sellerInfo{
+        Name: env("SELLER_NAME"), INN: env("SELLER_INN"), KPP: env("SELLER_KPP"), OGRN: env("SELLER_OGRN"),
+        Address: env("SELLER_ADDRESS"), Phone: env("SELLER_PHONE"), Email: env("SELLER_EMAIL"),
+        Bank: env("SELLER_BANK"), BIK: env("SELLER_BIK"), Account: env("SELLER_ACCOUNT"), CorrAccount: env("SELLER_CORR_ACCOUNT"),
+        Director: env("SELLER_DIRECTOR"), Accountant: env("SELLER_ACCOUNTANT"),
+    }
+}
+
+// documentVATRate is the VAT percent included in prices
+func documentVATRate() float64 {
+    if v, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv("VAT_RATE")), 64); err == nil && v >= 0 && v < 100 { return v }
+    return 20
+}
+
+// offerValidDays is how long a commercial offer holds its prices
+func offerValidDays() int {
+    if v, err := strconv.Atoi(strings.TrimSpace(os.Getenv("OFFER_VALID_DAYS"))); err == nil && v > 0 { return v }
+    return 5
+}
+
+// orderDocument returns the document of kind issued for o, issuing it on first request
+func orderDocument(kind string, o Order, by string) (store.Document, error) {
+    d, err := st.Documents.ForOrder(kind, o.ID)
+    if err != store.ErrNotFound { return d, err }
+    d = store.Document{Kind: kind, OrderID: o.ID, BuyerName: o.CompanyName, BuyerINN: o.CompanyINN, BuyerKPP: o.CompanyKPP,
+        BuyerAddress: o.CompanyAddress, PaymentDays: o.PaymentDays, VATRate: documentVATRate(), Total: o.Total, CreatedBy: by}
+    if d.BuyerName == "" { d.BuyerName = o.CustomerName }
+    for _, l := range o.Lines {
+        d.Lines = append(d.Lines, store.DocumentLine{Title: l.Title, Qty: l.Qty, Unit: l.Unit, WeightKg: l.WeightKg, Price: l.Price, Total: l.Total})
+    }
+    err = st.InTx(func(tx *store.Store) error {
+        // another request may have issued it meanwhile
+        cur, err := tx.Documents.ForOrder(kind, o.ID)
+        if err == nil { d = cur; return nil }
+        if err != store.ErrNotFound { return err }
+        return tx.Documents.Create(&d)
+    })
+    return d, err
+}
+
+// cartOffer issues a commercial offer for the lines of a cart at the customer's current prices.
+// Asking again the same day for an unchanged cart returns the offer already issued instead of a
+// new number.
+func cartOffer(r *http.Request, cartID string, items []checkoutItem) (store.Document, error) {
+    rules, err := currentPriceRules(r)
+    if err != nil { return store.Document{}, err }
+    login := currentUserLogin(r)
+    d := store.Document{Kind: store.DocOffer, CartID: cartID, VATRate: documentVATRate(), CreatedBy: login}
+    if login != "" {
+        if u, err := st.Users.GetByLogin(login); err == nil {
+            var o Order
+            setOrderCompany(&o, u)
+            d.BuyerName, d.BuyerINN, d.BuyerKPP, d.BuyerAddress, d.PaymentDays = o.CompanyName, o.CompanyINN, o.CompanyKPP, o.CompanyAddress, o.PaymentDays
+            if d.BuyerName == "" { d.BuyerName = strings.TrimSpace(u.LastName + " " + u.FirstName) }
+        }
+    }
+    for _, it := range items {
+        // lines that can no longer be bought are left out, as in the cart total
+        pl, err := priceLine(st.Products, rules, it.ItemID, it.Qty, it.Unit)
+        if err != nil { continue }
+        q := pl.Quote
+        d.Lines = append(d.Lines, store.DocumentLine{Title: pl.Title, Qty: q.Qty, Unit: q.Unit, WeightKg: q.WeightKg, Price: q.UnitPrice, Total: q.Total})
+        d.Total += q.Total
+    }
+    if len(d.Lines) == 0 { return d, errEmptyCart }
+    d.Total = roundKop(d.Total)
+
+    if last, err := st.Documents.LastForCart(cartID); err == nil && sameOffer(last, d) {
+        return last, nil
+    } else if err != nil && err != store.ErrNotFound {
+        return d, err
+    }
+    err = st.InTx(func(tx *store.Store) error { return tx.Documents.Create(&d) })
+    return d, err
+}
+
+// sameOffer tells whether the offer issued before would read the same as d today
+func sameOffer(prev, d store.Document) bool {
+    if prev.CreatedAt[:10] != store.Now()[:10] || prev.CreatedBy != d.CreatedBy || prev.BuyerName != d.BuyerName || prev.BuyerINN != d.BuyerINN ||
+        prev.VATRate != d.VATRate || prev.Total != d.Total || len(prev.Lines) != len(d.Lines) {
+        return false
+    }
+    for i := range d.Lines {
+        if prev.Lines[i] != d.Lines[i] { return false }
+    }
+    return true
+}
+
+// documentFileName is the download name of d: schet-15-2026.pdf
+func documentFileName(d store.Document) string {
+    return fmt.Sprintf("%s-%d-%d.pdf", documentTitles[d.Kind].file, d.Number, d.Year)
+}
+
+// writeDocumentPDF renders d and sends it as a download
+func writeDocumentPDF(w http.ResponseWriter, d store.Document) {
+    var buf bytes.Buffer
+    if err := renderDocument(&buf, d, documentSeller()); err != nil { http.Error(w, err.Error(), 500); return }
+    w.Header().Set("Content-Type", "application/pdf")
+    w.Header().Set("Content-Disposition", `attachment; filename="`+documentFileName(d)+`"`)
+    w.Header().Set("Cache-Control", "no-store")
+    w.Write(buf.Bytes())
+}
+
+// documentKind maps the last path segment (invoice.pdf, offer.pdf) to a kind
+func documentKind(action string) (string, bool) {
+    kind := strings.TrimSuffix(action, ".pdf")
+    _, ok := documentTitles[kind]
+    return kind, ok && kind != action
+}
+
+// GET /api/admin/item_orders/{id}/invoice.pdf and /offer.pdf issue the document for an order on
+// first request and download it
+func adminItemOrderDocument(w http.ResponseWriter, r *http.Request) {
+    rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/item_orders/"), "/")
+    idPart, action, _ := strings.Cut(rest, "/")
+    id, err := strconv.ParseInt(idPart, 10, 64)
+    kind, ok := documentKind(action)
+    if err != nil || id <= 0 || !ok { http.NotFound(w, r); return }
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    o, err := st.Orders.Get(id)
+    if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    d, err := orderDocument(kind, o, currentAdminLogin(r))
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    writeDocumentPDF(w, d)
+}
+
+// GET /api/admin/documents[?order_id=] lists issued documents, newest first
+// GET /api/admin/documents/{id}.pdf downloads one
+func adminDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    if rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/documents"), "/"); rest != "" {
+        id, err := strconv.ParseInt(strings.TrimSuffix(rest, ".pdf"), 10, 64)
+        if err != nil || !strings.HasSuffix(rest, ".pdf") { http.NotFound(w, r); return }
+        d, err := st.Documents.Get(id)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeDocumentPDF(w, d)
+        return
+    }
+    orderID, _ := strconv.ParseInt(r.URL.Query().Get("order_id"), 10, 64)
+    out, err := st.Documents.List(orderID)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    writeJSON(w, out)
+}
+
+// myOrderDocument serves /api/my/orders/{id}/invoice.pdf and /offer.pdf to the owner of the order.
+// The invoice is issued once a manager has confirmed the order.
+func myOrderDocument(w http.ResponseWriter, r *http.Request, kind string, o Order, login string) {
+    if o.Status == statusCancelled { http.Error(w, "the order is cancelled", http.StatusConflict); return }
+    if kind == store.DocInvoice && o.Status == statusNew {
+        // the manager may have issued it before confirming
+        d, err := st.Documents.ForOrder(kind, o.ID)
+        if err == store.ErrNotFound { http.Error(w, "the invoice is issued once the order is confirmed", http.StatusConflict); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeDocumentPDF(w, d)
+        return
+    }
+    d, err := orderDocument(kind, o, login)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    writeDocumentPDF(w, d)
+}
+
+// POST /api/cart/offer.pdf {items} downloads a commercial offer for the lines of the cart page,
+// sent like the checkout sends them; without items the cart stored on the server is used
+func cartOfferHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    var in struct{ Items []checkoutItem `json:"items"` }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil && err != io.EOF { http.Error(w, "bad json", 400); return }
+    cartID := resolveCartID(w, r)
+    if len(in.Items) == 0 {
+        stored, err := st.Cart.Items(cartID)
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        for _, it := range stored { in.Items = append(in.Items, checkoutItem{ItemID: it.ID, Qty: it.Qty, Unit: it.Unit}) }
+    }
+    d, err := cartOffer(r, cartID, in.Items)
+    if err == errEmptyCart { http.Error(w, err.Error(), 400); return }
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    writeDocumentPDF(w, d)
+}
+
+// Layout of the documents on A4, in points
+const (
+    docLeft   = 40.0
+    docRight  = 555.0
+    docBottom = 800.0
+)
+
+// Fonts of a document by their index in newPDF
+const (
+    fontRegular = 0
+    fontBold    = 1
+)
+
+// docColumn is a column of the line table
+type docColumn struct {
+    title string
+    width float64
+    right bool // numbers are aligned to the right
+}
+
+// docLayout places the blocks of a document one under another, starting a page when one is full
+type docLayout struct {
+    *pdfDoc
+    y float64
+}
+
+// room starts a new page when h more points do not fit on this one and tells whether it did
+func (l *docLayout) room(h float64) bool {
+    if l.y+h <= docBottom { return false }
+    l.addPage()
+    l.y = 40
+    return true
+}
+
+// field prints "label value" with the value wrapped in the rest of the width
+func (l *docLayout) field(label, value string, bold bool) {
+    const indent = 90.0
+    font := fontRegular
+    if bold { font = fontBold }
+    lines := l.wrap(font, 9, docRight-docLeft-indent, value)
+    l.room(float64(len(lines)) * 12)
+    l.text(docLeft, l.y, fontRegular, 9, label)
+    for _, s := range lines {
+        l.text(docLeft+indent, l.y, font, 9, s)
+        l.y += 12
+    }
+    l.y += 3
+}
+
+// paragraph prints wrapped text across the page
+func (l *docLayout) paragraph(font int, size float64, s string) {
+    for _, line := range l.wrap(font, size, docRight-docLeft, s) {
+        l.room(size + 3)
+        l.text(docLeft, l.y, font, size, line)
+        l.y += size + 3
+    }
+}
+
+// table prints the header and rows, repeating the header on every page it spans
+func (l *docLayout) table(cols []docColumn, rows [][]string) {
+    const size, lead, pad = 8.5, 11.0, 3.0
+    header := func() {
+        h := lead + 2*pad
+        x := docLeft
+        for _, c := range cols {
+            l.rect(x, l.y, c.width, h, 0.6)
+            l.text(x+(c.width-l.textWidth(fontBold, size, c.title))/2, l.y+pad+size, fontBold, size, c.title)
+            x += c.width
+        }
+        l.y += h
+    }
+    l.room(3 * (lead + 2*pad))
+    header()
+    for _, row := range rows {
+        cells := make([][]string, len(cols))
+        n := 1
+        for i, c := range cols {
+            cells[i] = l.wrap(fontRegular, size, c.width-2*pad, row[i])
+            n = max(n, len(cells[i]))
+        }
+        h := float64(n)*lead + 2*pad
+        if l.room(h) { header() }
+        x := docLeft
+        for i, c := range cols {
+            l.rect(x, l.y, c.width, h, 0.6)
+            for j, s := range cells[i] {
+                y := l.y + pad + size + float64(j)*lead
+                if c.right {
+                    l.textRight(x+c.width-pad, y, fontRegular, size, s)
+                } else {
+                    l.text(x+pad, y, fontRegular, size, s)
+                }
+            }
+            x += c.width
+        }
+        l.y += h
+    }
+}
+
+// totals prints label and value pairs aligned to the right edge
+func (l *docLayout) totals(pairs [][2]string) {
+    l.y += 6
+    for _, p := range pairs {
+        l.room(13)
+        l.y += 10
+        l.textRight(docRight-85, l.y, fontBold, 9, p[0])
+        l.textRight(docRight, l.y, fontBold, 9, p[1])
+        l.y += 3
+    }
+    l.y += 10
+}
+
+// signature prints "role ________ name"
+func (l *docLayout) signature(x float64, role, name string) {
+    l.text(x, l.y, fontBold, 9, role)
+    w := l.textWidth(fontBold, 9, role) + 6
+    l.line(x+w, l.y+2, x+w+90, l.y+2, 0.6)
+    l.text(x+w+96, l.y, fontRegular, 9, name)
+}
+
+// requisites joins the non-empty parts of a party description
+func requisites(parts ...string) string {
+    var out []string
+    for _, p := range parts {
+        if p = strings.TrimSpace(p); p != "" { out = append(out, p) }
+    }
+    return strings.Join(out, ", ")
+}
+
+// labelled returns "label value", or "" when value is empty
+func labelled(label, value string) string {
+    if value == "" { return "" }
+    return label + " " + value
+}
+
+// renderDocument draws d as a PDF
+func renderDocument(w io.Writer, d store.Document, seller sellerInfo) error {
+    regular, err := documentFont(false)
+    if err != nil { return err }
+    bold, err := documentFont(true)
+    if err != nil { return err }
+    created, err := time.Parse(store.TimeLayout, d.CreatedAt)
+    if err != nil { return err }
+    title := fmt.Sprintf("%s № %d от %s", documentTitles[d.Kind].title, d.Number, ruDate(created))
+    l := &docLayout{pdfDoc: newPDF(title, regular, bold), y: 40}
+
+    if d.Kind == store.DocInvoice {
+        l.bankBox(seller)
+    } else {
+        l.text(docLeft, l.y+12, fontBold, 12, seller.Name)
+        l.y += 26
+        l.paragraph(fontRegular, 8.5, requisites(labelled("ИНН", seller.INN), labelled("КПП", seller.KPP), labelled("ОГРН", seller.OGRN), seller.Address,
+            labelled("тел.", seller.Phone), seller.Email))
+        l.line(docLeft, l.y, docRight, l.y, 0.6)
+        l.y += 14
+    }
+    l.y += 16
+    for _, s := range l.wrap(fontBold, 14, docRight-docLeft, title) {
+        l.text(docLeft, l.y, fontBold, 14, s)
+        l.y += 18
+    }
+    l.line(docLeft, l.y-8, docRight, l.y-8, 1.5)
+    l.y += 8
+
+    buyer := requisites(d.BuyerName, labelled("ИНН", d.BuyerINN), labelled("КПП", d.BuyerKPP), d.BuyerAddress)
+    if d.Kind == store.DocInvoice {
+        l.field("Поставщик:", requisites(seller.Name, labelled("ИНН", seller.INN), labelled("КПП", seller.KPP), seller.Address, labelled("тел.", seller.Phone)), true)
+        l.field("Покупатель:", buyer, true)
+        if d.OrderID != 0 { l.field("Основание:", fmt.Sprintf("Заказ № %d", d.OrderID), false) }
+    } else {
+        if buyer != "" { l.field("Кому:", buyer, true) }
+        l.paragraph(fontRegular, 9, "Предлагаем к поставке следующую металлопродукцию:")
+    }
+    l.y += 4
+
+    cols := []docColumn{{"№", 22, true}, {"Товары (работы, услуги)", 248, false}, {"Кол-во", 60, true}, {"Ед.", 30, false}, {"Цена", 75, true}, {"Сумма", 80, true}}
+    if d.Kind == store.DocOffer {
+        cols = []docColumn{{"№", 22, true}, {"Наименование", 203, false}, {"Кол-во", 55, true}, {"Ед.", 30, false}, {"Вес, кг", 50, true}, {"Цена", 75, true}, {"Сумма", 80, true}}
+    }
+    var rows [][]string
+    var weight float64
+    for i, ln := range d.Lines {
+        unit, ok := unitLabels[ln.Unit]
+        if !ok { unit = unitLabels[unitPiece] }
+        row := []string{strconv.Itoa(i + 1), ln.Title, formatDecimalRu(ln.Qty), unit, formatRub(ln.Price), formatRub(ln.Total)}
+        if d.Kind == store.DocOffer {
+            w := ""
+            if ln.WeightKg > 0 { w = formatDecimalRu(round3(ln.WeightKg)) }
+            row = append(row[:4], w, row[4], row[5])
+        }
+        weight += ln.WeightKg
+        rows = append(rows, row)
+    }
+    l.table(cols, rows)
+
+    vat := [2]string{"Без налога (НДС):", "—"}
+    if d.VATRate > 0 {
+        vat = [2]string{fmt.Sprintf("В том числе НДС (%s%%):", formatDecimalRu(d.VATRate)), formatRub(math.Round(d.Total*d.VATRate/(100+d.VATRate)*100) / 100)}
+    }
+    due := "Всего к оплате:"
+    if d.Kind == store.DocOffer { due = "Всего:" }
+    l.totals([][2]string{{"Итого:", formatRub(d.Total)}, vat, {due, formatRub(d.Total)}})
+
+    l.paragraph(fontRegular, 9, fmt.Sprintf("Всего наименований %d, на сумму %s руб.", len(d.Lines), formatRub(d.Total)))
+    l.paragraph(fontBold, 9, rublesInWords(d.Total))
+    if d.Kind == store.DocOffer && weight > 0 { l.paragraph(fontRegular, 9, "Общий вес: "+formatDecimalRu(round3(weight/1000))+" т") }
+    l.y += 8
+
+    var terms []string
+    if d.Kind == store.DocInvoice {
+        terms = append(terms, "Оплата данного счёта означает согласие с условиями поставки товара.")
+        if d.PaymentDays > 0 {
+            terms = append(terms, fmt.Sprintf("Оплата в течение %d календарных дней с даты отгрузки.", d.PaymentDays))
+        } else {
+            terms = append(terms, "Счёт действителен к оплате в течение 5 банковских дней. Товар отгружается после поступления денег на расчётный счёт поставщика.")
+        }
+    } else {
+        if d.VATRate > 0 {
+            terms = append(terms, "Цены указаны в рублях с учётом НДС "+formatDecimalRu(d.VATRate)+"%.")
+        } else {
+            terms = append(terms, "Цены указаны в рублях, НДС не облагается.")
+        }
+        terms = append(terms, "Предложение действительно до "+created.AddDate(0, 0, offerValidDays()).Format("02.01.2006")+".")
+        if d.PaymentDays > 0 { terms = append(terms, fmt.Sprintf("Отсрочка платежа: %d календарных дней.", d.PaymentDays)) }
+        terms = append(terms, "Наличие и сроки поставки уточняйте у менеджера.")
+    }
+    for _, t := range terms { l.paragraph(fontRegular, 8.5, t) }
+    l.y += 6
+    l.line(docLeft, l.y, docRight, l.y, 1.5)
+    l.y += 28
+    l.room(30)
+    l.signature(docLeft, "Руководитель", seller.Director)
+    if d.Kind == store.DocInvoice { l.signature(300, "Бухгалтер", seller.Accountant) }
+
+    return l.write(w)
+}
+
+// bankBox draws the payment requisites of the seller above an invoice, as on the usual form
+func (l *docLayout) bankBox(s sellerInfo) {
+    const size = 9.0
+    x0, x1, x2, x3 := docLeft, 330.0, 380.0, docRight
+    y := l.y
+    l.rect(x0, y, x3-x0, 80, 0.6)
+    l.line(x1, y, x1, y+80, 0.6)
+    l.line(x2, y, x2, y+80, 0.6)
+    l.line(x1, y+17, x2, y+17, 0.6)
+    l.line(x0, y+36, x3, y+36, 0.6)
+    l.line(x0, y+52, x1, y+52, 0.6)
+    l.line(185, y+36, 185, y+52, 0.6)
+
+    bank := l.wrap(fontRegular, size, x1-x0-8, s.Bank)
+    for i, ln := range bank[:min(len(bank), 2)] { l.text(x0+4, y+12+float64(i)*11, fontRegular, size, ln) }
+    l.text(x0+4, y+33, fontRegular, 7, "Банк получателя")
+    l.text(x1+4, y+12, fontRegular, size, "БИК")
+    l.text(x2+4, y+12, fontRegular, size, s.BIK)
+    l.text(x1+4, y+29, fontRegular, size, "Сч. №")
+    l.text(x2+4, y+29, fontRegular, size, s.CorrAccount)
+
+    l.text(x0+4, y+47, fontRegular, size, "ИНН "+s.INN)
+    l.text(189, y+47, fontRegular, size, "КПП "+s.KPP)
+    l.text(x1+4, y+47, fontRegular, size, "Сч. №")
+    l.text(x2+4, y+47, fontRegular, size, s.Account)
+    name := l.wrap(fontRegular, size, x1-x0-8, s.Name)
+    l.text(x0+4, y+64, fontRegular, size, name[0])
+    l.text(x0+4, y+77, fontRegular, 7, "Получатель")
+    l.y += 80
+}
@@ -11,12 +11,15 @@ import (
     "time"
 )
 
-func writeJSON(w http.ResponseWriter, v any) {
+func writeJSON(w http.ResponseWriter, v any) { writeJSONStatus(w, http.StatusOK, v) }
+
+func writeJSONStatus(w http.ResponseWriter, status int, v any) {
     w.Header().Set("Content-Type", "application/json; charset=utf-8")
     // Prevent caching of API responses so clients always see fresh data
     w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, max-age=0")
     w.Header().Set("Pragma", "no-cache")
     w.Header().Set("Expires", "0")
+    w.WriteHeader(status)
     enc := json.NewEncoder(w)
     enc.SetIndent("", "  ")
     _ = enc.Encode(v)
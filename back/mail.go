@@ -0,0 +1,77 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "mime"
+    "net/smtp"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Mailer sends a plain-text email
+type Mailer interface {
+    Send(to, subject, body string) error
+}
+
+// smtpMailer delivers through an SMTP relay; net/smtp upgrades to STARTTLS when the server offers it
+type smtpMailer struct {
+    addr, host string
+    user, pass string
+    from       string
+}
+
+// mailerFromEnv builds the SMTP mailer from SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASSWORD and SMTP_FROM.
+// Without SMTP_HOST, MAIL_LOG_FILE selects a logMailer writing to that file; with neither it returns nil.
+func mailerFromEnv() Mailer {
+    host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+    if host == "" {
+        if p := strings.TrimSpace(os.Getenv("MAIL_LOG_FILE")); p != "" { return &logMailer{path: p} }
+        return nil
+    }
+    port := strings.TrimSpace(os.Getenv("SMTP_PORT"))
+    if port == "" { port = "587" }
+    m := &smtpMailer{
+        addr: host + ":" + port,
+        host: host,
+        user: os.Getenv("SMTP_USER"),
+        pass: os.Getenv("SMTP_PASSWORD"),
+        from: strings.TrimSpace(os.Getenv("SMTP_FROM")),
+    }
+    if m.from == "" { m.from = m.user }
+    return m
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+    var auth smtp.Auth
+    if m.user != "" { auth = smtp.PlainAuth("", m.user, m.pass, m.host) }
+    var b strings.Builder
+    fmt.Fprintf(&b, "From: %s\r\n", m.from)
+    fmt.Fprintf(&b, "To: %s\r\n", to)
+    fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+    fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+    b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+    b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+    return smtp.SendMail(m.addr, auth, m.from, []string{to}, []byte(b.String()))
+}
+
+// logMailer appends messages to a file, or to the server log when path is empty.
+// It stands in for SMTP in development and tests.
+type logMailer struct {
+    path string
+    mu   sync.Mutex
+}
+
+func (m *logMailer) Send(to, subject, body string) error {
+    msg := fmt.Sprintf("To: %s\nSubject: %s\nDate: %s\n\n%s\n\n", to, subject, time.Now().Format(time.RFC3339), body)
+    if m.path == "" { log.Printf("mail (not sent):\n%s", msg); return nil }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    f, err := os.OpenFile(m.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+    if err != nil { return err }
+    _, err = f.WriteString(msg)
+    if cerr := f.Close(); err == nil { err = cerr }
+    return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestMailerFromEnv(t *testing.T) {
+    cases := []struct {
+        name               string
+        host, port, user   string
+        from, logFile      string
+        wantAddr, wantFrom string
+        wantLog            bool
+        wantNil            bool
+    }{
+        {name: "nothing configured", wantNil: true},
+        {name: "log file", logFile: "mail.log", wantLog: true},
+        {name: "smtp wins over the log file", host: "smtp.example.ru", user: "shop@example.ru", logFile: "mail.log", wantAddr: "smtp.example.ru:587", wantFrom: "shop@example.ru"},
+        {name: "explicit port and sender", host: "smtp.example.ru", port: "465", user: "u", from: "Металл <info@example.ru>", wantAddr: "smtp.example.ru:465", wantFrom: "Металл <info@example.ru>"},
+    }
+    for _, c := range cases {
+        t.Run(c.name, func(t *testing.T) {
+            t.Setenv("SMTP_HOST", c.host)
+            t.Setenv("SMTP_PORT", c.port)
+            t.Setenv("SMTP_USER", c.user)
+            t.Setenv("SMTP_PASSWORD", "")
+            t.Setenv("SMTP_FROM", c.from)
+            t.Setenv("MAIL_LOG_FILE", c.logFile)
+            m := mailerFromEnv()
+            switch mm := m.(type) {
+            case nil:
+                if !c.wantNil { t.Fatal("got no mailer") }
+            case *logMailer:
+                if !c.wantLog { t.Fatalf("got a log mailer") }
+                if mm.path != c.logFile { t.Errorf("path = %q, want %q", mm.path, c.logFile) }
+            case *smtpMailer:
+                if c.wantNil || c.wantLog { t.Fatalf("got an SMTP mailer") }
+                if mm.addr != c.wantAddr || mm.from != c.wantFrom { t.Errorf("addr, from = %q, %q, want %q, %q", mm.addr, mm.from, c.wantAddr, c.wantFrom) }
+            default:
+                t.Fatalf("unexpected mailer %T", m)
+            }
+        })
+    }
+}
+
+func TestLogMailerAppends(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mail.log")
+    m := &logMailer{path: path}
+    if err := m.Send("a@example.ru", "Первое", "текст 1"); err != nil { t.Fatal(err) }
+    if err := m.Send("b@example.ru", "Второе", "текст 2"); err != nil { t.Fatal(err) }
+    data, err := os.ReadFile(path)
+    if err != nil { t.Fatal(err) }
+    s := string(data)
+    for _, want := range []string{"To: a@example.ru\nSubject: Первое\n", "текст 1", "To: b@example.ru\nSubject: Второе\n", "текст 2"} {
+        if !strings.Contains(s, want) { t.Errorf("log lacks %q:\n%s", want, s) }
+    }
+    if strings.Index(s, "Первое") > strings.Index(s, "Второе") { t.Error("messages are out of order") }
+}
+
+func TestEmailNotifier(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mail.log")
+    n := emailNotifier{mailer: &logMailer{path: path}}
+    // no address, nothing to send
+    if err := n.NotifyStatus(statusEvent{OrderID: 7, To: "confirmed", Phone: "+7 999"}); err != nil { t.Fatal(err) }
+    if _, err := os.Stat(path); !os.IsNotExist(err) { t.Fatal("mail written for an order without email") }
+
+    ev := statusEvent{OrderID: 7, Name: "Иван", Email: "ivan@example.ru", From: "new", To: "confirmed", Total: 1250.5}
+    if err := n.NotifyStatus(ev); err != nil { t.Fatal(err) }
+    data, err := os.ReadFile(path)
+    if err != nil { t.Fatal(err) }
+    s := string(data)
+    for _, want := range []string{"To: ivan@example.ru", "Subject: Заказ №7: " + statusLabel("confirmed"), "Здравствуйте, Иван!", "Сумма: 1250.50 ₽"} {
+        if !strings.Contains(s, want) { t.Errorf("mail lacks %q:\n%s", want, s) }
+    }
+}
@@ -2,7 +2,6 @@ package main
 
 import (
     "crypto/rand"
-    "database/sql"
     "encoding/json"
     "fmt"
     "io"
@@ -11,19 +10,14 @@ import (
     "net/url"
     "os"
     "path/filepath"
-    "sort"
     "strconv"
     "strings"
     "time"
 
-    _ "modernc.org/sqlite"
     "golang.org/x/crypto/bcrypt"
-)
 
-type Category struct {
-    ID   string `json:"id"`
-    Name string `json:"name"`
-}
+    "metal-main/back/store"
+)
 
 type Product struct {
     ID          string `json:"id"`
@@ -33,17 +27,6 @@ type Product struct {
     Description string `json:"description"`
 }
 
-var categories = []Category{
-    {ID: "rebar", Name: "Арматура"},
-    {ID: "profile-pipe", Name: "Труба профильная"},
-    {ID: "sheet", Name: "Листовой прокат"},
-    {ID: "angle", Name: "Уголок"},
-    {ID: "channel", Name: "Швеллер"},
-    {ID: "beam", Name: "Балка двутавровая"},
-    {ID: "round-pipe", Name: "Труба круглая"},
-    {ID: "profnastil", Name: "Профнастил"},
-}
-
 var products = []Product{
     {ID: "arm-a500c", Title: "Арматура А500С", Image: "/img/iron1.jpg", CategoryID: "rebar"},
     {ID: "pipe-40x20", Title: "Труба профильная 40x20", Image: "/img/iron2.jpg", CategoryID: "profile-pipe"},
@@ -74,195 +57,80 @@ const defaultTelegramBotToken = "7724103152:AAG09wYrm5VpYxlQdN8hqT6npgGVDE3-z_E"
 const defaultTelegramChatID = "7257756560"
 const telegramChatIDCacheFile = "telegram_chat_id.txt"
 
-// DB and models
-var db *sql.DB
-var userDB *sql.DB
-var newsDB *sql.DB
-var articlesDB *sql.DB
-var productsDB *sql.DB
-var cartDB *sql.DB
-var itemOrdersDB *sql.DB
+// DB and models: every entity lives in one SQLite file behind the store repositories
+var st *store.Store
 
-func initDB() error {
-    var err error
-    db, err = sql.Open("sqlite", "file:orders.db?_pragma=journal_mode(WAL)")
-    if err != nil {
-        return err
-    }
-    _, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS orders (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            service TEXT NOT NULL,
-            name TEXT NOT NULL,
-            phone TEXT NOT NULL,
-            email TEXT,
-            status TEXT NOT NULL DEFAULT 'active',
-            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-        );
-    `)
-    if err != nil { return err }
+// dbPath is the consolidated database file; METAL_DB overrides it
+func dbPath() string {
+    if p := strings.TrimSpace(os.Getenv("METAL_DB")); p != "" { return p }
+    return "metal.db"
+}
 
-    // news database
-    newsDB, err = sql.Open("sqlite", "file:news.db?_pragma=journal_mode(WAL)")
-    if err != nil { return err }
-    _, err = newsDB.Exec(`
-        CREATE TABLE IF NOT EXISTS news (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            title TEXT NOT NULL,
-            short_text TEXT NOT NULL,
-            full_text TEXT NOT NULL,
-            published_at TEXT NOT NULL DEFAULT (date('now'))
-        );
-        CREATE INDEX IF NOT EXISTS idx_news_published_at ON news(published_at DESC);
-    `)
+// openStore opens the database and applies pending migrations
+func openStore() error {
+    s, err := store.Open(dbPath())
     if err != nil { return err }
-    // try to add image_url column for older DBs (ignore error if exists)
-    _, _ = newsDB.Exec("ALTER TABLE news ADD COLUMN image_url TEXT")
+    st = s
+    return migrateStore()
+}
 
-    // articles database
-    articlesDB, err = sql.Open("sqlite", "file:articles.db?_pragma=journal_mode(WAL)")
+func migrateStore() error {
+    n, err := st.Migrate()
     if err != nil { return err }
-    _, err = articlesDB.Exec(`
-        CREATE TABLE IF NOT EXISTS articles (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            title TEXT NOT NULL,
-            short_text TEXT NOT NULL,
-            full_text TEXT NOT NULL,
-            published_at TEXT NOT NULL
-        );
-        CREATE INDEX IF NOT EXISTS idx_articles_published_at ON articles(published_at DESC);
-    `)
+    if n > 0 { log.Printf("Applied %d migration(s) to %s", n, dbPath()) }
+    return nil
+}
+
+func initDB() error {
+    _, statErr := os.Stat(dbPath())
+    fresh := os.IsNotExist(statErr)
+    s, err := store.Open(dbPath())
     if err != nil { return err }
+    st = s
+
+    // first start after consolidation: pull data over from the old per-entity files
+    legacyDir := filepath.Dir(dbPath())
+    if fresh && store.HasLegacyFiles(legacyDir) {
+        counts, err := st.ImportLegacy(legacyDir)
+        if err != nil { return fmt.Errorf("import legacy databases: %w", err) }
+        log.Printf("Imported legacy databases from %s: %v", legacyDir, counts)
+    }
+    if err := migrateStore(); err != nil { return err }
+    // catalog slugs resolve through the category tree, including the product seed below
+    if err := loadCategories(); err != nil { return err }
+
     // seed default articles if table is empty
-    var ac int
-    _ = articlesDB.QueryRow("SELECT COUNT(1) FROM articles").Scan(&ac)
-    if ac == 0 {
+    if arts, _ := st.Content.ListArticles(""); len(arts) == 0 {
         if err := seedDefaultArticles(); err != nil { return err }
     }
 
-    // users database
-    userDB, err = sql.Open("sqlite", "file:users.db?_pragma=journal_mode(WAL)")
-    if err != nil { return err }
-    _, err = userDB.Exec(`
-        CREATE TABLE IF NOT EXISTS users (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            login TEXT NOT NULL UNIQUE,
-            password_hash TEXT NOT NULL,
-            email TEXT,
-            phone TEXT,
-            is_admin INTEGER NOT NULL DEFAULT 0
-        );
-        CREATE TABLE IF NOT EXISTS social_links (
-            id INTEGER PRIMARY KEY CHECK (id=1),
-            telegram_link TEXT,
-            vk_link TEXT,
-            wp_link TEXT
-        );
-        INSERT OR IGNORE INTO social_links(id, telegram_link, vk_link, wp_link) VALUES(1, '', '', '');
-    `)
-    if err != nil { return err }
     // seed admin if not exists
-    var c int
-    _ = userDB.QueryRow("SELECT COUNT(1) FROM users WHERE login='admin'").Scan(&c)
-    if c == 0 {
+    if _, err := st.Users.GetByLogin("admin"); err == store.ErrNotFound {
         hash, _ := bcrypt.GenerateFromPassword([]byte("admin"), bcrypt.DefaultCost)
-        _, _ = userDB.Exec("INSERT INTO users (login, password_hash, email, phone, is_admin) VALUES (?,?,?,?,1)",
-            "admin", string(hash), "admin@example.com", "+70000000000")
+        _ = st.Users.Create(&store.User{Login: "admin", PasswordHash: string(hash), Email: "admin@example.com", Phone: "+70000000000", IsAdmin: true})
         log.Printf("Seeded default admin user: admin/admin")
     }
 
-    // products database
-    productsDB, err = sql.Open("sqlite", "file:products.db?_pragma=journal_mode(WAL)")
-    if err != nil { return err }
-    _, err = productsDB.Exec(`
-        CREATE TABLE IF NOT EXISTS products (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            type TEXT NOT NULL,
-            name TEXT NOT NULL,
-            size TEXT,
-            subtype TEXT,
-            img TEXT,
-            price REAL NOT NULL DEFAULT 0,
-            price_per_ton REAL,
-            thickness_mm REAL,
-            weight_kg REAL,
-            length_m REAL,
-            in_stock INTEGER NOT NULL DEFAULT 1,
-            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-            featured INTEGER NOT NULL DEFAULT 0
-        );
-        CREATE INDEX IF NOT EXISTS idx_products_type ON products(type);
-        CREATE INDEX IF NOT EXISTS idx_products_price ON products(price);
-        CREATE INDEX IF NOT EXISTS idx_products_created ON products(created_at DESC);
-    `)
-    if err != nil { return err }
-    // Try to add new columns for older DBs; ignore errors if they exist
-    _, _ = productsDB.Exec("ALTER TABLE products ADD COLUMN in_stock INTEGER NOT NULL DEFAULT 1")
-    _, _ = productsDB.Exec("ALTER TABLE products ADD COLUMN subtype TEXT")
-    _, _ = productsDB.Exec("ALTER TABLE products ADD COLUMN price_per_ton REAL")
-    _, _ = productsDB.Exec("ALTER TABLE products ADD COLUMN thickness_mm REAL")
-    _, _ = productsDB.Exec("ALTER TABLE products ADD COLUMN weight_kg REAL")
-    _, _ = productsDB.Exec("ALTER TABLE products ADD COLUMN length_m REAL")
-    _, _ = productsDB.Exec("ALTER TABLE products ADD COLUMN featured INTEGER NOT NULL DEFAULT 0")
-    // ensure subtype index exists after potential migration
-    _, _ = productsDB.Exec("CREATE INDEX IF NOT EXISTS idx_products_subtype ON products(subtype)")
-    // ensure featured index exists (after column may be added above)
-    _, _ = productsDB.Exec("CREATE INDEX IF NOT EXISTS idx_products_featured ON products(featured)")
-    // descriptions table
-    _, _ = productsDB.Exec(`CREATE TABLE IF NOT EXISTS product_descriptions (type TEXT PRIMARY KEY, description TEXT)`)
-
     // Seed initial sample products from in-memory list if table is empty
-    var pcnt int
-    _ = productsDB.QueryRow("SELECT COUNT(1) FROM products").Scan(&pcnt)
-    if pcnt == 0 {
+    if pcnt, _ := st.Products.Count(); pcnt == 0 {
         for _, p := range products {
-            tp := categoryToTypeSlug(p.CategoryID)
-            name := p.Title
-            size := p.Description
-            img := p.Image
-            _, _ = productsDB.Exec("INSERT INTO products(type, name, size, img, price, in_stock) VALUES(?,?,?,?,?,1)", tp, name, size, img, 0)
+            _ = st.Products.Create(&ProductRow{Type: categoryToTypeSlug(p.CategoryID), Name: p.Title, Size: p.Description, Img: p.Image, InStock: true})
         }
-        log.Printf("Seeded %d sample products into products.db", len(products))
+        log.Printf("Seeded %d sample products", len(products))
+    }
+    // catalog filters read the stored unit price; bring it in line with the current rule
+    if n, err := refreshUnitPrices(); err != nil {
+        return fmt.Errorf("refresh unit prices: %w", err)
+    } else if n > 0 {
+        log.Printf("Updated the unit price of %d products", n)
     }
 
-    // cart database
-    cartDB, err = sql.Open("sqlite", "file:cart.db?_pragma=journal_mode(WAL)")
-    if err != nil { return err }
-    _, err = cartDB.Exec(`
-        CREATE TABLE IF NOT EXISTS cart_items (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            cart_id TEXT NOT NULL,
-            item_id TEXT NOT NULL,
-            title TEXT,
-            price REAL NOT NULL DEFAULT 0,
-            image TEXT,
-            qty INTEGER NOT NULL DEFAULT 1,
-            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-        );
-        CREATE INDEX IF NOT EXISTS idx_cart_items_cart ON cart_items(cart_id);
-        CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_unique ON cart_items(cart_id, item_id);
-    `)
-    if err != nil { return err }
-    // item orders database
-    // item orders stored in orders-item.db to match requirement
-    itemOrdersDB, err = sql.Open("sqlite", "file:orders-item.db?_pragma=journal_mode(WAL)")
-    if err != nil { return err }
-    _, err = itemOrdersDB.Exec(`
-        CREATE TABLE IF NOT EXISTS item_orders (
-            id INTEGER PRIMARY KEY AUTOINCREMENT,
-            item_id TEXT,
-            title TEXT,
-            qty INTEGER NOT NULL DEFAULT 1,
-            price REAL NOT NULL DEFAULT 0,
-            total REAL NOT NULL DEFAULT 0,
-            phone TEXT,
-            user_login TEXT,
-            status TEXT NOT NULL DEFAULT 'Ожидает подтверждения',
-            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-        );
-        CREATE INDEX IF NOT EXISTS idx_item_orders_created ON item_orders(created_at DESC);
-    `)
-    if err != nil { return err }
+    // products that predate the attributes table get theirs parsed from name and size once
+    if n, err := st.Attributes.CountValues(); err == nil && n == 0 {
+        pn, vn, err := backfillAttributes()
+        if err != nil { return fmt.Errorf("backfill attributes: %w", err) }
+        log.Printf("Parsed %d attribute values from %d products", vn, pn)
+    }
     return nil
 }
 
@@ -291,9 +159,20 @@ func resolveDir(name string) string {
 }
 
 func main() {
+    if len(os.Args) > 1 {
+        os.Exit(runCLI(os.Args[1:]))
+    }
     if err := initDB(); err != nil {
         log.Fatalf("DB init error: %v", err)
     }
+    if err := rebuildSearchIndex(); err != nil { log.Printf("search index rebuild error: %v", err) }
+    rebuildSuggestIndex()
+    mailer := mailerFromEnv()
+    orderNotifier = newOrderNotifier(mailer)
+    if mailer == nil { log.Printf("SMTP is not configured: order status changes reach the staff Telegram chat only, customers are not notified") }
+    passwordMailer = mailer
+    if passwordMailer == nil { passwordMailer = &logMailer{} }
+    startPriceFeed()
     mux := http.NewServeMux()
 
     // API endpoints
@@ -303,34 +182,39 @@ func main() {
     // API endpoints
     mux.HandleFunc("/api/catalog/categories", withCORS(handleGetCategories))
     mux.HandleFunc("/api/catalog/products", withCORS(handleGetProducts))
+    mux.HandleFunc("/api/catalog/products/", withCORS(handleGetProduct))
+    mux.HandleFunc("/api/catalog/quote", withCORS(handleQuote))
     mux.HandleFunc("/api/search", withCORS(handleSearch))
+    mux.HandleFunc("/api/search/suggest", withCORS(handleSearchSuggest))
     mux.HandleFunc("/api/gost", withCORS(handleGostList))
     mux.HandleFunc("/api/news", withCORS(handleNewsList))
     mux.HandleFunc("/api/social", withCORS(handleSocialPublic))
     // Public auth
-    mux.HandleFunc("/api/register", withCORS(publicRegister))
-    mux.HandleFunc("/api/login", withCORS(publicLogin))
+    mux.HandleFunc("/api/register", withCORS(rateLimited(registerRate, publicRegister)))
+    mux.HandleFunc("/api/login", withCORS(rateLimited(loginRate, publicLogin)))
     mux.HandleFunc("/api/me", withCORS(func(w http.ResponseWriter, r *http.Request) {
         if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
-        c, err := r.Cookie(userSessionCookieName)
-        if err != nil || c.Value == "" {
+        s, ok := sessionFromRequest(r, userSessionCookieName)
+        if !ok {
             http.Error(w, "unauthorized", http.StatusUnauthorized)
             return
         }
-        loginVal, _ := url.QueryUnescape(c.Value)
-        var id int64
-        var login, email, phone string
-        var isAdmin int
-        err = userDB.QueryRow("SELECT id, login, email, phone, is_admin FROM users WHERE login=? OR email=? OR phone=?", loginVal, loginVal, loginVal).Scan(&id, &login, &email, &phone, &isAdmin)
+        u, err := st.Users.Get(s.UserID)
         if err != nil {
             http.Error(w, "unauthorized", http.StatusUnauthorized)
             return
         }
-        writeJSON(w, map[string]any{"id": id, "login": login, "email": email, "phone": phone, "is_admin": isAdmin==1})
+        writeJSON(w, map[string]any{"id": u.ID, "login": u.Login, "email": u.Email, "phone": u.Phone, "is_admin": u.IsAdmin})
     }))
+    mux.HandleFunc("/api/password/forgot", withCORS(rateLimited(recoveryRate, passwordForgotHandler)))
+    mux.HandleFunc("/api/password/reset", withCORS(rateLimited(recoveryRate, passwordResetHandler)))
+    mux.HandleFunc("/api/profile", withCORS(profileHandler))
+    mux.HandleFunc("/api/profile/password", withCORS(rateLimited(accountRate, profilePasswordHandler)))
+    mux.HandleFunc("/api/my/orders", withCORS(myOrdersHandler))
+    mux.HandleFunc("/api/my/orders/", withCORS(myOrderHandler))
     mux.HandleFunc("/api/logout", withCORS(func(w http.ResponseWriter, r *http.Request) {
         if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
-        clearUserSession(w)
+        clearUserSession(w, r)
         writeJSON(w, map[string]string{"status":"ok"})
     }))
     mux.HandleFunc("/api/articles", withCORS(handleArticlesList))
@@ -387,29 +271,45 @@ func main() {
     }))
 
     // Orders API
-    mux.HandleFunc("/api/orders", withCORS(ordersHandler))
+    mux.HandleFunc("/api/orders", withCORS(rateLimited(checkoutRate, ordersHandler)))
     mux.HandleFunc("/api/admin/orders", withCORS(csrfProtect(requireAdmin(adminListOrders))))
-    mux.HandleFunc("/api/admin/orders/status", withCORS(csrfProtect(requireAdmin(adminUpdateOrderStatus))))
+    mux.HandleFunc("/api/admin/orders/status", withCORS(csrfProtect(requireAdmin(adminSetStatus(store.KindService)))))
     mux.HandleFunc("/api/admin/users", withCORS(csrfProtect(requireAdmin(adminUsersHandler))))
+    mux.HandleFunc("/api/admin/companies", withCORS(csrfProtect(requireAdmin(adminCompaniesHandler))))
+    mux.HandleFunc("/api/admin/sessions", withCORS(csrfProtect(requireAdmin(adminSessionsHandler))))
     mux.HandleFunc("/api/admin/news", withCORS(csrfProtect(requireAdmin(adminNewsHandler))))
     mux.HandleFunc("/api/admin/articles", withCORS(csrfProtect(requireAdmin(adminArticlesHandler))))
     mux.HandleFunc("/api/admin/products", withCORS(csrfProtect(requireAdmin(adminProductsHandler))))
+    mux.HandleFunc("/api/admin/products/import", withCORS(csrfProtect(requireAdmin(adminProductsImportHandler))))
+    mux.HandleFunc("/api/admin/products/export", withCORS(csrfProtect(requireAdmin(adminProductsExportHandler))))
+    mux.HandleFunc("/api/admin/products/", withCORS(csrfProtect(requireAdmin(adminProductSubHandler))))
+    mux.HandleFunc("/api/admin/categories", withCORS(csrfProtect(requireAdmin(adminCategoriesHandler))))
+    mux.HandleFunc("/api/admin/price_rules", withCORS(csrfProtect(requireAdmin(adminPriceRulesHandler))))
+    mux.HandleFunc("/api/admin/attributes", withCORS(csrfProtect(requireAdmin(adminAttributesHandler))))
+    mux.HandleFunc("/api/admin/attributes/backfill", withCORS(csrfProtect(requireAdmin(adminAttributesBackfillHandler))))
+    mux.HandleFunc("/api/admin/product_attributes", withCORS(csrfProtect(requireAdmin(adminProductAttributesHandler))))
     mux.HandleFunc("/api/admin/featured", withCORS(csrfProtect(requireAdmin(adminFeaturedHandler))))
     mux.HandleFunc("/api/admin/social", withCORS(csrfProtect(requireAdmin(adminSocialHandler))))
     mux.HandleFunc("/api/admin/social/", withCORS(csrfProtect(requireAdmin(adminSocialHandler))))
     mux.HandleFunc("/api/admin/item_orders", withCORS(csrfProtect(requireAdmin(adminItemOrdersList))))
-    mux.HandleFunc("/api/admin/item_orders/status", withCORS(csrfProtect(requireAdmin(adminItemOrdersStatus))))
+    mux.HandleFunc("/api/admin/item_orders/status", withCORS(csrfProtect(requireAdmin(adminSetStatus(store.KindOrder)))))
+    mux.HandleFunc("/api/admin/item_orders/", withCORS(csrfProtect(requireAdmin(adminItemOrderDocument))))
+    mux.HandleFunc("/api/admin/documents", withCORS(csrfProtect(requireAdmin(adminDocumentsHandler))))
+    mux.HandleFunc("/api/admin/documents/", withCORS(csrfProtect(requireAdmin(adminDocumentsHandler))))
+    mux.HandleFunc("/api/admin/order_statuses", withCORS(csrfProtect(requireAdmin(adminOrderStatusesHandler))))
+    mux.HandleFunc("/api/admin/order_history", withCORS(csrfProtect(requireAdmin(adminOrderHistoryHandler))))
 
     // Cart API
     mux.HandleFunc("/api/cart", withCORS(cartHandler))
+    mux.HandleFunc("/api/cart/offer.pdf", withCORS(cartOfferHandler))
     // Quick buy item order (public)
-    mux.HandleFunc("/api/item-order", withCORS(handleCreateItemOrder))
-    mux.HandleFunc("/api/item-order/batch", withCORS(handleCreateItemOrderBatch))
+    mux.HandleFunc("/api/item-order", withCORS(rateLimited(checkoutRate, handleCreateItemOrder)))
+    mux.HandleFunc("/api/item-order/batch", withCORS(rateLimited(checkoutRate, handleCreateItemOrderBatch)))
     mux.HandleFunc("/api/admin/product_descriptions", withCORS(csrfProtect(requireAdmin(adminProductDescriptionsHandler))))
 
     // Simple admin UI
     // auth pages
-    mux.HandleFunc("/admin/login", loginPage)
+    mux.HandleFunc("/admin/login", rateLimited(loginRate, loginPage))
     mux.HandleFunc("/admin/logout", logout)
     // protected admin
     mux.HandleFunc("/admin/", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
@@ -451,12 +351,20 @@ func main() {
     mux.HandleFunc("/back/news/", handleNewsPublic)
     mux.Handle("/gost/", http.StripPrefix("/gost/", http.FileServer(http.Dir(gostDirPath))))
 
+    mux.HandleFunc("/sitemap.xml", handleSitemap)
+    mux.HandleFunc("/robots.txt", handleRobots)
+
     // Root redirect to main page
     mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
         if r.URL.Path == "/" {
             http.Redirect(w, r, "/front/HTML/main.html", http.StatusFound)
             return
         }
+        // parts of a split sitemap: /sitemap-{n}.xml
+        if strings.HasPrefix(r.URL.Path, "/sitemap-") && strings.HasSuffix(r.URL.Path, ".xml") {
+            handleSitemap(w, r)
+            return
+        }
         http.NotFound(w, r)
     })
 
@@ -513,12 +421,13 @@ func loginPage(w http.ResponseWriter, r *http.Request) {
         if !validateCSRF(r.FormValue("csrf")) { http.Error(w, "invalid csrf", 403); return }
         login := strings.TrimSpace(r.FormValue("login"))
         pass := r.FormValue("password")
-        var hash string
-        var isAdmin int
-        err := userDB.QueryRow("SELECT password_hash, is_admin FROM users WHERE login=?", login).Scan(&hash, &isAdmin)
-        if err != nil { http.Error(w, "invalid credentials", 401); return }
-        if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil { http.Error(w, "invalid credentials", 401); return }
-        setSession(w, login, isAdmin==1)
+        key := lockoutKey("admin", login)
+        if !checkLockout(w, key) { return }
+        u, err := st.Users.GetByLogin(login)
+        if err != nil { loginLockout.fail(key); http.Error(w, "invalid credentials", 401); return }
+        if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(pass)) != nil { loginLockout.fail(key); http.Error(w, "invalid credentials", 401); return }
+        loginLockout.reset(key)
+        if err := setSession(w, r, u.ID, u.IsAdmin); err != nil { http.Error(w, err.Error(), 500); return }
         http.Redirect(w, r, "/admin/", http.StatusFound)
     default:
         http.Error(w, "method not allowed", 405)
@@ -526,13 +435,13 @@ func loginPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func logout(w http.ResponseWriter, r *http.Request) {
-    clearSession(w)
+    clearSession(w, r)
     http.Redirect(w, r, "/admin/login", http.StatusFound)
 }
 
 // removed inline login HTML; using external file
 
-// --- Security helpers: CSRF, headers, rate limiting ---
+// --- Security helpers: CSRF, headers (rate limiting lives in ratelimit.go) ---
 var csrfSecret = mustRandomKey()
 
 func mustRandomKey() []byte {
@@ -556,14 +465,11 @@ func sendHTMLWithCSRF(w http.ResponseWriter, path string) {
     _, _ = w.Write([]byte(html))
 }
 
-func handleGetCategories(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodGet {
-        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-        return
-    }
-    writeJSON(w, categories)
-}
-
+// GET /api/catalog/products?category=&sub=&page=&limit=&sort=
+//   price_min, price_max, thickness_min, thickness_max, weight_min, weight_max, length_min, length_max,
+//   in_stock=1, size= and diameter= (repeatable or comma-separated),
+//   attr.<code>=v1|v2, attr.<code>.min, attr.<code>.max for the category's attributes
+// Filtering, sorting and paging run in SQL; the response carries the total and facet counts.
 func handleGetProducts(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
         http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -581,90 +487,116 @@ func handleGetProducts(w http.ResponseWriter, r *http.Request) {
         limit = 12
     }
 
-    // Prefer DB-backed products if table has rows for this type
-    dbType := categoryToTypeSlug(category)
-    if productsDB != nil {
-        if rows, err := queryProductsFromDB(productsDB, dbType); err == nil {
-            // Fallback: если по типу ничего не нашли (расхождение в данных), пробуем без фильтра типа и отфильтруем вручную
-            if len(rows) == 0 && dbType != "" {
-                if allRows, err2 := queryProductsFromDB(productsDB, ""); err2 == nil {
-                    want := strings.ToLower(strings.TrimSpace(dbType))
-                    tmp := make([]ProductRow, 0, len(allRows))
-                    for _, it := range allRows {
-                        // accept exact match or canonicalized match of type slug
-                        if strings.ToLower(strings.TrimSpace(it.Type)) == want || normalizeTypeSlug(it.Type) == want {
-                            tmp = append(tmp, it)
-                        }
-                    }
-                    rows = tmp
-                }
-            }
-            // apply subcategory predicate on name
-            var arr []ProductRow
-            if sub != "" {
-                // Unified predicate for belonging to sub
-                for _, it := range rows { if itemBelongsToSub(category, sub, it) { arr = append(arr, it) } }
-            } else { arr = rows }
-            // stable sort: subtype asc, then price asc to match UI expectations
-            sort.SliceStable(arr, func(i, j int) bool {
-                si := normalizeSubtypeLabel(arr[i].Subtype)
-                sj := normalizeSubtypeLabel(arr[j].Subtype)
-                if si == sj {
-                    return arr[i].Price < arr[j].Price
-                }
-                return si < sj
-            })
-
-            // map to API objects that include price and stock for client rendering
-            type apiItem map[string]any
-            var out []apiItem
-            for _, it := range arr {
-                out = append(out, apiItem{
-                    "id": strconv.FormatInt(it.ID, 10),
-                    "title": it.Name,
-                    "image": it.Img,
-                    "categoryId": category,
-                    "description": it.Size,
-                    "name": it.Name,
-                    "img": it.Img,
-                    "price": it.Price,
-                    "price_per_ton": it.PricePerTon,
-                    "thickness_mm": it.ThicknessMM,
-                    "weight_kg": it.WeightKg,
-                    "length_m": it.LengthM,
-                    "weight_tons": it.WeightKg/1000.0,
-                    "in_stock": it.InStock,
-                    "subtype": it.Subtype,
-                    "size": it.Size,
-                })
-            }
-            // pagination
-            start := (page - 1) * limit
-            if start > len(out) { start = len(out) }
-            end := start + limit
-            if end > len(out) { end = len(out) }
-            writeJSON(w, out[start:end])
-            return
+    if st == nil {
+        var filtered []Product
+        for _, p := range products {
+            if category != "" && p.CategoryID != category { continue }
+            if sub != "" && !productMatchesSubcategory(p, category, sub) { continue }
+            filtered = append(filtered, p)
         }
+        start := (page - 1) * limit
+        if start > len(filtered) { start = len(filtered) }
+        end := start + limit
+        if end > len(filtered) { end = len(filtered) }
+        writeJSON(w, map[string]any{"items": filtered[start:end], "total": len(filtered), "page": page, "limit": limit})
+        return
     }
 
-    var filtered []Product
-    for _, p := range products {
-        if category != "" && p.CategoryID != category { continue }
-        if sub != "" && !productMatchesSubcategory(p, category, sub) { continue }
-        filtered = append(filtered, p)
-    }
+    f, defs, msg, err := catalogFilter(category, sub, q)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    if msg != "" { http.Error(w, msg, http.StatusBadRequest); return }
+    f.Limit, f.Offset = limit, (page-1)*limit
+    rows, total, err := st.Products.Filter(f)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    facets, err := st.Products.Facets(f)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    attrFacets, err := st.Products.AttributeFacets(f, defs)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    ids := make([]int64, len(rows))
+    for i, it := range rows { ids[i] = it.ID }
+    attrs, err := st.Attributes.Values(ids...)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+
+    // map to API objects that include price and stock for client rendering
+    out := make([]map[string]any, 0, len(rows))
+    for _, it := range rows {
+        out = append(out, map[string]any{
+            "id": strconv.FormatInt(it.ID, 10),
+            "title": it.Name,
+            "image": it.Img,
+            "categoryId": category,
+            "description": it.Size,
+            "name": it.Name,
+            "img": it.Img,
+            "price": it.Price,
+            "price_per_ton": it.PricePerTon,
+            "thickness_mm": it.ThicknessMM,
+            "weight_kg": it.WeightKg,
+            "length_m": it.LengthM,
+            "weight_tons": it.WeightKg/1000.0,
+            "in_stock": it.InStock,
+            "subtype": it.Subtype,
+            "size": it.Size,
+            "attributes": productAttributesJSON(attrs[it.ID]),
+        })
+    }
+    writeJSON(w, map[string]any{"items": out, "total": total, "page": page, "limit": limit, "facets": facets, "attribute_facets": attrFacets})
+}
+
+// catalogFilter builds the listing filter of a category page from its query parameters; the
+// attribute definitions of the category come along for the facets. A non-empty message means
+// a bad request.
+func catalogFilter(category, sub string, q url.Values) (store.ProductFilter, []store.AttributeDef, string, error) {
+    f, msg := productFilterFromQuery(q)
+    if msg != "" { return f, nil, msg, nil }
+    f.Type = categoryToTypeSlug(category)
+    f.SubSubtypes, f.SubPatterns = subFilter(category, sub)
+    defs, err := attributeDefsFor(f.Type)
+    if err != nil { return f, nil, "", err }
+    f.Attrs, msg = attrFiltersFromQuery(q, defs)
+    return f, defs, msg, nil
+}
 
-    // pagination
-    start := (page - 1) * limit
-    if start > len(filtered) {
-        start = len(filtered)
+// productFilterFromQuery reads the facet parameters; a non-empty message means a bad request
+func productFilterFromQuery(q url.Values) (store.ProductFilter, string) {
+    var f store.ProductFilter
+    ranges := []struct {
+        name string
+        dst  *store.Range
+    }{
+        {"price", &f.Price}, {"thickness", &f.Thickness}, {"weight", &f.Weight}, {"length", &f.Length},
+    }
+    for _, rg := range ranges {
+        for _, end := range []string{"min", "max"} {
+            s := strings.TrimSpace(strings.ReplaceAll(q.Get(rg.name+"_"+end), ",", "."))
+            if s == "" { continue }
+            v, err := strconv.ParseFloat(s, 64)
+            if err != nil { return f, "bad " + rg.name + "_" + end }
+            if end == "min" { rg.dst.Min = &v } else { rg.dst.Max = &v }
+        }
     }
-    end := start + limit
-    if end > len(filtered) {
-        end = len(filtered)
+    f.InStock = q.Get("in_stock") == "1" || q.Get("in_stock") == "true"
+    f.Sizes = queryList(q, "size")
+    for _, s := range queryList(q, "diameter") {
+        d, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+        if err != nil { return f, "bad diameter" }
+        f.Diameters = append(f.Diameters, d)
     }
-    writeJSON(w, filtered[start:end])
+    f.Sort = strings.TrimSpace(q.Get("sort"))
+    if !store.KnownProductSort(f.Sort) { return f, "unknown sort" }
+    return f, ""
+}
+
+// queryList collects a parameter given repeatedly (size=a&size=b) or as a list (size=a|b).
+// Sizes contain commas ("57x3,5"), so lists are split on '|' only.
+func queryList(q url.Values, name string) []string {
+    var out []string
+    for _, v := range q[name] {
+        for _, s := range strings.Split(v, "|") {
+            if s = strings.TrimSpace(s); s != "" { out = append(out, s) }
+        }
+    }
+    return out
 }
 
 // productMatchesSubcategory applies keyword-based matching per category/sub slug
@@ -740,37 +672,6 @@ func productMatchesSubcategory(p Product, category, sub string) bool {
     return true
 }
 
-// Map (category, subSlug) -> human label used in DB subtype
-func subSlugToLabel(category, sub string) string {
-    switch category {
-    case "profile-pipe":
-        switch sub { case "kvadratnaya": return "Труба квадратная"; case "otsinkovannaya": return "Труба оцинкованная"; case "pryamougolnaya": return "Труба прямоугольная" }
-    case "rebar":
-        switch sub { case "a500c": return "Арматура А500C"; case "a1": return "Гладкая арматура A1"; case "a400": return "Арматура A400"; case "fixatory": return "Фиксаторы для арматуры"; case "stekloplastikovaya": return "Арматура стеклопластиковая" }
-    case "round-pipe":
-        switch sub { case "besshovnaya": return "Бесшовные трубы"; case "vgp": return "Труба водогазопроводная"; case "ocinkovannaya": return "Труба оцинкованная"; case "elektrosvarka": return "Труба электросварная" }
-    case "sheet":
-        switch sub { case "ocinkovanniy": return "Лист оцинкованный"; case "st_goryachekatanyi": return "Лист стальной горячекатаный"; case "st_holodnokatanyi": return "Лист стальной холоднокатаный"; case "rifleniy_romb": return "Лист рифленый ромб"; case "riflenaya_chechevica": return "Лист рифленый чечевица"; case "prosechno-vytyazhnoy": return "Лист просечно-вытяжной" }
-    case "profnastil":
-        switch sub { case "krashennyy": return "Профнастил крашеный"; case "ocinkovannyy": return "Профнастил оцинкованный"; case "dlya-zabora": return "Профнастил для забора" }
-    }
-    return ""
-}
-
-// normalizeSubtypeLabel normalizes minor Cyrillic/Latin variations (A/А, C/С), spaces and case
-func normalizeSubtypeLabel(s string) string {
-    // Replace Cyrillic letters with Latin counterparts for A and C which appear in designations
-    replacer := strings.NewReplacer(
-        "А", "A", "а", "a",
-        "С", "C", "с", "c",
-    )
-    ns := replacer.Replace(s)
-    ns = strings.ToLower(strings.TrimSpace(ns))
-    // collapse multiple spaces
-    for strings.Contains(ns, "  ") { ns = strings.ReplaceAll(ns, "  ", " ") }
-    return ns
-}
-
 // normalizeTypeSlug extracts canonical slug from products.type
 func normalizeTypeSlug(s string) string {
     ns := strings.ToLower(strings.TrimSpace(s))
@@ -793,107 +694,38 @@ func normalizeCode(s string) string {
     return string(b)
 }
 
-func wantedCodeForSub(category, sub string) string {
-    switch category {
-    case "rebar":
-        switch sub {
-        case "a500c":
-            return "a500c"
-        case "a1":
-            return "a1"
-        case "a400":
-            return "a400"
-        default:
-            return ""
-        }
-    default:
-        return ""
-    }
-}
-
-// optional additional keyword hints for other categories/subs
-func wantedKeywordsForSub(category, sub string) []string {
-    switch category {
-    case "profile-pipe":
-        switch sub {
-        case "kvadratnaya":
-            return []string{"kvadrat"}
-        case "otsinkovannaya":
-            return []string{"ocink"}
-        case "pryamougolnaya":
-            return []string{"pryamougol"}
-        }
-    case "round-pipe":
-        switch sub {
-        case "besshovnaya":
-            return []string{"besshov"}
-        case "vgp":
-            return []string{"vgp", "vodogaz"}
-        case "ocinkovannaya":
-            return []string{"ocink"}
-        case "elektrosvarka":
-            return []string{"elektrosvar"}
-        }
-    case "sheet":
-        switch sub {
-        case "ocinkovanniy":
-            return []string{"ocink"}
-        case "st_goryachekatanyi":
-            return []string{"goryachekat"}
-        case "st_holodnokatanyi":
-            return []string{"holodnokat"}
-        case "rifleniy_romb":
-            return []string{"rifl", "romb"}
-        case "riflenaya_chechevica":
-            return []string{"chechev"}
-        case "prosechno-vytyazhnoy":
-            return []string{"prosech", "vytyazh"}
-        }
-    case "profnastil":
-        switch sub {
-        case "krashennyy":
-            return []string{"krashen", "polimer"}
-        case "ocinkovannyy":
-            return []string{"ocink"}
-        case "dlya-zabora":
-            return []string{"zabor"}
-        }
-    }
-    return nil
-}
-
-func itemBelongsToSub(category, sub string, it ProductRow) bool {
-    if strings.TrimSpace(sub) == "" { return true }
-    // exact subtype label match after normalization
-    wl := normalizeSubtypeLabel(subSlugToLabel(category, sub))
-    if wl != "" && normalizeSubtypeLabel(it.Subtype) == wl { return true }
-    // otherwise, keyword/code match on combined text
-    wantCode := wantedCodeForSub(category, sub)
-    code := normalizeCode(it.Subtype + " " + it.Name + " " + it.Size)
-    if wantCode != "" && strings.Contains(code, wantCode) { return true }
-    if kws := wantedKeywordsForSub(category, sub); len(kws) > 0 {
-        for _, kw := range kws { if strings.Contains(code, kw) { return true } }
-    }
-    return false
-}
-
-func handleSearch(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodGet {
-        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-        return
-    }
-    q := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("q")))
-    if q == "" {
-        writeJSON(w, []Product{})
-        return
-    }
-    var found []Product
-    for _, p := range products {
-        if strings.Contains(strings.ToLower(p.Title), q) || strings.Contains(strings.ToLower(p.Description), q) {
-            found = append(found, p)
+// subFilter turns a subcategory into the SQL predicate of store.ProductFilter: the subtype holds the
+// slug or its title, or subtype, name and size mention the category's grade code or a keyword
+func subFilter(category, sub string) (subtypes, patterns []string) {
+    if strings.TrimSpace(sub) == "" { return nil, nil }
+    subtypes = []string{sub}
+    t := catalogTree()
+    parent, ok := t.topCategory(category)
+    if !ok { return subtypes, nil }
+    c, ok := t.subcategory(parent, sub)
+    if !ok { return subtypes, nil }
+    subtypes = append(subtypes, c.Title)
+    // a grade code is written with Latin or Cyrillic а/с in either case; LIKE folds ASCII case only
+    if code := c.MatchCode; code != "" {
+        variants := []string{""}
+        for _, ch := range code {
+            alts := []string{string(ch)}
+            switch ch {
+            case 'a':
+                alts = append(alts, "а", "А")
+            case 'c':
+                alts = append(alts, "с", "С")
+            }
+            next := make([]string, 0, len(variants)*len(alts))
+            for _, v := range variants {
+                for _, a := range alts { next = append(next, v+a) }
+            }
+            variants = next
         }
+        for _, v := range variants { patterns = append(patterns, "%"+v+"%") }
     }
-    writeJSON(w, found)
+    for _, kw := range c.KeywordList() { patterns = append(patterns, "%"+kw+"%") }
+    return subtypes, patterns
 }
 
 func handleGostList(w http.ResponseWriter, r *http.Request) {
@@ -933,7 +765,6 @@ func handleGostList(w http.ResponseWriter, r *http.Request) {
 
 // moved to orders.go: adminListOrders
 
-// moved to orders.go: adminUpdateOrderStatus
 
 // moved to users.go: type User, adminUsersHandler
 
@@ -2,16 +2,11 @@ package main
 
 import (
     "net/http"
-    "net/url"
 )
 
 func isAdminRequest(r *http.Request) bool {
-    c, err := r.Cookie(sessionCookieName)
-    if err != nil || c.Value == "" { return false }
-    login, _ := url.QueryUnescape(c.Value)
-    var isAdmin int
-    if err := userDB.QueryRow("SELECT is_admin FROM users WHERE login=?", login).Scan(&isAdmin); err != nil { return false }
-    return isAdmin == 1
+    s, ok := sessionFromRequest(r, sessionCookieName)
+    return ok && s.IsAdmin
 }
 
 func requireAdmin(h http.HandlerFunc) http.HandlerFunc {
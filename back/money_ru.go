@@ -0,0 +1,111 @@
+package main
+
+import (
+    "math"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Amounts and dates the way Russian accounting papers print them: "43 300,00", "Сорок три
+// тысячи триста рублей 00 копеек", "18 октября 2026 г.".
+
+var (
+    ruOnes     = []string{"", "один", "два", "три", "четыре", "пять", "шесть", "семь", "восемь", "девять"}
+    ruOnesFem  = []string{"", "одна", "две", "три", "четыре", "пять", "шесть", "семь", "восемь", "девять"}
+    ruTeens    = []string{"десять", "одиннадцать", "двенадцать", "тринадцать", "четырнадцать", "пятнадцать", "шестнадцать", "семнадцать", "восемнадцать", "девятнадцать"}
+    ruTens     = []string{"", "", "двадцать", "тридцать", "сорок", "пятьдесят", "шестьдесят", "семьдесят", "восемьдесят", "девяносто"}
+    ruHundreds = []string{"", "сто", "двести", "триста", "четыреста", "пятьсот", "шестьсот", "семьсот", "восемьсот", "девятьсот"}
+    ruMonthsGen = []string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"}
+)
+
+// ruPlural picks the form of a noun for n: one (1, 21), few (2-4, 22) or many (5-20, 25)
+func ruPlural(n int64, one, few, many string) string {
+    n %= 100
+    if n >= 11 && n <= 14 { return many }
+    switch n % 10 {
+    case 1:
+        return one
+    case 2, 3, 4:
+        return few
+    }
+    return many
+}
+
+// ruTriad spells 0..999; feminine for thousands ("одна тысяча", "две тысячи")
+func ruTriad(n int64, feminine bool) []string {
+    var out []string
+    if h := n / 100; h > 0 { out = append(out, ruHundreds[h]) }
+    n %= 100
+    switch {
+    case n >= 10 && n < 20:
+        out = append(out, ruTeens[n-10])
+    default:
+        if t := n / 10; t > 0 { out = append(out, ruTens[t]) }
+        ones := ruOnes
+        if feminine { ones = ruOnesFem }
+        if o := n % 10; o > 0 { out = append(out, ones[o]) }
+    }
+    return out
+}
+
+// ruNumber spells a non-negative whole number in the masculine
+func ruNumber(n int64) string {
+    if n == 0 { return "ноль" }
+    scales := []struct {
+        size           int64
+        feminine       bool
+        one, few, many string
+    }{
+        {1e9, false, "миллиард", "миллиарда", "миллиардов"},
+        {1e6, false, "миллион", "миллиона", "миллионов"},
+        {1e3, true, "тысяча", "тысячи", "тысяч"},
+    }
+    var words []string
+    for _, s := range scales {
+        if part := n / s.size; part > 0 {
+            words = append(words, ruTriad(part%1000, s.feminine)...)
+            words = append(words, ruPlural(part, s.one, s.few, s.many))
+            n %= s.size
+        }
+    }
+    words = append(words, ruTriad(n, false)...)
+    return strings.Join(words, " ")
+}
+
+// rublesInWords spells an amount for the "сумма прописью" line: roubles in words, kopecks in digits
+func rublesInWords(v float64) string {
+    kop := int64(math.Round(math.Abs(v) * 100))
+    rub, k := kop/100, kop%100
+    s := ruNumber(rub) + " " + ruPlural(rub, "рубль", "рубля", "рублей") + " " + twoDigits(k) + " " + ruPlural(k, "копейка", "копейки", "копеек")
+    r := []rune(s)
+    return strings.ToUpper(string(r[0])) + string(r[1:])
+}
+
+func twoDigits(n int64) string {
+    if n < 10 { return "0" + strconv.FormatInt(n, 10) }
+    return strconv.FormatInt(n, 10)
+}
+
+// formatRub prints an amount with a space between thousands and a decimal comma: "43 300,00"
+func formatRub(v float64) string {
+    s := strconv.FormatFloat(math.Abs(v), 'f', 2, 64)
+    whole, frac, _ := strings.Cut(s, ".")
+    var b strings.Builder
+    if v < 0 { b.WriteByte('-') }
+    for i, c := range whole {
+        if i > 0 && (len(whole)-i)%3 == 0 { b.WriteByte(' ') }
+        b.WriteRune(c)
+    }
+    return b.String() + "," + frac
+}
+
+// formatDecimalRu prints a quantity with a decimal comma and no trailing zeros: "1,5"
+func formatDecimalRu(v float64) string {
+    return strings.Replace(strconv.FormatFloat(v, 'f', -1, 64), ".", ",", 1)
+}
+
+// ruDate prints a date in words: "18 октября 2026 г."
+func ruDate(t time.Time) string {
+    return strconv.Itoa(t.Day()) + " " + ruMonthsGen[t.Month()-1] + " " + strconv.Itoa(t.Year()) + " г."
+}
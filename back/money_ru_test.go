@@ -0,0 +1,60 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestRuPlural(t *testing.T) {
+    cases := []struct {
+        n    int64
+        want string
+    }{
+        {0, "рублей"}, {1, "рубль"}, {2, "рубля"}, {4, "рубля"}, {5, "рублей"},
+        {11, "рублей"}, {12, "рублей"}, {14, "рублей"}, {21, "рубль"}, {22, "рубля"},
+        {25, "рублей"}, {101, "рубль"}, {111, "рублей"}, {1000004, "рубля"},
+    }
+    for _, c := range cases {
+        if got := ruPlural(c.n, "рубль", "рубля", "рублей"); got != c.want { t.Errorf("ruPlural(%d) = %q, want %q", c.n, got, c.want) }
+    }
+}
+
+func TestRublesInWords(t *testing.T) {
+    cases := []struct {
+        v    float64
+        want string
+    }{
+        {0.99, "Ноль рублей 99 копеек"},
+        {1, "Один рубль 00 копеек"},
+        {11, "Одиннадцать рублей 00 копеек"},
+        {21.01, "Двадцать один рубль 01 копейка"},
+        {112.02, "Сто двенадцать рублей 02 копейки"},
+        // thousands are feminine
+        {2000.5, "Две тысячи рублей 50 копеек"},
+        {43300, "Сорок три тысячи триста рублей 00 копеек"},
+        {1001122.22, "Один миллион одна тысяча сто двадцать два рубля 22 копейки"},
+        {2000000000, "Два миллиарда рублей 00 копеек"},
+        // float noise must not lose a kopeck
+        {0.1 + 0.2, "Ноль рублей 30 копеек"},
+    }
+    for _, c := range cases {
+        if got := rublesInWords(c.v); got != c.want { t.Errorf("rublesInWords(%v) = %q, want %q", c.v, got, c.want) }
+    }
+}
+
+func TestFormatRub(t *testing.T) {
+    cases := []struct {
+        v    float64
+        want string
+    }{
+        {0, "0,00"}, {999, "999,00"}, {43300, "43 300,00"}, {1234567.5, "1 234 567,50"}, {-1500, "-1 500,00"},
+    }
+    for _, c := range cases {
+        if got := formatRub(c.v); got != c.want { t.Errorf("formatRub(%v) = %q, want %q", c.v, got, c.want) }
+    }
+}
+
+func TestRuDate(t *testing.T) {
+    if got, want := ruDate(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)), "18 октября 2026 г."; got != want { t.Errorf("ruDate = %q, want %q", got, want) }
+    if got, want := formatDecimalRu(1.5), "1,5"; got != want { t.Errorf("formatDecimalRu = %q, want %q", got, want) }
+}
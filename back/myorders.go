@@ -0,0 +1,112 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "metal-main/back/store"
+)
+
+// Personal cabinet: a signed-in user sees only the orders placed under their login.
+
+// myOrder is a catalog order as the cabinet shows it
+type myOrder struct {
+    Order
+    StatusLabel string               `json:"status_label"`
+    History     []store.StatusChange `json:"history,omitempty"`
+}
+
+// myServiceOrder is a service request as the cabinet shows it
+type myServiceOrder struct {
+    ServiceOrder
+    StatusLabel string               `json:"status_label"`
+    History     []store.StatusChange `json:"history,omitempty"`
+}
+
+// GET /api/my/orders
+func myOrdersHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    login := currentUserLogin(r)
+    if login == "" { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    orders, err := st.Orders.ListByLogin(login)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    services, err := st.Orders.ListServiceOrdersByLogin(login)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    outOrders := make([]myOrder, 0, len(orders))
+    for _, o := range orders { outOrders = append(outOrders, myOrder{Order: o, StatusLabel: statusLabel(o.Status)}) }
+    outServices := make([]myServiceOrder, 0, len(services))
+    for _, o := range services { outServices = append(outServices, myServiceOrder{ServiceOrder: o, StatusLabel: statusLabel(o.Status)}) }
+    writeJSON(w, map[string]any{"orders": outOrders, "service_orders": outServices})
+}
+
+// /api/my/orders/{id}[?kind=service] - GET one order with its status history
+// /api/my/orders/{id}/repeat - POST puts the lines of a catalog order back into the cart
+// /api/my/orders/{id}/invoice.pdf, /offer.pdf - GET downloads the invoice or commercial offer of a catalog order
+func myOrderHandler(w http.ResponseWriter, r *http.Request) {
+    login := currentUserLogin(r)
+    if login == "" { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/my/orders/"), "/")
+    idPart, action, _ := strings.Cut(rest, "/")
+    id, err := strconv.ParseInt(idPart, 10, 64)
+    if err != nil || id <= 0 { http.NotFound(w, r); return }
+    kind := store.KindOrder
+    if r.URL.Query().Get("kind") == store.KindService { kind = store.KindService }
+
+    switch {
+    case action == "" && r.Method == http.MethodGet:
+        history, err := st.Orders.StatusHistory(kind, id)
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if kind == store.KindService {
+            o, err := st.Orders.GetServiceOrder(id)
+            if err == store.ErrNotFound || (err == nil && o.UserLogin != login) { http.Error(w, "not found", 404); return }
+            if err != nil { http.Error(w, err.Error(), 500); return }
+            writeJSON(w, myServiceOrder{ServiceOrder: o, StatusLabel: statusLabel(o.Status), History: history})
+            return
+        }
+        o, err := st.Orders.Get(id)
+        if err == store.ErrNotFound || (err == nil && o.UserLogin != login) { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, myOrder{Order: o, StatusLabel: statusLabel(o.Status), History: history})
+    case action == "repeat" && r.Method == http.MethodPost:
+        if kind == store.KindService { http.Error(w, "service requests cannot be repeated into the cart", 400); return }
+        o, err := st.Orders.Get(id)
+        if err == store.ErrNotFound || (err == nil && o.UserLogin != login) { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        repeatOrder(w, r, o)
+    case strings.HasSuffix(action, ".pdf") && r.Method == http.MethodGet:
+        docKind, ok := documentKind(action)
+        if !ok || kind == store.KindService { http.NotFound(w, r); return }
+        o, err := st.Orders.Get(id)
+        if err == store.ErrNotFound || (err == nil && o.UserLogin != login) { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        myOrderDocument(w, r, docKind, o, login)
+    case action == "" || action == "repeat":
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+// repeatOrder adds every line of o to the cart at today's prices. Lines whose product was
+// removed or is out of stock are skipped and reported back instead of failing the whole repeat.
+func repeatOrder(w http.ResponseWriter, r *http.Request, o Order) {
+    cartID := resolveCartID(w, r)
+    rules, err := currentPriceRules(r)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    added, skipped := []store.CartItem{}, []string{}
+    for _, l := range o.Lines {
+        pl, err := priceLine(st.Products, rules, l.ItemID, l.Qty, l.Unit)
+        // a line in a unit the product no longer supports (its weight was removed) or whose price was
+        // withdrawn cannot be repeated either
+        if errors.Is(err, errUnknownProduct) || errors.Is(err, errOutOfStock) || errors.Is(err, errBadUnit) || errors.Is(err, errPriceOnRequest) { skipped = append(skipped, l.Title); continue }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        it, err := cartItemFor(cartID, pl)
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if err := st.Cart.Add(cartID, it); err != nil { http.Error(w, err.Error(), 500); return }
+        added = append(added, it)
+    }
+    // added lets the storefront mirror the lines into its local cart copy
+    writeJSON(w, map[string]any{"status": "ok", "added": added, "skipped": skipped})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "metal-main/back/store"
+)
+
+// signIn creates the public user login with a session and returns its cookie
+func signIn(t *testing.T, login string) *http.Cookie {
+    t.Helper()
+    u := store.User{Login: login, PasswordHash: "x", Email: login + "@example.ru"}
+    if err := st.Users.Create(&u); err != nil { t.Fatal(err) }
+    w := httptest.NewRecorder()
+    if err := setUserSession(w, httptest.NewRequest(http.MethodPost, "/api/user/login", nil), u.ID); err != nil { t.Fatal(err) }
+    for _, c := range w.Result().Cookies() {
+        if c.Name == userSessionCookieName { return c }
+    }
+    t.Fatal("no session cookie set")
+    return nil
+}
+
+func TestMyOrderIsPrivate(t *testing.T) {
+    useTestStore(t)
+    ivan, petr := signIn(t, "ivan"), signIn(t, "petr")
+    o := store.Order{UserLogin: "ivan", Phone: "+7 999", Status: statusNew, Lines: []store.OrderLine{{ItemID: "1", Title: "Арматура", Qty: 2, Price: 100, Total: 200}}}
+    if err := st.InTx(func(tx *store.Store) error { return tx.Orders.Create(&o) }); err != nil { t.Fatal(err) }
+    so := store.ServiceOrder{Service: "Резка", Name: "Иван", Phone: "+7 999", UserLogin: "ivan", Status: statusNew}
+    if err := st.Orders.CreateServiceOrder(&so); err != nil { t.Fatal(err) }
+
+    cases := []struct {
+        name, method, path string
+        cookie             *http.Cookie
+        want               int
+    }{
+        {"owner", http.MethodGet, fmt.Sprintf("/api/my/orders/%d", o.ID), ivan, 200},
+        {"another customer", http.MethodGet, fmt.Sprintf("/api/my/orders/%d", o.ID), petr, 404},
+        {"signed out", http.MethodGet, fmt.Sprintf("/api/my/orders/%d", o.ID), nil, 401},
+        {"missing order", http.MethodGet, fmt.Sprintf("/api/my/orders/%d", o.ID+100), ivan, 404},
+        {"own service request", http.MethodGet, fmt.Sprintf("/api/my/orders/%d?kind=service", so.ID), ivan, 200},
+        {"another customer's service request", http.MethodGet, fmt.Sprintf("/api/my/orders/%d?kind=service", so.ID), petr, 404},
+        {"repeat another customer's order", http.MethodPost, fmt.Sprintf("/api/my/orders/%d/repeat", o.ID), petr, 404},
+        {"invoice of another customer's order", http.MethodGet, fmt.Sprintf("/api/my/orders/%d/invoice.pdf", o.ID), petr, 404},
+    }
+    for _, c := range cases {
+        r := httptest.NewRequest(c.method, c.path, nil)
+        if c.cookie != nil { r.AddCookie(c.cookie) }
+        w := httptest.NewRecorder()
+        myOrderHandler(w, r)
+        if w.Code != c.want { t.Errorf("%s: %d, want %d", c.name, w.Code, c.want) }
+    }
+}
+
+func TestRepeatOrder(t *testing.T) {
+    useTestStore(t)
+    ivan := signIn(t, "ivan")
+    rebar, removed, gone, onRequest := testRebar, testRebar, testRebar, ProductRow{Type: "armatura", Name: "Арматура", Size: "40", LengthM: 11.7, InStock: true}
+    rebar.ID, rebar.InStock = 0, true
+    removed.ID, removed.InStock = 0, false
+    for _, p := range []*ProductRow{&rebar, &removed, &gone, &onRequest} {
+        if err := st.Products.Create(p); err != nil { t.Fatal(err) }
+    }
+    if err := st.Products.Delete(gone.ID); err != nil { t.Fatal(err) }
+    id := func(p ProductRow) string { return fmt.Sprint(p.ID) }
+    o := store.Order{UserLogin: "ivan", Status: statusDelivered, Lines: []store.OrderLine{
+        {ItemID: id(rebar), Title: "Арматура 12", Qty: 25, Unit: unitMetre, Price: 90, Total: 2250},
+        {ItemID: id(removed), Title: "Нет в наличии", Qty: 1, Price: 100, Total: 100},
+        {ItemID: id(gone), Title: "Удалён", Qty: 1, Price: 100, Total: 100},
+        {ItemID: id(onRequest), Title: "По запросу", Qty: 1, Price: 100, Total: 100},
+    }}
+    if err := st.InTx(func(tx *store.Store) error { return tx.Orders.Create(&o) }); err != nil { t.Fatal(err) }
+
+    r := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/my/orders/%d/repeat", o.ID), nil)
+    r.AddCookie(ivan)
+    r.AddCookie(&http.Cookie{Name: "cart_id", Value: "cart-1"})
+    w := httptest.NewRecorder()
+    myOrderHandler(w, r)
+    if w.Code != 200 { t.Fatalf("repeat: %d %s", w.Code, w.Body) }
+    var res struct {
+        Added   []store.CartItem `json:"added"`
+        Skipped []string         `json:"skipped"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil { t.Fatal(err) }
+    // repeated at today's list price, not the price of the old order
+    if len(res.Added) != 1 || res.Added[0].ID != id(rebar) || res.Added[0].Qty != 25 || res.Added[0].Price != 100 { t.Errorf("added = %+v", res.Added) }
+    if want := []string{"Нет в наличии", "Удалён", "По запросу"}; fmt.Sprint(res.Skipped) != fmt.Sprint(want) { t.Errorf("skipped = %q, want %q", res.Skipped, want) }
+    items, err := st.Cart.Items("cart-1")
+    if err != nil { t.Fatal(err) }
+    if len(items) != 1 || items[0].ID != id(rebar) { t.Errorf("cart = %+v", items) }
+
+    // service requests have nothing to put in the cart
+    so := store.ServiceOrder{Service: "Резка", Name: "Иван", Phone: "+7 999", UserLogin: "ivan", Status: statusNew}
+    if err := st.Orders.CreateServiceOrder(&so); err != nil { t.Fatal(err) }
+    r = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/my/orders/%d/repeat?kind=service", so.ID), nil)
+    r.AddCookie(ivan)
+    w = httptest.NewRecorder()
+    myOrderHandler(w, r)
+    if w.Code != 400 { t.Errorf("repeat a service request: %d, want 400", w.Code) }
+}
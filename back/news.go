@@ -1,7 +1,6 @@
 package main
 
 import (
-    "database/sql"
     "encoding/json"
     "html"
     "net/http"
@@ -11,17 +10,12 @@ import (
     "strconv"
     "strings"
     "time"
+
+    "metal-main/back/store"
 )
 
 // News represents a news article item
-type News struct {
-    ID          int64  `json:"id"`
-    Title       string `json:"title"`
-    ShortText   string `json:"short_text"`
-    FullText    string `json:"full_text"`
-    PublishedAt string `json:"published_at"` // YYYY-MM-DD
-    ImageURL    string `json:"image_url"`
-}
+type News = store.News
 
 // Public list of news with optional year filter
 func handleNewsList(w http.ResponseWriter, r *http.Request) {
@@ -30,21 +24,8 @@ func handleNewsList(w http.ResponseWriter, r *http.Request) {
         return
     }
     year := strings.TrimSpace(r.URL.Query().Get("year"))
-    var rows *sql.Rows
-    var err error
-    if year == "" {
-        rows, err = newsDB.Query("SELECT id, title, short_text, full_text, published_at, COALESCE(image_url,'') FROM news ORDER BY published_at DESC, id DESC")
-    } else {
-        rows, err = newsDB.Query("SELECT id, title, short_text, full_text, published_at, COALESCE(image_url,'') FROM news WHERE strftime('%Y', published_at)=? ORDER BY published_at DESC, id DESC", year)
-    }
+    out, err := st.Content.ListNews(year)
     if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
-    defer rows.Close()
-    var out []News
-    for rows.Next() {
-        var n News
-        if err := rows.Scan(&n.ID, &n.Title, &n.ShortText, &n.FullText, &n.PublishedAt, &n.ImageURL); err != nil { http.Error(w, err.Error(), 500); return }
-        out = append(out, n)
-    }
     writeJSON(w, out)
 }
 
@@ -52,15 +33,8 @@ func handleNewsList(w http.ResponseWriter, r *http.Request) {
 func adminNewsHandler(w http.ResponseWriter, r *http.Request) {
     switch r.Method {
     case http.MethodGet:
-        rows, err := newsDB.Query("SELECT id, title, short_text, full_text, published_at, COALESCE(image_url,'') FROM news ORDER BY published_at DESC, id DESC")
+        out, err := st.Content.ListNews("")
         if err != nil { http.Error(w, err.Error(), 500); return }
-        defer rows.Close()
-        var out []News
-        for rows.Next() {
-            var n News
-            if err := rows.Scan(&n.ID, &n.Title, &n.ShortText, &n.FullText, &n.PublishedAt, &n.ImageURL); err != nil { http.Error(w, err.Error(), 500); return }
-            out = append(out, n)
-        }
         writeJSON(w, out)
     case http.MethodPost:
         var n News
@@ -72,31 +46,31 @@ func adminNewsHandler(w http.ResponseWriter, r *http.Request) {
         if strings.TrimSpace(n.PublishedAt) == "" {
             n.PublishedAt = time.Now().Format("2006-01-02")
         }
-        res, err := newsDB.Exec("INSERT INTO news (title, short_text, full_text, published_at, image_url) VALUES (?,?,?,?,?)", n.Title, n.ShortText, n.FullText, n.PublishedAt, strings.TrimSpace(n.ImageURL))
-        if err != nil { http.Error(w, err.Error(), 500); return }
-        id, _ := res.LastInsertId()
-        writeJSON(w, map[string]any{"id": id, "status": "ok"})
+        n.ImageURL = strings.TrimSpace(n.ImageURL)
+        if err := st.Content.CreateNews(&n); err != nil { http.Error(w, err.Error(), 500); return }
+        reindex(newsDoc(n))
+        writeJSON(w, map[string]any{"id": n.ID, "status": "ok"})
     case http.MethodPatch:
         var n News
         if err := json.NewDecoder(r.Body).Decode(&n); err != nil { http.Error(w, err.Error(), 400); return }
         if n.ID == 0 { http.Error(w, "id required", 400); return }
-        fields := []string{}
-        args := []any{}
-        if strings.TrimSpace(n.Title) != "" { fields = append(fields, "title=?"); args = append(args, strings.TrimSpace(n.Title)) }
+        cur, err := st.Content.GetNews(n.ID)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if strings.TrimSpace(n.Title) != "" { cur.Title = strings.TrimSpace(n.Title) }
         // allow clearing/overwriting text fields
-        if n.ShortText != "" || n.ShortText == "" { fields = append(fields, "short_text=?"); args = append(args, n.ShortText) }
-        if n.FullText != "" || n.FullText == "" { fields = append(fields, "full_text=?"); args = append(args, n.FullText) }
-        if strings.TrimSpace(n.PublishedAt) != "" { fields = append(fields, "published_at=?"); args = append(args, strings.TrimSpace(n.PublishedAt)) }
-        if n.ImageURL != "" || n.ImageURL == "" { fields = append(fields, "image_url=?"); args = append(args, strings.TrimSpace(n.ImageURL)) }
-        if len(fields) == 0 { writeJSON(w, map[string]string{"status":"ok"}); return }
-        args = append(args, n.ID)
-        q := "UPDATE news SET " + strings.Join(fields, ",") + " WHERE id=?"
-        if _, err := newsDB.Exec(q, args...); err != nil { http.Error(w, err.Error(), 500); return }
+        cur.ShortText = n.ShortText
+        cur.FullText = n.FullText
+        if strings.TrimSpace(n.PublishedAt) != "" { cur.PublishedAt = strings.TrimSpace(n.PublishedAt) }
+        cur.ImageURL = strings.TrimSpace(n.ImageURL)
+        if err := st.Content.UpdateNews(cur); err != nil { http.Error(w, err.Error(), 500); return }
+        reindex(newsDoc(cur))
         writeJSON(w, map[string]string{"status":"ok"})
     case http.MethodDelete:
-        idStr := r.URL.Query().Get("id")
-        if idStr == "" { http.Error(w, "id required", 400); return }
-        if _, err := newsDB.Exec("DELETE FROM news WHERE id=?", idStr); err != nil { http.Error(w, err.Error(), 500); return }
+        id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if id == 0 { http.Error(w, "id required", 400); return }
+        if err := st.Content.DeleteNews(id); err != nil { http.Error(w, err.Error(), 500); return }
+        unindex(store.EntityNews, id)
         writeJSON(w, map[string]string{"status":"ok"})
     default:
         http.Error(w, "method not allowed", 405)
@@ -116,10 +90,8 @@ func handleNewsPublic(w http.ResponseWriter, r *http.Request) {
         http.Error(w, "invalid id", http.StatusBadRequest)
         return
     }
-    var n News
-    err = newsDB.QueryRow("SELECT id, title, short_text, full_text, published_at, COALESCE(image_url,'') FROM news WHERE id=?", id).
-        Scan(&n.ID, &n.Title, &n.ShortText, &n.FullText, &n.PublishedAt, &n.ImageURL)
-    if err == sql.ErrNoRows {
+    n, err := st.Content.GetNews(id)
+    if err == store.ErrNotFound {
         http.NotFound(w, r)
         return
     }
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "fmt"
+    "log"
+    "strings"
+
+    "metal-main/back/store"
+)
+
+// statusEvent is an order status change with the customer's contacts
+type statusEvent struct {
+    Kind    string // store.KindOrder / store.KindService
+    OrderID int64
+    Name    string
+    Phone   string
+    Email   string
+    From    string
+    To      string
+    Total   float64
+}
+
+func (ev statusEvent) title() string {
+    if ev.Kind == store.KindService { return fmt.Sprintf("Заявка №%d", ev.OrderID) }
+    return fmt.Sprintf("Заказ №%d", ev.OrderID)
+}
+
+// Notifier passes on that an order moved to a new status
+type Notifier interface {
+    NotifyStatus(ev statusEvent) error
+}
+
+// notifiers fans one event out to every configured channel
+type notifiers []Notifier
+
+func (ns notifiers) NotifyStatus(ev statusEvent) error {
+    var errs []string
+    for _, n := range ns {
+        if err := n.NotifyStatus(ev); err != nil { errs = append(errs, err.Error()) }
+    }
+    if len(errs) > 0 { return fmt.Errorf("notify: %s", strings.Join(errs, "; ")) }
+    return nil
+}
+
+// telegramNotifier alerts staff, not the customer: it posts to the shop's own chat, since no
+// customer has a Telegram chat on file. Customers are notified by emailNotifier only; a manager
+// calls those without an email address using the phone in this message.
+type telegramNotifier struct{}
+
+func (telegramNotifier) NotifyStatus(ev statusEvent) error {
+    msg := fmt.Sprintf("📦 %s: %s → %s", ev.title(), statusLabel(ev.From), statusLabel(ev.To))
+    if ev.Name != "" { msg += "\nКлиент: " + ev.Name }
+    if ev.Phone != "" { msg += "\nТелефон: " + ev.Phone }
+    if ev.Email != "" { msg += "\nEmail: " + ev.Email }
+    sendTelegram(msg)
+    return nil
+}
+
+// emailNotifier writes to the customer when the order has an email address
+type emailNotifier struct{ mailer Mailer }
+
+func (n emailNotifier) NotifyStatus(ev statusEvent) error {
+    if ev.Email == "" || !strings.Contains(ev.Email, "@") { return nil }
+    subject := fmt.Sprintf("%s: %s", ev.title(), statusLabel(ev.To))
+    var b strings.Builder
+    if ev.Name != "" { fmt.Fprintf(&b, "Здравствуйте, %s!\n\n", ev.Name) } else { b.WriteString("Здравствуйте!\n\n") }
+    fmt.Fprintf(&b, "Статус: %s.\n", statusLabel(ev.To))
+    if ev.Total > 0 { fmt.Fprintf(&b, "Сумма: %.2f ₽\n", ev.Total) }
+    b.WriteString("\nЕсли у вас есть вопросы, ответьте на это письмо или позвоните нам.\n")
+    return n.mailer.Send(ev.Email, subject, b.String())
+}
+
+// orderNotifier is set up in main: the staff Telegram chat always, the customer's email when
+// SMTP is configured. Without SMTP customers get no notification at all.
+var orderNotifier Notifier = notifiers{telegramNotifier{}}
+
+func newOrderNotifier(mailer Mailer) Notifier {
+    ns := notifiers{telegramNotifier{}}
+    if mailer != nil { ns = append(ns, emailNotifier{mailer: mailer}) }
+    return ns
+}
+
+// notifyStatus is best-effort: failures are logged, never returned to the admin
+func notifyStatus(ev statusEvent) {
+    if err := orderNotifier.NotifyStatus(ev); err != nil { log.Printf("order %d status notification: %v", ev.OrderID, err) }
+}
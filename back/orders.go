@@ -1,184 +1,160 @@
 package main
 
 import (
-    "database/sql"
     "encoding/json"
     "fmt"
     "net/http"
-    "net/url"
+    "strconv"
     "strings"
-    "time"
+
+    "metal-main/back/store"
 )
 
-// Order represents a service order submitted from services page
-type Order struct {
-    ID        int64     `json:"id"`
-    Service   string    `json:"service"`
-    Name      string    `json:"name"`
-    Phone     string    `json:"phone"`
-    Email     string    `json:"email"`
-    Status    string    `json:"status"` // active/closed
-    CreatedAt time.Time `json:"createdAt"`
+// ServiceOrder represents a service order submitted from services page
+type ServiceOrder = store.ServiceOrder
+
+// Order is a catalog order (header + lines) placed from the item page or the cart
+type Order = store.Order
+
+
+type checkoutItem struct {
+    ItemID string  `json:"item_id"`
+    Qty    float64 `json:"qty"`
+    Unit   string  `json:"unit"` // pcs, m, m2, t or kg; the product's base unit when empty
 }
 
-func createOrder(o *Order) (int64, error) {
-    res, err := db.Exec("INSERT INTO orders (service, name, phone, email, status) VALUES (?,?,?,?,?)", o.Service, o.Name, o.Phone, o.Email, o.Status)
-    if err != nil {
-        return 0, err
-    }
-    return res.LastInsertId()
+// checkoutRequest is the body of both order endpoints. Titles and prices sent by the page
+// are ignored; lines are priced from the products table.
+type checkoutRequest struct {
+    Items   []checkoutItem `json:"items"`
+    Name    string `json:"name"`
+    Phone   string `json:"phone"`
+    Email   string `json:"email"`
+    Address string `json:"address"`
+    Comment string `json:"comment"`
 }
 
-func listOrders() ([]Order, error) {
-    rows, err := db.Query("SELECT id, service, name, phone, email, status, created_at FROM orders ORDER BY created_at DESC")
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-    var out []Order
-    for rows.Next() {
-        var o Order
-        var ts string
-        if err := rows.Scan(&o.ID, &o.Service, &o.Name, &o.Phone, &o.Email, &o.Status, &ts); err != nil {
-            return nil, err
+// placeOrder prices every line and stores the order header with its lines in one transaction.
+// One unknown or out-of-stock item rejects the whole order. A logged in buyer's account supplies
+// a missing phone and the requisites of the company the order is invoiced to. A company order
+// gets the company's payment deferral only while its unpaid deferred orders, this one included,
+// stay within the credit limit; past it the order is placed on prepayment.
+func placeOrder(r *http.Request, in checkoutRequest) (Order, error) {
+    // login + contact enrichment from the account
+    login := strings.TrimSpace(currentUserLogin(r))
+    o := Order{
+        Status:       statusNew,
+        CustomerName: strings.TrimSpace(in.Name),
+        UserLogin:    login,
+        Phone:        strings.TrimSpace(in.Phone),
+        Email:        strings.TrimSpace(in.Email),
+        Address:      strings.TrimSpace(in.Address),
+        Comment:      strings.TrimSpace(in.Comment),
+    }
+    if login != "" {
+        if u, err := st.Users.GetByLogin(login); err == nil {
+            if o.Phone == "" { o.Phone = strings.TrimSpace(u.Phone) }
+            setOrderCompany(&o, u)
         }
-        t, _ := time.Parse("2006-01-02 15:04:05", ts)
-        o.CreatedAt = t
-        out = append(out, o)
     }
-    return out, nil
+    rules, err := currentPriceRules(r)
+    if err != nil { return o, err }
+    err = st.InTx(func(tx *store.Store) error {
+        for _, it := range in.Items {
+            line, err := priceLine(tx.Products, rules, it.ItemID, it.Qty, it.Unit)
+            if err != nil { return err }
+            q := line.Quote
+            ol := store.OrderLine{ItemID: strconv.FormatInt(line.Product.ID, 10), Title: line.Title, Qty: q.Qty, Unit: q.Unit, WeightKg: q.WeightKg, Price: q.UnitPrice, Total: q.Total}
+            if q.Rule != nil { ol.ListPrice, ol.PriceRuleID, ol.PriceRule = q.ListPrice, q.Rule.ID, q.Rule.Name }
+            o.Lines = append(o.Lines, ol)
+        }
+        if o.PaymentDays > 0 {
+            ok, err := withinCreditLimit(tx, o)
+            if err != nil { return err }
+            if !ok { o.PaymentDays = 0 }
+        }
+        return tx.Orders.Create(&o)
+    })
+    return o, err
 }
 
-func updateOrderStatus(id int64, status string) error {
-    _, err := db.Exec("UPDATE orders SET status=? WHERE id=?", status, id)
-    return err
+// unpaidStatuses are the statuses of an order that has not been paid yet
+var unpaidStatuses = []string{statusNew, statusConfirmed, statusInvoiced}
+
+// withinCreditLimit reports whether o fits the credit limit of its company next to the company's
+// unpaid deferred orders
+func withinCreditLimit(tx *store.Store, o Order) (bool, error) {
+    c, err := tx.Companies.Get(o.CompanyID)
+    if err == store.ErrNotFound { return false, nil }
+    if err != nil { return false, err }
+    used, err := tx.Orders.CreditUsed(o.CompanyID, unpaidStatuses)
+    if err != nil { return false, err }
+    total := 0.0
+    for _, l := range o.Lines { total += l.Total }
+    return used+total <= c.CreditLimit, nil
 }
 
-// --- Quick item orders (from catalog item page) ---
-type ItemOrder struct {
-    ID        int64   `json:"id"`
-    ItemID    string  `json:"item_id"`
-    Title     string  `json:"title"`
-    Qty       int     `json:"qty"`
-    Price     float64 `json:"price"`
-    Total     float64 `json:"total"`
-    Phone     string  `json:"phone"`
-    UserLogin string  `json:"user_login"`
-    Status    string  `json:"status"`
-    CreatedAt string  `json:"created_at"`
+// orderMessage formats an order for the Telegram notification
+func orderMessage(heading string, o Order) string {
+    var b strings.Builder
+    b.WriteString(heading); b.WriteString(fmt.Sprintf(" №%d\n", o.ID))
+    if o.CustomerName != "" { b.WriteString("Имя: "); b.WriteString(o.CustomerName); b.WriteString("\n") }
+    if o.UserLogin != "" { b.WriteString("Пользователь: "); b.WriteString(o.UserLogin); b.WriteString("\n") }
+    if o.CompanyName != "" {
+        b.WriteString("Компания: "); b.WriteString(o.CompanyName)
+        if o.CompanyINN != "" { b.WriteString(", ИНН "); b.WriteString(o.CompanyINN) }
+        if o.PaymentDays > 0 { b.WriteString(fmt.Sprintf(", отсрочка %d дн.", o.PaymentDays)) }
+        b.WriteString("\n")
+    }
+    if o.Phone != "" { b.WriteString("Телефон: "); b.WriteString(o.Phone); b.WriteString("\n") }
+    if o.Email != "" { b.WriteString("Email: "); b.WriteString(o.Email); b.WriteString("\n") }
+    if o.Address != "" { b.WriteString("Адрес: "); b.WriteString(o.Address); b.WriteString("\n") }
+    if o.Comment != "" { b.WriteString("Комментарий: "); b.WriteString(o.Comment); b.WriteString("\n") }
+    for _, l := range o.Lines {
+        b.WriteString("• "); b.WriteString(l.Title); b.WriteString(" — "); b.WriteString(fmt.Sprintf("%s — %.2f ₽", formatQty(l.Qty, l.Unit), l.Total))
+        if l.PriceRule != "" { b.WriteString(" (скидка: "); b.WriteString(l.PriceRule); b.WriteString(")") }
+        b.WriteString("\n")
+    }
+    b.WriteString("Итого: "); b.WriteString(fmt.Sprintf("%.2f ₽", o.Total))
+    return b.String()
 }
 
+// One-click order of a single catalog item
 func handleCreateItemOrder(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
     var p struct {
-        ItemID string  `json:"item_id"`
-        Title  string  `json:"title"`
-        Qty    int     `json:"qty"`
-        Price  float64 `json:"price"`
-        Phone  string  `json:"phone"`
+        checkoutRequest
+        checkoutItem
     }
     if err := json.NewDecoder(r.Body).Decode(&p); err != nil { http.Error(w, "bad json", 400); return }
-    if p.Qty <= 0 { p.Qty = 1 }
-    total := float64(p.Qty) * p.Price
-    // read user login from cookie if present
-    var login string
-    if c, err := r.Cookie(userSessionCookieName); err == nil && c.Value != "" {
-        login, _ = url.QueryUnescape(c.Value)
-    }
-    // If phone is not provided but user is authenticated, try to read phone from users table
-    phone := strings.TrimSpace(p.Phone)
-    if phone == "" && strings.TrimSpace(login) != "" {
-        var ph sql.NullString
-        if err := userDB.QueryRow("SELECT phone FROM users WHERE login=?", strings.TrimSpace(login)).Scan(&ph); err == nil {
-            if ph.Valid { phone = strings.TrimSpace(ph.String) }
-        }
-    }
-    res, err := itemOrdersDB.Exec("INSERT INTO item_orders(item_id,title,qty,price,total,phone,user_login) VALUES(?,?,?,?,?,?,?)", strings.TrimSpace(p.ItemID), strings.TrimSpace(p.Title), p.Qty, p.Price, total, phone, strings.TrimSpace(login))
-    if err != nil { http.Error(w, err.Error(), 500); return }
-    id, _ := res.LastInsertId()
-    // Telegram notify
-    msg := fmt.Sprintf("🛒 Новый заказ одним кликом\nТовар: %s\nКол-во: %d\nСумма: %.2f", p.Title, p.Qty, total)
-    if strings.TrimSpace(login) != "" { msg += "\nПользователь: " + strings.TrimSpace(login) }
-    if phone != "" { msg += "\nТелефон: " + phone }
-    go sendTelegram(msg)
-    writeJSON(w, map[string]any{"id": id, "status":"ok"})
+    in := p.checkoutRequest
+    in.Items = []checkoutItem{p.checkoutItem}
+    o, err := placeOrder(r, in)
+    if err != nil { writePricingError(w, err); return }
+    go sendTelegram(orderMessage("🛒 Новый заказ одним кликом", o))
+    writeJSON(w, map[string]any{"id": o.ID, "status":"ok", "total": o.Total, "order": o})
+}
+
+// Batch: the cart checkout becomes one order with a line per cart item
+func handleCreateItemOrderBatch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    var in checkoutRequest
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if len(in.Items) == 0 { http.Error(w, "empty items", 400); return }
+    o, err := placeOrder(r, in)
+    if err != nil { writePricingError(w, err); return }
+    go sendTelegram(orderMessage("🛒 Новый заказ из корзины", o))
+    writeJSON(w, map[string]any{"id": o.ID, "status":"ok", "total": o.Total, "order": o})
 }
 
+// Admin: catalog orders with their lines, newest first
 func adminItemOrdersList(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
-    rows, err := itemOrdersDB.Query("SELECT id,item_id,title,qty,price,total,phone,user_login,status,created_at FROM item_orders ORDER BY created_at DESC")
+    out, err := st.Orders.List()
     if err != nil { http.Error(w, err.Error(), 500); return }
-    defer rows.Close()
-    var out []ItemOrder
-    for rows.Next() {
-        var o ItemOrder
-        if err := rows.Scan(&o.ID,&o.ItemID,&o.Title,&o.Qty,&o.Price,&o.Total,&o.Phone,&o.UserLogin,&o.Status,&o.CreatedAt); err == nil { out = append(out, o) }
-    }
     writeJSON(w, out)
 }
 
-func adminItemOrdersStatus(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPatch { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
-    var p struct{ ID int64 `json:"id"`; Status string `json:"status"` }
-    if err := json.NewDecoder(r.Body).Decode(&p); err != nil { http.Error(w, "bad json", 400); return }
-    if p.ID == 0 || strings.TrimSpace(p.Status)=="" { http.Error(w, "id and status required", 400); return }
-    _, err := itemOrdersDB.Exec("UPDATE item_orders SET status=? WHERE id=?", p.Status, p.ID)
-    if err != nil { http.Error(w, err.Error(), 500); return }
-    writeJSON(w, map[string]string{"status":"ok"})
-}
-
-// Batch: create multiple item orders and send one Telegram message
-func handleCreateItemOrderBatch(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
-    var payload struct {
-        Items []struct{
-            ItemID string  `json:"item_id"`
-            Title  string  `json:"title"`
-            Qty    int     `json:"qty"`
-            Price  float64 `json:"price"`
-        } `json:"items"`
-        Phone string `json:"phone"`
-    }
-    if err := json.NewDecoder(r.Body).Decode(&payload); err != nil { http.Error(w, "bad json", 400); return }
-    if len(payload.Items) == 0 { http.Error(w, "empty items", 400); return }
-    // login + phone enrichment
-    var login string
-    if c, err := r.Cookie(userSessionCookieName); err == nil && c.Value != "" { login, _ = url.QueryUnescape(c.Value) }
-    phone := strings.TrimSpace(payload.Phone)
-    if phone == "" && strings.TrimSpace(login) != "" {
-        var ph sql.NullString
-        if err := userDB.QueryRow("SELECT phone FROM users WHERE login=?", strings.TrimSpace(login)).Scan(&ph); err == nil {
-            if ph.Valid { phone = strings.TrimSpace(ph.String) }
-        }
-    }
-    // insert all
-    tx, err := itemOrdersDB.Begin()
-    if err != nil { http.Error(w, err.Error(), 500); return }
-    for _, it := range payload.Items {
-        qty := it.Qty; if qty <= 0 { qty = 1 }
-        total := float64(qty) * it.Price
-        if _, err := tx.Exec("INSERT INTO item_orders(item_id,title,qty,price,total,phone,user_login) VALUES(?,?,?,?,?,?,?)", strings.TrimSpace(it.ItemID), strings.TrimSpace(it.Title), qty, it.Price, total, phone, strings.TrimSpace(login)); err != nil {
-            tx.Rollback(); http.Error(w, err.Error(), 500); return
-        }
-    }
-    if err := tx.Commit(); err != nil { http.Error(w, err.Error(), 500); return }
-    // Telegram single message
-    var b strings.Builder
-    b.WriteString("🛒 Новый заказ из корзины\n")
-    if strings.TrimSpace(login) != "" { b.WriteString("Пользователь: "); b.WriteString(strings.TrimSpace(login)); b.WriteString("\n") }
-    if phone != "" { b.WriteString("Телефон: "); b.WriteString(phone); b.WriteString("\n") }
-    var totalSum float64
-    for _, it := range payload.Items {
-        qty := it.Qty; if qty <= 0 { qty = 1 }
-        itemTotal := float64(qty) * it.Price
-        totalSum += itemTotal
-        b.WriteString("• "); b.WriteString(strings.TrimSpace(it.Title)); b.WriteString(" — "); b.WriteString(fmt.Sprintf("%d шт. — %.2f ₽", qty, itemTotal)); b.WriteString("\n")
-    }
-    b.WriteString("Итого: "); b.WriteString(fmt.Sprintf("%.2f ₽", totalSum))
-    go sendTelegram(b.String())
-    writeJSON(w, map[string]string{"status":"ok"})
-}
-
 // Public orders endpoint - accepts new orders
 func ordersHandler(w http.ResponseWriter, r *http.Request) {
     switch r.Method {
@@ -193,33 +169,33 @@ func ordersHandler(w http.ResponseWriter, r *http.Request) {
             http.Error(w, err.Error(), http.StatusBadRequest)
             return
         }
-        o := &Order{
-            Service: payload.Service,
-            Name:    strings.TrimSpace(payload.Name),
-            Phone:   strings.TrimSpace(payload.Phone),
-            Email:   strings.TrimSpace(payload.Email),
-            Status:  "active",
+        o := ServiceOrder{
+            Service:   payload.Service,
+            Name:      strings.TrimSpace(payload.Name),
+            Phone:     strings.TrimSpace(payload.Phone),
+            Email:     strings.TrimSpace(payload.Email),
+            UserLogin: currentUserLogin(r),
+            Status:    statusNew,
         }
-        id, err := createOrder(o)
-        if err != nil {
+        if err := st.Orders.CreateServiceOrder(&o); err != nil {
             http.Error(w, err.Error(), http.StatusInternalServerError)
             return
         }
         // Telegram notify (best-effort)
         go sendTelegram(fmt.Sprintf("🛠 Новая заявка: %s\nИмя: %s\nТелефон: %s\nEmail: %s", o.Service, o.Name, o.Phone, o.Email))
-        writeJSON(w, map[string]any{"id": id, "status": "ok"})
+        writeJSON(w, map[string]any{"id": o.ID, "status": "ok"})
     default:
         http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
     }
 }
 
-// Admin list and status update
+// Admin list of service requests
 func adminListOrders(w http.ResponseWriter, r *http.Request) {
     if r.Method != http.MethodGet {
         http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
         return
     }
-    items, err := listOrders()
+    items, err := st.Orders.ListServiceOrders()
     if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
@@ -227,28 +203,4 @@ func adminListOrders(w http.ResponseWriter, r *http.Request) {
     writeJSON(w, items)
 }
 
-func adminUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPatch {
-        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-        return
-    }
-    var payload struct {
-        ID     int64  `json:"id"`
-        Status string `json:"status"`
-    }
-    if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
-        return
-    }
-    if payload.Status != "active" && payload.Status != "closed" {
-        http.Error(w, "invalid status", http.StatusBadRequest)
-        return
-    }
-    if err := updateOrderStatus(payload.ID, payload.Status); err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-    writeJSON(w, map[string]string{"status": "ok"})
-}
-
 
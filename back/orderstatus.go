@@ -0,0 +1,143 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "metal-main/back/store"
+)
+
+// Order lifecycle shared by catalog orders and service requests
+const (
+    statusNew       = "new"
+    statusConfirmed = "confirmed"
+    statusInvoiced  = "invoiced"
+    statusPaid      = "paid"
+    statusShipped   = "shipped"
+    statusDelivered = "delivered"
+    statusCancelled = "cancelled"
+)
+
+// orderStatuses lists the lifecycle in display order with the moves allowed from each status
+var orderStatuses = []struct {
+    Code  string   `json:"code"`
+    Label string   `json:"label"`
+    Next  []string `json:"next"`
+}{
+    {statusNew, "Новый", []string{statusConfirmed, statusCancelled}},
+    {statusConfirmed, "Подтверждён", []string{statusInvoiced, statusCancelled}},
+    {statusInvoiced, "Выставлен счёт", []string{statusPaid, statusCancelled}},
+    {statusPaid, "Оплачен", []string{statusShipped, statusCancelled}},
+    {statusShipped, "Отгружен", []string{statusDelivered}},
+    {statusDelivered, "Выполнен", nil},
+    {statusCancelled, "Отменён", nil},
+}
+
+var (
+    errUnknownStatus = errors.New("unknown status")
+    errBadTransition = errors.New("status change not allowed")
+)
+
+func statusLabel(code string) string {
+    for _, s := range orderStatuses {
+        if s.Code == code { return s.Label }
+    }
+    return code
+}
+
+// nextStatuses returns the statuses an order in status from may move to
+func nextStatuses(from string) []string {
+    for _, s := range orderStatuses {
+        if s.Code == from { return s.Next }
+    }
+    return nil
+}
+
+func checkTransition(from, to string) error {
+    known := false
+    for _, s := range orderStatuses {
+        if s.Code == to { known = true; break }
+    }
+    if !known { return fmt.Errorf("%w: %q", errUnknownStatus, to) }
+    for _, n := range nextStatuses(from) {
+        if n == to { return nil }
+    }
+    return fmt.Errorf("%w: %s → %s", errBadTransition, from, to)
+}
+
+// changeOrderStatus validates and applies a status change of a catalog order (store.KindOrder) or
+// service request (store.KindService), records it in order_status_history and returns the event
+// for the customer notification
+func changeOrderStatus(kind string, id int64, to, admin string) (statusEvent, error) {
+    ev := statusEvent{Kind: kind, OrderID: id, To: to}
+    err := st.InTx(func(tx *store.Store) error {
+        switch kind {
+        case store.KindOrder:
+            o, err := tx.Orders.Get(id)
+            if err != nil { return err }
+            ev.From, ev.Name, ev.Phone, ev.Email, ev.Total = o.Status, o.CustomerName, o.Phone, o.Email, o.Total
+            if ev.Email == "" && o.UserLogin != "" {
+                if u, err := tx.Users.GetByLogin(o.UserLogin); err == nil { ev.Email = u.Email }
+            }
+            if err := checkTransition(ev.From, to); err != nil { return err }
+            if err := tx.Orders.SetStatus(id, to); err != nil { return err }
+        case store.KindService:
+            o, err := tx.Orders.GetServiceOrder(id)
+            if err != nil { return err }
+            ev.From, ev.Name, ev.Phone, ev.Email = o.Status, o.Name, o.Phone, o.Email
+            if err := checkTransition(ev.From, to); err != nil { return err }
+            if err := tx.Orders.SetServiceOrderStatus(id, to); err != nil { return err }
+        default:
+            return fmt.Errorf("unknown order kind %q", kind)
+        }
+        return tx.Orders.AddStatusChange(&store.StatusChange{OrderKind: kind, OrderID: id, From: ev.From, To: to, ChangedBy: admin})
+    })
+    return ev, err
+}
+
+// adminSetStatus is the shared PATCH {id, status} handler of both admin order lists
+func adminSetStatus(kind string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPatch { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+        var p struct{ ID int64 `json:"id"`; Status string `json:"status"` }
+        if err := json.NewDecoder(r.Body).Decode(&p); err != nil { http.Error(w, "bad json", 400); return }
+        p.Status = strings.TrimSpace(p.Status)
+        if p.ID == 0 || p.Status == "" { http.Error(w, "id and status required", 400); return }
+        ev, err := changeOrderStatus(kind, p.ID, p.Status, currentAdminLogin(r))
+        switch {
+        case err == nil:
+        case errors.Is(err, store.ErrNotFound):
+            http.Error(w, "not found", http.StatusNotFound); return
+        case errors.Is(err, errUnknownStatus):
+            http.Error(w, err.Error(), http.StatusBadRequest); return
+        case errors.Is(err, errBadTransition):
+            http.Error(w, err.Error(), http.StatusConflict); return
+        default:
+            http.Error(w, err.Error(), 500); return
+        }
+        go notifyStatus(ev)
+        writeJSON(w, map[string]any{"status":"ok", "order_status": ev.To, "next": nextStatuses(ev.To)})
+    }
+}
+
+// Admin: lifecycle description for the order screens
+func adminOrderStatusesHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    writeJSON(w, orderStatuses)
+}
+
+// Admin: status history of one order, ?kind=order|service&id=N
+func adminOrderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    kind := strings.TrimSpace(r.URL.Query().Get("kind"))
+    if kind == "" { kind = store.KindOrder }
+    id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+    if id == 0 { http.Error(w, "id required", 400); return }
+    out, err := st.Orders.StatusHistory(kind, id)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    writeJSON(w, out)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+    "errors"
+    "path/filepath"
+    "testing"
+
+    "metal-main/back/store"
+)
+
+// useTestStore points the package store at a fresh, fully migrated database for the test
+func useTestStore(t *testing.T) {
+    t.Helper()
+    s, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+    if err != nil { t.Fatal(err) }
+    if _, err := s.Migrate(); err != nil { s.Close(); t.Fatal(err) }
+    saved := st
+    st = s
+    t.Cleanup(func() { st = saved; s.Close() })
+}
+
+func TestCheckTransition(t *testing.T) {
+    cases := []struct {
+        from, to string
+        want     error
+    }{
+        {statusNew, statusConfirmed, nil},
+        {statusConfirmed, statusInvoiced, nil},
+        {statusInvoiced, statusPaid, nil},
+        {statusPaid, statusShipped, nil},
+        {statusShipped, statusDelivered, nil},
+        {statusNew, statusCancelled, nil},
+        {statusPaid, statusCancelled, nil},
+        // no skipping ahead or going back
+        {statusNew, statusPaid, errBadTransition},
+        {statusShipped, statusConfirmed, errBadTransition},
+        // a shipped order can only be delivered
+        {statusShipped, statusCancelled, errBadTransition},
+        // terminal states
+        {statusDelivered, statusCancelled, errBadTransition},
+        {statusCancelled, statusNew, errBadTransition},
+        {statusCancelled, statusConfirmed, errBadTransition},
+        // a move to the same status is not a change
+        {statusNew, statusNew, errBadTransition},
+        {statusDelivered, statusDelivered, errBadTransition},
+        {statusNew, "closed", errUnknownStatus},
+        {"Ожидает подтверждения", statusConfirmed, errBadTransition},
+    }
+    for _, c := range cases {
+        if err := checkTransition(c.from, c.to); !errors.Is(err, c.want) { t.Errorf("%s → %s: err = %v, want %v", c.from, c.to, err, c.want) }
+    }
+}
+
+func TestChangeOrderStatus(t *testing.T) {
+    useTestStore(t)
+    if err := st.Users.Create(&store.User{Login: "ivan", PasswordHash: "x", Email: "ivan@example.ru"}); err != nil { t.Fatal(err) }
+    o := store.Order{CustomerName: "Иван", UserLogin: "ivan", Phone: "+7 999", Status: statusNew, Lines: []store.OrderLine{{ItemID: "1", Title: "Арматура", Qty: 2, Price: 100, Total: 200}}}
+    if err := st.InTx(func(tx *store.Store) error { return tx.Orders.Create(&o) }); err != nil { t.Fatal(err) }
+
+    ev, err := changeOrderStatus(store.KindOrder, o.ID, statusConfirmed, "manager")
+    if err != nil { t.Fatal(err) }
+    // the address of the account stands in for an order placed without one
+    if ev.From != statusNew || ev.To != statusConfirmed || ev.Email != "ivan@example.ru" || ev.Total != 200 { t.Errorf("event = %+v", ev) }
+    got, err := st.Orders.Get(o.ID)
+    if err != nil { t.Fatal(err) }
+    if got.Status != statusConfirmed { t.Errorf("status = %q, want %q", got.Status, statusConfirmed) }
+
+    // a refused move changes nothing and leaves no history
+    if _, err := changeOrderStatus(store.KindOrder, o.ID, statusShipped, "manager"); !errors.Is(err, errBadTransition) { t.Errorf("confirmed → shipped: err = %v", err) }
+    if _, err := changeOrderStatus(store.KindOrder, o.ID+1, statusConfirmed, "manager"); !errors.Is(err, store.ErrNotFound) { t.Errorf("missing order: err = %v", err) }
+    hist, err := st.Orders.StatusHistory(store.KindOrder, o.ID)
+    if err != nil { t.Fatal(err) }
+    if len(hist) != 1 { t.Fatalf("%d history rows, want 1: %+v", len(hist), hist) }
+    if h := hist[0]; h.From != statusNew || h.To != statusConfirmed || h.ChangedBy != "manager" || h.ChangedAt == "" { t.Errorf("history = %+v", h) }
+
+    // service requests share the lifecycle but keep their own history
+    so := store.ServiceOrder{Service: "Резка", Name: "Пётр", Phone: "+7 111", Status: statusNew}
+    if err := st.Orders.CreateServiceOrder(&so); err != nil { t.Fatal(err) }
+    if _, err := changeOrderStatus(store.KindService, so.ID, statusCancelled, "admin"); err != nil { t.Fatal(err) }
+    if _, err := changeOrderStatus(store.KindService, so.ID, statusConfirmed, "admin"); !errors.Is(err, errBadTransition) { t.Errorf("cancelled → confirmed: err = %v", err) }
+    if hist, _ := st.Orders.StatusHistory(store.KindService, so.ID); len(hist) != 1 || hist[0].ChangedBy != "admin" { t.Errorf("service history = %+v", hist) }
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+    "bytes"
+    "html/template"
+    "log"
+    "net/http"
+    "net/url"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "metal-main/back/store"
+)
+
+// Category and item pages are rendered server-side from the templates in front/HTML, so crawlers
+// get the products, prices, breadcrumbs and schema.org data without running the page scripts.
+// The scripts then take over and redraw the listing from /api/catalog/products, which builds its
+// filter through the same catalogFilter.
+
+// catalogPageSize is the number of products rendered into a category page; further pages are
+// reachable through ?page= links
+const catalogPageSize = 24
+
+var pageFuncs = template.FuncMap{"price": formatPrice, "unit": func(u string) string { return unitLabels[u] }}
+
+// formatPrice prints a unit price the way the page scripts do
+func formatPrice(v float64) string {
+    if v <= 0 { return "Цена по запросу" }
+    return strconv.FormatFloat(v, 'f', -1, 64) + " ₽"
+}
+
+// renderPage executes front/HTML/name with data. Templates are parsed per request like the static
+// pages are read, so edits to front/ show without a restart.
+func renderPage(w http.ResponseWriter, name string, status int, data any) {
+    t, err := template.New(name).Funcs(pageFuncs).ParseFiles(filepath.Join(frontDirPath, "HTML", name))
+    if err != nil {
+        log.Printf("parse %s: %v", name, err)
+        http.Error(w, "not found", http.StatusNotFound)
+        return
+    }
+    // render into a buffer so a template error still yields a clean 500
+    var buf bytes.Buffer
+    if err := t.Execute(&buf, data); err != nil {
+        log.Printf("render %s: %v", name, err)
+        http.Error(w, "internal error", http.StatusInternalServerError)
+        return
+    }
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(status)
+    _, _ = w.Write(buf.Bytes())
+}
+
+// catalogPageItem is one product row of a rendered category page
+type catalogPageItem struct {
+    Title   string
+    URL     string
+    Image   string
+    Price   float64
+    InStock bool
+}
+
+// catalogPage is the data of catalog_list.html
+type catalogPage struct {
+    SEOTitle        string
+    SEODescription  string
+    Canonical       string
+    Title           string
+    CategorySlug    string
+    SubcategorySlug string
+    Subcategories   []map[string]string
+    Breadcrumbs     []breadcrumb
+    Items           []catalogPageItem
+    Total           int
+    PrevURL         string
+    NextURL         string
+    JSONLD          []any
+}
+
+// itemPage is the data of catalog_item.html
+type itemPage struct {
+    Product        productDetail
+    SEOTitle       string
+    SEODescription string
+    Canonical      string
+    TypeTitle      string
+    SubTitle       string
+    PriceSeries    []pricePoint // empty unless PUBLIC_PRICE_HISTORY is on and the price changed
+    JSONLD         []any
+}
+
+// renderCatalogPage renders the listing of cat, narrowed to the subcategory sub when it is set
+func renderCatalogPage(w http.ResponseWriter, r *http.Request, cat, sub store.Category) {
+    // the page heading stays the category; SEO fields come from the most specific level
+    seo := cat
+    base := "/catalog/" + cat.Slug + "/"
+    crumbs := []breadcrumb{{Title: "Каталог", URL: "/catalog/"}, {Title: cat.Title, URL: base}}
+    if sub.ID != 0 {
+        seo = sub
+        base += sub.Slug + "/"
+        crumbs = append(crumbs, breadcrumb{Title: sub.Title, URL: base})
+    }
+    q := r.URL.Query()
+    f, _, msg, err := catalogFilter(cat.Slug, sub.Slug, q)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    if msg != "" { http.Error(w, msg, http.StatusBadRequest); return }
+    page, _ := strconv.Atoi(q.Get("page"))
+    if page <= 0 { page = 1 }
+    f.Limit, f.Offset = catalogPageSize, (page-1)*catalogPageSize
+    rows, total, err := st.Products.Filter(f)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+
+    d := catalogPage{
+        SEOTitle:        seo.SEOTitle,
+        SEODescription:  seo.SEODescription,
+        Canonical:       siteURL() + base,
+        Title:           cat.Title,
+        CategorySlug:    cat.Slug,
+        SubcategorySlug: sub.Slug,
+        Subcategories:   []map[string]string{},
+        Breadcrumbs:     crumbs,
+        Items:           make([]catalogPageItem, 0, len(rows)),
+        Total:           total,
+    }
+    if d.SEOTitle == "" { d.SEOTitle = seo.Title + " — каталог" }
+    if d.SEODescription == "" { d.SEODescription = seo.Title }
+    for _, c := range catalogTree().children[cat.ID] {
+        d.Subcategories = append(d.Subcategories, map[string]string{"slug": c.Slug, "label": c.Title, "image": c.Image})
+    }
+    pageURL := func(n int) string {
+        v := url.Values{}
+        for k, vs := range q { v[k] = vs }
+        v.Del("page")
+        if n > 1 { v.Set("page", strconv.Itoa(n)) }
+        if len(v) == 0 { return base }
+        return base + "?" + v.Encode()
+    }
+    if page > 1 {
+        d.Canonical += "?page=" + strconv.Itoa(page)
+        d.PrevURL = pageURL(page - 1)
+    }
+    if page*catalogPageSize < total { d.NextURL = pageURL(page + 1) }
+
+    list := []any{}
+    for i, p := range rows {
+        it := catalogPageItem{Title: productTitle(p), URL: productURL(p), Image: p.Img, Price: unitPrice(p), InStock: p.InStock}
+        d.Items = append(d.Items, it)
+        list = append(list, map[string]any{"@type": "ListItem", "position": f.Offset + i + 1, "item": productLD(p)})
+    }
+    d.JSONLD = []any{
+        breadcrumbsLD(crumbs),
+        map[string]any{"@context": "https://schema.org", "@type": "ItemList", "numberOfItems": total, "itemListElement": list},
+    }
+    status := http.StatusOK
+    // a page past the end lists nothing and should not be indexed
+    if page > 1 && len(rows) == 0 { status = http.StatusNotFound }
+    renderPage(w, "catalog_list.html", status, d)
+}
+
+// renderItemPage renders the item page of p with the prices the customer's rules give
+func renderItemPage(w http.ResponseWriter, p ProductRow, rules priceRules) {
+    detail, err := buildProductDetail(p, rules)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    d := itemPage{Product: detail, Canonical: siteURL() + detail.URL}
+    if len(detail.Breadcrumbs) > 1 { d.TypeTitle = detail.Breadcrumbs[1].Title }
+    if len(detail.Breadcrumbs) > 2 { d.SubTitle = detail.Breadcrumbs[2].Title }
+    d.SEOTitle = detail.Title
+    if d.TypeTitle != "" { d.SEOTitle += " — " + d.TypeTitle }
+    d.SEODescription = detail.Title
+    if detail.UnitPrice > 0 { d.SEODescription += ", цена " + formatPrice(detail.UnitPrice) }
+    if detail.InStock { d.SEODescription += ", в наличии" }
+    if publicPriceHistory() {
+        if d.PriceSeries, err = priceSeries(p); err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+        if len(d.PriceSeries) < 2 { d.PriceSeries = nil }
+    }
+    crumbs := append(append([]breadcrumb{}, detail.Breadcrumbs...), breadcrumb{Title: detail.Title, URL: detail.URL})
+    product := productLD(p)
+    product["@context"] = "https://schema.org"
+    d.JSONLD = []any{breadcrumbsLD(crumbs), product}
+    renderPage(w, "catalog_item.html", http.StatusOK, d)
+}
+
+// productLD is the schema.org Product of p; the Offer is left out while the price is on request
+func productLD(p ProductRow) map[string]any {
+    ld := map[string]any{
+        "@type": "Product",
+        "name":  productTitle(p),
+        "url":   siteURL() + productURL(p),
+    }
+    if p.Img != "" { ld["image"] = absoluteURL(p.Img) }
+    if p.SKU != "" { ld["sku"] = p.SKU }
+    if price := unitPrice(p); price > 0 {
+        availability := "https://schema.org/OutOfStock"
+        if p.InStock { availability = "https://schema.org/InStock" }
+        ld["offers"] = map[string]any{
+            "@type":         "Offer",
+            "price":         strconv.FormatFloat(roundKop(price), 'f', 2, 64),
+            "priceCurrency": "RUB",
+            "availability":  availability,
+            "url":           siteURL() + productURL(p),
+        }
+    }
+    return ld
+}
+
+// breadcrumbsLD is the schema.org BreadcrumbList of a trail
+func breadcrumbsLD(crumbs []breadcrumb) map[string]any {
+    items := make([]any, 0, len(crumbs))
+    for i, c := range crumbs {
+        items = append(items, map[string]any{"@type": "ListItem", "position": i + 1, "name": c.Title, "item": siteURL() + c.URL})
+    }
+    return map[string]any{"@context": "https://schema.org", "@type": "BreadcrumbList", "itemListElement": items}
+}
+
+// absoluteURL prefixes site paths with the public origin and leaves full URLs alone
+func absoluteURL(u string) string {
+    if strings.HasPrefix(u, "/") { return siteURL() + u }
+    return u
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+    "encoding/json"
+    "log"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "metal-main/back/store"
+)
+
+const resetTokenTTL = time.Hour
+
+// passwordMailer delivers reset links; main falls back to a logMailer when nothing is configured
+var passwordMailer Mailer
+
+// siteURL is the public origin used in emailed links. It comes from SITE_URL rather than the
+// request Host header, which a client could forge to receive someone else's token.
+func siteURL() string {
+    if u := strings.TrimRight(strings.TrimSpace(os.Getenv("SITE_URL")), "/"); u != "" { return u }
+    return "http://localhost:8080"
+}
+
+// sendPasswordReset issues a new token for u and emails the reset link
+func sendPasswordReset(u store.User) error {
+    token, err := newSessionToken()
+    if err != nil { return err }
+    now := time.Now().UTC()
+    err = st.Users.CreateResetToken(store.ResetToken{
+        ID: hashSessionToken(token), UserID: u.ID,
+        CreatedAt: now.Format(store.TimeLayout), ExpiresAt: now.Add(resetTokenTTL).Format(store.TimeLayout),
+    })
+    if err != nil { return err }
+    link := siteURL() + "/front/HTML/password_reset.html?token=" + url.QueryEscape(token)
+    body := "Здравствуйте!\n\nДля вашего аккаунта на сайте Межрегионсталь запрошено восстановление пароля.\n" +
+        "Чтобы задать новый пароль, перейдите по ссылке (действует 1 час):\n" + link +
+        "\n\nЕсли вы не запрашивали восстановление, просто проигнорируйте это письмо."
+    return passwordMailer.Send(u.Email, "Восстановление пароля", body)
+}
+
+// POST /api/password/forgot {email|phone}
+// The answer is the same whether or not the account exists so the endpoint cannot be used to probe for users.
+func passwordForgotHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    var in struct {
+        Email string `json:"email"`
+        Phone string `json:"phone"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    in.Email, in.Phone = strings.TrimSpace(in.Email), strings.TrimSpace(in.Phone)
+    if in.Email == "" && in.Phone == "" { http.Error(w, "email or phone required", 400); return }
+    login := in.Email
+    if login == "" { login = in.Phone }
+    u, err := st.Users.FindByIdentity(login, in.Email, in.Phone)
+    if err == nil && strings.Contains(u.Email, "@") {
+        // delivery runs in the background so response time does not reveal whether the account exists
+        go func() {
+            if err := sendPasswordReset(u); err != nil { log.Printf("password reset for user %d: %v", u.ID, err) }
+        }()
+    } else if err != nil && err != store.ErrNotFound {
+        log.Printf("password reset lookup: %v", err)
+    }
+    writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// POST /api/password/reset {token, password}
+func passwordResetHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    var in struct {
+        Token    string `json:"token"`
+        Password string `json:"password"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if strings.TrimSpace(in.Token) == "" { http.Error(w, "token required", 400); return }
+    if strings.TrimSpace(in.Password) == "" { http.Error(w, "password required", 400); return }
+    hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    var userID int64
+    err = st.InTx(func(tx *store.Store) error {
+        id, err := tx.Users.ConsumeResetToken(hashSessionToken(strings.TrimSpace(in.Token)), time.Now().UTC().Format(store.TimeLayout))
+        if err != nil { return err }
+        userID = id
+        if err := tx.Users.SetPassword(id, string(hash)); err != nil { return err }
+        return tx.Users.DeleteUserSessions(id)
+    })
+    if err == store.ErrNotFound { http.Error(w, "invalid or expired token", 400); return }
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    // a fresh password lifts a lockout caused by the forgotten one
+    if u, err := st.Users.Get(userID); err == nil { loginLockout.reset(lockoutKey("user", u.Login)) }
+    log.Printf("password reset completed for user %d", userID)
+    writeJSON(w, map[string]string{"status": "ok"})
+}
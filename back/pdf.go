@@ -0,0 +1,220 @@
+package main
+
+import (
+    "bytes"
+    "compress/zlib"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// A minimal PDF writer for the sales documents: A4 pages with text in embedded TrueType fonts,
+// lines and rectangles. Positions are in points from the top-left corner of the page, the way the
+// layouts are written; the writer turns them into PDF's bottom-left coordinates. Text is shown
+// by glyph id (Identity-H) with a ToUnicode map, so it can be searched and copied.
+
+const (
+    pdfPageWidth  = 595.28
+    pdfPageHeight = 841.89
+)
+
+// pdfFont is a font of a document with the glyphs its text uses
+type pdfFont struct {
+    tt   *ttFont
+    used map[uint16]rune
+}
+
+// pdfDoc collects the pages of a document
+type pdfDoc struct {
+    title string
+    fonts []*pdfFont
+    pages []*bytes.Buffer
+    page  *bytes.Buffer
+}
+
+// newPDF starts a document; text refers to fonts by their index here
+func newPDF(title string, fonts ...*ttFont) *pdfDoc {
+    d := &pdfDoc{title: title}
+    for _, f := range fonts { d.fonts = append(d.fonts, &pdfFont{tt: f, used: map[uint16]rune{}}) }
+    d.addPage()
+    return d
+}
+
+func (d *pdfDoc) addPage() {
+    d.page = &bytes.Buffer{}
+    d.pages = append(d.pages, d.page)
+}
+
+func pdfNum(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+// textWidth is the width of s in points
+func (d *pdfDoc) textWidth(font int, size float64, s string) float64 {
+    tt := d.fonts[font].tt
+    var w float64
+    for _, r := range s { w += tt.advance(tt.glyph(r)) }
+    return w * size / 1000
+}
+
+// text draws s with its baseline at y
+func (d *pdfDoc) text(x, y float64, font int, size float64, s string) {
+    f := d.fonts[font]
+    var hex strings.Builder
+    for _, r := range s {
+        g := f.tt.glyph(r)
+        if _, ok := f.used[g]; !ok && r <= 0xFFFF { f.used[g] = r }
+        fmt.Fprintf(&hex, "%04X", g)
+    }
+    fmt.Fprintf(d.page, "BT /F%d %s Tf %s %s Td <%s> Tj ET\n", font+1, pdfNum(size), pdfNum(round3(x)), pdfNum(round3(pdfPageHeight-y)), hex.String())
+}
+
+// textRight draws s ending at x
+func (d *pdfDoc) textRight(x, y float64, font int, size float64, s string) {
+    d.text(x-d.textWidth(font, size, s), y, font, size, s)
+}
+
+// wrap splits s into lines no wider than width, breaking at spaces where it can
+func (d *pdfDoc) wrap(font int, size, width float64, s string) []string {
+    var lines []string
+    for _, para := range strings.Split(s, "\n") {
+        line := ""
+        for _, word := range strings.Fields(para) {
+            next := word
+            if line != "" { next = line + " " + word }
+            if line == "" || d.textWidth(font, size, next) <= width { line = next; continue }
+            lines = append(lines, line)
+            line = word
+        }
+        // a word wider than the column is cut where it overflows
+        for line != "" && d.textWidth(font, size, line) > width {
+            runes := []rune(line)
+            n := len(runes) - 1
+            for n > 1 && d.textWidth(font, size, string(runes[:n])) > width { n-- }
+            lines = append(lines, string(runes[:n]))
+            line = string(runes[n:])
+        }
+        lines = append(lines, line)
+    }
+    return lines
+}
+
+// line draws a segment of the given width
+func (d *pdfDoc) line(x1, y1, x2, y2, width float64) {
+    fmt.Fprintf(d.page, "%s w %s %s m %s %s l S\n", pdfNum(width), pdfNum(round3(x1)), pdfNum(round3(pdfPageHeight-y1)), pdfNum(round3(x2)), pdfNum(round3(pdfPageHeight-y2)))
+}
+
+// rect outlines a rectangle whose top-left corner is x, y
+func (d *pdfDoc) rect(x, y, w, h, width float64) {
+    fmt.Fprintf(d.page, "%s w %s %s %s %s re S\n", pdfNum(width), pdfNum(round3(x)), pdfNum(round3(pdfPageHeight-y-h)), pdfNum(round3(w)), pdfNum(round3(h)))
+}
+
+// pdfWriter numbers objects and records their offsets for the cross-reference table
+type pdfWriter struct {
+    buf     bytes.Buffer
+    offsets []int
+}
+
+// reserve allocates an object number to be written later
+func (pw *pdfWriter) reserve() int {
+    pw.offsets = append(pw.offsets, 0)
+    return len(pw.offsets)
+}
+
+func (pw *pdfWriter) object(n int, body string) {
+    pw.offsets[n-1] = pw.buf.Len()
+    fmt.Fprintf(&pw.buf, "%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+// stream writes a Flate-compressed stream; extra goes into its dictionary
+func (pw *pdfWriter) stream(n int, extra string, data []byte) {
+    var z bytes.Buffer
+    zw := zlib.NewWriter(&z)
+    zw.Write(data)
+    zw.Close()
+    pw.offsets[n-1] = pw.buf.Len()
+    fmt.Fprintf(&pw.buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode%s >>\nstream\n", n, z.Len(), extra)
+    pw.buf.Write(z.Bytes())
+    pw.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// pdfString encodes s as a UTF-16 text string for the document information
+func pdfString(s string) string {
+    var b strings.Builder
+    b.WriteString("<FEFF")
+    for _, r := range s {
+        if r > 0xFFFF { r = '?' }
+        fmt.Fprintf(&b, "%04X", r)
+    }
+    return b.String() + ">"
+}
+
+// write produces the PDF file
+func (d *pdfDoc) write(w io.Writer) error {
+    pw := &pdfWriter{}
+    pw.buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+    catalog, pages, info := pw.reserve(), pw.reserve(), pw.reserve()
+
+    var fontRefs strings.Builder
+    for i, f := range d.fonts {
+        ref := d.writeFont(pw, f)
+        fmt.Fprintf(&fontRefs, "/F%d %d 0 R ", i+1, ref)
+    }
+    var kids strings.Builder
+    for _, content := range d.pages {
+        page, stream := pw.reserve(), pw.reserve()
+        pw.stream(stream, "", content.Bytes())
+        pw.object(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+            pages, pdfNum(pdfPageWidth), pdfNum(pdfPageHeight), fontRefs.String(), stream))
+        fmt.Fprintf(&kids, "%d 0 R ", page)
+    }
+    pw.object(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(d.pages)))
+    pw.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+    pw.object(info, fmt.Sprintf("<< /Title %s /Producer (metal-main) >>", pdfString(d.title)))
+
+    xref := pw.buf.Len()
+    fmt.Fprintf(&pw.buf, "xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+    for _, off := range pw.offsets { fmt.Fprintf(&pw.buf, "%010d 00000 n \n", off) }
+    fmt.Fprintf(&pw.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, catalog, info, xref)
+    _, err := w.Write(pw.buf.Bytes())
+    return err
+}
+
+// writeFont embeds f as a Type0 font with a CIDFontType2 descendant and returns its object number
+func (d *pdfDoc) writeFont(pw *pdfWriter, f *pdfFont) int {
+    font, cid, desc, file, toUni := pw.reserve(), pw.reserve(), pw.reserve(), pw.reserve(), pw.reserve()
+    tt := f.tt
+    gids := make([]int, 0, len(f.used))
+    for g := range f.used { gids = append(gids, int(g)) }
+    sort.Ints(gids)
+
+    data := tt.subset(f.used)
+    pw.stream(file, fmt.Sprintf(" /Length1 %d", len(data)), data)
+
+    // the subset tag is any six capitals; it tells viewers the font is not the whole file
+    name := "MMDOCS+" + tt.name
+    scale := 1000 / tt.unitsPerEm
+    pw.object(desc, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+        name, int(float64(tt.bbox[0])*scale), int(float64(tt.bbox[1])*scale), int(float64(tt.bbox[2])*scale), int(float64(tt.bbox[3])*scale),
+        int(float64(tt.ascent)*scale), int(float64(tt.descent)*scale), int(float64(tt.capHeight)*scale), file))
+
+    var widths strings.Builder
+    for _, g := range gids { fmt.Fprintf(&widths, "%d [%d] ", g, int(tt.advance(uint16(g))+0.5)) }
+    pw.object(cid, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW 0 /W [%s] /CIDToGIDMap /Identity >>",
+        name, desc, widths.String()))
+
+    var cmap strings.Builder
+    cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+    cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+    for i := 0; i < len(gids); i += 100 {
+        chunk := gids[i:min(i+100, len(gids))]
+        fmt.Fprintf(&cmap, "%d beginbfchar\n", len(chunk))
+        for _, g := range chunk { fmt.Fprintf(&cmap, "<%04X> <%04X>\n", g, f.used[uint16(g)]) }
+        cmap.WriteString("endbfchar\n")
+    }
+    cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+    pw.stream(toUni, "", []byte(cmap.String()))
+
+    pw.object(font, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", name, cid, toUni))
+    return font
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// TrueType fonts for the PDF documents. Cyrillic needs an embedded font, so the documents use a
+// TrueType file from the server (DejaVu Sans or Liberation Sans ship with most distributions, or
+// DOCUMENT_FONT / DOCUMENT_FONT_BOLD point to one). Only the glyphs a document uses are kept:
+// the others are emptied, so glyph ids stay those of the file and the embedded font stays small.
+
+var errBadFont = errors.New("not a TrueType font")
+
+// documentFontPaths are tried in order when DOCUMENT_FONT / DOCUMENT_FONT_BOLD are not set
+var documentFontPaths = map[bool][]string{
+    false: {
+        "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+        "/usr/share/fonts/dejavu/DejaVuSans.ttf",
+        "/usr/share/fonts/TTF/DejaVuSans.ttf",
+        "/usr/share/fonts/truetype/liberation/LiberationSans-Regular.ttf",
+        "/usr/share/fonts/liberation/LiberationSans-Regular.ttf",
+        "C:\\Windows\\Fonts\\arial.ttf",
+    },
+    true: {
+        "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf",
+        "/usr/share/fonts/dejavu/DejaVuSans-Bold.ttf",
+        "/usr/share/fonts/TTF/DejaVuSans-Bold.ttf",
+        "/usr/share/fonts/truetype/liberation/LiberationSans-Bold.ttf",
+        "/usr/share/fonts/liberation/LiberationSans-Bold.ttf",
+        "C:\\Windows\\Fonts\\arialbd.ttf",
+    },
+}
+
+var documentFonts struct {
+    sync.Mutex
+    loaded map[bool]*ttFont
+}
+
+// documentFont loads the regular or bold document font once
+func documentFont(bold bool) (*ttFont, error) {
+    documentFonts.Lock()
+    defer documentFonts.Unlock()
+    if f := documentFonts.loaded[bold]; f != nil { return f, nil }
+    env := "DOCUMENT_FONT"
+    if bold { env = "DOCUMENT_FONT_BOLD" }
+    paths := documentFontPaths[bold]
+    if p := strings.TrimSpace(os.Getenv(env)); p != "" { paths = []string{p} }
+    var err error = os.ErrNotExist
+    for _, p := range paths {
+        var data []byte
+        if data, err = os.ReadFile(p); err != nil { continue }
+        f, perr := parseTTF(data)
+        if perr != nil { err = perr; continue }
+        if documentFonts.loaded == nil { documentFonts.loaded = map[bool]*ttFont{} }
+        documentFonts.loaded[bold] = f
+        return f, nil
+    }
+    return nil, errors.New("no document font: set " + env + " to a TrueType file (" + err.Error() + ")")
+}
+
+// ttFont is a parsed TrueType file with the metrics a PDF font dictionary needs
+type ttFont struct {
+    tables     map[string][]byte
+    name       string // PostScript name
+    unitsPerEm float64
+    ascent     int
+    descent    int
+    capHeight  int
+    bbox       [4]int
+    advances   []uint16 // per glyph id
+    cmap       map[rune]uint16
+    longLoca   bool
+}
+
+func u16(b []byte, off int) int { return int(binary.BigEndian.Uint16(b[off:])) }
+func i16(b []byte, off int) int { return int(int16(binary.BigEndian.Uint16(b[off:]))) }
+func u32(b []byte, off int) int { return int(binary.BigEndian.Uint32(b[off:])) }
+
+// parseTTF reads the tables of a TrueType font; CFF-flavoured OpenType is not supported
+func parseTTF(data []byte) (f *ttFont, err error) {
+    // a truncated table makes the readers index out of range; report it as a bad font
+    defer func() {
+        if recover() != nil { f, err = nil, errBadFont }
+    }()
+    if len(data) < 12 || (u32(data, 0) != 0x00010000 && string(data[:4]) != "true") { return nil, errBadFont }
+    f = &ttFont{tables: map[string][]byte{}, cmap: map[rune]uint16{}}
+    for i, n := 0, u16(data, 4); i < n; i++ {
+        rec := 12 + 16*i
+        off, length := u32(data, rec+8), u32(data, rec+12)
+        if off+length > len(data) { return nil, errBadFont }
+        f.tables[string(data[rec:rec+4])] = data[off : off+length]
+    }
+    for _, tag := range []string{"head", "hhea", "maxp", "hmtx", "loca", "glyf", "cmap"} {
+        if f.tables[tag] == nil { return nil, errBadFont }
+    }
+    head, hhea := f.tables["head"], f.tables["hhea"]
+    f.unitsPerEm = float64(u16(head, 18))
+    f.bbox = [4]int{i16(head, 36), i16(head, 38), i16(head, 40), i16(head, 42)}
+    f.longLoca = i16(head, 50) == 1
+    f.ascent, f.descent = i16(hhea, 4), i16(hhea, 6)
+    f.capHeight = f.ascent * 7 / 10
+    if os2 := f.tables["OS/2"]; len(os2) >= 90 && u16(os2, 0) >= 2 { f.capHeight = i16(os2, 88) }
+
+    numGlyphs := u16(f.tables["maxp"], 4)
+    hmtx, numMetrics := f.tables["hmtx"], u16(hhea, 34)
+    f.advances = make([]uint16, numGlyphs)
+    for g := 0; g < numGlyphs; g++ {
+        // glyphs past the last metric share its advance
+        m := g
+        if m >= numMetrics { m = numMetrics - 1 }
+        f.advances[g] = uint16(u16(hmtx, 4*m))
+    }
+    // the name goes into PDF names, which cannot hold spaces or delimiters
+    f.name = strings.Map(func(r rune) rune {
+        if r > ' ' && r < 0x7F && !strings.ContainsRune("()<>[]{}/%#", r) { return r }
+        return -1
+    }, postScriptName(f.tables["name"]))
+    if f.name == "" { f.name = "DocumentFont" }
+    return f, f.parseCmap()
+}
+
+// parseCmap reads the Unicode character map: format 12 (full Unicode) or format 4 (BMP)
+func (f *ttFont) parseCmap() error {
+    cm := f.tables["cmap"]
+    best, bestFormat := -1, 0
+    for i, n := 0, u16(cm, 2); i < n; i++ {
+        rec := 4 + 8*i
+        platform, encoding, off := u16(cm, rec), u16(cm, rec+2), u32(cm, rec+4)
+        if !(platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))) { continue }
+        if format := u16(cm, off); (format == 4 || format == 12) && format > bestFormat { best, bestFormat = off, format }
+    }
+    if best < 0 { return errBadFont }
+    sub := cm[best:]
+    if bestFormat == 12 {
+        for i, n := 0, u32(sub, 12); i < n; i++ {
+            g := 16 + 12*i
+            start, end, gid := u32(sub, g), u32(sub, g+4), u32(sub, g+8)
+            for c := start; c <= end && c <= 0x10FFFF; c++ { f.cmap[rune(c)] = uint16(gid + c - start) }
+        }
+        return nil
+    }
+    segs := u16(sub, 6) / 2
+    ends, starts, deltas, ranges := 14, 16+2*segs, 16+4*segs, 16+6*segs
+    for i := 0; i < segs; i++ {
+        start, end := u16(sub, starts+2*i), u16(sub, ends+2*i)
+        delta, ro := u16(sub, deltas+2*i), u16(sub, ranges+2*i)
+        for c := start; c <= end && c != 0xFFFF; c++ {
+            gid := (c + delta) & 0xFFFF
+            if ro != 0 {
+                gid = u16(sub, ranges+2*i+ro+2*(c-start))
+                if gid != 0 { gid = (gid + delta) & 0xFFFF }
+            }
+            if gid != 0 { f.cmap[rune(c)] = uint16(gid) }
+        }
+    }
+    return nil
+}
+
+// postScriptName reads name id 6 from the name table
+func postScriptName(name []byte) string {
+    if len(name) < 6 { return "" }
+    storage := u16(name, 4)
+    for i, n := 0, u16(name, 2); i < n; i++ {
+        rec := 6 + 12*i
+        platform, id, length, off := u16(name, rec), u16(name, rec+6), u16(name, rec+8), u16(name, rec+10)
+        if id != 6 { continue }
+        raw := name[storage+off : storage+off+length]
+        if platform == 1 { return string(raw) }
+        var sb strings.Builder
+        for j := 0; j+1 < len(raw); j += 2 { sb.WriteByte(raw[j+1]) }
+        return sb.String()
+    }
+    return ""
+}
+
+// glyph returns the glyph id of r, 0 (.notdef) when the font lacks it
+func (f *ttFont) glyph(r rune) uint16 { return f.cmap[r] }
+
+// advance is the width of glyph g in thousandths of the font size
+func (f *ttFont) advance(g uint16) float64 {
+    if int(g) >= len(f.advances) { return 0 }
+    return float64(f.advances[g]) * 1000 / f.unitsPerEm
+}
+
+// glyphData returns the outline of glyph g from the glyf table
+func (f *ttFont) glyphData(g int) []byte {
+    loca, glyf := f.tables["loca"], f.tables["glyf"]
+    var start, end int
+    if f.longLoca {
+        start, end = u32(loca, 4*g), u32(loca, 4*g+4)
+    } else {
+        start, end = 2*u16(loca, 2*g), 2*u16(loca, 2*g+2)
+    }
+    if start >= end || end > len(glyf) { return nil }
+    return glyf[start:end]
+}
+
+// subset returns a font file in which only the glyphs used (and the parts of composite glyphs
+// they are built from) keep their outlines
+func (f *ttFont) subset(used map[uint16]rune) []byte {
+    keep := map[int]bool{0: true}
+    var queue []int
+    for g := range used { queue = append(queue, int(g)) }
+    for len(queue) > 0 {
+        g := queue[len(queue)-1]
+        queue = queue[:len(queue)-1]
+        if keep[g] || g >= len(f.advances) { continue }
+        keep[g] = true
+        queue = append(queue, compositeParts(f.glyphData(g))...)
+    }
+
+    var glyf bytes.Buffer
+    loca := make([]byte, 4*(len(f.advances)+1))
+    for g := range f.advances {
+        binary.BigEndian.PutUint32(loca[4*g:], uint32(glyf.Len()))
+        if !keep[g] { continue }
+        glyf.Write(f.glyphData(g))
+        for glyf.Len()%4 != 0 { glyf.WriteByte(0) }
+    }
+    binary.BigEndian.PutUint32(loca[4*len(f.advances):], uint32(glyf.Len()))
+
+    head := append([]byte(nil), f.tables["head"]...)
+    binary.BigEndian.PutUint32(head[8:], 0) // checkSumAdjustment
+    binary.BigEndian.PutUint16(head[50:], 1) // long loca offsets
+    tables := map[string][]byte{"head": head, "loca": loca, "glyf": glyf.Bytes()}
+    for _, tag := range []string{"hhea", "maxp", "hmtx", "cvt ", "fpgm", "prep"} {
+        if t := f.tables[tag]; t != nil { tables[tag] = t }
+    }
+    return writeSFNT(tables)
+}
+
+// compositeParts lists the glyphs a composite glyph is built from
+func compositeParts(g []byte) []int {
+    if len(g) < 10 || i16(g, 0) >= 0 { return nil }
+    var out []int
+    for off := 10; off+4 <= len(g); {
+        flags := u16(g, off)
+        out = append(out, u16(g, off+2))
+        off += 4
+        if flags&0x0001 != 0 { off += 4 } else { off += 2 }
+        switch {
+        case flags&0x0008 != 0:
+            off += 2
+        case flags&0x0040 != 0:
+            off += 4
+        case flags&0x0080 != 0:
+            off += 8
+        }
+        if flags&0x0020 == 0 { break }
+    }
+    return out
+}
+
+// writeSFNT assembles tables into a TrueType file
+func writeSFNT(tables map[string][]byte) []byte {
+    tags := make([]string, 0, len(tables))
+    for t := range tables { tags = append(tags, t) }
+    sort.Strings(tags)
+    n := len(tags)
+    pow := 1
+    for pow*2 <= n { pow *= 2 }
+    selector := 0
+    for 1<<(selector+1) <= pow { selector++ }
+
+    var out bytes.Buffer
+    header := make([]byte, 12+16*n)
+    binary.BigEndian.PutUint32(header, 0x00010000)
+    binary.BigEndian.PutUint16(header[4:], uint16(n))
+    binary.BigEndian.PutUint16(header[6:], uint16(pow*16))
+    binary.BigEndian.PutUint16(header[8:], uint16(selector))
+    binary.BigEndian.PutUint16(header[10:], uint16(n*16-pow*16))
+    offset := len(header)
+    var body bytes.Buffer
+    for i, tag := range tags {
+        t := tables[tag]
+        rec := header[12+16*i:]
+        copy(rec, tag)
+        binary.BigEndian.PutUint32(rec[4:], sfntChecksum(t))
+        binary.BigEndian.PutUint32(rec[8:], uint32(offset+body.Len()))
+        binary.BigEndian.PutUint32(rec[12:], uint32(len(t)))
+        body.Write(t)
+        for body.Len()%4 != 0 { body.WriteByte(0) }
+    }
+    out.Write(header)
+    out.Write(body.Bytes())
+    return out.Bytes()
+}
+
+func sfntChecksum(t []byte) uint32 {
+    var sum uint32
+    for i := 0; i < len(t); i += 4 {
+        var word [4]byte
+        copy(word[:], t[i:])
+        sum += binary.BigEndian.Uint32(word[:])
+    }
+    return sum
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+    "bytes"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "html"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "metal-main/back/store"
+)
+
+// Supplier price lists are dropped into PRICE_DROP_DIR (CSV, XLSX or a 1C CommerceML offers
+// file). Every PRICE_DROP_INTERVAL the directory is scanned, each row is matched to a product by
+// sku and then by name, and changed price / price_per_ton values are saved together with a
+// price_history entry. Unlike the admin import a drop is applied row by row: unknown or invalid
+// rows are skipped and reported. Processed files move to done/ or failed/ inside the directory
+// and a summary goes to Telegram.
+
+// defaultPriceDropInterval is the scan period when PRICE_DROP_INTERVAL is not set
+const defaultPriceDropInterval = 5 * time.Minute
+
+// priceDropSettle skips files modified more recently; they are probably still being copied
+const priceDropSettle = 10 * time.Second
+
+// priceFeedListLimit caps the per-product lines of a Telegram summary
+const priceFeedListLimit = 20
+
+// supplierPrice is one row of a supplier file; a zero price means the column was empty
+type supplierPrice struct {
+    Row         int
+    SKU         string
+    Name        string
+    Price       float64
+    PricePerTon float64
+}
+
+// priceFeedReport is the outcome of one supplier file
+type priceFeedReport struct {
+    File      string
+    Rows      int
+    Changed   []store.PriceChange
+    Titles    map[int64]string
+    Unchanged int
+    Unmatched []string
+    Errors    []string
+}
+
+// startPriceFeed starts the background scan of PRICE_DROP_DIR; without it the feed is off
+func startPriceFeed() {
+    dir := strings.TrimSpace(os.Getenv("PRICE_DROP_DIR"))
+    if dir == "" { return }
+    interval := defaultPriceDropInterval
+    if v := strings.TrimSpace(os.Getenv("PRICE_DROP_INTERVAL")); v != "" {
+        d, err := time.ParseDuration(v)
+        if err != nil || d <= 0 {
+            log.Printf("PRICE_DROP_INTERVAL %q: using %s", v, defaultPriceDropInterval)
+        } else {
+            interval = d
+        }
+    }
+    log.Printf("price feed: watching %s every %s", dir, interval)
+    go func() {
+        for {
+            scanPriceDrop(dir, time.Now())
+            time.Sleep(interval)
+        }
+    }()
+}
+
+// scanPriceDrop applies every settled supplier file in dir and moves it out of the way
+func scanPriceDrop(dir string, now time.Time) {
+    entries, err := os.ReadDir(dir)
+    if err != nil { log.Printf("price feed: %v", err); return }
+    for _, e := range entries {
+        name := e.Name()
+        // editors and office suites leave ~$lock and .hidden files next to the real ones
+        if !e.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") { continue }
+        switch strings.ToLower(filepath.Ext(name)) {
+        case ".csv", ".xlsx", ".xml":
+        default:
+            continue
+        }
+        info, err := e.Info()
+        if err != nil || now.Sub(info.ModTime()) < priceDropSettle { continue }
+        path := filepath.Join(dir, name)
+        rep, err := applyPriceFile(path)
+        sub := "done"
+        if err != nil {
+            sub = "failed"
+            log.Printf("price feed %s: %v", name, err)
+        } else {
+            log.Printf("price feed %s: %d rows, %d changed, %d unmatched, %d errors", name, rep.Rows, len(rep.Changed), len(rep.Unmatched), len(rep.Errors))
+        }
+        if err := moveProcessed(path, sub, now); err != nil { log.Printf("price feed %s: %v", name, err) }
+        sendTelegram(priceFeedMessage(rep, err))
+    }
+}
+
+// moveProcessed moves path into the sub directory next to it, prefixed with the time so repeated
+// drops of the same file name do not overwrite each other
+func moveProcessed(path, sub string, now time.Time) error {
+    dst := filepath.Join(filepath.Dir(path), sub)
+    if err := os.MkdirAll(dst, 0o755); err != nil { return err }
+    return os.Rename(path, filepath.Join(dst, now.Format("20060102-150405")+"-"+filepath.Base(path)))
+}
+
+// applyPriceFile updates the products listed in the supplier file at path
+func applyPriceFile(path string) (priceFeedReport, error) {
+    rep := priceFeedReport{File: filepath.Base(path), Titles: map[int64]string{}}
+    data, err := os.ReadFile(path)
+    if err != nil { return rep, err }
+    prices, bad, err := parsePriceFile(rep.File, data)
+    if err != nil { return rep, err }
+    rep.Rows = len(prices) + len(bad)
+    rep.Errors = append(rep.Errors, bad...)
+    all, err := st.Products.List("")
+    if err != nil { return rep, err }
+    names := newProductNameIndex(all)
+
+    err = st.InTx(func(tx *store.Store) error {
+        seen := map[int64]int{}
+        for _, sp := range prices {
+            label := sp.SKU
+            if sp.Name != "" { label = sp.Name }
+            p, ok, err := matchSupplierPrice(tx.Products, names, sp)
+            if err != nil { return err }
+            if !ok {
+                rep.Unmatched = append(rep.Unmatched, label)
+                continue
+            }
+            if prev, dup := seen[p.ID]; dup {
+                rep.Errors = append(rep.Errors, fmt.Sprintf("row %d: %s repeats row %d", sp.Row, label, prev))
+                continue
+            }
+            seen[p.ID] = sp.Row
+            next := p
+            if sp.Price > 0 { next.Price = roundKop(sp.Price) }
+            if sp.PricePerTon > 0 { next.PricePerTon = roundKop(sp.PricePerTon) }
+            if !priceChanged(p, next) {
+                rep.Unchanged++
+                continue
+            }
+            next.UnitPrice = unitPrice(next)
+            if err := tx.Products.Update(next); err != nil { return err }
+            c, _, err := recordPriceChange(tx.Products, p, next, "feed:"+rep.File, "")
+            if err != nil { return err }
+            rep.Changed = append(rep.Changed, c)
+            rep.Titles[p.ID] = productTitle(next)
+        }
+        return nil
+    })
+    if err != nil { rep.Changed = nil }
+    return rep, err
+}
+
+// matchSupplierPrice finds the product of sp: by sku when the file has one, otherwise (or when
+// the sku is unknown here) by a name that identifies exactly one product
+func matchSupplierPrice(products store.ProductRepo, names productNameIndex, sp supplierPrice) (ProductRow, bool, error) {
+    if sp.SKU != "" {
+        found, err := products.FindBySKU(sp.SKU)
+        if err != nil { return ProductRow{}, false, err }
+        if len(found) == 1 { return found[0], true, nil }
+    }
+    id, ok := names.lookup(sp.Name)
+    if !ok { return ProductRow{}, false, nil }
+    p, err := products.Get(id)
+    if err == store.ErrNotFound { return ProductRow{}, false, nil }
+    return p, err == nil, err
+}
+
+// productNameIndex maps normalised product names to product ids; a name shared by several
+// products is ambiguous and matches none of them
+type productNameIndex map[string][]int64
+
+func newProductNameIndex(products []ProductRow) productNameIndex {
+    idx := productNameIndex{}
+    for _, p := range products {
+        keys := map[string]bool{}
+        for _, s := range []string{productTitle(p), p.Name + " " + p.Size} {
+            if k := normalizeSupplierName(s); k != "" { keys[k] = true }
+        }
+        for k := range keys { idx[k] = append(idx[k], p.ID) }
+    }
+    return idx
+}
+
+func (idx productNameIndex) lookup(name string) (int64, bool) {
+    ids := idx[normalizeSupplierName(name)]
+    if len(ids) != 1 { return 0, false }
+    return ids[0], true
+}
+
+// normalizeSupplierName folds case, ё and runs of spaces, which supplier lists spell freely
+func normalizeSupplierName(s string) string {
+    s = strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+    return strings.Join(strings.Fields(s), " ")
+}
+
+// parsePriceFile reads a supplier file: XML is taken for CommerceML, anything else for a sheet.
+// Rows that cannot be read are skipped and described in bad; err is for a file that cannot be used at all.
+func parsePriceFile(name string, data []byte) (prices []supplierPrice, bad []string, err error) {
+    trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+    if strings.EqualFold(filepath.Ext(name), ".xml") || bytes.HasPrefix(trimmed, []byte("<")) {
+        return parseCommerceML(data)
+    }
+    if !bytes.HasPrefix(data, []byte("PK\x03\x04")) && !utf8.Valid(data) {
+        // CSV saved by Excel in a Russian locale is windows-1251
+        data = []byte(decodeCP1251(data))
+    }
+    rows, err := readSheet(name, data)
+    if err != nil { return nil, nil, err }
+    return parsePriceSheet(rows)
+}
+
+// parsePriceSheet reads the sku, name, price and price_per_ton columns of a sheet; the headers
+// are those of the admin import, aliases included
+func parsePriceSheet(rows [][]string) ([]supplierPrice, []string, error) {
+    if len(rows) == 0 { return nil, nil, errors.New("empty file") }
+    want := map[string]bool{"sku": true, "name": true, "price": true, "price_per_ton": true}
+    byHeader := map[string]string{}
+    for _, c := range sheetColumns {
+        if !want[c.Name] { continue }
+        byHeader[c.Name] = c.Name
+        for _, a := range c.Aliases { byHeader[a] = c.Name }
+    }
+    col := map[string]int{}
+    for i, h := range rows[0] {
+        if f, ok := byHeader[strings.ToLower(strings.TrimSpace(h))]; ok {
+            if _, dup := col[f]; !dup { col[f] = i }
+        }
+    }
+    _, hasSKU := col["sku"]
+    _, hasName := col["name"]
+    _, hasPrice := col["price"]
+    _, hasTon := col["price_per_ton"]
+    if !hasSKU && !hasName { return nil, nil, errors.New("header must name a sku or a name column") }
+    if !hasPrice && !hasTon { return nil, nil, errors.New("header must name a price or a price_per_ton column") }
+
+    cell := func(cells []string, field string) string {
+        i, ok := col[field]
+        if !ok || i >= len(cells) { return "" }
+        return strings.TrimSpace(cells[i])
+    }
+    var out []supplierPrice
+    var bad []string
+    for r, cells := range rows[1:] {
+        sp := supplierPrice{Row: r + 2, SKU: cell(cells, "sku"), Name: cell(cells, "name")}
+        if sp.SKU == "" && sp.Name == "" { continue }
+        var err error
+        if sp.Price, err = parseSheetNumber(cell(cells, "price")); err == nil {
+            sp.PricePerTon, err = parseSheetNumber(cell(cells, "price_per_ton"))
+        }
+        if err != nil || sp.Price < 0 || sp.PricePerTon < 0 {
+            bad = append(bad, fmt.Sprintf("row %d: bad price", sp.Row))
+            continue
+        }
+        if sp.Price == 0 && sp.PricePerTon == 0 { continue }
+        out = append(out, sp)
+    }
+    return out, bad, nil
+}
+
+// CommerceML 2 (the 1C exchange format) keeps prices in the offers package: each Предложение has
+// an Ид, usually an Артикул and a name, and one Цена per price type
+
+type cmlUnit struct {
+    Code string `xml:"Код,attr"`
+    Text string `xml:",chardata"`
+}
+
+type cmlPrice struct {
+    TypeID  string  `xml:"ИдТипаЦены"`
+    PerUnit string  `xml:"ЦенаЗаЕдиницу"`
+    Unit    cmlUnit `xml:"Единица"`
+}
+
+type cmlOffer struct {
+    ID       string     `xml:"Ид"`
+    SKU      string     `xml:"Артикул"`
+    Name     string     `xml:"Наименование"`
+    BaseUnit cmlUnit    `xml:"БазоваяЕдиница"`
+    Prices   []cmlPrice `xml:"Цены>Цена"`
+}
+
+type cmlPriceType struct {
+    ID   string `xml:"Ид"`
+    Name string `xml:"Наименование"`
+}
+
+// isTon tells a per-ton price from a per-unit one (168 is the OKEI code of a tonne)
+func (u cmlUnit) isTon() bool {
+    if strings.TrimSpace(u.Code) == "168" { return true }
+    switch strings.ToLower(strings.TrimSpace(strings.TrimSuffix(u.Text, "."))) {
+    case "т", "тн", "тонна", "t":
+        return true
+    }
+    return false
+}
+
+// parseCommerceML reads the offers of a CommerceML file. With several price types the one named
+// by PRICE_DROP_PRICE_TYPE (name or Ид) is used, otherwise the first price of each offer.
+func parseCommerceML(data []byte) ([]supplierPrice, []string, error) {
+    var doc struct {
+        PriceTypes []cmlPriceType `xml:"ПакетПредложений>ТипыЦен>ТипЦены"`
+        Offers     []cmlOffer     `xml:"ПакетПредложений>Предложения>Предложение"`
+    }
+    dec := xml.NewDecoder(bytes.NewReader(data))
+    dec.CharsetReader = func(charset string, in io.Reader) (io.Reader, error) {
+        switch strings.ToLower(charset) {
+        case "windows-1251", "cp1251":
+            b, err := io.ReadAll(in)
+            if err != nil { return nil, err }
+            return strings.NewReader(decodeCP1251(b)), nil
+        }
+        return nil, fmt.Errorf("unsupported charset %s", charset)
+    }
+    if err := dec.Decode(&doc); err != nil { return nil, nil, fmt.Errorf("commerceml: %w", err) }
+    if len(doc.Offers) == 0 { return nil, nil, errors.New("commerceml: no offers (only the offers file carries prices)") }
+
+    priceType := ""
+    if want := strings.TrimSpace(os.Getenv("PRICE_DROP_PRICE_TYPE")); want != "" {
+        for _, t := range doc.PriceTypes {
+            if strings.EqualFold(strings.TrimSpace(t.Name), want) || strings.TrimSpace(t.ID) == want { priceType = strings.TrimSpace(t.ID) }
+        }
+        if priceType == "" { return nil, nil, fmt.Errorf("commerceml: no price type %q", want) }
+    }
+    var out []supplierPrice
+    var bad []string
+    for i, o := range doc.Offers {
+        sp := supplierPrice{Row: i + 1, SKU: strings.TrimSpace(o.SKU), Name: strings.TrimSpace(o.Name)}
+        if sp.SKU == "" {
+            // an offer of a characteristic is addressed as product#characteristic
+            sp.SKU, _, _ = strings.Cut(strings.TrimSpace(o.ID), "#")
+        }
+        broken := false
+        for _, pr := range o.Prices {
+            if priceType != "" && strings.TrimSpace(pr.TypeID) != priceType { continue }
+            v, err := parseSheetNumber(pr.PerUnit)
+            if err != nil || v < 0 { broken = true; break }
+            unit := pr.Unit
+            if strings.TrimSpace(unit.Text) == "" && unit.Code == "" { unit = o.BaseUnit }
+            if unit.isTon() {
+                if sp.PricePerTon == 0 { sp.PricePerTon = v }
+            } else if sp.Price == 0 {
+                sp.Price = v
+            }
+            if priceType == "" { break }
+        }
+        if broken {
+            bad = append(bad, fmt.Sprintf("offer %d: bad price", sp.Row))
+            continue
+        }
+        if sp.Price == 0 && sp.PricePerTon == 0 { continue }
+        out = append(out, sp)
+    }
+    return out, bad, nil
+}
+
+// cp1251High holds the windows-1251 characters 0x80-0xBF; 0xC0-0xFF are А-я in order
+var cp1251High = [64]rune{
+    'Ђ', 'Ѓ', '‚', 'ѓ', '„', '…', '†', '‡', '€', '‰', 'Љ', '‹', 'Њ', 'Ќ', 'Ћ', 'Џ',
+    'ђ', '‘', '’', '“', '”', '•', '–', '—', '\ufffd', '™', 'љ', '›', 'њ', 'ќ', 'ћ', 'џ',
+    '\u00a0', 'Ў', 'ў', 'Ј', '¤', 'Ґ', '¦', '§', 'Ё', '©', 'Є', '«', '¬', '\u00ad', '®', 'Ї',
+    '°', '±', 'І', 'і', 'ґ', 'µ', '¶', '·', 'ё', '№', 'є', '»', 'ј', 'Ѕ', 'ѕ', 'ї',
+}
+
+func decodeCP1251(b []byte) string {
+    var sb strings.Builder
+    sb.Grow(len(b) * 2)
+    for _, c := range b {
+        switch {
+        case c < 0x80:
+            sb.WriteByte(c)
+        case c < 0xC0:
+            sb.WriteRune(cp1251High[c-0x80])
+        default:
+            sb.WriteRune(rune(c-0xC0) + 'А')
+        }
+    }
+    return sb.String()
+}
+
+// priceFeedMessage is the Telegram summary of one supplier file
+func priceFeedMessage(rep priceFeedReport, err error) string {
+    var b strings.Builder
+    b.WriteString("💰 Прайс поставщика: "); b.WriteString(html.EscapeString(rep.File)); b.WriteString("\n")
+    if err != nil {
+        b.WriteString("Не обработан: "); b.WriteString(html.EscapeString(err.Error()))
+        return b.String()
+    }
+    b.WriteString(fmt.Sprintf("Строк: %d, изменено: %d, без изменений: %d\n", rep.Rows, len(rep.Changed), rep.Unchanged))
+    for i, c := range rep.Changed {
+        if i == priceFeedListLimit { b.WriteString(fmt.Sprintf("… и ещё %d\n", len(rep.Changed)-i)); break }
+        b.WriteString("• "); b.WriteString(html.EscapeString(rep.Titles[c.ProductID]))
+        if c.OldPrice != c.NewPrice { b.WriteString(fmt.Sprintf(" — %s → %s ₽", priceText(c.OldPrice), priceText(c.NewPrice))) }
+        if c.OldPricePerTon != c.NewPricePerTon { b.WriteString(fmt.Sprintf(" — %s → %s ₽/т", priceText(c.OldPricePerTon), priceText(c.NewPricePerTon))) }
+        b.WriteString("\n")
+    }
+    if len(rep.Unmatched) > 0 {
+        b.WriteString(fmt.Sprintf("Не найдено в каталоге: %d\n", len(rep.Unmatched)))
+        for i, n := range rep.Unmatched {
+            if i == priceFeedListLimit { b.WriteString("…\n"); break }
+            b.WriteString("• "); b.WriteString(html.EscapeString(n)); b.WriteString("\n")
+        }
+    }
+    for i, e := range rep.Errors {
+        if i == priceFeedListLimit { b.WriteString(fmt.Sprintf("⚠ … и ещё %d\n", len(rep.Errors)-i)); break }
+        b.WriteString("⚠ "); b.WriteString(html.EscapeString(e)); b.WriteString("\n")
+    }
+    return strings.TrimRight(b.String(), "\n")
+}
+
+func priceText(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
@@ -0,0 +1,39 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+// a malformed price skips its row and is reported; the rest of the file still applies
+func TestParsePriceSheetSkipsBadRows(t *testing.T) {
+    rows := [][]string{
+        {"Артикул", "Цена"},
+        {"A-1", "100,5"},
+        {"A-2", "сто"},
+        {"A-3", "-5"},
+        {"A-4", ""},
+        {"A-5", "200"},
+    }
+    got, bad, err := parsePriceSheet(rows)
+    if err != nil { t.Fatal(err) }
+    want := []supplierPrice{{Row: 2, SKU: "A-1", Price: 100.5}, {Row: 6, SKU: "A-5", Price: 200}}
+    if !reflect.DeepEqual(got, want) { t.Errorf("prices = %+v, want %+v", got, want) }
+    if wantBad := []string{"row 3: bad price", "row 4: bad price"}; !reflect.DeepEqual(bad, wantBad) { t.Errorf("bad = %q, want %q", bad, wantBad) }
+
+    if _, _, err := parsePriceSheet([][]string{{"Артикул", "Остаток"}}); err == nil { t.Error("a sheet without a price column was accepted") }
+}
+
+func TestParseCommerceMLSkipsBadOffers(t *testing.T) {
+    t.Setenv("PRICE_DROP_PRICE_TYPE", "")
+    doc := `<?xml version="1.0" encoding="UTF-8"?>
+<КоммерческаяИнформация><ПакетПредложений><Предложения>
+<Предложение><Ид>1</Ид><Артикул>A-1</Артикул><Цены><Цена><ЦенаЗаЕдиницу>ошибка</ЦенаЗаЕдиницу></Цена></Цены></Предложение>
+<Предложение><Ид>2#x</Ид><Наименование>Уголок 50х5</Наименование><Цены><Цена><ЦенаЗаЕдиницу>85000</ЦенаЗаЕдиницу><Единица Код="168">т</Единица></Цена></Цены></Предложение>
+</Предложения></ПакетПредложений></КоммерческаяИнформация>`
+    got, bad, err := parseCommerceML([]byte(doc))
+    if err != nil { t.Fatal(err) }
+    want := []supplierPrice{{Row: 2, SKU: "2", Name: "Уголок 50х5", PricePerTon: 85000}}
+    if !reflect.DeepEqual(got, want) { t.Errorf("prices = %+v, want %+v", got, want) }
+    if wantBad := []string{"offer 1: bad price"}; !reflect.DeepEqual(bad, wantBad) { t.Errorf("bad = %q, want %q", bad, wantBad) }
+}
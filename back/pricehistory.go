@@ -0,0 +1,97 @@
+package main
+
+import (
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "metal-main/back/store"
+)
+
+// Every change of a product's price or price_per_ton is kept in price_history with where it came
+// from (admin, import or feed:<file>) and which admin made it, so a disputed price can be looked
+// up. With PUBLIC_PRICE_HISTORY=1 the item page also shows the unit price over time.
+
+// priceChanged reports whether cur differs from old in either stored price
+func priceChanged(old, cur ProductRow) bool {
+    return old.Price != cur.Price || old.PricePerTon != cur.PricePerTon
+}
+
+// recordPriceChange appends the price change from old to cur, if there is one, to the history
+func recordPriceChange(products store.ProductRepo, old, cur ProductRow, source, by string) (store.PriceChange, bool, error) {
+    if !priceChanged(old, cur) { return store.PriceChange{}, false, nil }
+    c := store.PriceChange{
+        ProductID: cur.ID,
+        OldPrice: old.Price, NewPrice: cur.Price,
+        OldPricePerTon: old.PricePerTon, NewPricePerTon: cur.PricePerTon,
+        Source: source, ChangedBy: by,
+    }
+    err := products.RecordPriceChange(&c)
+    return c, err == nil, err
+}
+
+// pricePoint is one step of the public price series
+type pricePoint struct {
+    Date  string  `json:"date"`
+    Price float64 `json:"price"`
+}
+
+// publicPriceHistory tells whether the price series may be shown to customers
+func publicPriceHistory() bool { return os.Getenv("PUBLIC_PRICE_HISTORY") == "1" }
+
+// priceSeries is the unit price of p over time, one point per day with a change (the last one of
+// the day wins), oldest first and starting with the price before the first change. That first
+// point is dated when the product was created, or the day before the first change if the product
+// is not older than that. A price of 0 is a spell of price on request.
+func priceSeries(p ProductRow) ([]pricePoint, error) {
+    changes, err := st.Products.PriceHistory(p.ID)
+    if err != nil { return nil, err }
+    out := []pricePoint{}
+    if len(changes) == 0 { return out, nil }
+    first := changes[len(changes)-1]
+    at := p
+    at.Price, at.PricePerTon = first.OldPrice, first.OldPricePerTon
+    out = append(out, pricePoint{Date: priceSeedDate(p, first), Price: unitPrice(at)})
+    for i := len(changes) - 1; i >= 0; i-- {
+        c := changes[i]
+        at.Price, at.PricePerTon = c.NewPrice, c.NewPricePerTon
+        pt := pricePoint{Date: lastModDate(c.ChangedAt), Price: unitPrice(at)}
+        // the seed never shares a day with a change, so only changes of one day merge
+        if n := len(out); n > 1 && out[n-1].Date == pt.Date {
+            out[n-1] = pt
+        } else {
+            out = append(out, pt)
+        }
+    }
+    return out, nil
+}
+
+// priceSeedDate dates the price p had before its first recorded change
+func priceSeedDate(p ProductRow, first store.PriceChange) string {
+    changed := lastModDate(first.ChangedAt)
+    if created := lastModDate(p.CreatedAt); created != "" && created < changed { return created }
+    d, err := time.Parse("2006-01-02", changed)
+    if err != nil { return changed }
+    return d.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+// GET /api/admin/products/{id}/price-history lists the recorded price changes of a product, newest first
+func adminProductSubHandler(w http.ResponseWriter, r *http.Request) {
+    rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/products/"), "/")
+    idPart, sub, _ := strings.Cut(rest, "/")
+    id, err := strconv.ParseInt(idPart, 10, 64)
+    if err != nil || id <= 0 || sub != "price-history" { http.NotFound(w, r); return }
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    if _, err := st.Products.Get(id); err == store.ErrNotFound {
+        http.Error(w, "not found", http.StatusNotFound)
+        return
+    } else if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    changes, err := st.Products.PriceHistory(id)
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    writeJSON(w, changes)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+
+    "metal-main/back/store"
+)
+
+func TestPriceSeries(t *testing.T) {
+    useTestStore(t)
+    type change struct {
+        at       string
+        from, to float64
+    }
+    cases := []struct {
+        name    string
+        p       ProductRow
+        created string
+        changes []change
+        want    []pricePoint
+    }{
+        {"the price before the first change is dated when the product was created", testPipe, "2025-12-01 08:00:00",
+            []change{{"2026-01-05 10:00:00", 100, 120}, {"2026-02-05 10:00:00", 120, 130}},
+            []pricePoint{{"2025-12-01", 100}, {"2026-01-05", 120}, {"2026-02-05", 130}}},
+        {"or the day before the first change when the product is not older", testPipe, "2026-01-05 09:00:00",
+            []change{{"2026-01-05 10:00:00", 100, 120}},
+            []pricePoint{{"2026-01-04", 100}, {"2026-01-05", 120}}},
+        {"the last change of a day wins", testPipe, "2025-12-01 08:00:00",
+            []change{{"2026-01-05 09:00:00", 100, 110}, {"2026-01-05 12:00:00", 110, 115}, {"2026-01-06 12:00:00", 115, 90}},
+            []pricePoint{{"2025-12-01", 100}, {"2026-01-05", 115}, {"2026-01-06", 90}}},
+        {"price on request is a point at 0", testPipe, "2025-12-01 08:00:00",
+            []change{{"2026-01-05 10:00:00", 0, 100}, {"2026-03-01 10:00:00", 100, 0}},
+            []pricePoint{{"2025-12-01", 0}, {"2026-01-05", 100}, {"2026-03-01", 0}}},
+        {"no changes, no series", testPipe, "2025-12-01 08:00:00", nil, []pricePoint{}},
+    }
+    for _, c := range cases {
+        p := c.p
+        p.ID = 0
+        if err := st.Products.Create(&p); err != nil { t.Fatal(err) }
+        if _, err := st.DB.Exec("UPDATE products SET created_at=? WHERE id=?", c.created, p.ID); err != nil { t.Fatal(err) }
+        for _, ch := range c.changes {
+            if err := st.Products.RecordPriceChange(&store.PriceChange{ProductID: p.ID, OldPrice: ch.from, NewPrice: ch.to, Source: "admin", ChangedAt: ch.at}); err != nil { t.Fatal(err) }
+        }
+        p, err := st.Products.Get(p.ID)
+        if err != nil { t.Fatal(err) }
+        got, err := priceSeries(p)
+        if err != nil { t.Fatal(err) }
+        if !reflect.DeepEqual(got, c.want) { t.Errorf("%s:\n got %v\nwant %v", c.name, got, c.want) }
+    }
+
+    // a price per ton becomes the unit price of the product: a 10 m bar of 20 kg
+    p := testRebar
+    p.ID = 0
+    if err := st.Products.Create(&p); err != nil { t.Fatal(err) }
+    // created today, so the old price is dated the day before the change
+    if err := st.Products.RecordPriceChange(&store.PriceChange{ProductID: p.ID, OldPricePerTon: 50000, NewPricePerTon: 60000, Source: "feed:x.csv", ChangedAt: "2020-01-02 10:00:00"}); err != nil { t.Fatal(err) }
+    p, err := st.Products.Get(p.ID)
+    if err != nil { t.Fatal(err) }
+    got, err := priceSeries(p)
+    if err != nil { t.Fatal(err) }
+    if want := []pricePoint{{"2020-01-01", 100}, {"2020-01-02", 120}}; !reflect.DeepEqual(got, want) { t.Errorf("per ton: got %v, want %v", got, want) }
+}
+
+// adminSignIn creates an admin with a session and returns its cookie
+func adminSignIn(t *testing.T, login string) *http.Cookie {
+    t.Helper()
+    u := store.User{Login: login, PasswordHash: "x", IsAdmin: true}
+    if err := st.Users.Create(&u); err != nil { t.Fatal(err) }
+    w := httptest.NewRecorder()
+    if err := setSession(w, httptest.NewRequest(http.MethodPost, "/api/admin/login", nil), u.ID, true); err != nil { t.Fatal(err) }
+    for _, c := range w.Result().Cookies() {
+        if c.Name == sessionCookieName { return c }
+    }
+    t.Fatal("no admin session cookie set")
+    return nil
+}
+
+// every way a price changes leaves one history row saying where it came from and who made it
+func TestPriceHistoryRecorded(t *testing.T) {
+    useTestStore(t)
+    admin := adminSignIn(t, "manager")
+    p := ProductRow{SKU: "A-1", Type: "armatura", Name: "Арматура", Size: "12", Price: 100, InStock: true}
+    if err := st.Products.Create(&p); err != nil { t.Fatal(err) }
+
+    patch := func(body string) {
+        t.Helper()
+        r := httptest.NewRequest(http.MethodPatch, "/api/admin/products", strings.NewReader(body))
+        r.AddCookie(admin)
+        w := httptest.NewRecorder()
+        adminProductsHandler(w, r)
+        if w.Code != 200 { t.Fatalf("PATCH %s: %d %s", body, w.Code, w.Body) }
+    }
+    importFile := func(file string) {
+        t.Helper()
+        r := httptest.NewRequest(http.MethodPost, "/api/admin/products/import?filename=prices.csv&commit=1", strings.NewReader(file))
+        r.AddCookie(admin)
+        w := httptest.NewRecorder()
+        adminProductsImportHandler(w, r)
+        if w.Code != 200 { t.Fatalf("import: %d %s", w.Code, w.Body) }
+    }
+    feed := func(file string) {
+        t.Helper()
+        path := filepath.Join(t.TempDir(), "supplier.csv")
+        if err := os.WriteFile(path, []byte(file), 0o644); err != nil { t.Fatal(err) }
+        if _, err := applyPriceFile(path); err != nil { t.Fatal(err) }
+    }
+
+    type want struct {
+        old, new      float64
+        source, login string
+    }
+    steps := []struct {
+        name string
+        do   func()
+        rows []want // newest first
+    }{
+        {"admin edit", func() { patch(fmt.Sprintf(`{"id":%d,"price":150,"in_stock":true}`, p.ID)) }, []want{{100, 150, "admin", "manager"}}},
+        {"admin edit of the name only", func() { patch(fmt.Sprintf(`{"id":%d,"name":"Арматура А500С","in_stock":true}`, p.ID)) }, nil},
+        {"import", func() { importFile("sku,price\nA-1,160\n") }, []want{{150, 160, "import", "manager"}}},
+        {"import at the same price", func() { importFile("sku,price,size\nA-1,160,14\n") }, nil},
+        {"supplier feed", func() { feed("Артикул;Цена\nA-1;170\n") }, []want{{160, 170, "feed:supplier.csv", ""}}},
+        {"supplier feed at the same price", func() { feed("Артикул;Цена\nA-1;170\n") }, nil},
+    }
+    var all []want
+    for _, s := range steps {
+        s.do()
+        all = append(s.rows, all...)
+        hist, err := st.Products.PriceHistory(p.ID)
+        if err != nil { t.Fatal(err) }
+        var got []want
+        for _, c := range hist { got = append(got, want{c.OldPrice, c.NewPrice, c.Source, c.ChangedBy}) }
+        if !reflect.DeepEqual(got, all) { t.Fatalf("after %s:\n got %+v\nwant %+v", s.name, got, all) }
+    }
+    if cur, _ := st.Products.Get(p.ID); cur.Price != 170 || cur.Size != "14" || cur.UnitPrice != unitPrice(cur) { t.Errorf("product = %+v", cur) }
+}
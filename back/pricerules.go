@@ -0,0 +1,232 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "metal-main/back/store"
+)
+
+// Pricing rules lower the list price of a line: volume tiers ("from 5 t of this rebar at 68 000 ₽/t"),
+// discounts for a customer group (dealers, builders) and promotions limited in time. Rules do not
+// stack: every rule that applies to a line is tried and the lowest total wins. A rule never raises
+// a price and never prices a product that is on request. Tier thresholds are measured on the line
+// itself, in the rule's unit. The customer group is set by an admin on the account's company or
+// on the account itself.
+
+// priceRules are the rules in force for one customer, loaded once per request
+type priceRules []store.PriceRule
+
+// appliedRule names the rule that produced a price
+type appliedRule struct {
+    ID   int64  `json:"id"`
+    Name string `json:"name"`
+}
+
+// priceTier is a rule offered on the product API: its terms and the base-unit price it gives
+type priceTier struct {
+    appliedRule
+    MinQty      float64 `json:"min_qty,omitempty"`
+    MinUnit     string  `json:"min_unit,omitempty"`
+    DiscountPct float64 `json:"discount_pct,omitempty"`
+    PricePerTon float64 `json:"price_per_ton,omitempty"`
+    EndsAt      string  `json:"ends_at,omitempty"`
+    UnitPrice   float64 `json:"unit_price"` // per Unit, the product's base unit
+    Unit        string  `json:"unit"`
+}
+
+// normalizePriceGroup folds a customer group so "Dealer " and "dealer" match
+func normalizePriceGroup(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
+
+// currentPriceGroup is the customer group of the signed-in public user, "" for guests
+func currentPriceGroup(r *http.Request) string {
+    s, ok := sessionFromRequest(r, userSessionCookieName)
+    if !ok { return "" }
+    u, err := st.Users.Get(s.UserID)
+    if err != nil { return "" }
+    return accountPriceGroup(u)
+}
+
+// currentPriceRules loads the rules in force now for the customer of r
+func currentPriceRules(r *http.Request) (priceRules, error) {
+    group := currentPriceGroup(r)
+    all, err := st.PriceRules.Current(store.Now())
+    if err != nil { return nil, err }
+    out := priceRules{}
+    for _, pr := range all {
+        if pr.CustomerGroup == "" || pr.CustomerGroup == group { out = append(out, pr) }
+    }
+    return out, nil
+}
+
+// productInCategory tells whether p belongs to the category id: its top-level category or its subcategory
+func productInCategory(p ProductRow, id int64) bool {
+    t := catalogTree()
+    cat, ok := t.topCategory(normalizeTypeSlug(p.Type))
+    if !ok { return false }
+    if cat.ID == id { return true }
+    sub, ok := productSubcategory(t, cat, p)
+    return ok && sub.ID == id
+}
+
+// ruleCovers tells whether pr is scoped to p, ignoring the quantity threshold
+func ruleCovers(pr store.PriceRule, p ProductRow) bool {
+    if pr.ProductID != 0 && pr.ProductID != p.ID { return false }
+    if pr.CategoryID != 0 && !productInCategory(p, pr.CategoryID) { return false }
+    return true
+}
+
+// rulePiecePrice is the price of one piece of p under pr, given its list price
+func rulePiecePrice(pr store.PriceRule, m productMeasure, listPiece float64) (float64, bool) {
+    switch {
+    case pr.PricePerTon > 0:
+        if m.WeightKg <= 0 { return 0, false }
+        return pr.PricePerTon * m.WeightKg / 1000, true
+    case pr.DiscountPct > 0:
+        return listPiece * (1 - pr.DiscountPct/100), true
+    }
+    return 0, false
+}
+
+// apply re-prices q of p with the best rule that applies to it; q is returned as is when none lowers it
+func (rules priceRules) apply(p ProductRow, q quote) quote {
+    if q.Total <= 0 { return q }
+    m := measureProduct(p)
+    listPiece := piecePrice(p, m)
+    pieces := q.Qty / m.perPiece(q.Unit)
+    best, bestTotal := -1, q.Total
+    for i, pr := range rules {
+        if !ruleCovers(pr, p) { continue }
+        if pr.MinQty > 0 {
+            amount, err := convertQty(p, q.Qty, q.Unit, pr.MinUnit)
+            if err != nil || amount < pr.MinQty-1e-9 { continue }
+        }
+        piece, ok := rulePiecePrice(pr, m, listPiece)
+        if !ok { continue }
+        if total := roundKop(pieces * piece); total < bestTotal { best, bestTotal = i, total }
+    }
+    if best < 0 { return q }
+    q.ListPrice, q.ListTotal = q.UnitPrice, q.Total
+    q.Total = bestTotal
+    q.UnitPrice = roundKop(bestTotal / q.Qty)
+    q.Rule = &appliedRule{ID: rules[best].ID, Name: rules[best].Name}
+    return q
+}
+
+// tiers lists the rules covering p with the base-unit price each gives, by threshold
+func (rules priceRules) tiers(p ProductRow) []priceTier {
+    m := measureProduct(p)
+    listPiece := piecePrice(p, m)
+    out := []priceTier{}
+    if listPiece <= 0 { return out }
+    base := m.units()[0]
+    for _, pr := range rules {
+        if !ruleCovers(pr, p) { continue }
+        if pr.MinQty > 0 && !m.supports(pr.MinUnit) { continue }
+        piece, ok := rulePiecePrice(pr, m, listPiece)
+        if !ok || piece >= listPiece { continue }
+        t := priceTier{appliedRule: appliedRule{ID: pr.ID, Name: pr.Name}, DiscountPct: pr.DiscountPct, PricePerTon: pr.PricePerTon, EndsAt: pr.EndsAt,
+            UnitPrice: roundKop(piece / m.perPiece(base)), Unit: base}
+        if pr.MinQty > 0 { t.MinQty, t.MinUnit = pr.MinQty, pr.MinUnit }
+        out = append(out, t)
+    }
+    // the usual tier table: smaller thresholds first, then by price
+    for i := 1; i < len(out); i++ {
+        for j := i; j > 0 && tierBefore(out[j], out[j-1]); j-- { out[j], out[j-1] = out[j-1], out[j] }
+    }
+    return out
+}
+
+func tierBefore(a, b priceTier) bool {
+    if a.MinUnit != b.MinUnit { return a.MinUnit < b.MinUnit }
+    if a.MinQty != b.MinQty { return a.MinQty < b.MinQty }
+    return a.UnitPrice > b.UnitPrice
+}
+
+// validatePriceRule normalizes pr and returns a client-facing error message or ""
+func validatePriceRule(pr *store.PriceRule) string {
+    pr.Name = strings.TrimSpace(pr.Name)
+    pr.CustomerGroup = normalizePriceGroup(pr.CustomerGroup)
+    pr.MinUnit = strings.ToLower(strings.TrimSpace(pr.MinUnit))
+    if pr.Name == "" { return "name required" }
+    if pr.ProductID != 0 && pr.CategoryID != 0 { return "a rule is scoped to a product or to a category, not both" }
+    if pr.ProductID != 0 {
+        if _, err := st.Products.Get(pr.ProductID); err != nil { return "unknown product_id" }
+    }
+    if pr.CategoryID != 0 {
+        if _, err := st.Categories.Get(pr.CategoryID); err != nil { return "unknown category_id" }
+    }
+    if pr.MinQty < 0 || math.IsInf(pr.MinQty, 0) || math.IsNaN(pr.MinQty) { return "min_qty must not be negative" }
+    if pr.MinQty == 0 { pr.MinUnit = "" }
+    if pr.MinQty > 0 {
+        if _, ok := unitLabels[pr.MinUnit]; !ok { return "min_unit must be pcs, m, m2, t or kg" }
+    }
+    if (pr.DiscountPct > 0) == (pr.PricePerTon > 0) { return "set either discount_pct or price_per_ton" }
+    if pr.DiscountPct < 0 || pr.DiscountPct >= 100 { return "discount_pct must be between 0 and 100" }
+    if pr.PricePerTon < 0 { return "price_per_ton must not be negative" }
+    var err error
+    if pr.StartsAt, err = ruleTime(pr.StartsAt); err != nil { return "starts_at must be YYYY-MM-DD or YYYY-MM-DD HH:MM:SS" }
+    if pr.EndsAt, err = ruleTime(pr.EndsAt); err != nil { return "ends_at must be YYYY-MM-DD or YYYY-MM-DD HH:MM:SS" }
+    if pr.StartsAt != "" && pr.EndsAt != "" && pr.EndsAt <= pr.StartsAt { return "ends_at must be after starts_at" }
+    return ""
+}
+
+// ruleTime normalizes a period bound to the TEXT timestamp layout; a bare date is its midnight (UTC)
+func ruleTime(s string) (string, error) {
+    s = strings.TrimSpace(strings.Replace(s, "T", " ", 1))
+    if s == "" { return "", nil }
+    var err error
+    for _, layout := range []string{store.TimeLayout, "2006-01-02 15:04", "2006-01-02"} {
+        var t time.Time
+        if t, err = time.Parse(layout, s); err == nil { return t.Format(store.TimeLayout), nil }
+    }
+    return "", err
+}
+
+// GET/POST/PATCH/DELETE /api/admin/price_rules manages pricing rules; PATCH keeps absent fields
+func adminPriceRulesHandler(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        out, err := st.PriceRules.List()
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, out)
+    case http.MethodPost:
+        pr := store.PriceRule{Active: true}
+        if err := json.NewDecoder(r.Body).Decode(&pr); err != nil { http.Error(w, "bad json", 400); return }
+        pr.ID = 0
+        if msg := validatePriceRule(&pr); msg != "" { http.Error(w, msg, 400); return }
+        if err := st.PriceRules.Create(&pr); err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, pr)
+    case http.MethodPatch:
+        // decode over the stored row so absent fields keep their value
+        body, err := io.ReadAll(r.Body)
+        if err != nil { http.Error(w, err.Error(), 400); return }
+        var probe struct{ ID int64 `json:"id"` }
+        if err := json.Unmarshal(body, &probe); err != nil { http.Error(w, "bad json", 400); return }
+        if probe.ID == 0 { http.Error(w, "id required", 400); return }
+        pr, err := st.PriceRules.Get(probe.ID)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if err := json.Unmarshal(body, &pr); err != nil { http.Error(w, "bad json", 400); return }
+        pr.ID = probe.ID
+        if msg := validatePriceRule(&pr); msg != "" { http.Error(w, msg, 400); return }
+        err = st.PriceRules.Update(pr)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, pr)
+    case http.MethodDelete:
+        id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if id == 0 { http.Error(w, "id required", 400); return }
+        err := st.PriceRules.Delete(id)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, map[string]string{"status": "ok"})
+    default:
+        http.Error(w, "method not allowed", 405)
+    }
+}
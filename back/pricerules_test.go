@@ -0,0 +1,61 @@
+package main
+
+import (
+    "testing"
+
+    "metal-main/back/store"
+)
+
+func TestPriceRulesApply(t *testing.T) {
+    // category rules resolve the product type through the tree
+    saved := categoriesCur
+    categoriesCur = &categoryTree{children: map[int64][]store.Category{0: {{ID: 1, Slug: "armatura", Alias: "rebar"}, {ID: 2, Slug: "truba-profilnaya"}}}}
+    t.Cleanup(func() { categoriesCur = saved })
+
+    tenPct := store.PriceRule{ID: 1, Name: "−10%", DiscountPct: 10}
+    fivePct := store.PriceRule{ID: 2, Name: "−5%", DiscountPct: 5}
+    // from 0.1 t of rebar at 40 000 ₽/t instead of 50 000
+    tier := store.PriceRule{ID: 3, Name: "от 0,1 т", MinQty: 0.1, MinUnit: unitTon, PricePerTon: 40000}
+    dearer := store.PriceRule{ID: 4, Name: "дороже", PricePerTon: 60000}
+    otherProduct := store.PriceRule{ID: 5, Name: "другой товар", ProductID: 99, DiscountPct: 50}
+    rebarOnly := store.PriceRule{ID: 6, Name: "арматура", CategoryID: 1, DiscountPct: 20}
+
+    cases := []struct {
+        name      string
+        rules     priceRules
+        p         ProductRow
+        qty       float64
+        unit      string
+        total     float64
+        unitPrice float64
+        rule      int64 // 0 when the list price stays
+    }{
+        {"no rules", nil, testRebar, 25, unitMetre, 2500, 100, 0},
+        {"discount", priceRules{tenPct}, testRebar, 25, unitMetre, 2250, 90, 1},
+        {"the lowest total wins, rules do not stack", priceRules{fivePct, tenPct}, testRebar, 25, unitMetre, 2250, 90, 1},
+        {"below the tier threshold", priceRules{tier}, testRebar, 25, unitMetre, 2500, 100, 0},
+        {"tier threshold measured in its own unit", priceRules{tenPct, tier}, testRebar, 60, unitMetre, 4800, 80, 3},
+        {"tier reached in pieces", priceRules{tier}, testRebar, 5, unitPiece, 4000, 800, 3},
+        {"a rule never raises the price", priceRules{dearer}, testRebar, 25, unitMetre, 2500, 100, 0},
+        {"scoped to another product", priceRules{otherProduct}, testRebar, 25, unitMetre, 2500, 100, 0},
+        {"category rule", priceRules{rebarOnly}, testRebar, 25, unitMetre, 2000, 80, 6},
+        {"category rule elsewhere", priceRules{rebarOnly}, testPipe, 6, unitMetre, 720, 120, 0},
+        {"per-ton rule needs a weight", priceRules{tier, dearer}, testPipe, 600, unitMetre, 72000, 120, 0},
+        {"price on request stays on request", priceRules{tenPct}, ProductRow{ID: 4, Type: "armatura", LengthM: 11.7}, 2, unitMetre, 0, 0, 0},
+    }
+    for _, c := range cases {
+        q, err := quoteProduct(c.p, c.qty, c.unit)
+        if err != nil { t.Fatalf("%s: %v", c.name, err) }
+        list := q
+        q = c.rules.apply(c.p, q)
+        if q.Total != c.total || q.UnitPrice != c.unitPrice { t.Errorf("%s: %v ₽ at %v, want %v ₽ at %v", c.name, q.Total, q.UnitPrice, c.total, c.unitPrice) }
+        switch {
+        case c.rule == 0 && q.Rule != nil:
+            t.Errorf("%s: rule %q applied", c.name, q.Rule.Name)
+        case c.rule != 0 && (q.Rule == nil || q.Rule.ID != c.rule):
+            t.Errorf("%s: rule %+v, want id %d", c.name, q.Rule, c.rule)
+        case c.rule != 0 && (q.ListTotal != list.Total || q.ListPrice != list.UnitPrice):
+            t.Errorf("%s: list %v at %v, want %v at %v", c.name, q.ListTotal, q.ListPrice, list.Total, list.UnitPrice)
+        }
+    }
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "metal-main/back/store"
+)
+
+// Orders and carts never trust prices or titles sent by the browser: every line is
+// re-priced from the products table before it is stored.
+
+var (
+    errUnknownProduct = errors.New("unknown product")
+    errOutOfStock     = errors.New("out of stock")
+    // the product has neither a price nor a price per ton it can be converted from;
+    // it is quoted by a manager, never sold at 0 ₽
+    errPriceOnRequest = errors.New("price on request")
+)
+
+// pricedLine is one catalog item priced from the DB
+type pricedLine struct {
+    Product ProductRow
+    Title   string
+    Quote   quote
+}
+
+// unitPrice is the authoritative price of the base unit of p (a metre of rolled stock, a sheet
+// or a piece): the explicit price when set, otherwise price_per_ton converted through the weight
+// of that unit (as catalog_item.html shows it)
+func unitPrice(p ProductRow) float64 {
+    m := measureProduct(p)
+    per := 1.0
+    if !m.Sheet { per = m.LengthM }
+    return roundKop(piecePrice(p, m) / per)
+}
+
+// refreshUnitPrices stores the unit price of every product whose saved value is stale: after the
+// migration that added the column, or when the rule or the category tree it depends on changed
+func refreshUnitPrices() (int, error) {
+    all, err := st.Products.List("")
+    if err != nil { return 0, err }
+    n := 0
+    err = st.InTx(func(tx *store.Store) error {
+        for _, p := range all {
+            if v := unitPrice(p); v != p.UnitPrice {
+                if err := tx.Products.SetUnitPrice(p.ID, v); err != nil { return err }
+                n++
+            }
+        }
+        return nil
+    })
+    return n, err
+}
+
+// productTitle builds the display name the same way the item page does
+func productTitle(p ProductRow) string {
+    parts := []string{}
+    sub := strings.TrimSpace(p.Subtype)
+    // subtypes are stored as slugs (a500c, vgp); show their label
+    if l := subSlugToLabel(normalizeTypeSlug(p.Type), sub); l != "" { sub = l }
+    if sub != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(sub)) { parts = append(parts, sub) }
+    for _, s := range []string{p.Name, p.Size} {
+        if s = strings.TrimSpace(s); s != "" { parts = append(parts, s) }
+    }
+    return strings.Join(parts, " ")
+}
+
+func roundKop(v float64) float64 { return math.Round(v*100) / 100 }
+
+// priceLine looks up the item id sent by the storefront and prices qty of it in unit
+// (the product's base unit when empty) with the best of the customer's pricing rules
+func priceLine(products store.ProductRepo, rules priceRules, itemID string, qty float64, unit string) (pricedLine, error) {
+    id, err := strconv.ParseInt(strings.TrimSpace(itemID), 10, 64)
+    if err != nil || id <= 0 { return pricedLine{}, fmt.Errorf("%w: %q", errUnknownProduct, itemID) }
+    p, err := products.Get(id)
+    if err == store.ErrNotFound { return pricedLine{}, fmt.Errorf("%w: %q", errUnknownProduct, itemID) }
+    if err != nil { return pricedLine{}, err }
+    title := productTitle(p)
+    if !p.InStock { return pricedLine{}, fmt.Errorf("%s: %w", title, errOutOfStock) }
+    if qty <= 0 { qty = 1 }
+    q, err := quoteProduct(p, qty, unit)
+    if err != nil { return pricedLine{}, fmt.Errorf("%s: %w", title, err) }
+    if piecePrice(p, measureProduct(p)) <= 0 { return pricedLine{}, fmt.Errorf("%s: %w", title, errPriceOnRequest) }
+    return pricedLine{Product: p, Title: title, Quote: rules.apply(p, q)}, nil
+}
+
+// writePricingError maps lookup failures to 404/409, bad quantities to 400 and anything else to 500
+func writePricingError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, errUnknownProduct):
+        http.Error(w, err.Error(), http.StatusNotFound)
+    case errors.Is(err, errOutOfStock), errors.Is(err, errPriceOnRequest):
+        http.Error(w, err.Error(), http.StatusConflict)
+    case errors.Is(err, errBadUnit), errors.Is(err, errBadQty):
+        http.Error(w, err.Error(), http.StatusBadRequest)
+    default:
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+    }
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+    "bytes"
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "metal-main/back/store"
+)
+
+// Price lists are exchanged as spreadsheets: the export writes one column per product field and
+// the import reads the same layout back, matching rows to products by sku. An import is a dry
+// run that only reports what would change unless ?commit=1 is given, and a commit is refused
+// while any row is invalid, so a file is applied either whole or not at all.
+
+// importMaxBytes bounds an uploaded price list
+const importMaxBytes = 16 << 20
+
+// productColumn maps one spreadsheet column to a product field
+type productColumn struct {
+    Name    string
+    Aliases []string // lower-case headers managers use in their own sheets
+    get     func(p ProductRow) any
+    set     func(p *ProductRow, v string) error
+    copy    func(dst *ProductRow, src ProductRow)
+}
+
+func numberColumn(name string, aliases []string, field func(p *ProductRow) *float64) productColumn {
+    return productColumn{Name: name, Aliases: aliases,
+        get:  func(p ProductRow) any { return *field(&p) },
+        copy: func(dst *ProductRow, src ProductRow) { *field(dst) = *field(&src) },
+        set: func(p *ProductRow, v string) error {
+            n, err := parseSheetNumber(v)
+            if err == nil && n < 0 { err = errors.New("must not be negative") }
+            if err == nil { *field(p) = n }
+            return err
+        },
+    }
+}
+
+func textColumn(name string, aliases []string, field func(p *ProductRow) *string) productColumn {
+    return productColumn{Name: name, Aliases: aliases,
+        get:  func(p ProductRow) any { return *field(&p) },
+        set:  func(p *ProductRow, v string) error { *field(p) = unescapeSheetText(v); return nil },
+        copy: func(dst *ProductRow, src ProductRow) { *field(dst) = *field(&src) },
+    }
+}
+
+func boolColumn(name string, aliases []string, field func(p *ProductRow) *bool) productColumn {
+    return productColumn{Name: name, Aliases: aliases,
+        get:  func(p ProductRow) any { if *field(&p) { return 1 }; return 0 },
+        copy: func(dst *ProductRow, src ProductRow) { *field(dst) = *field(&src) },
+        set: func(p *ProductRow, v string) error {
+            b, err := parseSheetBool(v)
+            if err == nil { *field(p) = b }
+            return err
+        },
+    }
+}
+
+// idColumn carries the product id, the fallback key of rows without a sku; it is never copied
+// onto a stored product
+var idColumn = productColumn{Name: "id",
+    get:  func(p ProductRow) any { return int(p.ID) },
+    copy: func(dst *ProductRow, src ProductRow) {},
+    set: func(p *ProductRow, v string) error {
+        if v == "" { return nil }
+        id, err := strconv.ParseInt(v, 10, 64)
+        if err != nil || id <= 0 { return errors.New("not a product id") }
+        p.ID = id
+        return nil
+    },
+}
+
+// sheetColumns is the export layout; sku is the key of the import
+var sheetColumns = []productColumn{
+    idColumn,
+    textColumn("sku", []string{"артикул"}, func(p *ProductRow) *string { return &p.SKU }),
+    textColumn("type", []string{"тип", "категория"}, func(p *ProductRow) *string { return &p.Type }),
+    textColumn("name", []string{"название", "наименование"}, func(p *ProductRow) *string { return &p.Name }),
+    textColumn("size", []string{"размер"}, func(p *ProductRow) *string { return &p.Size }),
+    textColumn("subtype", []string{"подтип"}, func(p *ProductRow) *string { return &p.Subtype }),
+    textColumn("img", []string{"image", "изображение", "картинка"}, func(p *ProductRow) *string { return &p.Img }),
+    numberColumn("price", []string{"цена"}, func(p *ProductRow) *float64 { return &p.Price }),
+    numberColumn("price_per_ton", []string{"цена за тонну", "цена за т"}, func(p *ProductRow) *float64 { return &p.PricePerTon }),
+    numberColumn("thickness_mm", []string{"толщина", "толщина, мм"}, func(p *ProductRow) *float64 { return &p.ThicknessMM }),
+    numberColumn("weight_kg", []string{"вес", "вес, кг"}, func(p *ProductRow) *float64 { return &p.WeightKg }),
+    numberColumn("length_m", []string{"длина", "длина, м"}, func(p *ProductRow) *float64 { return &p.LengthM }),
+    boolColumn("in_stock", []string{"в наличии", "наличие"}, func(p *ProductRow) *bool { return &p.InStock }),
+    boolColumn("featured", []string{"хит"}, func(p *ProductRow) *bool { return &p.Featured }),
+}
+
+// escapeSheetText keeps a spreadsheet from running a text cell as a formula: a leading =, +, - or @
+// gets an apostrophe in front, the usual marker of a literal
+func escapeSheetText(s string) string {
+    if s != "" && strings.ContainsRune("=+-@", rune(s[0])) { return "'" + s }
+    return s
+}
+
+// unescapeSheetText drops the apostrophe escapeSheetText added, so an exported file imports unchanged
+func unescapeSheetText(s string) string {
+    if len(s) > 1 && s[0] == '\'' && strings.ContainsRune("=+-@", rune(s[1])) { return s[1:] }
+    return s
+}
+
+// parseSheetNumber accepts the way spreadsheets print numbers: "1 234,50", "1234.5", "" for 0
+func parseSheetNumber(s string) (float64, error) {
+    s = strings.NewReplacer(" ", "", "\u00a0", "", ",", ".").Replace(strings.TrimSpace(s))
+    if s == "" { return 0, nil }
+    v, err := strconv.ParseFloat(s, 64)
+    if err != nil { return 0, errors.New("not a number") }
+    return v, nil
+}
+
+func parseSheetBool(s string) (bool, error) {
+    switch strings.ToLower(strings.TrimSpace(s)) {
+    case "1", "true", "yes", "y", "да", "+":
+        return true, nil
+    case "0", "false", "no", "n", "нет", "-", "":
+        return false, nil
+    }
+    return false, errors.New("expected 1/0 or да/нет")
+}
+
+// readSheet parses an uploaded CSV or XLSX file into rows of cells
+func readSheet(name string, data []byte) ([][]string, error) {
+    if strings.EqualFold(filepath.Ext(name), ".xlsx") || bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+        return readXLSX(data)
+    }
+    data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+    if !utf8.Valid(data) { return nil, errors.New("csv must be UTF-8") }
+    r := csv.NewReader(bytes.NewReader(data))
+    // spreadsheets in a Russian locale separate CSV fields with ';'
+    if first, _, _ := bytes.Cut(data, []byte("\n")); bytes.Count(first, []byte(";")) > bytes.Count(first, []byte(",")) { r.Comma = ';' }
+    r.FieldsPerRecord = -1
+    return r.ReadAll()
+}
+
+// importIssue is a validation problem of one spreadsheet row (1-based, the header is row 1)
+type importIssue struct {
+    Row     int    `json:"row"`
+    Column  string `json:"column,omitempty"`
+    Message string `json:"message"`
+}
+
+// importRow is the planned change of one valid row
+type importRow struct {
+    Row    int    `json:"row"`
+    Action string `json:"action"` // create or update
+    ID     int64  `json:"id,omitempty"`
+    SKU    string `json:"sku"`
+    Name   string `json:"name"`
+}
+
+type importReport struct {
+    DryRun  bool          `json:"dry_run"`
+    Total   int           `json:"total"`
+    Created int           `json:"created"`
+    Updated int           `json:"updated"`
+    Rows    []importRow   `json:"rows"`
+    Errors  []importIssue `json:"errors"`
+}
+
+// planImport validates rows against the stored products and returns the products to save in
+// file order; updates only overwrite the cells the file fills in
+func planImport(products store.ProductRepo, rows [][]string) ([]ProductRow, importReport, error) {
+    rep := importReport{Rows: []importRow{}, Errors: []importIssue{}}
+    if len(rows) == 0 {
+        rep.Errors = append(rep.Errors, importIssue{Row: 1, Message: "empty file"})
+        return nil, rep, nil
+    }
+    byHeader := map[string]int{}
+    for i, c := range sheetColumns {
+        byHeader[c.Name] = i
+        for _, a := range c.Aliases { byHeader[a] = i }
+    }
+    cols := make([]int, len(rows[0])) // spreadsheet column -> sheetColumns index, -1 to skip
+    seen := map[int]bool{}
+    for i, h := range rows[0] {
+        h = strings.ToLower(strings.TrimSpace(h))
+        ci, ok := byHeader[h]
+        if !ok || seen[ci] { cols[i] = -1; continue }
+        cols[i], seen[ci] = ci, true
+    }
+    if !seen[byHeader["name"]] && !seen[byHeader["sku"]] {
+        rep.Errors = append(rep.Errors, importIssue{Row: 1, Message: "header must name at least a sku or a name column"})
+        return nil, rep, nil
+    }
+
+    var out []ProductRow
+    skuRow := map[string]int{}
+    for r, cells := range rows[1:] {
+        rowNo := r + 2
+        blank := true
+        for _, c := range cells { if strings.TrimSpace(c) != "" { blank = false; break } }
+        if blank { continue }
+        rep.Total++
+        // read the row into a blank product first to learn its sku
+        var in ProductRow
+        set := map[int]bool{}
+        bad := false
+        for i, v := range cells {
+            if i >= len(cols) || cols[i] < 0 { continue }
+            // a blank cell keeps the stored value; a new product keeps the default
+            if v = strings.TrimSpace(v); v == "" { continue }
+            c := sheetColumns[cols[i]]
+            if err := c.set(&in, v); err != nil {
+                rep.Errors = append(rep.Errors, importIssue{Row: rowNo, Column: c.Name, Message: err.Error()})
+                bad = true
+                continue
+            }
+            set[cols[i]] = true
+        }
+        if bad { continue }
+        var existing []ProductRow
+        var err error
+        if in.SKU == "" && in.ID != 0 {
+            // products that never had a sku are exported with a blank one and matched back by id
+            cur, err := products.Get(in.ID)
+            if err == store.ErrNotFound {
+                rep.Errors = append(rep.Errors, importIssue{Row: rowNo, Column: "id", Message: "unknown product id"})
+                continue
+            }
+            if err != nil { return nil, rep, err }
+            existing = []ProductRow{cur}
+        } else {
+            if in.SKU == "" { in.SKU = defaultSKU(in) }
+            if existing, err = products.FindBySKU(in.SKU); err != nil { return nil, rep, err }
+        }
+        if len(existing) > 1 {
+            rep.Errors = append(rep.Errors, importIssue{Row: rowNo, Column: "sku", Message: fmt.Sprintf("sku %s matches %d products", in.SKU, len(existing))})
+            continue
+        }
+        p := ProductRow{InStock: true}
+        action := "create"
+        if len(existing) == 1 {
+            p, action = existing[0], "update"
+        }
+        for ci := range set { sheetColumns[ci].copy(&p, in) }
+        if p.Type == "" || p.Name == "" {
+            rep.Errors = append(rep.Errors, importIssue{Row: rowNo, Message: "type and name required"})
+            continue
+        }
+        if p.SKU == "" { p.SKU = defaultSKU(p) }
+        if prev, ok := skuRow[p.SKU]; ok {
+            rep.Errors = append(rep.Errors, importIssue{Row: rowNo, Column: "sku", Message: fmt.Sprintf("sku %s repeats row %d", p.SKU, prev)})
+            continue
+        }
+        skuRow[p.SKU] = rowNo
+        out = append(out, p)
+        rep.Rows = append(rep.Rows, importRow{Row: rowNo, Action: action, ID: p.ID, SKU: p.SKU, Name: p.Name})
+        if action == "create" { rep.Created++ } else { rep.Updated++ }
+    }
+    return out, rep, nil
+}
+
+// POST /api/admin/products/import takes a CSV or XLSX file (multipart field "file" or the raw
+// body) and reports the planned changes; ?commit=1 applies them when every row is valid
+func adminProductsImportHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+    r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+    name := r.URL.Query().Get("filename")
+    var data []byte
+    var err error
+    if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+        f, hdr, ferr := r.FormFile("file")
+        if ferr != nil { http.Error(w, "file required", 400); return }
+        defer f.Close()
+        name = hdr.Filename
+        data, err = io.ReadAll(f)
+    } else {
+        data, err = io.ReadAll(r.Body)
+    }
+    if err != nil { http.Error(w, "file too large or unreadable", 400); return }
+    rows, err := readSheet(name, data)
+    if err != nil { http.Error(w, "cannot read file: "+err.Error(), 400); return }
+
+    commit := r.URL.Query().Get("commit") == "1"
+    var saved []ProductRow
+    var rep importReport
+    err = st.InTx(func(tx *store.Store) error {
+        var plan []ProductRow
+        var err error
+        plan, rep, err = planImport(tx.Products, rows)
+        if err != nil || !commit || len(rep.Errors) > 0 { return err }
+        for _, p := range plan {
+            p.UnitPrice = unitPrice(p)
+            if p.ID == 0 {
+                err = tx.Products.Create(&p)
+            } else {
+                var old ProductRow
+                if old, err = tx.Products.Get(p.ID); err == nil { err = tx.Products.Update(p) }
+                if err == nil { _, _, err = recordPriceChange(tx.Products, old, p, "import", currentAdminLogin(r)) }
+            }
+            if err != nil { return err }
+            saved = append(saved, p)
+        }
+        return nil
+    })
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    rep.DryRun = len(saved) == 0 && (!commit || len(rep.Errors) > 0)
+    if commit && len(rep.Errors) > 0 { writeJSONStatus(w, http.StatusUnprocessableEntity, rep); return }
+    if len(saved) > 0 {
+        for _, p := range saved {
+            reparseAttributes(p)
+            reindex(productDoc(p))
+        }
+        rebuildSuggestIndex()
+    }
+    writeJSON(w, rep)
+}
+
+// GET /api/admin/products/export?format=csv|xlsx[&type=] downloads the catalog in the import layout
+func adminProductsExportHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
+    format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+    if format == "" { format = "csv" }
+    if format != "csv" && format != "xlsx" { http.Error(w, "format must be csv or xlsx", 400); return }
+    rows, err := st.Products.List(strings.TrimSpace(r.URL.Query().Get("type")))
+    if err != nil { http.Error(w, err.Error(), 500); return }
+
+    header := make([]any, len(sheetColumns))
+    for i, c := range sheetColumns { header[i] = c.Name }
+    table := [][]any{header}
+    for _, p := range rows {
+        line := make([]any, len(sheetColumns))
+        for i, c := range sheetColumns { line[i] = c.get(p) }
+        table = append(table, line)
+    }
+    fileName := "products-" + time.Now().Format("2006-01-02") + "." + format
+    w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+    w.Header().Set("Cache-Control", "no-store")
+    if format == "xlsx" {
+        w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+        _ = writeXLSX(w, "products", table)
+        return
+    }
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    // the BOM makes Excel open the file as UTF-8
+    _, _ = w.Write([]byte("\xef\xbb\xbf"))
+    cw := csv.NewWriter(w)
+    for _, line := range table {
+        rec := make([]string, len(line))
+        for i, v := range line {
+            switch x := v.(type) {
+            case float64:
+                rec[i] = strconv.FormatFloat(x, 'f', -1, 64)
+            case string:
+                rec[i] = escapeSheetText(x)
+            default:
+                rec[i] = fmt.Sprint(v)
+            }
+        }
+        _ = cw.Write(rec)
+    }
+    cw.Flush()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// seedImportProducts stores a product with a sku, one exported without a sku and two sharing a sku
+func seedImportProducts(t *testing.T) (rebar, angle ProductRow) {
+    t.Helper()
+    rebar = ProductRow{SKU: "A-1", Type: "armatura", Name: "Арматура", Size: "12", Price: 100, LengthM: 11.7, InStock: true}
+    angle = ProductRow{Type: "ugolok", Name: "Уголок", Size: "50x5", Price: 300, InStock: true}
+    for _, p := range []*ProductRow{&rebar, &angle, {SKU: "DUP", Type: "list", Name: "Лист 2"}, {SKU: "DUP", Type: "list", Name: "Лист 3"}} {
+        if err := st.Products.Create(p); err != nil { t.Fatal(err) }
+    }
+    return rebar, angle
+}
+
+func TestPlanImport(t *testing.T) {
+    useTestStore(t)
+    rebar, angle := seedImportProducts(t)
+    // as a spreadsheet in a Russian locale saves it: BOM, ';' separators, decimal commas, Russian headers
+    file := "\xef\xbb\xbfid;Артикул;name;type;Цена;length_m;В наличии\n" +
+        ";A-1;;;120,5;;\n" +
+        fmt.Sprintf("%d;;Уголок равнополочный;;;;\n", angle.ID) +
+        ";NEW-1;Лист г/к;list;5 000;;да\n" +
+        ";;;;;;\n" +
+        ";A-1;;;130;;\n" +
+        ";DUP;;;1;;\n" +
+        ";X-1;Труба;truba;сто;;может\n" +
+        "999;;;;;;\n" +
+        ";X-2;;armatura;1;;\n"
+    rows, err := readSheet("prices.csv", []byte(file))
+    if err != nil { t.Fatal(err) }
+    plan, rep, err := planImport(st.Products, rows)
+    if err != nil { t.Fatal(err) }
+
+    wantRows := []importRow{
+        {Row: 2, Action: "update", ID: rebar.ID, SKU: "A-1", Name: "Арматура"},
+        // matched by id; it had no sku, so it gets the generated one
+        {Row: 3, Action: "update", ID: angle.ID, SKU: defaultSKU(ProductRow{Type: "ugolok", Name: "Уголок равнополочный", Size: "50x5"}), Name: "Уголок равнополочный"},
+        {Row: 4, Action: "create", SKU: "NEW-1", Name: "Лист г/к"},
+    }
+    if !reflect.DeepEqual(rep.Rows, wantRows) { t.Errorf("rows = %+v\nwant %+v", rep.Rows, wantRows) }
+    wantErrors := []importIssue{
+        {Row: 6, Column: "sku", Message: "sku A-1 repeats row 2"},
+        {Row: 7, Column: "sku", Message: "sku DUP matches 2 products"},
+        {Row: 8, Column: "price", Message: "not a number"},
+        {Row: 8, Column: "in_stock", Message: "expected 1/0 or да/нет"},
+        {Row: 9, Column: "id", Message: "unknown product id"},
+        {Row: 10, Message: "type and name required"},
+    }
+    if !reflect.DeepEqual(rep.Errors, wantErrors) { t.Errorf("errors = %+v\nwant %+v", rep.Errors, wantErrors) }
+    // the blank row 5 is not counted
+    if rep.Total != 8 || rep.Created != 1 || rep.Updated != 2 { t.Errorf("total %d, created %d, updated %d; want 8, 1, 2", rep.Total, rep.Created, rep.Updated) }
+
+    if len(plan) != 3 { t.Fatalf("plan has %d products, want 3", len(plan)) }
+    // blank cells keep what is stored
+    if p := plan[0]; p.Price != 120.5 || p.Name != "Арматура" || p.Size != "12" || p.LengthM != 11.7 || !p.InStock { t.Errorf("updated rebar = %+v", p) }
+    if p := plan[1]; p.Price != 300 || p.Type != "ugolok" || p.Size != "50x5" { t.Errorf("updated angle = %+v", p) }
+    if p := plan[2]; p.Price != 5000 || !p.InStock || p.ID != 0 { t.Errorf("new sheet = %+v", p) }
+
+    _, rep, err = planImport(st.Products, [][]string{{"цена", "размер"}, {"1", "12"}})
+    if err != nil { t.Fatal(err) }
+    if len(rep.Errors) != 1 || rep.Errors[0].Row != 1 { t.Errorf("header without sku or name: errors = %+v", rep.Errors) }
+}
+
+func TestImportCommitRefusedWithErrors(t *testing.T) {
+    useTestStore(t)
+    rebar, _ := seedImportProducts(t)
+    post := func(query, file string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        adminProductsImportHandler(w, httptest.NewRequest(http.MethodPost, "/api/admin/products/import?filename=prices.csv&"+query, strings.NewReader(file)))
+        return w
+    }
+    bad := "sku,price\nA-1,150\nDUP,1\n"
+    if w := post("commit=1", bad); w.Code != http.StatusUnprocessableEntity { t.Fatalf("commit with an invalid row: %d, want 422", w.Code) }
+    if p, _ := st.Products.Get(rebar.ID); p.Price != 100 { t.Errorf("valid row of a refused file applied: price %v", p.Price) }
+
+    // a dry run reports and writes nothing
+    w := post("", "sku,price\nA-1,150\n")
+    var rep importReport
+    if err := json.Unmarshal(w.Body.Bytes(), &rep); err != nil || w.Code != 200 || !rep.DryRun || rep.Updated != 1 { t.Fatalf("dry run: %d %s", w.Code, w.Body) }
+    if p, _ := st.Products.Get(rebar.ID); p.Price != 100 { t.Errorf("dry run applied: price %v", p.Price) }
+
+    if w := post("commit=1", "sku,price\nA-1,150\n"); w.Code != 200 { t.Fatalf("commit: %d %s", w.Code, w.Body) }
+    p, _ := st.Products.Get(rebar.ID)
+    if p.Price != 150 || p.UnitPrice != unitPrice(p) { t.Errorf("after commit: price %v, unit price %v", p.Price, p.UnitPrice) }
+}
+
+func TestEscapeSheetText(t *testing.T) {
+    cases := []struct{ in, out string }{
+        {"Арматура", "Арматура"},
+        {"=1+1", "'=1+1"},
+        {"+7 999", "'+7 999"},
+        {"-10", "'-10"},
+        {"@SUM(A1)", "'@SUM(A1)"},
+        {"'quoted", "'quoted"},
+        {"", ""},
+    }
+    for _, c := range cases {
+        if got := escapeSheetText(c.in); got != c.out { t.Errorf("escapeSheetText(%q) = %q, want %q", c.in, got, c.out) }
+        if got := unescapeSheetText(c.out); got != c.in { t.Errorf("unescapeSheetText(%q) = %q, want %q", c.out, got, c.in) }
+    }
+}
+
+// a name or sku that looks like a formula is exported as text and imports back unchanged
+func TestExportCSVEscapesFormulas(t *testing.T) {
+    useTestStore(t)
+    p := ProductRow{SKU: "-A-1", Type: "armatura", Name: `=HYPERLINK("http://example.com","Арматура")`, Size: "12", Price: 100, InStock: true}
+    if err := st.Products.Create(&p); err != nil { t.Fatal(err) }
+    w := httptest.NewRecorder()
+    adminProductsExportHandler(w, httptest.NewRequest(http.MethodGet, "/api/admin/products/export?format=csv", nil))
+    if w.Code != 200 { t.Fatalf("export: %d", w.Code) }
+    rows, err := readSheet("products.csv", w.Body.Bytes())
+    if err != nil { t.Fatal(err) }
+    if len(rows) != 2 { t.Fatalf("%d rows exported, want the header and 1", len(rows)) }
+    cells := map[string]string{}
+    for i, h := range rows[0] { cells[h] = rows[1][i] }
+    if cells["sku"] != "'-A-1" || cells["name"] != "'"+p.Name || cells["size"] != "12" { t.Errorf("exported sku %q, name %q, size %q", cells["sku"], cells["name"], cells["size"]) }
+
+    plan, rep, err := planImport(st.Products, rows)
+    if err != nil { t.Fatal(err) }
+    if len(rep.Errors) != 0 || len(plan) != 1 || rep.Updated != 1 { t.Fatalf("re-import: %+v", rep) }
+    if plan[0].ID != p.ID || plan[0].SKU != p.SKU || plan[0].Name != p.Name { t.Errorf("re-imported as %+v", plan[0]) }
+}
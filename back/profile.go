@@ -0,0 +1,134 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+
+    "golang.org/x/crypto/bcrypt"
+
+    "metal-main/back/store"
+)
+
+// profileView is what the cabinet shows and edits; login is fixed at registration
+// because orders are attributed to it
+type profileView struct {
+    ID    int64  `json:"id"`
+    Login string `json:"login"`
+    Name  string `json:"name"`
+    Email string `json:"email"`
+    Phone string `json:"phone"`
+    store.Profile
+    // Company is the company an admin linked the account to; its requisites replace the profile's on orders
+    Company *companyView `json:"company,omitempty"`
+}
+
+// companyView is what the users of a company see of it
+type companyView struct {
+    Name         string  `json:"name"`
+    INN          string  `json:"inn"`
+    KPP          string  `json:"kpp"`
+    LegalAddress string  `json:"legal_address"`
+    CreditLimit  float64 `json:"credit_limit"`
+    PaymentDays  int     `json:"payment_days"`
+}
+
+func newProfileView(u store.User) profileView {
+    name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+    v := profileView{ID: u.ID, Login: u.Login, Name: name, Email: u.Email, Phone: u.Phone, Profile: u.Profile}
+    if c, ok := accountCompany(u); ok {
+        v.Company = &companyView{Name: c.Name, INN: c.INN, KPP: c.KPP, LegalAddress: c.LegalAddress, CreditLimit: c.CreditLimit, PaymentDays: c.PaymentDays}
+    }
+    return v
+}
+
+// profileUpdate holds the fields of a PATCH; absent fields keep their value
+type profileUpdate struct {
+    FirstName      *string `json:"first_name"`
+    LastName       *string `json:"last_name"`
+    Email          *string `json:"email"`
+    Phone          *string `json:"phone"`
+    CompanyName    *string `json:"company_name"`
+    INN            *string `json:"inn"`
+    KPP            *string `json:"kpp"`
+    CompanyAddress *string `json:"company_address"`
+}
+
+func setTrimmed(dst *string, src *string) {
+    if src != nil { *dst = strings.TrimSpace(*src) }
+}
+
+func allDigits(s string) bool {
+    for _, c := range s {
+        if c < '0' || c > '9' { return false }
+    }
+    return true
+}
+
+// validateProfile returns a client-facing error message or ""
+func validateProfile(u store.User) string {
+    if u.Email == "" && u.Phone == "" { return "email or phone required" }
+    if u.Email != "" && !strings.Contains(u.Email, "@") { return "invalid email" }
+    if u.INN != "" && (!allDigits(u.INN) || (len(u.INN) != 10 && len(u.INN) != 12)) { return "inn must be 10 or 12 digits" }
+    if u.KPP != "" && (!allDigits(u.KPP) || len(u.KPP) != 9) { return "kpp must be 9 digits" }
+    return ""
+}
+
+// GET/PATCH (POST accepted for the cabinet form): /api/profile
+func profileHandler(w http.ResponseWriter, r *http.Request) {
+    s, ok := sessionFromRequest(r, userSessionCookieName)
+    if !ok { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    u, err := st.Users.Get(s.UserID)
+    if err != nil { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+
+    switch r.Method {
+    case http.MethodGet:
+        writeJSON(w, newProfileView(u))
+    case http.MethodPatch, http.MethodPost:
+        var in profileUpdate
+        if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+        setTrimmed(&u.FirstName, in.FirstName)
+        setTrimmed(&u.LastName, in.LastName)
+        setTrimmed(&u.Email, in.Email)
+        setTrimmed(&u.Phone, in.Phone)
+        setTrimmed(&u.CompanyName, in.CompanyName)
+        setTrimmed(&u.INN, in.INN)
+        setTrimmed(&u.KPP, in.KPP)
+        setTrimmed(&u.CompanyAddress, in.CompanyAddress)
+        if msg := validateProfile(u); msg != "" { http.Error(w, msg, 400); return }
+        // same duplicate rule as publicRegister, ignoring the account itself
+        c, err := st.Users.CountOthersByContact(u.ID, u.Email, u.Phone)
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        if c > 0 { http.Error(w, "email or phone already in use", 409); return }
+        if err := st.Users.UpdateProfile(u); err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, newProfileView(u))
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// POST /api/profile/password {current_password, new_password}
+// Every session of the account is revoked and the current browser gets a fresh one.
+func profilePasswordHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    s, ok := sessionFromRequest(r, userSessionCookieName)
+    if !ok { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    u, err := st.Users.Get(s.UserID)
+    if err != nil { http.Error(w, "unauthorized", http.StatusUnauthorized); return }
+    var in struct {
+        Current string `json:"current_password"`
+        New     string `json:"new_password"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if strings.TrimSpace(in.New) == "" { http.Error(w, "new password required", 400); return }
+    key := lockoutKey("user", u.Login)
+    if !checkLockout(w, key) { return }
+    if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(in.Current)) != nil { loginLockout.fail(key); http.Error(w, "current password is incorrect", 403); return }
+    loginLockout.reset(key)
+    hash, err := bcrypt.GenerateFromPassword([]byte(in.New), bcrypt.DefaultCost)
+    if err != nil { http.Error(w, err.Error(), 500); return }
+    if err := st.Users.SetPassword(u.ID, string(hash)); err != nil { http.Error(w, err.Error(), 500); return }
+    if err := revokeUserSessions(u.ID); err != nil { http.Error(w, err.Error(), 500); return }
+    if err := setUserSession(w, r, u.ID); err != nil { http.Error(w, err.Error(), 500); return }
+    writeJSON(w, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "metal-main/back/store"
+)
+
+// Rolled metal is sold by the piece but ordered in whatever unit the customer thinks in: metres
+// or tonnes of rebar, square metres of sheet. A quote converts a quantity in any unit the product
+// supports into pieces, total length or area, total weight and price. Rolled stock is measured
+// through its linear mass (weight_kg of a length_m piece); sheets through the dimensions in their
+// size and thickness_mm. The amount asked for is priced exactly; pieces is the number of whole
+// pieces it is cut from.
+
+// Quantity units
+const (
+    unitPiece = "pcs"
+    unitMetre = "m"
+    unitSqM   = "m2"
+    unitTon   = "t"
+    unitKg    = "kg"
+)
+
+var (
+    errBadUnit = errors.New("unit not available for this product")
+    errBadQty  = errors.New("quantity must be positive")
+)
+
+// unitLabels are the short Russian names of the units for messages and pages
+var unitLabels = map[string]string{unitPiece: "шт.", unitMetre: "м", unitSqM: "м²", unitTon: "т", unitKg: "кг"}
+
+// sheetCategories are the top-level categories sold as sheets: a piece is a sheet measured by its area
+var sheetCategories = map[string]bool{"listovoy-prokat": true, "profnastil": true}
+
+// steelKgPerM2mm is the weight of a square metre of 1 mm steel sheet (7850 kg/m³)
+const steelKgPerM2mm = 7.85
+
+// productMeasure describes one piece of a product
+type productMeasure struct {
+    Sheet    bool
+    LengthM  float64 // length of a piece of rolled stock; 1 when the product does not say
+    AreaM2   float64 // area of a sheet, 0 when its size does not say
+    WeightKg float64 // weight of one piece, 0 when unknown
+}
+
+// measureProduct reads the piece geometry of p
+func measureProduct(p ProductRow) productMeasure {
+    m := productMeasure{Sheet: sheetCategories[categoryToTypeSlug(normalizeTypeSlug(p.Type))], WeightKg: p.WeightKg}
+    if !m.Sheet {
+        m.LengthM = p.LengthM
+        if m.LengthM <= 0 { m.LengthM = 1 }
+        return m
+    }
+    thickness := p.ThicknessMM
+    dims := parseDims(foldAttrText(p.Size))
+    if len(dims) < 2 { dims = parseDims(foldAttrText(p.Name)) }
+    // "3х1250х2500" is thickness, width and length; "1250х2500" width and length
+    if len(dims) >= 3 {
+        if thickness <= 0 { thickness = dims[0] }
+        dims = dims[1:3]
+    }
+    if len(dims) == 2 {
+        m.AreaM2 = sheetMetres(dims[0]) * sheetMetres(dims[1])
+    }
+    if m.WeightKg <= 0 && thickness > 0 && m.AreaM2 > 0 {
+        m.WeightKg = m.AreaM2 * thickness * steelKgPerM2mm
+    }
+    return m
+}
+
+// sheetMetres takes sheet sides written in millimetres (1250) or metres (1.25)
+func sheetMetres(v float64) float64 {
+    if v > 20 { return v / 1000 }
+    return v
+}
+
+// units lists the units a product with this geometry can be quoted in; the first is its base unit
+func (m productMeasure) units() []string {
+    out := []string{unitMetre, unitPiece}
+    if m.Sheet {
+        out = []string{unitPiece}
+        if m.AreaM2 > 0 { out = append(out, unitSqM) }
+    }
+    if m.WeightKg > 0 { out = append(out, unitTon, unitKg) }
+    return out
+}
+
+func (m productMeasure) supports(unit string) bool {
+    for _, u := range m.units() {
+        if u == unit { return true }
+    }
+    return false
+}
+
+// perPiece is how much of unit one piece holds
+func (m productMeasure) perPiece(unit string) float64 {
+    switch unit {
+    case unitPiece:
+        return 1
+    case unitMetre:
+        return m.LengthM
+    case unitSqM:
+        return m.AreaM2
+    case unitTon:
+        return m.WeightKg / 1000
+    case unitKg:
+        return m.WeightKg
+    }
+    return 0
+}
+
+// piecePrice is the price of one piece of p: the explicit price is per metre of rolled stock and
+// per sheet, price_per_ton goes through the weight of the piece; 0 means price on request
+func piecePrice(p ProductRow, m productMeasure) float64 {
+    switch {
+    case p.Price > 0 && m.Sheet:
+        return p.Price
+    case p.Price > 0:
+        return p.Price * m.LengthM
+    case p.PricePerTon > 0 && m.WeightKg > 0:
+        return p.PricePerTon * m.WeightKg / 1000
+    }
+    return 0
+}
+
+// quote is the price of a quantity of one product
+type quote struct {
+    ProductID int64    `json:"product_id"`
+    Qty       float64  `json:"qty"`
+    Unit      string   `json:"unit"`
+    Pieces    int      `json:"pieces"`
+    LengthM   float64  `json:"length_m,omitempty"`
+    AreaM2    float64  `json:"area_m2,omitempty"`
+    WeightKg  float64  `json:"weight_kg,omitempty"`
+    UnitPrice float64  `json:"unit_price"` // per Unit; 0 while the price is on request
+    Total     float64  `json:"total"`
+    Units     []string `json:"units"`
+    // set when a pricing rule lowered the price: the list price and total before it and the rule
+    ListPrice float64      `json:"list_price,omitempty"`
+    ListTotal float64      `json:"list_total,omitempty"`
+    Rule      *appliedRule `json:"rule,omitempty"`
+}
+
+// quoteProduct prices qty of p in unit, or in the product's base unit when unit is empty
+func quoteProduct(p ProductRow, qty float64, unit string) (quote, error) {
+    m := measureProduct(p)
+    unit = strings.ToLower(strings.TrimSpace(unit))
+    if unit == "" { unit = m.units()[0] }
+    if !m.supports(unit) { return quote{}, fmt.Errorf("%w: %s", errBadUnit, unit) }
+    if !(qty > 0) || math.IsInf(qty, 0) { return quote{}, errBadQty }
+
+    pieces := qty / m.perPiece(unit)
+    q := quote{ProductID: p.ID, Qty: qty, Unit: unit, Units: m.units()}
+    // a hair over a whole number is float noise, not another piece
+    q.Pieces = int(math.Ceil(pieces - 1e-9))
+    if m.Sheet {
+        q.AreaM2 = round3(pieces * m.AreaM2)
+    } else {
+        q.LengthM = round3(pieces * m.LengthM)
+    }
+    q.WeightKg = round3(pieces * m.WeightKg)
+    price := piecePrice(p, m)
+    q.Total = roundKop(pieces * price)
+    q.UnitPrice = roundKop(price / m.perPiece(unit))
+    return q, nil
+}
+
+// convertQty re-expresses qty in unit from as an amount in unit to, for merging cart lines
+func convertQty(p ProductRow, qty float64, from, to string) (float64, error) {
+    if from == to { return qty, nil }
+    m := measureProduct(p)
+    for _, u := range []string{from, to} {
+        if !m.supports(u) { return 0, fmt.Errorf("%w: %s", errBadUnit, u) }
+    }
+    return round3(qty / m.perPiece(from) * m.perPiece(to)), nil
+}
+
+func round3(v float64) float64 { return math.Round(v*1000) / 1000 }
+
+// formatQty prints a quantity with its unit label: "12 м", "1.5 т", "3 шт."
+func formatQty(qty float64, unit string) string {
+    label, ok := unitLabels[unit]
+    if !ok { label = unitLabels[unitPiece] }
+    return strconv.FormatFloat(qty, 'f', -1, 64) + " " + label
+}
+
+// GET /api/catalog/quote?id=&qty=&unit= or POST {item_id, qty, unit} prices a quantity of one
+// product with the pricing rules of the customer; an out-of-stock product is quoted all the same
+func handleQuote(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        ItemID string  `json:"item_id"`
+        Qty    float64 `json:"qty"`
+        Unit   string  `json:"unit"`
+    }
+    switch r.Method {
+    case http.MethodGet:
+        q := r.URL.Query()
+        in.ItemID, in.Unit = q.Get("id"), q.Get("unit")
+        in.Qty = 1
+        if s := strings.TrimSpace(q.Get("qty")); s != "" {
+            v, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+            if err != nil { http.Error(w, "bad qty", http.StatusBadRequest); return }
+            in.Qty = v
+        }
+    case http.MethodPost:
+        if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", http.StatusBadRequest); return }
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    id, err := strconv.ParseInt(strings.TrimSpace(in.ItemID), 10, 64)
+    if err != nil || id <= 0 { http.Error(w, "id required", http.StatusBadRequest); return }
+    p, err := st.Products.Get(id)
+    if err == store.ErrNotFound { err = fmt.Errorf("%w: %q", errUnknownProduct, in.ItemID) }
+    if err != nil { writePricingError(w, err); return }
+    q, err := quoteProduct(p, in.Qty, in.Unit)
+    if err != nil { writePricingError(w, err); return }
+    rules, err := currentPriceRules(r)
+    if err != nil { writePricingError(w, err); return }
+    writeJSON(w, rules.apply(p, q))
+}
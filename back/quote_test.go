@@ -0,0 +1,106 @@
+package main
+
+import (
+    "errors"
+    "testing"
+)
+
+var (
+    // a 10 m bar of 20 kg at 50 000 ₽/t: 1000 ₽ a bar, 100 ₽ a metre
+    testRebar = ProductRow{ID: 1, Type: "armatura", Name: "Арматура", Size: "12", LengthM: 10, WeightKg: 20, PricePerTon: 50000}
+    // priced per metre, weight unknown
+    testPipe = ProductRow{ID: 2, Type: "truba-profilnaya", Name: "Труба", Size: "40х20х2", LengthM: 6, Price: 120}
+    // 3 mm sheet of 1.25 x 2.5 m without a weight: 3.125 m², 73.59375 kg, 5887.5 ₽
+    testSheet = ProductRow{ID: 3, Type: "listovoy-prokat", Name: "Лист г/к", Size: "3х1250х2500", PricePerTon: 80000}
+)
+
+func TestQuoteProduct(t *testing.T) {
+    cases := []struct {
+        name      string
+        p         ProductRow
+        qty       float64
+        unit      string
+        wantUnit  string
+        pieces    int
+        lengthM   float64
+        areaM2    float64
+        weightKg  float64
+        unitPrice float64
+        total     float64
+    }{
+        {"base unit of rolled stock is the metre", testRebar, 25, "", unitMetre, 3, 25, 0, 50, 100, 2500},
+        {"tonnes", testRebar, 0.1, unitTon, unitTon, 5, 50, 0, 100, 50000, 5000},
+        {"kilograms", testRebar, 30, unitKg, unitKg, 2, 15, 0, 30, 50, 1500},
+        {"pieces", testRebar, 2, unitPiece, unitPiece, 2, 20, 0, 40, 1000, 2000},
+        {"explicit price is per metre", testPipe, 12, unitPiece, unitPiece, 12, 72, 0, 0, 720, 8640},
+        {"sheet weight from its size and thickness", testSheet, 1, "", unitPiece, 1, 0, 3.125, 73.594, 5887.5, 5887.5},
+        {"sheet by area", testSheet, 6.25, unitSqM, unitSqM, 2, 0, 6.25, 147.188, 1884, 11775},
+        {"price on request", ProductRow{ID: 4, Type: "armatura", LengthM: 11.7}, 2, "", unitMetre, 1, 2, 0, 0, 0, 0},
+    }
+    for _, c := range cases {
+        q, err := quoteProduct(c.p, c.qty, c.unit)
+        if err != nil { t.Errorf("%s: %v", c.name, err); continue }
+        if q.Unit != c.wantUnit || q.Pieces != c.pieces || q.LengthM != c.lengthM || q.AreaM2 != c.areaM2 || q.WeightKg != c.weightKg || q.UnitPrice != c.unitPrice || q.Total != c.total {
+            t.Errorf("%s: got %s, %d pcs, %v m, %v m², %v kg, %v ₽/unit, %v ₽; want %s, %d pcs, %v m, %v m², %v kg, %v ₽/unit, %v ₽", c.name,
+                q.Unit, q.Pieces, q.LengthM, q.AreaM2, q.WeightKg, q.UnitPrice, q.Total,
+                c.wantUnit, c.pieces, c.lengthM, c.areaM2, c.weightKg, c.unitPrice, c.total)
+        }
+    }
+}
+
+func TestQuoteProductErrors(t *testing.T) {
+    cases := []struct {
+        name string
+        p    ProductRow
+        qty  float64
+        unit string
+        want error
+    }{
+        {"no weight, no tonnes", testPipe, 1, unitTon, errBadUnit},
+        {"sheets are not sold by the metre", testSheet, 1, unitMetre, errBadUnit},
+        {"unknown unit", testRebar, 1, "ft", errBadUnit},
+        {"zero quantity", testRebar, 0, unitMetre, errBadQty},
+        {"negative quantity", testRebar, -1, unitMetre, errBadQty},
+    }
+    for _, c := range cases {
+        if _, err := quoteProduct(c.p, c.qty, c.unit); !errors.Is(err, c.want) { t.Errorf("%s: err = %v, want %v", c.name, err, c.want) }
+    }
+}
+
+func TestUnitPrice(t *testing.T) {
+    cases := []struct {
+        p    ProductRow
+        want float64
+    }{
+        {testRebar, 100},
+        {testPipe, 120},
+        {testSheet, 5887.5},
+        {ProductRow{Type: "armatura"}, 0},
+    }
+    for _, c := range cases {
+        if got := unitPrice(c.p); got != c.want { t.Errorf("unitPrice(%s %s) = %v, want %v", c.p.Name, c.p.Size, got, c.want) }
+    }
+}
+
+func TestConvertQty(t *testing.T) {
+    cases := []struct {
+        p        ProductRow
+        qty      float64
+        from, to string
+        want     float64
+        err      error
+    }{
+        {testRebar, 1, unitTon, unitMetre, 500, nil},
+        {testRebar, 3, unitPiece, unitMetre, 30, nil},
+        {testRebar, 25, unitMetre, unitKg, 50, nil},
+        {testRebar, 7, unitMetre, unitMetre, 7, nil},
+        {testSheet, 6.25, unitSqM, unitPiece, 2, nil},
+        {testPipe, 6, unitMetre, unitTon, 0, errBadUnit},
+    }
+    for _, c := range cases {
+        got, err := convertQty(c.p, c.qty, c.from, c.to)
+        if !errors.Is(err, c.err) || got != c.want {
+            t.Errorf("convertQty(%v %s → %s) = %v, %v; want %v, %v", c.qty, c.from, c.to, got, err, c.want, c.err)
+        }
+    }
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Throttling is in memory: one process serves the shop, and a restart simply forgets the counters.
+
+// tokenLimiter keeps one token bucket per key: up to burst requests at once, refilled at rate per second
+type tokenLimiter struct {
+    rate   float64
+    burst  float64
+    mu     sync.Mutex
+    bucket map[string]*tokenBucket
+    pruned time.Time
+}
+
+type tokenBucket struct {
+    tokens float64
+    last   time.Time
+}
+
+// newLimiter allows n requests per period with bursts of up to n
+func newLimiter(n int, per time.Duration) *tokenLimiter {
+    return &tokenLimiter{rate: float64(n) / per.Seconds(), burst: float64(n), bucket: map[string]*tokenBucket{}}
+}
+
+// take spends one token of key; when none is left it reports how long until the next one
+func (l *tokenLimiter) take(key string, now time.Time) (bool, time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.prune(now)
+    b, ok := l.bucket[key]
+    if !ok {
+        b = &tokenBucket{tokens: l.burst, last: now}
+        l.bucket[key] = b
+    }
+    b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+    b.last = now
+    if b.tokens >= 1 {
+        b.tokens--
+        return true, 0
+    }
+    return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// prune drops buckets that have refilled completely; they are equivalent to new ones
+func (l *tokenLimiter) prune(now time.Time) {
+    if now.Sub(l.pruned) < time.Minute { return }
+    l.pruned = now
+    for k, b := range l.bucket {
+        if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst { delete(l.bucket, k) }
+    }
+}
+
+// rateRule configures the limits of one route. PerAccount applies to signed-in users and admins.
+type rateRule struct {
+    PerIP      *tokenLimiter
+    PerAccount *tokenLimiter
+}
+
+var (
+    loginRate    = rateRule{PerIP: newLimiter(10, time.Minute)}
+    registerRate = rateRule{PerIP: newLimiter(5, 10*time.Minute)}
+    recoveryRate = rateRule{PerIP: newLimiter(5, 15*time.Minute)}
+    checkoutRate = rateRule{PerIP: newLimiter(5, time.Minute), PerAccount: newLimiter(10, 10*time.Minute)}
+    accountRate  = rateRule{PerIP: newLimiter(10, time.Minute), PerAccount: newLimiter(5, 15*time.Minute)}
+)
+
+// rateLimited throttles state-changing requests to h; reads pass through
+func rateLimited(rule rateRule, h http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions { h(w, r); return }
+        now := time.Now()
+        if rule.PerIP != nil {
+            if ok, wait := rule.PerIP.take(clientIP(r), now); !ok { tooManyRequests(w, wait); return }
+        }
+        if rule.PerAccount != nil {
+            if login := requestAccount(r); login != "" {
+                if ok, wait := rule.PerAccount.take(login, now); !ok { tooManyRequests(w, wait); return }
+            }
+        }
+        h(w, r)
+    }
+}
+
+func requestAccount(r *http.Request) string {
+    if login := currentUserLogin(r); login != "" { return "user:" + login }
+    if login := currentAdminLogin(r); login != "" { return "admin:" + login }
+    return ""
+}
+
+func tooManyRequests(w http.ResponseWriter, wait time.Duration) {
+    w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+    http.Error(w, "too many requests", http.StatusTooManyRequests)
+}
+
+// accountLockout locks an account for lockoutPeriod after lockoutAttempts failed passwords
+// within lockoutPeriod, whichever IPs they came from
+type accountLockout struct {
+    mu       sync.Mutex
+    failures map[string][]time.Time
+    until    map[string]time.Time
+    pruned   time.Time
+}
+
+const (
+    lockoutAttempts = 5
+    lockoutPeriod   = 15 * time.Minute
+)
+
+var loginLockout = &accountLockout{failures: map[string][]time.Time{}, until: map[string]time.Time{}}
+
+func lockoutKey(kind, account string) string { return kind + ":" + strings.ToLower(strings.TrimSpace(account)) }
+
+// locked returns how long the account stays locked, or 0
+func (a *accountLockout) locked(key string) time.Duration {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    a.prune(time.Now())
+    until, ok := a.until[key]
+    if !ok { return 0 }
+    if d := time.Until(until); d > 0 { return d }
+    delete(a.until, key)
+    return 0
+}
+
+// fail records a failed attempt and reports whether it locked the account
+func (a *accountLockout) fail(key string) bool {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    now := time.Now()
+    a.prune(now)
+    recent := a.failures[key][:0]
+    for _, t := range a.failures[key] {
+        if now.Sub(t) < lockoutPeriod { recent = append(recent, t) }
+    }
+    recent = append(recent, now)
+    if len(recent) >= lockoutAttempts {
+        delete(a.failures, key)
+        a.until[key] = now.Add(lockoutPeriod)
+        return true
+    }
+    a.failures[key] = recent
+    return false
+}
+
+// prune forgets expired locks and accounts whose last failure is older than lockoutPeriod,
+// so guessed logins do not pile up in memory
+func (a *accountLockout) prune(now time.Time) {
+    if now.Sub(a.pruned) < time.Minute { return }
+    a.pruned = now
+    for k, ts := range a.failures {
+        if len(ts) == 0 || now.Sub(ts[len(ts)-1]) >= lockoutPeriod { delete(a.failures, k) }
+    }
+    for k, until := range a.until {
+        if !now.Before(until) { delete(a.until, k) }
+    }
+}
+
+func (a *accountLockout) reset(key string) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    delete(a.failures, key)
+    delete(a.until, key)
+}
+
+// checkLockout answers 429 and returns false while key is locked
+func checkLockout(w http.ResponseWriter, key string) bool {
+    if wait := loginLockout.locked(key); wait > 0 {
+        w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+        http.Error(w, "account temporarily locked after failed attempts", http.StatusTooManyRequests)
+        return false
+    }
+    return true
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "testing"
+    "time"
+)
+
+func TestAccountLockout(t *testing.T) {
+    a := &accountLockout{failures: map[string][]time.Time{}, until: map[string]time.Time{}}
+    key := lockoutKey("user", " Ivan ")
+    if key != lockoutKey("user", "ivan") { t.Fatalf("key %q depends on case and spaces", key) }
+    for i := 1; i < lockoutAttempts; i++ {
+        if a.fail(key) { t.Fatalf("locked after %d failures", i) }
+    }
+    if a.locked(key) != 0 { t.Fatal("locked before the last attempt") }
+    if !a.fail(key) { t.Fatal("not locked after lockoutAttempts failures") }
+    if d := a.locked(key); d <= 0 || d > lockoutPeriod { t.Fatalf("locked for %v", d) }
+
+    a.fail(lockoutKey("user", "guess"))
+    a.prune(time.Now().Add(lockoutPeriod + time.Second))
+    if len(a.failures) != 0 || len(a.until) != 0 { t.Errorf("prune kept %d failures and %d locks", len(a.failures), len(a.until)) }
+}
+
+func TestTokenLimiterTake(t *testing.T) {
+    // 3 requests a minute: one token every 20 s
+    l := newLimiter(3, time.Minute)
+    t0 := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+    steps := []struct {
+        after time.Duration
+        key   string
+        ok    bool
+        wait  time.Duration
+    }{
+        {0, "a", true, 0},
+        {0, "a", true, 0},
+        {0, "a", true, 0},
+        {0, "a", false, 20 * time.Second},
+        {0, "b", true, 0}, // keys have their own buckets
+        {10 * time.Second, "a", false, 10 * time.Second},
+        {20 * time.Second, "a", true, 0},
+        {20 * time.Second, "a", false, 20 * time.Second},
+        // a full interval refills the whole burst, never more
+        {2 * time.Minute, "a", true, 0},
+        {2 * time.Minute, "a", true, 0},
+        {2 * time.Minute, "a", true, 0},
+        {2 * time.Minute, "a", false, 20 * time.Second},
+    }
+    for i, s := range steps {
+        ok, wait := l.take(s.key, t0.Add(s.after))
+        if ok != s.ok || (wait-s.wait).Abs() > time.Millisecond { t.Errorf("step %d (%s at +%v): %v, wait %v; want %v, wait %v", i, s.key, s.after, ok, wait, s.ok, s.wait) }
+    }
+    // buckets that refilled are dropped
+    l.take("c", t0.Add(10*time.Minute))
+    if _, ok := l.bucket["a"]; ok { t.Error("refilled bucket kept") }
+}
+
+func TestRateLimited(t *testing.T) {
+    t.Setenv("TRUST_PROXY", "")
+    h := rateLimited(rateRule{PerIP: newLimiter(2, 7*time.Second)}, func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+    send := func(method, ip, forwarded string) *httptest.ResponseRecorder {
+        r := httptest.NewRequest(method, "/api/user/login", nil)
+        r.RemoteAddr = ip + ":40000"
+        if forwarded != "" { r.Header.Set("X-Forwarded-For", forwarded) }
+        w := httptest.NewRecorder()
+        h(w, r)
+        return w
+    }
+    for i := 0; i < 2; i++ {
+        if w := send(http.MethodPost, "10.0.0.1", ""); w.Code != http.StatusNoContent { t.Fatalf("request %d: %d", i+1, w.Code) }
+    }
+    // a forged proxy header does not buy a fresh bucket
+    w := send(http.MethodPost, "10.0.0.1", "203.0.113.9")
+    if w.Code != http.StatusTooManyRequests { t.Fatalf("over the limit: %d, want 429", w.Code) }
+    // the next token is a little under 3.5 s away, rounded up to whole seconds
+    if got := w.Header().Get("Retry-After"); got != "4" { t.Errorf("Retry-After = %q, want 4", got) }
+    if w := send(http.MethodGet, "10.0.0.1", ""); w.Code != http.StatusNoContent { t.Errorf("GET throttled: %d", w.Code) }
+    if w := send(http.MethodPost, "10.0.0.2", ""); w.Code != http.StatusNoContent { t.Errorf("another IP throttled: %d", w.Code) }
+
+    w = httptest.NewRecorder()
+    tooManyRequests(w, 1500*time.Millisecond)
+    if got := w.Header().Get("Retry-After"); w.Code != http.StatusTooManyRequests || got != "2" { t.Errorf("tooManyRequests(1.5s) = %d, Retry-After %q; want 429, 2", w.Code, got) }
+}
+
+func TestCheckLockout(t *testing.T) {
+    key := lockoutKey("user", "lockout-test")
+    t.Cleanup(func() { loginLockout.reset(key) })
+    w := httptest.NewRecorder()
+    if !checkLockout(w, key) || w.Code != http.StatusOK { t.Fatalf("unlocked account refused: %d", w.Code) }
+    for i := 0; i < lockoutAttempts; i++ { loginLockout.fail(key) }
+    w = httptest.NewRecorder()
+    if checkLockout(w, key) { t.Fatal("locked account let through") }
+    // the lock started a moment ago, so the wait rounds up to the full period
+    if got, want := w.Header().Get("Retry-After"), strconv.Itoa(int(lockoutPeriod.Seconds())); w.Code != http.StatusTooManyRequests || got != want { t.Errorf("%d, Retry-After %q; want 429, %s", w.Code, got, want) }
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+    "html"
+    "log"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode"
+
+    "metal-main/back/store"
+)
+
+// Site search runs on the search_index FTS5 table. Documents and queries pass through the same
+// analyzer: lower case, ё→е, lookalike Latin/Cyrillic letters unified, Russian words stemmed.
+
+// latinLookalikes maps Latin letters to the Cyrillic ones they are typed for (А500С typed as A500C)
+var latinLookalikes = map[rune]rune{'a': 'а', 'b': 'в', 'c': 'с', 'e': 'е', 'h': 'н', 'k': 'к', 'm': 'м', 'o': 'о', 'p': 'р', 't': 'т', 'x': 'х', 'y': 'у'}
+
+var cyrillicLookalikes = func() map[rune]rune {
+    m := make(map[rune]rune, len(latinLookalikes))
+    for lat, cyr := range latinLookalikes { m[cyr] = lat }
+    return m
+}()
+
+func isCyrillic(r rune) bool { return unicode.Is(unicode.Cyrillic, r) }
+
+// analyzeToken normalizes one lower-case word. Tokens with digits are grade or size codes
+// (а500с, 40х20) and are spelled in Latin, the way normalizeCode does; Cyrillic words are stemmed.
+func analyzeToken(tok string) string {
+    hasDigit, hasCyr := false, false
+    for _, r := range tok {
+        if unicode.IsDigit(r) { hasDigit = true }
+        if isCyrillic(r) { hasCyr = true }
+    }
+    switch {
+    case hasDigit:
+        return strings.Map(func(r rune) rune {
+            if lat, ok := cyrillicLookalikes[r]; ok { return lat }
+            return r
+        }, tok)
+    case hasCyr:
+        tok = strings.Map(func(r rune) rune {
+            if cyr, ok := latinLookalikes[r]; ok { return cyr }
+            return r
+        }, tok)
+        return stemRussian(tok)
+    }
+    return tok
+}
+
+// searchTokens splits text into analyzed tokens
+func searchTokens(s string) []string {
+    s = strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+    words := strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+    out := make([]string, 0, len(words))
+    for _, w := range words {
+        if t := analyzeToken(w); t != "" { out = append(out, t) }
+    }
+    return out
+}
+
+func analyzeText(parts ...string) string { return strings.Join(searchTokens(strings.Join(parts, " ")), " ") }
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+func stripHTML(s string) string { return html.UnescapeString(htmlTagRe.ReplaceAllString(s, " ")) }
+
+// searchMatch builds the FTS5 expression: every token must match, as a prefix so partly typed words hit
+func searchMatch(q string) string {
+    toks := searchTokens(q)
+    for i, t := range toks { toks[i] = `"` + t + `"*` }
+    return strings.Join(toks, " ")
+}
+
+func productDoc(p ProductRow) store.SearchDoc {
+    return store.SearchDoc{
+        Entity: store.EntityProduct, EntityID: p.ID,
+        Title: analyzeText(productTitle(p)),
+        Body:  analyzeText(p.Subtype, p.SKU, typeLabel(normalizeTypeSlug(p.Type))),
+    }
+}
+
+func articleDoc(a store.Article) store.SearchDoc {
+    return store.SearchDoc{Entity: store.EntityArticle, EntityID: a.ID, Title: analyzeText(a.Title), Body: analyzeText(a.ShortText, stripHTML(a.FullText))}
+}
+
+func newsDoc(n store.News) store.SearchDoc {
+    return store.SearchDoc{Entity: store.EntityNews, EntityID: n.ID, Title: analyzeText(n.Title), Body: analyzeText(n.ShortText, stripHTML(n.FullText))}
+}
+
+// rebuildSearchIndex re-analyzes every product, article and news item; run at startup
+func rebuildSearchIndex() error {
+    var docs []store.SearchDoc
+    products, err := st.Products.List("")
+    if err != nil { return err }
+    for _, p := range products { docs = append(docs, productDoc(p)) }
+    articles, err := st.Content.ListArticles("")
+    if err != nil { return err }
+    for _, a := range articles { docs = append(docs, articleDoc(a)) }
+    news, err := st.Content.ListNews("")
+    if err != nil { return err }
+    for _, n := range news { docs = append(docs, newsDoc(n)) }
+    return st.InTx(func(tx *store.Store) error { return tx.Search.Rebuild(docs) })
+}
+
+// reindex updates the index after an admin change; a failure only degrades search, so it is logged
+func reindex(d store.SearchDoc) {
+    if err := st.Search.Put(d); err != nil { log.Printf("search index %s %d: %v", d.Entity, d.EntityID, err) }
+}
+
+func unindex(entity string, id int64) {
+    if err := st.Search.Delete(entity, id); err != nil { log.Printf("search unindex %s %d: %v", entity, id, err) }
+}
+
+// productURL is the item page path the catalog links to
+func productURL(p ProductRow) string {
+    parts := []string{normalizeTypeSlug(p.Type)}
+    if sub := strings.TrimSpace(p.Subtype); sub != "" { parts = append(parts, sub) }
+    parts = append(parts, strings.TrimSpace(p.Name))
+    if size := strings.TrimSpace(p.Size); size != "" { parts = append(parts, size) }
+    for i, s := range parts { parts[i] = url.PathEscape(s) }
+    return "/catalog/" + strings.Join(parts, "/") + "/"
+}
+
+// searchGroup is one entity type of the search response
+type searchGroup struct {
+    Type  string           `json:"type"`
+    Total int              `json:"total"`
+    Items []map[string]any `json:"items"`
+}
+
+var searchEntities = []struct{ Type, Entity string }{
+    {"products", store.EntityProduct},
+    {"articles", store.EntityArticle},
+    {"news", store.EntityNews},
+}
+
+// GET /api/search?q=&type=products|articles|news&page=&limit=
+// Results are grouped by entity type, ranked within each group; page and limit apply per group.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    q := r.URL.Query()
+    query := strings.TrimSpace(q.Get("q"))
+    only := strings.TrimSpace(q.Get("type"))
+    page, _ := strconv.Atoi(q.Get("page"))
+    limit, _ := strconv.Atoi(q.Get("limit"))
+    if page <= 0 { page = 1 }
+    if limit <= 0 || limit > 50 { limit = 10 }
+
+    groups := []searchGroup{}
+    match := searchMatch(query)
+    for _, e := range searchEntities {
+        if only != "" && only != e.Type { continue }
+        g := searchGroup{Type: e.Type, Items: []map[string]any{}}
+        if match != "" {
+            hits, total, err := st.Search.Query(match, e.Entity, limit, (page-1)*limit)
+            if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+            g.Total = total
+            for _, h := range hits {
+                if item := searchItem(h); item != nil { g.Items = append(g.Items, item) }
+            }
+        }
+        groups = append(groups, g)
+    }
+    writeJSON(w, map[string]any{"query": query, "page": page, "limit": limit, "groups": groups})
+}
+
+// searchItem loads the record behind a hit; a hit whose record vanished is dropped
+func searchItem(h store.SearchHit) map[string]any {
+    switch h.Entity {
+    case store.EntityProduct:
+        p, err := st.Products.Get(h.EntityID)
+        if err != nil { return nil }
+        return map[string]any{
+            "id": p.ID, "title": productTitle(p), "name": p.Name, "size": p.Size, "img": p.Img,
+            "price": unitPrice(p), "in_stock": p.InStock, "type_slug": normalizeTypeSlug(p.Type), "url": productURL(p),
+        }
+    case store.EntityArticle:
+        a, err := st.Content.GetArticle(h.EntityID)
+        if err != nil { return nil }
+        return map[string]any{"id": a.ID, "title": a.Title, "short_text": a.ShortText, "published_at": a.PublishedAt, "url": "/front/HTML/articles.html?id=" + strconv.FormatInt(a.ID, 10)}
+    case store.EntityNews:
+        n, err := st.Content.GetNews(h.EntityID)
+        if err != nil { return nil }
+        return map[string]any{"id": n.ID, "title": n.Title, "short_text": n.ShortText, "published_at": n.PublishedAt, "image_url": n.ImageURL, "url": "/back/news/" + strconv.FormatInt(n.ID, 10)}
+    }
+    return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+    "encoding/xml"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// /sitemap.xml lists the public pages: storefront pages, catalog categories, products and news.
+// Articles open in a modal of articles.html, so they are represented by that page with the date
+// of the newest one. Past sitemapLimit URLs /sitemap.xml becomes an index of /sitemap-{n}.xml.
+
+// sitemapLimit is the most URLs the sitemap protocol allows in one file; tests lower it
+var sitemapLimit = 50000
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapURL struct {
+    Loc     string `xml:"loc"`
+    LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+    XMLName xml.Name     `xml:"urlset"`
+    NS      string       `xml:"xmlns,attr"`
+    URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+    XMLName  xml.Name     `xml:"sitemapindex"`
+    NS       string       `xml:"xmlns,attr"`
+    Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// sitemapStaticPages are the storefront pages outside the catalog
+var sitemapStaticPages = []string{
+    "/front/HTML/main.html",
+    "/catalog/",
+    "/front/HTML/services.html",
+    "/front/HTML/delivery.html",
+    "/front/HTML/contact.html",
+    "/front/HTML/gost.html",
+    "/front/HTML/news.html",
+}
+
+// lastModDate keeps the date part of a created_at / published_at value
+func lastModDate(s string) string {
+    s = strings.TrimSpace(s)
+    if len(s) >= 10 { return s[:10] }
+    return ""
+}
+
+// sitemapURLs collects every public URL with its last modification date
+func sitemapURLs() ([]sitemapURL, error) {
+    base := siteURL()
+    var out []sitemapURL
+    for _, p := range sitemapStaticPages { out = append(out, sitemapURL{Loc: base + p}) }
+
+    articles, err := st.Content.ListArticles("")
+    if err != nil { return nil, err }
+    articlesPage := sitemapURL{Loc: base + "/front/HTML/articles.html"}
+    for _, a := range articles {
+        if d := lastModDate(a.PublishedAt); d > articlesPage.LastMod { articlesPage.LastMod = d }
+    }
+    out = append(out, articlesPage)
+
+    tree := catalogTree()
+    for _, c := range tree.children[0] {
+        out = append(out, sitemapURL{Loc: base + "/catalog/" + c.Slug + "/", LastMod: lastModDate(c.UpdatedAt)})
+        for _, sc := range tree.children[c.ID] {
+            out = append(out, sitemapURL{Loc: base + "/catalog/" + c.Slug + "/" + sc.Slug + "/", LastMod: lastModDate(sc.UpdatedAt)})
+        }
+    }
+
+    products, err := st.Products.List("")
+    if err != nil { return nil, err }
+    for _, p := range products {
+        // products outside the category tree have no page the catalog routes would serve
+        if _, ok := tree.topCategory(normalizeTypeSlug(p.Type)); !ok { continue }
+        out = append(out, sitemapURL{Loc: base + productURL(p), LastMod: lastModDate(p.CreatedAt)})
+    }
+
+    news, err := st.Content.ListNews("")
+    if err != nil { return nil, err }
+    for _, n := range news {
+        out = append(out, sitemapURL{Loc: base + "/back/news/" + strconv.FormatInt(n.ID, 10), LastMod: lastModDate(n.PublishedAt)})
+    }
+    return out, nil
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+    w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+    _, _ = w.Write([]byte(xml.Header))
+    enc := xml.NewEncoder(w)
+    enc.Indent("", "  ")
+    _ = enc.Encode(v)
+}
+
+// GET /sitemap.xml serves the URL set, or the sitemap index once it outgrows one file;
+// GET /sitemap-{n}.xml serves the n-th part (1-based)
+func handleSitemap(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    urls, err := sitemapURLs()
+    if err != nil { http.Error(w, err.Error(), http.StatusInternalServerError); return }
+    parts := (len(urls) + sitemapLimit - 1) / sitemapLimit
+
+    if r.URL.Path == "/sitemap.xml" {
+        if parts <= 1 {
+            writeXML(w, sitemapURLSet{NS: sitemapNS, URLs: urls})
+            return
+        }
+        idx := sitemapIndex{NS: sitemapNS}
+        for i := 1; i <= parts; i++ {
+            idx.Sitemaps = append(idx.Sitemaps, sitemapURL{Loc: siteURL() + "/sitemap-" + strconv.Itoa(i) + ".xml"})
+        }
+        writeXML(w, idx)
+        return
+    }
+    n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/sitemap-"), ".xml"))
+    if err != nil || n < 1 || n > parts || parts <= 1 { http.NotFound(w, r); return }
+    end := n * sitemapLimit
+    if end > len(urls) { end = len(urls) }
+    writeXML(w, sitemapURLSet{NS: sitemapNS, URLs: urls[(n-1)*sitemapLimit : end]})
+}
+
+// GET /robots.txt keeps crawlers out of the admin area, the API and per-user pages
+func handleRobots(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    lines := []string{
+        "User-agent: *",
+        "Disallow: /admin/",
+        "Disallow: /api/",
+        "Disallow: /front/HTML/admin.html",
+        "Disallow: /front/HTML/admin_login.html",
+        "Disallow: /front/HTML/password_reset.html",
+        "Disallow: /cabinet/",
+        "Disallow: /cart/",
+        "",
+        "Sitemap: " + siteURL() + "/sitemap.xml",
+    }
+    w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+    _, _ = w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
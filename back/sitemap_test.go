@@ -0,0 +1,106 @@
+package main
+
+import (
+    "encoding/xml"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "metal-main/back/store"
+)
+
+// useTestCatalog loads the seeded category tree of the test store
+func useTestCatalog(t *testing.T) {
+    t.Helper()
+    saved := categoriesCur
+    t.Cleanup(func() { categoriesCur = saved })
+    if err := loadCategories(); err != nil { t.Fatal(err) }
+}
+
+func getSitemap(t *testing.T, path string) *httptest.ResponseRecorder {
+    t.Helper()
+    w := httptest.NewRecorder()
+    handleSitemap(w, httptest.NewRequest(http.MethodGet, path, nil))
+    return w
+}
+
+func TestSitemapLastMod(t *testing.T) {
+    useTestStore(t)
+    useTestCatalog(t)
+    t.Setenv("SITE_URL", "https://metal.example.ru/")
+    p := ProductRow{Type: "armatura", Name: "Арматура А500С", Size: "12", CreatedAt: "2025-11-03 08:15:00"}
+    orphan := ProductRow{Type: "no-such-category", Name: "Без категории", CreatedAt: "2025-11-04 08:15:00"}
+    for _, x := range []*ProductRow{&p, &orphan} {
+        if err := st.Products.Create(x); err != nil { t.Fatal(err) }
+        if _, err := st.DB.Exec("UPDATE products SET created_at=? WHERE id=?", x.CreatedAt, x.ID); err != nil { t.Fatal(err) }
+    }
+    n := store.News{Title: "Новая поставка", ShortText: "-", FullText: "-", PublishedAt: "2026-02-01"}
+    if err := st.Content.CreateNews(&n); err != nil { t.Fatal(err) }
+    for _, d := range []string{"2025-06-01", "2026-03-15", "2025-12-31"} {
+        if err := st.Content.CreateArticle(&store.Article{Title: "Статья " + d, ShortText: "-", FullText: "-", PublishedAt: d}); err != nil { t.Fatal(err) }
+    }
+
+    w := getSitemap(t, "/sitemap.xml")
+    if w.Code != 200 { t.Fatalf("sitemap: %d", w.Code) }
+    var set sitemapURLSet
+    if err := xml.Unmarshal(w.Body.Bytes(), &set); err != nil { t.Fatal(err) }
+    lastmod := map[string]string{}
+    for _, u := range set.URLs { lastmod[u.Loc] = u.LastMod }
+    base := "https://metal.example.ru"
+    want := map[string]string{
+        base + productURL(p):                      "2025-11-03",
+        base + fmt.Sprintf("/back/news/%d", n.ID): "2026-02-01",
+        // the articles page changes with its newest article
+        base + "/front/HTML/articles.html": "2026-03-15",
+        base + "/front/HTML/main.html":     "",
+    }
+    for loc, d := range want {
+        got, ok := lastmod[loc]
+        if !ok { t.Errorf("%s missing", loc); continue }
+        if got != d { t.Errorf("%s: lastmod %q, want %q", loc, got, d) }
+    }
+    if _, ok := lastmod[base+"/catalog/armatura/"]; !ok { t.Error("category page missing") }
+    if _, ok := lastmod[base+productURL(orphan)]; ok { t.Error("a product outside the category tree is listed") }
+    for loc := range lastmod {
+        if strings.Contains(loc, "/admin") || strings.Contains(loc, "/api/") { t.Errorf("private URL %s listed", loc) }
+    }
+}
+
+func TestSitemapIndex(t *testing.T) {
+    useTestStore(t)
+    useTestCatalog(t)
+    t.Setenv("SITE_URL", "https://metal.example.ru")
+    for i := 0; i < 30; i++ {
+        if err := st.Products.Create(&ProductRow{Type: "armatura", Name: "Арматура", Size: fmt.Sprint(6 + i)}); err != nil { t.Fatal(err) }
+    }
+    var all sitemapURLSet
+    if err := xml.Unmarshal(getSitemap(t, "/sitemap.xml").Body.Bytes(), &all); err != nil { t.Fatal(err) }
+    if getSitemap(t, "/sitemap-1.xml").Code != 404 { t.Error("a single sitemap has parts") }
+
+    saved := sitemapLimit
+    sitemapLimit = 20
+    t.Cleanup(func() { sitemapLimit = saved })
+    parts := (len(all.URLs) + sitemapLimit - 1) / sitemapLimit
+    if parts < 3 { t.Fatalf("only %d URLs, the test needs at least 3 parts", len(all.URLs)) }
+
+    w := getSitemap(t, "/sitemap.xml")
+    var idx sitemapIndex
+    if err := xml.Unmarshal(w.Body.Bytes(), &idx); err != nil { t.Fatalf("%v:\n%s", err, w.Body) }
+    if len(idx.Sitemaps) != parts { t.Fatalf("index lists %d sitemaps, want %d", len(idx.Sitemaps), parts) }
+    var joined []sitemapURL
+    for i, sm := range idx.Sitemaps {
+        path := fmt.Sprintf("/sitemap-%d.xml", i+1)
+        if sm.Loc != "https://metal.example.ru"+path { t.Errorf("part %d at %s", i+1, sm.Loc) }
+        var set sitemapURLSet
+        if err := xml.Unmarshal(getSitemap(t, path).Body.Bytes(), &set); err != nil { t.Fatal(err) }
+        if len(set.URLs) > sitemapLimit || (i < parts-1 && len(set.URLs) != sitemapLimit) { t.Errorf("part %d has %d URLs", i+1, len(set.URLs)) }
+        joined = append(joined, set.URLs...)
+    }
+    // the parts together are the whole list, in order
+    if fmt.Sprint(joined) != fmt.Sprint(all.URLs) { t.Errorf("parts hold %d URLs, want the %d of the full list", len(joined), len(all.URLs)) }
+    for _, path := range []string{"/sitemap-0.xml", fmt.Sprintf("/sitemap-%d.xml", parts+1), "/sitemap-x.xml"} {
+        if w := getSitemap(t, path); w.Code != 404 { t.Errorf("%s: %d, want 404", path, w.Code) }
+    }
+}
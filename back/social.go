@@ -4,17 +4,14 @@ import (
     "encoding/json"
     "net/http"
     "strings"
+
+    "metal-main/back/store"
 )
 
-type socialLinks struct {
-    Telegram string `json:"telegram_link"`
-    VK       string `json:"vk_link"`
-    WP       string `json:"wp_link"`
-}
+type socialLinks = store.SocialLinks
 
 func readSocial() socialLinks {
-    var s socialLinks
-    _ = userDB.QueryRow("SELECT COALESCE(telegram_link,''), COALESCE(vk_link,''), COALESCE(wp_link,'') FROM social_links WHERE id=1").Scan(&s.Telegram, &s.VK, &s.WP)
+    s, _ := st.Content.Social()
     return s
 }
 
@@ -35,7 +32,7 @@ func adminSocialHandler(w http.ResponseWriter, r *http.Request) {
         p.Telegram = strings.TrimSpace(p.Telegram)
         p.VK = strings.TrimSpace(p.VK)
         p.WP = strings.TrimSpace(p.WP)
-        _, _ = userDB.Exec("UPDATE social_links SET telegram_link=?, vk_link=?, wp_link=? WHERE id=1", p.Telegram, p.VK, p.WP)
+        if err := st.Content.SaveSocial(p); err != nil { http.Error(w, err.Error(), 500); return }
         writeJSON(w, map[string]string{"status":"ok"})
     default:
         http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
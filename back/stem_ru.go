@@ -0,0 +1,113 @@
+package main
+
+// Russian stemmer after the Snowball algorithm (snowballstem.org/algorithms/russian/stemmer.html).
+// Words are expected in lower case with ё already folded to е.
+
+var (
+    ruPerfectiveGerund1 = []string{"вшись", "вши", "в"}
+    ruPerfectiveGerund2 = []string{"ившись", "ывшись", "ивши", "ывши", "ив", "ыв"}
+    ruAdjective         = []string{"ими", "ыми", "его", "ого", "ему", "ому", "ее", "ие", "ые", "ое", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}
+    ruParticiple1       = []string{"ем", "нн", "вш", "ющ", "щ"}
+    ruParticiple2       = []string{"ивш", "ывш", "ующ"}
+    ruReflexive         = []string{"ся", "сь"}
+    ruVerb1             = []string{"ете", "йте", "ешь", "нно", "ла", "на", "ли", "ем", "ло", "но", "ет", "ют", "ны", "ть", "й", "л", "н"}
+    ruVerb2             = []string{"ейте", "уйте", "ила", "ыла", "ена", "ите", "или", "ыли", "ило", "ыло", "ено", "ует", "уют", "ены", "ить", "ыть", "ишь", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ят", "ит", "ыт", "ую", "ю"}
+    ruNoun              = []string{"иями", "ями", "ами", "ией", "иям", "ием", "иях", "ев", "ов", "ие", "ье", "еи", "ии", "ей", "ой", "ий", "ям", "ем", "ам", "ом", "ах", "ях", "ию", "ью", "ия", "ья", "а", "е", "и", "й", "о", "у", "ы", "ь", "ю", "я"}
+    ruSuperlative       = []string{"ейше", "ейш"}
+    ruDerivational      = []string{"ость", "ост"}
+)
+
+func isRuVowel(r rune) bool {
+    switch r {
+    case 'а', 'е', 'и', 'о', 'у', 'ы', 'э', 'ю', 'я':
+        return true
+    }
+    return false
+}
+
+// ruRegions returns the start of RV and R2
+func ruRegions(w []rune) (rv, r2 int) {
+    rv, r1 := len(w), len(w)
+    for i, c := range w {
+        if isRuVowel(c) { rv = i + 1; break }
+    }
+    for i := 1; i < len(w); i++ {
+        if !isRuVowel(w[i]) && isRuVowel(w[i-1]) { r1 = i + 1; break }
+    }
+    r2 = len(w)
+    for i := r1 + 1; i < len(w); i++ {
+        if !isRuVowel(w[i]) && isRuVowel(w[i-1]) { r2 = i + 1; break }
+    }
+    return rv, r2
+}
+
+func hasRuSuffix(w []rune, from int, s string) bool {
+    sr := []rune(s)
+    return len(w)-len(sr) >= from && string(w[len(w)-len(sr):]) == s
+}
+
+// trimRuSuffix removes the first (longest, as the lists are ordered) suffix found at or after from.
+// With afterAYa the suffix must also follow а or я, which stays in place.
+func trimRuSuffix(w []rune, from int, suffixes []string, afterAYa bool) ([]rune, bool) {
+    for _, s := range suffixes {
+        if !hasRuSuffix(w, from, s) { continue }
+        cut := len(w) - len([]rune(s))
+        if afterAYa && (cut-1 < from || (w[cut-1] != 'а' && w[cut-1] != 'я')) { continue }
+        return w[:cut], true
+    }
+    return w, false
+}
+
+// trimRuGroups tries a group-1 list (after а/я) and a group-2 list, taking the longer match
+func trimRuGroups(w []rune, from int, group1, group2 []string) ([]rune, bool) {
+    a, okA := trimRuSuffix(w, from, group1, true)
+    b, okB := trimRuSuffix(w, from, group2, false)
+    switch {
+    case okA && okB:
+        if len(b) < len(a) { return b, true }
+        return a, true
+    case okA:
+        return a, true
+    case okB:
+        return b, true
+    }
+    return w, false
+}
+
+func stemRussian(word string) string {
+    w := []rune(word)
+    rv, r2 := ruRegions(w)
+    if rv >= len(w) { return word }
+
+    // Step 1
+    if out, ok := trimRuGroups(w, rv, ruPerfectiveGerund1, ruPerfectiveGerund2); ok {
+        w = out
+    } else {
+        w, _ = trimRuSuffix(w, rv, ruReflexive, false)
+        if out, ok := trimRuSuffix(w, rv, ruAdjective, false); ok {
+            w = out
+            if out, ok := trimRuGroups(w, rv, ruParticiple1, ruParticiple2); ok { w = out }
+        } else if out, ok := trimRuGroups(w, rv, ruVerb1, ruVerb2); ok {
+            w = out
+        } else {
+            w, _ = trimRuSuffix(w, rv, ruNoun, false)
+        }
+    }
+
+    // Step 2
+    if hasRuSuffix(w, rv, "и") { w = w[:len(w)-1] }
+
+    // Step 3
+    if out, ok := trimRuSuffix(w, r2, ruDerivational, false); ok { w = out }
+
+    // Step 4
+    if hasRuSuffix(w, rv, "нн") {
+        w = w[:len(w)-1]
+    } else if out, ok := trimRuSuffix(w, rv, ruSuperlative, false); ok {
+        w = out
+        if hasRuSuffix(w, rv, "нн") { w = w[:len(w)-1] }
+    } else if hasRuSuffix(w, rv, "ь") {
+        w = w[:len(w)-1]
+    }
+    return string(w)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestStemRussian(t *testing.T) {
+    cases := []struct{ word, want string }{
+        // noun endings
+        {"арматура", "арматур"},
+        {"арматуры", "арматур"},
+        {"трубами", "труб"},
+        {"швеллеры", "швеллер"},
+        {"уголки", "уголк"},
+        {"вагоны", "вагон"},
+        // adjectives and participles
+        {"профильная", "профильн"},
+        {"профильный", "профильн"},
+        {"стальной", "стальн"},
+        {"оцинкованный", "оцинкова"},
+        {"оцинкованная", "оцинкова"},
+        {"нержавеющая", "нержавеющ"},
+        {"горячекатаный", "горячекатан"},
+        // superlative, and a derivational suffix outside R2 that stays
+        {"красивейший", "красив"},
+        {"быстрость", "быстрост"},
+        // nothing to cut before RV
+        {"прокат", "прокат"},
+        {"уголок", "уголок"},
+        {"он", "он"},
+        {"а", "а"},
+    }
+    for _, c := range cases {
+        if got := stemRussian(c.word); got != c.want { t.Errorf("stemRussian(%q) = %q, want %q", c.word, got, c.want) }
+    }
+}
+
+func TestSearchTokens(t *testing.T) {
+    cases := []struct {
+        in   string
+        want []string
+    }{
+        {"Трубы ПРОФИЛЬНЫЕ 40х20", []string{"труб", "профильн", "40x20"}},
+        // the grade typed in Cyrillic or Latin gives the same token
+        {"Арматура А500С", []string{"арматур", "a500c"}},
+        {"арматура a500c", []string{"арматур", "a500c"}},
+        // a Latin lookalike inside a Russian word is folded before stemming
+        {"Tрубы", []string{"труб"}},
+        {"Лист оцинкованный 0,5", []string{"лист", "оцинкова", "0", "5"}},
+        {"ёлка", []string{"елк"}},
+        {"", []string{}},
+    }
+    for _, c := range cases {
+        if got := searchTokens(c.in); !reflect.DeepEqual(got, c.want) { t.Errorf("searchTokens(%q) = %q, want %q", c.in, got, c.want) }
+    }
+}
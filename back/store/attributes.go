@@ -0,0 +1,220 @@
+package store
+
+import (
+    "database/sql"
+    "strconv"
+    "strings"
+)
+
+// Attribute kinds
+const (
+    AttrNumber = "number"
+    AttrText   = "text"
+)
+
+// Attribute value sources: parsed values are rewritten whenever the product is re-parsed,
+// manual ones are left alone
+const (
+    AttrParsed = "parsed"
+    AttrManual = "manual"
+)
+
+// AttributeDef is a typed characteristic products of one top-level category carry
+type AttributeDef struct {
+    ID         int64  `json:"id"`
+    CategoryID int64  `json:"category_id"`
+    Code       string `json:"code"` // stable key used in filters: diameter, grade, gost
+    Title      string `json:"title"`
+    Kind       string `json:"kind"` // AttrNumber or AttrText
+    Unit       string `json:"unit"`
+    Filterable bool   `json:"filterable"`
+    SortOrder  int    `json:"sort_order"`
+}
+
+// AttributeValue is the value of one attribute of a product, with its definition
+type AttributeValue struct {
+    AttributeID int64   `json:"attribute_id"`
+    Code        string  `json:"code"`
+    Title       string  `json:"title"`
+    Kind        string  `json:"kind"`
+    Unit        string  `json:"unit"`
+    Value       string  `json:"value"`
+    Num         float64 `json:"num,omitempty"` // numeric value of AttrNumber attributes
+    Source      string  `json:"source"`
+}
+
+// AttributeRepo persists attribute definitions and product values
+type AttributeRepo interface {
+    // Definitions returns the definitions of a category, or of all categories when categoryID is 0
+    Definitions(categoryID int64) ([]AttributeDef, error)
+    GetDefinition(id int64) (AttributeDef, error)
+    // CreateDefinition and UpdateDefinition return ErrConflict when the code is taken in the category
+    CreateDefinition(d *AttributeDef) error
+    UpdateDefinition(d AttributeDef) error
+    DeleteDefinition(id int64) error
+    // Values returns the values of the given products keyed by product id, in definition order
+    Values(productIDs ...int64) (map[int64][]AttributeValue, error)
+    // SetValue stores one value; an empty Value removes it
+    SetValue(productID int64, v AttributeValue) error
+    // CountValues returns the number of stored product values
+    CountValues() (int, error)
+    // ReplaceParsed swaps the parsed values of a product for vals, keeping manual ones
+    ReplaceParsed(productID int64, vals []AttributeValue) error
+}
+
+type attributeRepo struct{ q dbtx }
+
+const attributeDefColumns = "id, category_id, code, title, kind, unit, filterable, sort_order"
+
+func scanAttributeDef(sc scanner) (AttributeDef, error) {
+    var d AttributeDef
+    var filterable int
+    err := sc.Scan(&d.ID, &d.CategoryID, &d.Code, &d.Title, &d.Kind, &d.Unit, &filterable, &d.SortOrder)
+    d.Filterable = filterable == 1
+    return d, err
+}
+
+func (r *attributeRepo) Definitions(categoryID int64) ([]AttributeDef, error) {
+    q := "SELECT " + attributeDefColumns + " FROM attributes"
+    var args []any
+    if categoryID != 0 { q += " WHERE category_id=?"; args = append(args, categoryID) }
+    rows, err := r.q.Query(q+" ORDER BY category_id, sort_order, id", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []AttributeDef{}
+    for rows.Next() {
+        d, err := scanAttributeDef(rows)
+        if err != nil { return nil, err }
+        out = append(out, d)
+    }
+    return out, rows.Err()
+}
+
+func (r *attributeRepo) GetDefinition(id int64) (AttributeDef, error) {
+    d, err := scanAttributeDef(r.q.QueryRow("SELECT "+attributeDefColumns+" FROM attributes WHERE id=?", id))
+    return d, notFound(err)
+}
+
+func (r *attributeRepo) CreateDefinition(d *AttributeDef) error {
+    res, err := r.q.Exec("INSERT INTO attributes(category_id, code, title, kind, unit, filterable, sort_order) VALUES(?,?,?,?,?,?,?)",
+        d.CategoryID, d.Code, d.Title, d.Kind, d.Unit, boolInt(d.Filterable), d.SortOrder)
+    if isUniqueViolation(err) { return ErrConflict }
+    if err != nil { return err }
+    d.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *attributeRepo) UpdateDefinition(d AttributeDef) error {
+    res, err := r.q.Exec("UPDATE attributes SET category_id=?, code=?, title=?, kind=?, unit=?, filterable=?, sort_order=? WHERE id=?",
+        d.CategoryID, d.Code, d.Title, d.Kind, d.Unit, boolInt(d.Filterable), d.SortOrder, d.ID)
+    if isUniqueViolation(err) { return ErrConflict }
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *attributeRepo) DeleteDefinition(id int64) error {
+    res, err := r.q.Exec("DELETE FROM attributes WHERE id=?", id)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *attributeRepo) Values(productIDs ...int64) (map[int64][]AttributeValue, error) {
+    out := map[int64][]AttributeValue{}
+    if len(productIDs) == 0 { return out, nil }
+    args := make([]any, len(productIDs))
+    for i, id := range productIDs { args[i] = id }
+    rows, err := r.q.Query(`SELECT pa.product_id, a.id, a.code, a.title, a.kind, a.unit, pa.value_text, ifnull(pa.value_num,0), pa.source
+        FROM product_attributes pa JOIN attributes a ON a.id = pa.attribute_id
+        WHERE pa.product_id IN (`+placeholders(len(args))+`) ORDER BY pa.product_id, a.sort_order, a.id`, args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    for rows.Next() {
+        var pid int64
+        var v AttributeValue
+        if err := rows.Scan(&pid, &v.AttributeID, &v.Code, &v.Title, &v.Kind, &v.Unit, &v.Value, &v.Num, &v.Source); err != nil { return nil, err }
+        out[pid] = append(out[pid], v)
+    }
+    return out, rows.Err()
+}
+
+// attributeNum is the value_num column for v: the parsed number of an AttrNumber value, else NULL
+func attributeNum(v AttributeValue) any {
+    if v.Kind != AttrNumber { return nil }
+    n, err := strconv.ParseFloat(strings.ReplaceAll(v.Value, ",", "."), 64)
+    if err != nil { return nil }
+    return n
+}
+
+func (r *attributeRepo) SetValue(productID int64, v AttributeValue) error {
+    if strings.TrimSpace(v.Value) == "" {
+        _, err := r.q.Exec("DELETE FROM product_attributes WHERE product_id=? AND attribute_id=?", productID, v.AttributeID)
+        return err
+    }
+    _, err := r.q.Exec(`INSERT INTO product_attributes(product_id, attribute_id, value_text, value_num, source) VALUES(?,?,?,?,?)
+        ON CONFLICT(product_id, attribute_id) DO UPDATE SET value_text=excluded.value_text, value_num=excluded.value_num, source=excluded.source`,
+        productID, v.AttributeID, v.Value, attributeNum(v), v.Source)
+    return err
+}
+
+func (r *attributeRepo) CountValues() (int, error) {
+    var n int
+    err := r.q.QueryRow("SELECT COUNT(*) FROM product_attributes").Scan(&n)
+    return n, err
+}
+
+func (r *attributeRepo) ReplaceParsed(productID int64, vals []AttributeValue) error {
+    if _, err := r.q.Exec("DELETE FROM product_attributes WHERE product_id=? AND source=?", productID, AttrParsed); err != nil { return err }
+    for _, v := range vals {
+        // DO NOTHING keeps a manual value of the same attribute
+        _, err := r.q.Exec(`INSERT INTO product_attributes(product_id, attribute_id, value_text, value_num, source) VALUES(?,?,?,?,?)
+            ON CONFLICT(product_id, attribute_id) DO NOTHING`, productID, v.AttributeID, v.Value, attributeNum(v), AttrParsed)
+        if err != nil { return err }
+    }
+    return nil
+}
+
+// seedAttribute is one definition written by the attributes migration
+type seedAttribute struct {
+    Code, Title, Kind, Unit string
+    Filterable              bool
+}
+
+var (
+    seedAttrClass     = seedAttribute{"class", "Класс", AttrText, "", true}
+    seedAttrGrade     = seedAttribute{"grade", "Марка стали", AttrText, "", true}
+    seedAttrGOST      = seedAttribute{"gost", "ГОСТ", AttrText, "", false}
+    seedAttrDiameter  = seedAttribute{"diameter", "Диаметр", AttrNumber, "мм", true}
+    seedAttrWall      = seedAttribute{"wall", "Толщина стенки", AttrNumber, "мм", true}
+    seedAttrWidth     = seedAttribute{"width", "Ширина", AttrNumber, "мм", true}
+    seedAttrHeight    = seedAttribute{"height", "Высота", AttrNumber, "мм", true}
+    seedAttrThickness = seedAttribute{"thickness", "Толщина", AttrNumber, "мм", true}
+    seedAttrCoating   = seedAttribute{"coating", "Покрытие", AttrText, "", true}
+)
+
+// defaultAttributes maps top-level category slugs to their initial definitions
+var defaultAttributes = map[string][]seedAttribute{
+    "armatura":         {seedAttrClass, seedAttrDiameter, seedAttrGrade, seedAttrGOST},
+    "truba-profilnaya": {seedAttrWidth, seedAttrHeight, seedAttrWall, seedAttrGrade, seedAttrGOST, seedAttrCoating},
+    "truba-kruglaya":   {seedAttrDiameter, seedAttrWall, seedAttrGrade, seedAttrGOST, seedAttrCoating},
+    "listovoy-prokat":  {seedAttrThickness, seedAttrWidth, seedAttrGrade, seedAttrGOST, seedAttrCoating},
+    "profnastil":       {seedAttrThickness, seedAttrCoating, seedAttrGOST},
+    "sortovoy-prokat":  {seedAttrWidth, seedAttrHeight, seedAttrThickness, seedAttrGrade, seedAttrGOST},
+    "vintovye-svai":    {seedAttrDiameter, seedAttrWall},
+}
+
+func seedAttributes(tx *sql.Tx) error {
+    for slug, defs := range defaultAttributes {
+        var catID int64
+        err := tx.QueryRow("SELECT id FROM categories WHERE parent_id IS NULL AND slug=?", slug).Scan(&catID)
+        if err == sql.ErrNoRows { continue }
+        if err != nil { return err }
+        for i, d := range defs {
+            _, err := tx.Exec("INSERT INTO attributes(category_id, code, title, kind, unit, filterable, sort_order) VALUES(?,?,?,?,?,?,?)",
+                catID, d.Code, d.Title, d.Kind, d.Unit, boolInt(d.Filterable), (i+1)*10)
+            if err != nil { return err }
+        }
+    }
+    return nil
+}
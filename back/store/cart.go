@@ -0,0 +1,58 @@
+package store
+
+// CartItem is one line of an anonymous cart
+type CartItem struct {
+    ID    string  `json:"ID"`
+    Title string  `json:"Title"`
+    Image string  `json:"Image"`
+    Price float64 `json:"Price"` // per Unit
+    Qty   float64 `json:"Qty"`
+    Unit  string  `json:"Unit"` // quantity unit; empty for the product's base unit
+}
+
+// CartRepo persists carts keyed by the cart_id cookie
+type CartRepo interface {
+    Items(cartID string) ([]CartItem, error)
+    // Add inserts the item or increases the quantity of an existing line; the caller converts
+    // it.Qty to the unit of that line first
+    Add(cartID string, it CartItem) error
+    SetQty(cartID, itemID string, qty float64) error
+    Remove(cartID, itemID string) error
+    Clear(cartID string) error
+}
+
+type cartRepo struct{ q dbtx }
+
+func (r *cartRepo) Items(cartID string) ([]CartItem, error) {
+    rows, err := r.q.Query("SELECT item_id, IFNULL(title,''), price, IFNULL(image,''), qty, unit FROM cart_items WHERE cart_id=? ORDER BY id", cartID)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []CartItem
+    for rows.Next() {
+        var it CartItem
+        if err := rows.Scan(&it.ID, &it.Title, &it.Price, &it.Image, &it.Qty, &it.Unit); err != nil { return nil, err }
+        out = append(out, it)
+    }
+    return out, rows.Err()
+}
+
+func (r *cartRepo) Add(cartID string, it CartItem) error {
+    _, err := r.q.Exec(`INSERT INTO cart_items(cart_id, item_id, title, price, image, qty, unit) VALUES(?,?,?,?,?,?,?)
+        ON CONFLICT(cart_id, item_id) DO UPDATE SET qty = qty + excluded.qty`, cartID, it.ID, it.Title, it.Price, it.Image, it.Qty, it.Unit)
+    return err
+}
+
+func (r *cartRepo) SetQty(cartID, itemID string, qty float64) error {
+    _, err := r.q.Exec("UPDATE cart_items SET qty=? WHERE cart_id=? AND item_id=?", qty, cartID, itemID)
+    return err
+}
+
+func (r *cartRepo) Remove(cartID, itemID string) error {
+    _, err := r.q.Exec("DELETE FROM cart_items WHERE cart_id=? AND item_id=?", cartID, itemID)
+    return err
+}
+
+func (r *cartRepo) Clear(cartID string) error {
+    _, err := r.q.Exec("DELETE FROM cart_items WHERE cart_id=?", cartID)
+    return err
+}
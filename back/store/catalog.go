@@ -0,0 +1,321 @@
+package store
+
+import (
+    "strconv"
+    "strings"
+)
+
+// Range bounds a numeric column; nil ends are open
+type Range struct {
+    Min *float64
+    Max *float64
+}
+
+// ProductFilter narrows a catalog listing; zero fields do not filter
+type ProductFilter struct {
+    // Type matches products.type case-insensitively, also when the slug is followed by a
+    // free-text tail ("truba-profilnaya — ...")
+    Type string
+    // A subcategory matches when the subtype is one of SubSubtypes or subtype, name and size
+    // together match one of the LIKE SubPatterns
+    SubSubtypes []string
+    SubPatterns []string
+    Price       Range // effective unit price, see productPriceExpr
+    Thickness   Range
+    Weight      Range
+    Length      Range
+    InStock     bool
+    Sizes       []string  // exact sizes
+    Diameters   []float64 // leading number of the size: 57 for "57x3.5"
+    Attrs       []AttrFilter
+    Sort        string    // one of productOrders
+    Limit       int
+    Offset      int
+}
+
+// AttrFilter matches products whose attribute has one of Values and, for numeric attributes,
+// lies within Num
+type AttrFilter struct {
+    AttributeID int64
+    Values      []string
+    Num         Range
+}
+
+// FacetValue is one selectable value and the number of products having it
+type FacetValue struct {
+    Value string `json:"value"`
+    Count int    `json:"count"`
+}
+
+// RangeFacet is the span of a numeric column
+type RangeFacet struct {
+    Min float64 `json:"min"`
+    Max float64 `json:"max"`
+}
+
+// ProductFacets describes what the other filters leave to choose from. Each facet ignores its own
+// filter, so picking one size still shows the counts of the other sizes.
+type ProductFacets struct {
+    Subtypes  []FacetValue `json:"subtypes"`
+    Sizes     []FacetValue `json:"sizes"`
+    Diameters []FacetValue `json:"diameters"`
+    InStock   int          `json:"in_stock"`
+    Price     RangeFacet   `json:"price"`
+    Thickness RangeFacet   `json:"thickness_mm"`
+    Weight    RangeFacet   `json:"weight_kg"`
+    Length    RangeFacet   `json:"length_m"`
+}
+
+// AttributeFacet lists the values of one filterable attribute; numeric ones also get their span
+type AttributeFacet struct {
+    Code   string       `json:"code"`
+    Title  string       `json:"title"`
+    Kind   string       `json:"kind"`
+    Unit   string       `json:"unit"`
+    Values []FacetValue `json:"values"`
+    Range  *RangeFacet  `json:"range,omitempty"`
+}
+
+// productPriceExpr is the unit price as the storefront shows it. It is computed in Go (unitPrice
+// in package main, which derives sheet weights from the size) and stored with the product.
+const productPriceExpr = "ifnull(unit_price,0)"
+
+// productDiameterExpr takes the leading number of the size; SQLite casts "57x3.5" to 57
+const productDiameterExpr = "CAST(replace(trim(ifnull(size,'')), ',', '.') AS REAL)"
+
+// productOrders maps the sort names Filter accepts to ORDER BY clauses; "" keeps the catalog
+// order of subtype, then price
+var productOrders = map[string]string{
+    "":           "lower(trim(ifnull(subtype,''))), " + productPriceExpr + ", id",
+    "price_asc":  productPriceExpr + ", id",
+    "price_desc": productPriceExpr + " DESC, id",
+    "name":       "name, size, id",
+    "new":        "created_at DESC, id DESC",
+}
+
+// KnownProductSort reports whether Filter accepts the sort name s
+func KnownProductSort(s string) bool {
+    _, ok := productOrders[s]
+    return ok
+}
+
+// Facet names passed to where so a facet can leave its own condition out
+const (
+    facetNone      = ""
+    facetSub       = "sub"
+    facetPrice     = "price"
+    facetThickness = "thickness"
+    facetWeight    = "weight"
+    facetLength    = "length"
+    facetInStock   = "in_stock"
+    facetSize      = "size"
+    facetDiameter  = "diameter"
+)
+
+// attrFacet is the facet name of an attribute filter
+func attrFacet(id int64) string { return "attr:" + strconv.FormatInt(id, 10) }
+
+func likeEscape(s string) string {
+    return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// where builds the WHERE clause of f, leaving out the condition named skip
+func (f ProductFilter) where(skip string) (string, []any) {
+    var conds []string
+    var args []any
+    if t := strings.ToLower(strings.TrimSpace(f.Type)); t != "" {
+        p := likeEscape(t)
+        conds = append(conds, `(lower(trim(type)) = ? OR lower(trim(type)) LIKE ? ESCAPE '\' OR lower(trim(type)) LIKE ? ESCAPE '\' OR lower(trim(type)) LIKE ? ESCAPE '\')`)
+        args = append(args, t, p+" %", p+"\t%", p+"—%")
+    }
+    if skip != facetSub && (len(f.SubSubtypes) > 0 || len(f.SubPatterns) > 0) {
+        var or []string
+        if len(f.SubSubtypes) > 0 {
+            or = append(or, "trim(ifnull(subtype,'')) IN ("+placeholders(len(f.SubSubtypes))+")")
+            for _, s := range f.SubSubtypes { args = append(args, s) }
+        }
+        for _, p := range f.SubPatterns {
+            or = append(or, `(ifnull(subtype,'') || ' ' || ifnull(name,'') || ' ' || ifnull(size,'')) LIKE ? ESCAPE '\'`)
+            args = append(args, p)
+        }
+        conds = append(conds, "("+strings.Join(or, " OR ")+")")
+    }
+    ranges := []struct {
+        facet, expr string
+        r           Range
+    }{
+        {facetPrice, productPriceExpr, f.Price},
+        {facetThickness, "ifnull(thickness_mm,0)", f.Thickness},
+        {facetWeight, "ifnull(weight_kg,0)", f.Weight},
+        {facetLength, "ifnull(length_m,0)", f.Length},
+    }
+    for _, rg := range ranges {
+        if skip == rg.facet { continue }
+        if rg.r.Min != nil { conds = append(conds, rg.expr+" >= ?"); args = append(args, *rg.r.Min) }
+        if rg.r.Max != nil { conds = append(conds, rg.expr+" <= ?"); args = append(args, *rg.r.Max) }
+    }
+    if f.InStock && skip != facetInStock { conds = append(conds, "ifnull(in_stock,1) = 1") }
+    if len(f.Sizes) > 0 && skip != facetSize {
+        conds = append(conds, "trim(ifnull(size,'')) IN ("+placeholders(len(f.Sizes))+")")
+        for _, s := range f.Sizes { args = append(args, s) }
+    }
+    if len(f.Diameters) > 0 && skip != facetDiameter {
+        conds = append(conds, productDiameterExpr+" IN ("+placeholders(len(f.Diameters))+")")
+        for _, d := range f.Diameters { args = append(args, d) }
+    }
+    for _, af := range f.Attrs {
+        if skip == attrFacet(af.AttributeID) { continue }
+        sub := []string{"pa.product_id = products.id", "pa.attribute_id = ?"}
+        args = append(args, af.AttributeID)
+        if len(af.Values) > 0 {
+            sub = append(sub, "pa.value_text IN ("+placeholders(len(af.Values))+")")
+            for _, v := range af.Values { args = append(args, v) }
+        }
+        if af.Num.Min != nil { sub = append(sub, "pa.value_num >= ?"); args = append(args, *af.Num.Min) }
+        if af.Num.Max != nil { sub = append(sub, "pa.value_num <= ?"); args = append(args, *af.Num.Max) }
+        conds = append(conds, "EXISTS (SELECT 1 FROM product_attributes pa WHERE "+strings.Join(sub, " AND ")+")")
+    }
+    if len(conds) == 0 { return "", nil }
+    return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func (r *productRepo) Filter(f ProductFilter) ([]Product, int, error) {
+    where, args := f.where(facetNone)
+    var total int
+    if err := r.q.QueryRow("SELECT COUNT(*) FROM products"+where, args...).Scan(&total); err != nil { return nil, 0, err }
+    order, ok := productOrders[f.Sort]
+    if !ok { order = productOrders[""] }
+    q := "SELECT " + productColumns + " FROM products" + where + " ORDER BY " + order
+    if f.Limit > 0 {
+        q += " LIMIT ? OFFSET ?"
+        args = append(args, f.Limit, f.Offset)
+    }
+    rows, err := r.q.Query(q, args...)
+    if err != nil { return nil, 0, err }
+    defer rows.Close()
+    out := []Product{}
+    for rows.Next() {
+        p, err := scanProduct(rows)
+        if err != nil { return nil, 0, err }
+        out = append(out, p)
+    }
+    return out, total, rows.Err()
+}
+
+func (r *productRepo) Facets(f ProductFilter) (ProductFacets, error) {
+    var fc ProductFacets
+    var err error
+    if fc.Subtypes, err = r.facetValues(f, facetSub, "trim(ifnull(subtype,''))"); err != nil { return fc, err }
+    if fc.Sizes, err = r.facetValues(f, facetSize, "trim(ifnull(size,''))"); err != nil { return fc, err }
+    if fc.Diameters, err = r.facetValues(f, facetDiameter, productDiameterExpr); err != nil { return fc, err }
+    where, args := f.where(facetInStock)
+    if err := r.q.QueryRow("SELECT COUNT(*) FROM products"+where+joinCond(where, "ifnull(in_stock,1) = 1"), args...).Scan(&fc.InStock); err != nil { return fc, err }
+    ranges := []struct {
+        facet, expr string
+        dst         *RangeFacet
+    }{
+        {facetPrice, productPriceExpr, &fc.Price},
+        {facetThickness, "ifnull(thickness_mm,0)", &fc.Thickness},
+        {facetWeight, "ifnull(weight_kg,0)", &fc.Weight},
+        {facetLength, "ifnull(length_m,0)", &fc.Length},
+    }
+    for _, rg := range ranges {
+        where, args := f.where(rg.facet)
+        if err := r.q.QueryRow("SELECT ifnull(min("+rg.expr+"),0), ifnull(max("+rg.expr+"),0) FROM products"+where, args...).Scan(&rg.dst.Min, &rg.dst.Max); err != nil { return fc, err }
+    }
+    return fc, nil
+}
+
+func (r *productRepo) AttributeFacets(f ProductFilter, defs []AttributeDef) ([]AttributeFacet, error) {
+    out := []AttributeFacet{}
+    for _, d := range defs {
+        if !d.Filterable { continue }
+        af := AttributeFacet{Code: d.Code, Title: d.Title, Kind: d.Kind, Unit: d.Unit, Values: []FacetValue{}}
+        where, args := f.where(attrFacet(d.ID))
+        from := " FROM products JOIN product_attributes pa ON pa.product_id = products.id" + where + joinCond(where, "pa.attribute_id = ?")
+        args = append(args, d.ID)
+        order := "COUNT(*) DESC, pa.value_text"
+        if d.Kind == AttrNumber { order = "min(pa.value_num), pa.value_text" }
+        rows, err := r.q.Query("SELECT pa.value_text, COUNT(*)"+from+" GROUP BY pa.value_text ORDER BY "+order, args...)
+        if err != nil { return nil, err }
+        for rows.Next() {
+            var fv FacetValue
+            if err := rows.Scan(&fv.Value, &fv.Count); err != nil { rows.Close(); return nil, err }
+            af.Values = append(af.Values, fv)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil { return nil, err }
+        if len(af.Values) == 0 { continue }
+        if d.Kind == AttrNumber {
+            var rf RangeFacet
+            if err := r.q.QueryRow("SELECT ifnull(min(pa.value_num),0), ifnull(max(pa.value_num),0)"+from, args...).Scan(&rf.Min, &rf.Max); err != nil { return nil, err }
+            af.Range = &rf
+        }
+        out = append(out, af)
+    }
+    return out, nil
+}
+
+func (r *productRepo) FindByName(productType, name string) ([]Product, error) {
+    where, args := ProductFilter{Type: productType}.where(facetNone)
+    rows, err := r.q.Query("SELECT "+productColumns+" FROM products"+where+joinCond(where, "trim(ifnull(name,'')) = ?")+" ORDER BY id", append(args, strings.TrimSpace(name))...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Product{}
+    for rows.Next() {
+        p, err := scanProduct(rows)
+        if err != nil { return nil, err }
+        out = append(out, p)
+    }
+    return out, rows.Err()
+}
+
+func (r *productRepo) Related(productType string, p Product, limit int) ([]Product, error) {
+    where, args := ProductFilter{Type: productType}.where(facetNone)
+    var price float64
+    if err := r.q.QueryRow("SELECT "+productPriceExpr+" FROM products WHERE id=?", p.ID).Scan(&price); err != nil { return nil, notFound(err) }
+    args = append(args, p.ID, strings.TrimSpace(p.Subtype), price, limit)
+    rows, err := r.q.Query("SELECT "+productColumns+" FROM products"+where+joinCond(where, "id <> ?")+
+        " ORDER BY trim(ifnull(subtype,'')) = ? DESC, abs("+productPriceExpr+" - ?), id LIMIT ?", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Product{}
+    for rows.Next() {
+        rp, err := scanProduct(rows)
+        if err != nil { return nil, err }
+        out = append(out, rp)
+    }
+    return out, rows.Err()
+}
+
+// facetValues counts products per non-empty value of expr, most common first
+func (r *productRepo) facetValues(f ProductFilter, facet, expr string) ([]FacetValue, error) {
+    where, args := f.where(facet)
+    rows, err := r.q.Query("SELECT "+expr+" AS v, COUNT(*) FROM products"+where+joinCond(where, "v <> '' AND v <> 0")+" GROUP BY v ORDER BY COUNT(*) DESC, v", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []FacetValue{}
+    for rows.Next() {
+        var v any
+        var fv FacetValue
+        if err := rows.Scan(&v, &fv.Count); err != nil { return nil, err }
+        switch x := v.(type) {
+        case float64:
+            fv.Value = strconv.FormatFloat(x, 'f', -1, 64)
+        case int64:
+            fv.Value = strconv.FormatInt(x, 10)
+        case string:
+            fv.Value = x
+        case []byte:
+            fv.Value = string(x)
+        }
+        out = append(out, fv)
+    }
+    return out, rows.Err()
+}
+
+// joinCond appends cond to a WHERE clause built by where, which may be empty
+func joinCond(where, cond string) string {
+    if where == "" { return " WHERE " + cond }
+    return " AND " + cond
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+    "reflect"
+    "testing"
+)
+
+func seedCatalog(t *testing.T, s *Store) []int64 {
+    t.Helper()
+    products := []Product{
+        {Type: "truba-kruglaya", Subtype: "vgp", Name: "Труба ВГП", Size: "57x3.5", WeightKg: 28.3, LengthM: 6, InStock: true, UnitPrice: 500, CreatedAt: "2026-01-01 10:00:00"},
+        {Type: "truba-kruglaya", Subtype: "vgp", Name: "Труба ВГП", Size: "57x3.5", WeightKg: 28.3, LengthM: 12, InStock: false, UnitPrice: 700, CreatedAt: "2026-01-02 10:00:00"},
+        {Type: "truba-kruglaya", Subtype: "esv", Name: "Труба ЭСВ", Size: "76x4", WeightKg: 42.6, LengthM: 6, InStock: true, UnitPrice: 900, CreatedAt: "2026-01-09 10:00:00"},
+        {Type: "truba-kruglaya", Subtype: "esv", Name: "Труба ЭСВ", Size: "89x4", WeightKg: 50.1, LengthM: 6, InStock: true, UnitPrice: 1200, CreatedAt: "2026-01-04 10:00:00"},
+        // price on request
+        {Type: "Truba-Kruglaya — б/у", Subtype: "esv", Name: "Труба ЭСВ", Size: "89x4", LengthM: 6, InStock: true, CreatedAt: "2026-01-05 10:00:00"},
+        {Type: "armatura", Name: "Арматура", Size: "12", InStock: true, UnitPrice: 100, CreatedAt: "2026-01-06 10:00:00"},
+    }
+    ids := make([]int64, len(products))
+    for i := range products {
+        if err := s.Products.Create(&products[i]); err != nil { t.Fatal(err) }
+        // Create leaves created_at to the column default
+        if _, err := s.DB.Exec("UPDATE products SET created_at=? WHERE id=?", products[i].CreatedAt, products[i].ID); err != nil { t.Fatal(err) }
+        ids[i] = products[i].ID
+    }
+    return ids
+}
+
+func TestProductFilter(t *testing.T) {
+    s := openTestStore(t)
+    if _, err := s.Migrate(); err != nil { t.Fatal(err) }
+    ids := seedCatalog(t, s)
+    num := func(v float64) *float64 { return &v }
+    pipes := ProductFilter{Type: "truba-kruglaya"}
+
+    cases := []struct {
+        name  string
+        f     ProductFilter
+        want  []int64 // by index into the seeded products
+        total int
+    }{
+        {"type, also with a free-text tail; catalog order is subtype, then price", pipes, []int64{4, 2, 3, 0, 1}, 5},
+        {"price range reads the stored unit price", ProductFilter{Type: "truba-kruglaya", Price: Range{Min: num(600), Max: num(1000)}}, []int64{2, 1}, 2},
+        {"price from", ProductFilter{Type: "truba-kruglaya", Price: Range{Min: num(900)}}, []int64{2, 3}, 2},
+        {"in stock", ProductFilter{Type: "truba-kruglaya", InStock: true, Sort: "price_asc"}, []int64{4, 0, 2, 3}, 4},
+        {"price descending", ProductFilter{Type: "truba-kruglaya", Sort: "price_desc"}, []int64{3, 2, 1, 0, 4}, 5},
+        {"newest first", ProductFilter{Type: "truba-kruglaya", Sort: "new"}, []int64{2, 4, 3, 1, 0}, 5},
+        {"unknown sort falls back to the catalog order", ProductFilter{Type: "truba-kruglaya", Sort: "random"}, []int64{4, 2, 3, 0, 1}, 5},
+        {"page past the first keeps the total", ProductFilter{Type: "truba-kruglaya", Sort: "price_asc", Limit: 2, Offset: 2}, []int64{1, 2}, 5},
+        {"sizes", ProductFilter{Type: "truba-kruglaya", Sizes: []string{"89x4", "76x4"}, Sort: "price_asc"}, []int64{4, 2, 3}, 3},
+        {"diameter", ProductFilter{Type: "truba-kruglaya", Diameters: []float64{57}, Sort: "price_asc"}, []int64{0, 1}, 2},
+        {"length", ProductFilter{Type: "truba-kruglaya", Length: Range{Min: num(10)}}, []int64{1}, 1},
+        {"subtype", ProductFilter{Type: "truba-kruglaya", SubSubtypes: []string{"vgp"}, Sort: "price_asc"}, []int64{0, 1}, 2},
+        {"nothing left", ProductFilter{Type: "ugolok"}, nil, 0},
+    }
+    for _, c := range cases {
+        got, total, err := s.Products.Filter(c.f)
+        if err != nil { t.Fatalf("%s: %v", c.name, err) }
+        var gotIdx []int64
+        for _, p := range got {
+            for i, id := range ids {
+                if p.ID == id { gotIdx = append(gotIdx, int64(i)) }
+            }
+        }
+        if !reflect.DeepEqual(gotIdx, c.want) || total != c.total { t.Errorf("%s: %v of %d, want %v of %d", c.name, gotIdx, total, c.want, c.total) }
+    }
+}
+
+func TestProductFacets(t *testing.T) {
+    s := openTestStore(t)
+    if _, err := s.Migrate(); err != nil { t.Fatal(err) }
+    seedCatalog(t, s)
+
+    fc, err := s.Products.Facets(ProductFilter{Type: "truba-kruglaya"})
+    if err != nil { t.Fatal(err) }
+    if want := []FacetValue{{"57x3.5", 2}, {"89x4", 2}, {"76x4", 1}}; !reflect.DeepEqual(fc.Sizes, want) { t.Errorf("sizes = %v, want %v", fc.Sizes, want) }
+    if want := []FacetValue{{"57", 2}, {"89", 2}, {"76", 1}}; !reflect.DeepEqual(fc.Diameters, want) { t.Errorf("diameters = %v, want %v", fc.Diameters, want) }
+    if want := []FacetValue{{"esv", 3}, {"vgp", 2}}; !reflect.DeepEqual(fc.Subtypes, want) { t.Errorf("subtypes = %v, want %v", fc.Subtypes, want) }
+    if fc.InStock != 4 { t.Errorf("in stock = %d, want 4", fc.InStock) }
+    // price on request counts as 0, so the span starts there
+    if fc.Price != (RangeFacet{0, 1200}) || fc.Length != (RangeFacet{6, 12}) { t.Errorf("price %v, length %v", fc.Price, fc.Length) }
+
+    // a facet ignores its own filter but follows the others; ties go by value
+    fc, err = s.Products.Facets(ProductFilter{Type: "truba-kruglaya", Sizes: []string{"57x3.5"}, InStock: true, Price: Range{Min: func(v float64) *float64 { return &v }(800)}})
+    if err != nil { t.Fatal(err) }
+    if want := []FacetValue{{"76x4", 1}, {"89x4", 1}}; !reflect.DeepEqual(fc.Sizes, want) { t.Errorf("sizes with the other filters = %v, want %v", fc.Sizes, want) }
+    if fc.InStock != 0 { t.Errorf("in stock among 57x3.5 from 800 ₽ = %d, want 0", fc.InStock) }
+    if fc.Price != (RangeFacet{500, 500}) { t.Errorf("price among in-stock 57x3.5 = %v, want 500..500", fc.Price) }
+}
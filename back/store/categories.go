@@ -0,0 +1,311 @@
+package store
+
+import (
+    "database/sql"
+    "strings"
+)
+
+// Category is a node of the catalog tree. Top-level categories correspond to products.type,
+// subcategories to products.subtype.
+type Category struct {
+    ID             int64  `json:"id"`
+    ParentID       int64  `json:"parent_id"` // 0 for a top-level category
+    Slug           string `json:"slug"`
+    Title          string `json:"title"`
+    Alias          string `json:"alias"` // old storefront id (rebar, profile-pipe) still accepted by the API
+    SortOrder      int    `json:"sort_order"`
+    Image          string `json:"image"`
+    SEOTitle       string `json:"seo_title"`
+    SEODescription string `json:"seo_description"`
+    // MatchCode and Keywords let a subcategory claim products whose subtype was typed freely:
+    // the grade code (a500c) or comma-separated Latin keywords found in subtype, name or size
+    MatchCode string `json:"match_code"`
+    Keywords  string `json:"keywords"`
+    CreatedAt string `json:"created_at"`
+    UpdatedAt string `json:"updated_at"`
+}
+
+// KeywordList splits Keywords into trimmed non-empty words
+func (c Category) KeywordList() []string {
+    var out []string
+    for _, k := range strings.Split(c.Keywords, ",") {
+        if k = strings.TrimSpace(k); k != "" { out = append(out, k) }
+    }
+    return out
+}
+
+// CategoryRepo persists the catalog tree
+type CategoryRepo interface {
+    // List returns every category ordered by sort_order, then title
+    List() ([]Category, error)
+    Get(id int64) (Category, error)
+    // Create and Update return ErrConflict when the slug is taken under the same parent
+    Create(c *Category) error
+    Update(c Category) error
+    // Delete returns ErrConflict while the category still has subcategories
+    Delete(id int64) error
+    // CountProducts counts the products listed under c by its slug: products.type for a top-level
+    // category, the parent's type plus products.subtype for a subcategory
+    CountProducts(c Category) (int, error)
+    // MoveProducts rewrites type and subtype of the products listed under old (and the type
+    // description) so they follow the category to its new slug or parent; call it in the
+    // transaction that updates the category
+    MoveProducts(old, c Category) error
+}
+
+type categoryRepo struct{ q dbtx }
+
+const categoryColumns = "id, ifnull(parent_id,0), slug, title, alias, sort_order, image, seo_title, seo_description, match_code, keywords, created_at, updated_at"
+
+func scanCategory(sc scanner) (Category, error) {
+    var c Category
+    err := sc.Scan(&c.ID, &c.ParentID, &c.Slug, &c.Title, &c.Alias, &c.SortOrder, &c.Image, &c.SEOTitle, &c.SEODescription, &c.MatchCode, &c.Keywords, &c.CreatedAt, &c.UpdatedAt)
+    return c, err
+}
+
+// nullID stores a zero parent as NULL so the foreign key is not checked
+func nullID(id int64) any {
+    if id == 0 { return nil }
+    return id
+}
+
+// isUniqueViolation reports a failed UNIQUE constraint
+func isUniqueViolation(err error) bool {
+    return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func (r *categoryRepo) List() ([]Category, error) {
+    rows, err := r.q.Query("SELECT " + categoryColumns + " FROM categories ORDER BY sort_order, title, id")
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Category{}
+    for rows.Next() {
+        c, err := scanCategory(rows)
+        if err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+func (r *categoryRepo) Get(id int64) (Category, error) {
+    c, err := scanCategory(r.q.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id=?", id))
+    return c, notFound(err)
+}
+
+func (r *categoryRepo) Create(c *Category) error {
+    now := Now()
+    res, err := r.q.Exec("INSERT INTO categories(parent_id, slug, title, alias, sort_order, image, seo_title, seo_description, match_code, keywords, created_at, updated_at) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)",
+        nullID(c.ParentID), c.Slug, c.Title, c.Alias, c.SortOrder, c.Image, c.SEOTitle, c.SEODescription, c.MatchCode, c.Keywords, now, now)
+    if isUniqueViolation(err) { return ErrConflict }
+    if err != nil { return err }
+    c.ID, err = res.LastInsertId()
+    c.CreatedAt, c.UpdatedAt = now, now
+    return err
+}
+
+func (r *categoryRepo) Update(c Category) error {
+    res, err := r.q.Exec("UPDATE categories SET parent_id=?, slug=?, title=?, alias=?, sort_order=?, image=?, seo_title=?, seo_description=?, match_code=?, keywords=?, updated_at=? WHERE id=?",
+        nullID(c.ParentID), c.Slug, c.Title, c.Alias, c.SortOrder, c.Image, c.SEOTitle, c.SEODescription, c.MatchCode, c.Keywords, Now(), c.ID)
+    if isUniqueViolation(err) { return ErrConflict }
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *categoryRepo) Delete(id int64) error {
+    var children int
+    if err := r.q.QueryRow("SELECT COUNT(*) FROM categories WHERE parent_id=?", id).Scan(&children); err != nil { return err }
+    if children > 0 { return ErrConflict }
+    res, err := r.q.Exec("DELETE FROM categories WHERE id=?", id)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+// productScope is the WHERE clause matching the products listed under c. Types are compared in
+// lower case and also by the old alias; older rows spell the subtype as the subcategory title.
+func (r *categoryRepo) productScope(c Category) (string, []any, error) {
+    top := c
+    if c.ParentID != 0 {
+        var err error
+        if top, err = r.Get(c.ParentID); err != nil { return "", nil, err }
+    }
+    where := "lower(trim(type)) IN (?, ?)"
+    args := []any{top.Slug, top.Slug}
+    if top.Alias != "" { args[1] = top.Alias }
+    if c.ParentID != 0 {
+        where += " AND trim(subtype) IN (?, ?)"
+        args = append(args, c.Slug, c.Title)
+    }
+    return where, args, nil
+}
+
+func (r *categoryRepo) CountProducts(c Category) (int, error) {
+    where, args, err := r.productScope(c)
+    if err != nil { return 0, err }
+    var n int
+    err = r.q.QueryRow("SELECT COUNT(*) FROM products WHERE "+where, args...).Scan(&n)
+    return n, err
+}
+
+func (r *categoryRepo) MoveProducts(old, c Category) error {
+    where, args, err := r.productScope(old)
+    if err != nil { return err }
+    if c.ParentID == 0 {
+        if _, err := r.q.Exec("UPDATE products SET type=? WHERE "+where, append([]any{c.Slug}, args...)...); err != nil { return err }
+        // the type description of the catalog page is keyed by the slug too
+        if old.ParentID == 0 {
+            _, err = r.q.Exec("UPDATE OR IGNORE product_descriptions SET type=? WHERE type=?", c.Slug, old.Slug)
+        }
+        return err
+    }
+    parent, err := r.Get(c.ParentID)
+    if err != nil { return err }
+    _, err = r.q.Exec("UPDATE products SET type=?, subtype=? WHERE "+where, append([]any{parent.Slug, c.Slug}, args...)...)
+    return err
+}
+
+// seedCategory is a node of the initial tree written by the categories migration
+type seedCategory struct {
+    Slug, Title, Alias, Image, MatchCode, Keywords string
+    Children                                       []seedCategory
+}
+
+// defaultCategories is the tree the storefront had hard-coded before categories moved to the database
+var defaultCategories = []seedCategory{
+    {Slug: "armatura", Title: "Арматура", Alias: "rebar", Image: "/img/catalog/catalog1.jpeg", Children: []seedCategory{
+            {Slug: "a500c", Title: "Арматура А500C", MatchCode: "a500c"},
+            {Slug: "a1", Title: "Гладкая арматура A1", MatchCode: "a1"},
+            {Slug: "a400", Title: "Арматура A400", MatchCode: "a400"},
+            {Slug: "fixatory", Title: "Фиксаторы для арматуры"},
+            {Slug: "stekloplastikovaya", Title: "Арматура стеклопластиковая"},
+        }},
+    {Slug: "truba-profilnaya", Title: "Труба профильная", Alias: "profile-pipe", Image: "/img/catalog/catalog2.jpeg", Children: []seedCategory{
+            {Slug: "kvadratnaya", Title: "Труба квадратная", Keywords: "kvadrat"},
+            {Slug: "otsinkovannaya", Title: "Труба оцинкованная", Keywords: "ocink"},
+            {Slug: "pryamougolnaya", Title: "Труба прямоугольная", Keywords: "pryamougol"},
+        }},
+    {Slug: "sortovoy-prokat", Title: "Сортовой прокат", Alias: "beam", Image: "/img/catalog/catalog3.jpg", Children: []seedCategory{
+            {Slug: "dvutavrovaya-balka", Title: "Балка двутавровая"},
+            {Slug: "ugolok", Title: "Уголок"},
+            {Slug: "polosa", Title: "Полоса"},
+            {Slug: "shveller", Title: "Швеллер"},
+            {Slug: "kvadrat-stalnoy", Title: "Квадрат стальной"},
+            {Slug: "provoloka-vyazalnaya", Title: "Проволока вязальная"},
+        }},
+    {Slug: "truba-kruglaya", Title: "Труба круглая", Alias: "round-pipe", Image: "/img/catalog/catalog4.jpeg", Children: []seedCategory{
+            {Slug: "besshovnaya", Title: "Бесшовные трубы", Keywords: "besshov"},
+            {Slug: "vgp", Title: "Труба водогазопроводная", Keywords: "vgp,vodogaz"},
+            {Slug: "ocinkovannaya", Title: "Труба оцинкованная", Keywords: "ocink"},
+            {Slug: "elektrosvarka", Title: "Труба электросварная", Keywords: "elektrosvar"},
+        }},
+    {Slug: "listovoy-prokat", Title: "Листовой прокат", Alias: "sheet", Image: "/img/catalog/catalog5.jpeg", Children: []seedCategory{
+            {Slug: "ocinkovanniy", Title: "Лист оцинкованный", Keywords: "ocink"},
+            {Slug: "st_goryachekatanyi", Title: "Лист стальной горячекатаный", Keywords: "goryachekat"},
+            {Slug: "st_holodnokatanyi", Title: "Лист стальной холоднокатаный", Keywords: "holodnokat"},
+            {Slug: "rifleniy_romb", Title: "Лист рифленый ромб", Keywords: "rifl,romb"},
+            {Slug: "riflenaya_chechevica", Title: "Лист рифленый чечевица", Keywords: "chechev"},
+            {Slug: "prosechno-vytyazhnoy", Title: "Лист просечно-вытяжной", Keywords: "prosech,vytyazh"},
+        }},
+    {Slug: "profnastil", Title: "Профнастил", Image: "/img/catalog/catalog6.jpeg", Children: []seedCategory{
+            {Slug: "krashennyy", Title: "Профнастил крашеный", Keywords: "krashen,polimer"},
+            {Slug: "ocinkovannyy", Title: "Профнастил оцинкованный", Keywords: "ocink"},
+            {Slug: "dlya-zabora", Title: "Профнастил для забора", Keywords: "zabor"},
+        }},
+    {Slug: "kovanye-izdeliya", Title: "Кованые изделия", Image: "/img/catalog/catalog7.png", Children: []seedCategory{
+            {Slug: "balyasiny-poruchni", Title: "Балясины, поручни"},
+            {Slug: "vinograd", Title: "Виноград"},
+            {Slug: "vstavka-v-balyasiny", Title: "Вставка в балясины"},
+            {Slug: "dekorativnye-kolpaki", Title: "Декоративные колпаки"},
+            {Slug: "korzinki", Title: "Корзинки"},
+            {Slug: "listya", Title: "Листья"},
+            {Slug: "osnovaniya-balyasin", Title: "Основания балясин"},
+            {Slug: "piki", Title: "Пики"},
+            {Slug: "polusfera", Title: "Полусфера металлическая"},
+            {Slug: "ruchki-i-petli", Title: "Ручки и петли"},
+            {Slug: "slozhnaya-kovka", Title: "Сложная ковка"},
+            {Slug: "hudozh-prokat", Title: "Художественный прокат"},
+            {Slug: "cvety-nakladki", Title: "Цветы, накладки"},
+            {Slug: "shary", Title: "Шары"},
+            {Slug: "elementy-ornamenta", Title: "Элементы орнамента"},
+        }},
+    {Slug: "shtaketnik-metallicheskiy", Title: "Штакетник металлический", Image: "/img/catalog/catalog8.webp", Children: []seedCategory{
+            {Slug: "m-obraznyj", Title: "Штакетник М-образный"},
+            {Slug: "p-obraznyj", Title: "Штакетник П-образный"},
+            {Slug: "polukruglyj", Title: "Штакетник Полукруглый"},
+            {Slug: "zolotoy-dub", Title: "Золотой дуб евроштакетник"},
+            {Slug: "seryy", Title: "Серый евроштакетник"},
+            {Slug: "zelenyy", Title: "Зеленый евроштакетник"},
+        }},
+    {Slug: "setka-metallicheskaia", Title: "Сетка металлическая", Image: "/img/catalog/catalog9.jpeg", Children: []seedCategory{
+            {Slug: "rabica", Title: "Сетка рабица"},
+            {Slug: "svark-v-kartah", Title: "Сетка сварная в картах"},
+            {Slug: "svark-v-rulonah", Title: "Сетка сварная в рулонах"},
+            {Slug: "kladichnaya", Title: "Сетка кладочная"},
+            {Slug: "pvkh", Title: "Сетка сварная ПВХ"},
+        }},
+    {Slug: "stroymaterialy", Title: "Стройматериалы", Image: "/img/catalog/catalog10.png", Children: []seedCategory{
+            {Slug: "bloki", Title: "Блоки строительные"},
+            {Slug: "diski-otreznye", Title: "Диски отрезные"},
+            {Slug: "izolyacionnye", Title: "Изоляционные материалы"},
+            {Slug: "gipsokarton", Title: "Профиль и комплектующие для гипсокартона"},
+            {Slug: "fanera", Title: "Фанера"},
+            {Slug: "elektrody", Title: "Электроды"},
+            {Slug: "suhie-smesi", Title: "Сухие смеси и грунтовки"},
+            {Slug: "listovye-materialy", Title: "Листовые материалы"},
+        }},
+    {Slug: "zabory", Title: "Заборы", Image: "/img/catalog/catalog11.png", Children: []seedCategory{
+            {Slug: "setka-dlya-zabora", Title: "Сетка сварная для забора"},
+            {Slug: "setka-rabica", Title: "Сетка рабица для забора"},
+            {Slug: "lagi", Title: "Лаги для забора"},
+            {Slug: "stolby", Title: "Столбы для забора"},
+            {Slug: "komplektuyushchie", Title: "Комплектующие для забора"},
+        }},
+    {Slug: "krepezh", Title: "Крепеж", Image: "/img/catalog/catalog12.webp", Children: []seedCategory{
+            {Slug: "ankery", Title: "Анкеры"},
+            {Slug: "gvozdi", Title: "Гвозди строительные"},
+            {Slug: "dyubeli", Title: "Дюбели"},
+            {Slug: "samorezy", Title: "Саморезы"},
+            {Slug: "santehnicheskij", Title: "Сантехнический крепеж"},
+            {Slug: "metricheskij", Title: "Метрический крепеж"},
+        }},
+    {Slug: "petli", Title: "Петли", Image: "/img/catalog/catalog13.png"},
+    {Slug: "fitingi", Title: "Фитинги", Image: "/img/catalog/catalog14.jpg", Children: []seedCategory{
+            {Slug: "bochata", Title: "Бочата"},
+            {Slug: "gayki-chugunnye", Title: "Гайки чугунные"},
+            {Slug: "mufty", Title: "Муфты"},
+            {Slug: "rezba", Title: "Резьба"},
+            {Slug: "sgony", Title: "Сгоны"},
+            {Slug: "otvody", Title: "Отводы"},
+        }},
+    {Slug: "vintovye-svai", Title: "Винтовые сваи", Image: "/img/catalog/catalog15.jpg", Children: []seedCategory{
+            {Slug: "57mm", Title: "Винтовые сваи 57 мм"},
+            {Slug: "76mm", Title: "Винтовые сваи 76 мм"},
+            {Slug: "89mm", Title: "Винтовые сваи 89 мм"},
+            {Slug: "108mm", Title: "Винтовые сваи 108 мм"},
+            {Slug: "133mm", Title: "Винтовые сваи 133 мм"},
+            {Slug: "159mm", Title: "Винтовые сваи 159 мм"},
+            {Slug: "ogolovki", Title: "Оголовки для свай"},
+        }},
+    {Slug: "zaglushki-dlya-profilnyh-trub", Title: "Заглушки для профильных труб", Image: "/img/catalog/catalog16.png", Children: []seedCategory{
+            {Slug: "metallicheskie", Title: "Заглушки металлические"},
+            {Slug: "plastikovye", Title: "Заглушки пластиковые"},
+        }},
+}
+
+func seedCategories(tx *sql.Tx) error {
+    now := Now()
+    var insert func(parent any, nodes []seedCategory) error
+    insert = func(parent any, nodes []seedCategory) error {
+        for i, n := range nodes {
+            res, err := tx.Exec("INSERT INTO categories(parent_id, slug, title, alias, sort_order, image, match_code, keywords, created_at, updated_at) VALUES(?,?,?,?,?,?,?,?,?,?)",
+                parent, n.Slug, n.Title, n.Alias, (i+1)*10, n.Image, n.MatchCode, n.Keywords, now, now)
+            if err != nil { return err }
+            id, err := res.LastInsertId()
+            if err != nil { return err }
+            if err := insert(id, n.Children); err != nil { return err }
+        }
+        return nil
+    }
+    return insert(nil, defaultCategories)
+}
@@ -0,0 +1,39 @@
+package store
+
+import "testing"
+
+func TestCategoryProductsFollowSlug(t *testing.T) {
+    s := openTestStore(t)
+    if _, err := s.Migrate(); err != nil { t.Fatal(err) }
+    top := Category{Slug: "armatura-test", Title: "Арматура", Alias: "rebar-test"}
+    if err := s.Categories.Create(&top); err != nil { t.Fatal(err) }
+    sub := Category{ParentID: top.ID, Slug: "a500", Title: "Арматура А500"}
+    if err := s.Categories.Create(&sub); err != nil { t.Fatal(err) }
+    // by slug, by alias in other case, by the subcategory title the way older rows spell it, and another type
+    for _, p := range [][2]string{{"armatura-test", "a500"}, {"Rebar-Test", "a500"}, {"armatura-test", "Арматура А500"}, {"armatura-test", "a1"}, {"ugolok", "a500"}} {
+        if _, err := s.DB.Exec("INSERT INTO products(type, subtype, name) VALUES(?,?,'x')", p[0], p[1]); err != nil { t.Fatal(err) }
+    }
+
+    count := func(c Category, want int) {
+        t.Helper()
+        n, err := s.Categories.CountProducts(c)
+        if err != nil { t.Fatal(err) }
+        if n != want { t.Errorf("CountProducts(%s) = %d, want %d", c.Slug, n, want) }
+    }
+    count(top, 4)
+    count(sub, 3)
+
+    moved := sub
+    moved.Slug = "a500c"
+    if err := s.Categories.MoveProducts(sub, moved); err != nil { t.Fatal(err) }
+    count(moved, 3)
+    count(sub, 0)
+
+    renamed := top
+    renamed.Slug = "armatura"
+    if err := s.Categories.MoveProducts(top, renamed); err != nil { t.Fatal(err) }
+    count(renamed, 4)
+    var left int
+    if err := s.DB.QueryRow("SELECT COUNT(*) FROM products WHERE type='armatura'").Scan(&left); err != nil { t.Fatal(err) }
+    if left != 4 { t.Errorf("%d products moved to the new type, want 4", left) }
+}
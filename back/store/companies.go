@@ -0,0 +1,130 @@
+package store
+
+import "database/sql"
+
+// Company is a customer organisation: its requisites for invoices, the price group its users buy
+// at and its credit terms. Several accounts may belong to one company.
+type Company struct {
+    ID           int64   `json:"id"`
+    Name         string  `json:"name"` // legal name
+    INN          string  `json:"inn"`
+    KPP          string  `json:"kpp"`
+    OGRN         string  `json:"ogrn"`
+    LegalAddress string  `json:"legal_address"`
+    BankName     string  `json:"bank_name"`
+    BIK          string  `json:"bik"`
+    BankAccount  string  `json:"bank_account"` // settlement account
+    CorrAccount  string  `json:"corr_account"`
+    PriceGroup   string  `json:"price_group"`
+    CreditLimit  float64 `json:"credit_limit"` // cap on the unpaid deferred orders; 0 for prepayment only
+    PaymentDays  int     `json:"payment_days"` // payment deferral in days, 0 for prepayment
+    Members      int     `json:"members"`      // accounts linked to the company; read only
+    CreatedAt    string  `json:"created_at"`
+    UpdatedAt    string  `json:"updated_at"`
+}
+
+// CompanyRepo persists customer companies
+type CompanyRepo interface {
+    // List returns every company ordered by name
+    List() ([]Company, error)
+    Get(id int64) (Company, error)
+    // Create and Update return ErrConflict when another company has the same INN and KPP
+    Create(c *Company) error
+    Update(c Company) error
+    // Delete unlinks the company's accounts; orders keep the requisites they were placed with
+    Delete(id int64) error
+}
+
+type companyRepo struct{ q dbtx }
+
+const companyColumns = `id, name, inn, kpp, ogrn, legal_address, bank_name, bik, bank_account, corr_account, price_group, credit_limit, payment_days,
+    (SELECT COUNT(1) FROM users u WHERE u.company_id = companies.id), created_at, updated_at`
+
+func scanCompany(sc scanner) (Company, error) {
+    var c Company
+    err := sc.Scan(&c.ID, &c.Name, &c.INN, &c.KPP, &c.OGRN, &c.LegalAddress, &c.BankName, &c.BIK, &c.BankAccount, &c.CorrAccount,
+        &c.PriceGroup, &c.CreditLimit, &c.PaymentDays, &c.Members, &c.CreatedAt, &c.UpdatedAt)
+    return c, err
+}
+
+func (r *companyRepo) List() ([]Company, error) {
+    rows, err := r.q.Query("SELECT " + companyColumns + " FROM companies ORDER BY name, id")
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Company{}
+    for rows.Next() {
+        c, err := scanCompany(rows)
+        if err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+func (r *companyRepo) Get(id int64) (Company, error) {
+    c, err := scanCompany(r.q.QueryRow("SELECT "+companyColumns+" FROM companies WHERE id=?", id))
+    return c, notFound(err)
+}
+
+func (r *companyRepo) Create(c *Company) error {
+    c.CreatedAt = Now()
+    c.UpdatedAt = c.CreatedAt
+    res, err := r.q.Exec(`INSERT INTO companies(name, inn, kpp, ogrn, legal_address, bank_name, bik, bank_account, corr_account, price_group, credit_limit, payment_days, created_at, updated_at)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+        c.Name, c.INN, c.KPP, c.OGRN, c.LegalAddress, c.BankName, c.BIK, c.BankAccount, c.CorrAccount, c.PriceGroup, c.CreditLimit, c.PaymentDays, c.CreatedAt, c.UpdatedAt)
+    if isUniqueViolation(err) { return ErrConflict }
+    if err != nil { return err }
+    c.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *companyRepo) Update(c Company) error {
+    res, err := r.q.Exec(`UPDATE companies SET name=?, inn=?, kpp=?, ogrn=?, legal_address=?, bank_name=?, bik=?, bank_account=?, corr_account=?,
+        price_group=?, credit_limit=?, payment_days=?, updated_at=? WHERE id=?`,
+        c.Name, c.INN, c.KPP, c.OGRN, c.LegalAddress, c.BankName, c.BIK, c.BankAccount, c.CorrAccount, c.PriceGroup, c.CreditLimit, c.PaymentDays, Now(), c.ID)
+    if isUniqueViolation(err) { return ErrConflict }
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *companyRepo) Delete(id int64) error {
+    res, err := r.q.Exec("DELETE FROM companies WHERE id=?", id)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+// seedCompanies turns the requisites accounts typed into their profile into companies, one per
+// INN and KPP, and links the accounts to them
+func seedCompanies(tx *sql.Tx) error {
+    rows, err := tx.Query("SELECT id, company_name, inn, kpp, company_address FROM users WHERE inn<>'' ORDER BY id")
+    if err != nil { return err }
+    type profile struct {
+        userID                  int64
+        name, inn, kpp, address string
+    }
+    var list []profile
+    for rows.Next() {
+        var p profile
+        if err := rows.Scan(&p.userID, &p.name, &p.inn, &p.kpp, &p.address); err != nil { rows.Close(); return err }
+        list = append(list, p)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil { return err }
+    now := Now()
+    ids := map[[2]string]int64{}
+    for _, p := range list {
+        key := [2]string{p.inn, p.kpp}
+        id, ok := ids[key]
+        if !ok {
+            name := p.name
+            if name == "" { name = "ИНН " + p.inn }
+            res, err := tx.Exec("INSERT INTO companies(name, inn, kpp, legal_address, created_at, updated_at) VALUES(?,?,?,?,?,?)", name, p.inn, p.kpp, p.address, now, now)
+            if err != nil { return err }
+            if id, err = res.LastInsertId(); err != nil { return err }
+            ids[key] = id
+        }
+        if _, err := tx.Exec("UPDATE users SET company_id=? WHERE id=?", id, p.userID); err != nil { return err }
+    }
+    return nil
+}
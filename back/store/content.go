@@ -0,0 +1,146 @@
+package store
+
+// News represents a news article item
+type News struct {
+    ID          int64  `json:"id"`
+    Title       string `json:"title"`
+    ShortText   string `json:"short_text"`
+    FullText    string `json:"full_text"`
+    PublishedAt string `json:"published_at"` // YYYY-MM-DD
+    ImageURL    string `json:"image_url"`
+}
+
+// Article represents an article item
+type Article struct {
+    ID          int64  `json:"id"`
+    Title       string `json:"title"`
+    ShortText   string `json:"short_text"`
+    FullText    string `json:"full_text"`
+    PublishedAt string `json:"published_at"` // YYYY-MM-DD
+}
+
+// SocialLinks are the site-wide messenger and social network links
+type SocialLinks struct {
+    Telegram string `json:"telegram_link"`
+    VK       string `json:"vk_link"`
+    WP       string `json:"wp_link"`
+}
+
+// ContentRepo persists editorial content: news, articles and social links
+type ContentRepo interface {
+    // ListNews returns news newest first, optionally limited to a year (YYYY)
+    ListNews(year string) ([]News, error)
+    GetNews(id int64) (News, error)
+    CreateNews(n *News) error
+    UpdateNews(n News) error
+    DeleteNews(id int64) error
+
+    ListArticles(year string) ([]Article, error)
+    GetArticle(id int64) (Article, error)
+    CountArticlesByTitle(title string) (int, error)
+    CreateArticle(a *Article) error
+    UpdateArticle(a Article) error
+    DeleteArticle(id int64) error
+
+    Social() (SocialLinks, error)
+    SaveSocial(s SocialLinks) error
+}
+
+type contentRepo struct{ q dbtx }
+
+const newsColumns = "id, title, short_text, full_text, published_at, COALESCE(image_url,'')"
+
+func (r *contentRepo) ListNews(year string) ([]News, error) {
+    q := "SELECT " + newsColumns + " FROM news"
+    var args []any
+    if year != "" { q += " WHERE strftime('%Y', published_at)=?"; args = append(args, year) }
+    rows, err := r.q.Query(q+" ORDER BY published_at DESC, id DESC", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []News
+    for rows.Next() {
+        var n News
+        if err := rows.Scan(&n.ID, &n.Title, &n.ShortText, &n.FullText, &n.PublishedAt, &n.ImageURL); err != nil { return nil, err }
+        out = append(out, n)
+    }
+    return out, rows.Err()
+}
+
+func (r *contentRepo) GetNews(id int64) (News, error) {
+    var n News
+    err := r.q.QueryRow("SELECT "+newsColumns+" FROM news WHERE id=?", id).Scan(&n.ID, &n.Title, &n.ShortText, &n.FullText, &n.PublishedAt, &n.ImageURL)
+    return n, notFound(err)
+}
+
+func (r *contentRepo) CreateNews(n *News) error {
+    res, err := r.q.Exec("INSERT INTO news (title, short_text, full_text, published_at, image_url) VALUES (?,?,?,?,?)", n.Title, n.ShortText, n.FullText, n.PublishedAt, n.ImageURL)
+    if err != nil { return err }
+    n.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *contentRepo) UpdateNews(n News) error {
+    _, err := r.q.Exec("UPDATE news SET title=?, short_text=?, full_text=?, published_at=?, image_url=? WHERE id=?", n.Title, n.ShortText, n.FullText, n.PublishedAt, n.ImageURL, n.ID)
+    return err
+}
+
+func (r *contentRepo) DeleteNews(id int64) error {
+    _, err := r.q.Exec("DELETE FROM news WHERE id=?", id)
+    return err
+}
+
+func (r *contentRepo) ListArticles(year string) ([]Article, error) {
+    q := "SELECT id, title, short_text, full_text, published_at FROM articles"
+    var args []any
+    if year != "" { q += " WHERE strftime('%Y', published_at)=?"; args = append(args, year) }
+    rows, err := r.q.Query(q+" ORDER BY published_at DESC, id DESC", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []Article
+    for rows.Next() {
+        var a Article
+        if err := rows.Scan(&a.ID, &a.Title, &a.ShortText, &a.FullText, &a.PublishedAt); err != nil { return nil, err }
+        out = append(out, a)
+    }
+    return out, rows.Err()
+}
+
+func (r *contentRepo) GetArticle(id int64) (Article, error) {
+    var a Article
+    err := r.q.QueryRow("SELECT id, title, short_text, full_text, published_at FROM articles WHERE id=?", id).Scan(&a.ID, &a.Title, &a.ShortText, &a.FullText, &a.PublishedAt)
+    return a, notFound(err)
+}
+
+func (r *contentRepo) CountArticlesByTitle(title string) (int, error) {
+    var n int
+    err := r.q.QueryRow("SELECT COUNT(1) FROM articles WHERE title=?", title).Scan(&n)
+    return n, err
+}
+
+func (r *contentRepo) CreateArticle(a *Article) error {
+    res, err := r.q.Exec("INSERT INTO articles (title, short_text, full_text, published_at) VALUES (?,?,?,?)", a.Title, a.ShortText, a.FullText, a.PublishedAt)
+    if err != nil { return err }
+    a.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *contentRepo) UpdateArticle(a Article) error {
+    _, err := r.q.Exec("UPDATE articles SET title=?, short_text=?, full_text=?, published_at=? WHERE id=?", a.Title, a.ShortText, a.FullText, a.PublishedAt, a.ID)
+    return err
+}
+
+func (r *contentRepo) DeleteArticle(id int64) error {
+    _, err := r.q.Exec("DELETE FROM articles WHERE id=?", id)
+    return err
+}
+
+func (r *contentRepo) Social() (SocialLinks, error) {
+    var s SocialLinks
+    err := r.q.QueryRow("SELECT COALESCE(telegram_link,''), COALESCE(vk_link,''), COALESCE(wp_link,'') FROM social_links WHERE id=1").Scan(&s.Telegram, &s.VK, &s.WP)
+    return s, notFound(err)
+}
+
+func (r *contentRepo) SaveSocial(s SocialLinks) error {
+    _, err := r.q.Exec("UPDATE social_links SET telegram_link=?, vk_link=?, wp_link=? WHERE id=1", s.Telegram, s.VK, s.WP)
+    return err
+}
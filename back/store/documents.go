@@ -0,0 +1,133 @@
+package store
+
+import "time"
+
+// Document kinds
+const (
+    DocInvoice = "invoice" // счёт на оплату
+    DocOffer   = "offer"   // коммерческое предложение
+)
+
+// Document is an issued sales document. It is numbered within its kind and calendar year and keeps
+// the buyer and the lines it was issued with, so downloading it again gives the same paper.
+type Document struct {
+    ID           int64          `json:"id"`
+    Kind         string         `json:"kind"`
+    Year         int            `json:"year"`
+    Number       int            `json:"number"`   // sequential within Kind and Year
+    OrderID      int64          `json:"order_id"` // 0 for an offer made from a cart
+    CartID       string         `json:"-"`
+    BuyerName    string         `json:"buyer_name"`
+    BuyerINN     string         `json:"buyer_inn"`
+    BuyerKPP     string         `json:"buyer_kpp"`
+    BuyerAddress string         `json:"buyer_address"`
+    PaymentDays  int            `json:"payment_days"`
+    VATRate      float64        `json:"vat_rate"` // percent included in the prices, 0 when not subject to VAT
+    Total        float64        `json:"total"`
+    CreatedBy    string         `json:"created_by"` // login of the admin or customer, empty for a guest
+    CreatedAt    string         `json:"created_at"`
+    Lines        []DocumentLine `json:"lines,omitempty"`
+}
+
+// DocumentLine is one row of a document's table
+type DocumentLine struct {
+    Title    string  `json:"title"`
+    Qty      float64 `json:"qty"`
+    Unit     string  `json:"unit"`
+    WeightKg float64 `json:"weight_kg"`
+    Price    float64 `json:"price"` // per Unit
+    Total    float64 `json:"total"`
+}
+
+// DocumentRepo persists issued documents
+type DocumentRepo interface {
+    // List returns documents newest first without their lines, only those of one order when orderID is set
+    List(orderID int64) ([]Document, error)
+    Get(id int64) (Document, error)
+    // ForOrder returns the latest document of kind issued for an order
+    ForOrder(kind string, orderID int64) (Document, error)
+    // LastForCart returns the latest offer made from a cart
+    LastForCart(cartID string) (Document, error)
+    // Create takes the next number of the kind in the year of CreatedAt (now when empty) and
+    // stores d with its lines; call it in a transaction
+    Create(d *Document) error
+}
+
+type documentRepo struct{ q dbtx }
+
+const documentColumns = "id, kind, year, number, order_id, cart_id, buyer_name, buyer_inn, buyer_kpp, buyer_address, payment_days, vat_rate, total, created_by, created_at"
+
+func scanDocument(sc scanner) (Document, error) {
+    var d Document
+    err := sc.Scan(&d.ID, &d.Kind, &d.Year, &d.Number, &d.OrderID, &d.CartID, &d.BuyerName, &d.BuyerINN, &d.BuyerKPP, &d.BuyerAddress,
+        &d.PaymentDays, &d.VATRate, &d.Total, &d.CreatedBy, &d.CreatedAt)
+    return d, err
+}
+
+func (r *documentRepo) List(orderID int64) ([]Document, error) {
+    q := "SELECT " + documentColumns + " FROM documents"
+    var args []any
+    if orderID != 0 {
+        q += " WHERE order_id=?"
+        args = append(args, orderID)
+    }
+    rows, err := r.q.Query(q+" ORDER BY id DESC", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Document{}
+    for rows.Next() {
+        d, err := scanDocument(rows)
+        if err != nil { return nil, err }
+        out = append(out, d)
+    }
+    return out, rows.Err()
+}
+
+func (r *documentRepo) Get(id int64) (Document, error) {
+    return r.one("WHERE id=?", id)
+}
+
+func (r *documentRepo) ForOrder(kind string, orderID int64) (Document, error) {
+    return r.one("WHERE kind=? AND order_id=? ORDER BY id DESC LIMIT 1", kind, orderID)
+}
+
+func (r *documentRepo) LastForCart(cartID string) (Document, error) {
+    return r.one("WHERE kind=? AND cart_id=? AND cart_id<>'' ORDER BY id DESC LIMIT 1", DocOffer, cartID)
+}
+
+// one loads a single document with its lines
+func (r *documentRepo) one(where string, args ...any) (Document, error) {
+    d, err := scanDocument(r.q.QueryRow("SELECT "+documentColumns+" FROM documents "+where, args...))
+    if err != nil { return d, notFound(err) }
+    rows, err := r.q.Query("SELECT title, qty, unit, weight_kg, price, total FROM document_lines WHERE document_id=? ORDER BY id", d.ID)
+    if err != nil { return d, err }
+    defer rows.Close()
+    d.Lines = []DocumentLine{}
+    for rows.Next() {
+        var l DocumentLine
+        if err := rows.Scan(&l.Title, &l.Qty, &l.Unit, &l.WeightKg, &l.Price, &l.Total); err != nil { return d, err }
+        d.Lines = append(d.Lines, l)
+    }
+    return d, rows.Err()
+}
+
+func (r *documentRepo) Create(d *Document) error {
+    if d.CreatedAt == "" { d.CreatedAt = Now() }
+    t, err := time.Parse(TimeLayout, d.CreatedAt)
+    if err != nil { return err }
+    d.Year = t.Year()
+    // the number is taken in the insert itself so two documents issued at once cannot share it
+    res, err := r.q.Exec(`INSERT INTO documents(kind, year, number, order_id, cart_id, buyer_name, buyer_inn, buyer_kpp, buyer_address, payment_days, vat_rate, total, created_by, created_at)
+        SELECT ?, ?, ifnull(MAX(number),0)+1, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM documents WHERE kind=? AND year=?`,
+        d.Kind, d.Year, d.OrderID, d.CartID, d.BuyerName, d.BuyerINN, d.BuyerKPP, d.BuyerAddress, d.PaymentDays, d.VATRate, d.Total, d.CreatedBy, d.CreatedAt,
+        d.Kind, d.Year)
+    if err != nil { return err }
+    if d.ID, err = res.LastInsertId(); err != nil { return err }
+    if err := r.q.QueryRow("SELECT number FROM documents WHERE id=?", d.ID).Scan(&d.Number); err != nil { return err }
+    for _, l := range d.Lines {
+        _, err := r.q.Exec("INSERT INTO document_lines(document_id, title, qty, unit, weight_kg, price, total) VALUES(?,?,?,?,?,?,?)",
+            d.ID, l.Title, l.Qty, l.Unit, l.WeightKg, l.Price, l.Total)
+        if err != nil { return err }
+    }
+    return nil
+}
@@ -0,0 +1,38 @@
+package store
+
+import "testing"
+
+// documents are numbered from 1 within each kind and calendar year
+func TestDocumentNumbering(t *testing.T) {
+    s := openTestStore(t)
+    if _, err := s.Migrate(); err != nil { t.Fatal(err) }
+    docs := []struct {
+        kind, at string
+        orderID  int64
+        want     int
+    }{
+        {DocInvoice, "2025-12-31 23:59:59", 1, 1},
+        {DocInvoice, "2026-01-01 00:00:00", 1, 1},
+        {DocInvoice, "2026-03-01 10:00:00", 2, 2},
+        {DocOffer, "2026-03-01 10:00:00", 2, 1},
+        {DocInvoice, "2026-03-02 10:00:00", 1, 3},
+        {DocInvoice, "2025-12-31 23:59:59", 3, 2},
+    }
+    ids := make([]int64, len(docs))
+    for i, d := range docs {
+        doc := Document{Kind: d.kind, OrderID: d.orderID, CreatedAt: d.at, Total: 100, Lines: []DocumentLine{{Title: "Арматура", Qty: 12, Unit: "m", Price: 50, Total: 600}}}
+        if err := s.InTx(func(tx *Store) error { return tx.Documents.Create(&doc) }); err != nil { t.Fatal(err) }
+        if doc.Number != d.want { t.Errorf("%s of %s numbered %d, want %d", d.kind, d.at, doc.Number, d.want) }
+        ids[i] = doc.ID
+    }
+
+    // the latest invoice of an order is the one reissued
+    got, err := s.Documents.ForOrder(DocInvoice, 1)
+    if err != nil { t.Fatal(err) }
+    if got.ID != ids[4] || got.Year != 2026 || got.Number != 3 { t.Errorf("ForOrder = id %d, %d/%d, want id %d, 3/2026", got.ID, got.Number, got.Year, ids[4]) }
+    if len(got.Lines) != 1 || got.Lines[0].Title != "Арматура" || got.Lines[0].Total != 600 { t.Errorf("lines = %+v", got.Lines) }
+    if _, err := s.Documents.ForOrder(DocOffer, 1); err != ErrNotFound { t.Errorf("ForOrder without an offer: err = %v, want ErrNotFound", err) }
+
+    // a number is never handed out twice
+    if _, err := s.DB.Exec("INSERT INTO documents(kind, year, number, created_at) VALUES(?, 2026, 1, '2026-05-01 00:00:00')", DocOffer); err == nil { t.Error("duplicate document number accepted") }
+}
@@ -0,0 +1,107 @@
+package store
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// legacySchemaVersion is the last migration matching the layout of the per-entity files;
+// later migrations reshape imported data, so the import runs between the two
+const legacySchemaVersion = 8
+
+// legacyFiles maps the per-entity SQLite files used before consolidation to the tables they held
+var legacyFiles = []struct {
+    File   string
+    Tables []string
+}{
+    {"orders.db", []string{"orders"}},
+    {"orders-item.db", []string{"item_orders"}},
+    {"news.db", []string{"news"}},
+    {"articles.db", []string{"articles"}},
+    {"users.db", []string{"users", "social_links"}},
+    {"products.db", []string{"products", "product_descriptions"}},
+    {"cart.db", []string{"cart_items"}},
+}
+
+// HasLegacyFiles reports whether dir still contains any of the pre-consolidation database files
+func HasLegacyFiles(dir string) bool {
+    for _, lf := range legacyFiles {
+        if _, err := os.Stat(filepath.Join(dir, lf.File)); err == nil { return true }
+    }
+    return false
+}
+
+// ImportLegacy copies every table of the old per-entity files in dir into this database in one
+// transaction, preserving row IDs. Columns missing on either side are skipped, so files created
+// by older builds import as well. The database must be fresh: it is migrated up to
+// legacySchemaVersion first, and the caller runs Migrate afterwards for the remaining steps.
+func (s *Store) ImportLegacy(dir string) (map[string]int64, error) {
+    if _, err := s.migrateTo(legacySchemaVersion); err != nil { return nil, err }
+    done, err := s.appliedMigrations()
+    if err != nil { return nil, err }
+    for v := range done {
+        if v > legacySchemaVersion { return nil, fmt.Errorf("database is already at schema version %d; import needs a fresh database", v) }
+    }
+    ctx := context.Background()
+    // ATTACH is per connection, so pin one for the whole import
+    conn, err := s.DB.Conn(ctx)
+    if err != nil { return nil, err }
+    defer conn.Close()
+
+    for _, lf := range legacyFiles {
+        for _, t := range lf.Tables {
+            if t == "social_links" { continue }
+            var n int
+            if err := conn.QueryRowContext(ctx, "SELECT COUNT(1) FROM "+t).Scan(&n); err != nil { return nil, err }
+            if n > 0 { return nil, fmt.Errorf("table %s already has %d rows; import needs a fresh database", t, n) }
+        }
+    }
+
+    var attached []string
+    defer func() {
+        for _, a := range attached { _, _ = conn.ExecContext(ctx, "DETACH DATABASE "+a) }
+    }()
+    for i, lf := range legacyFiles {
+        p := filepath.Join(dir, lf.File)
+        if _, err := os.Stat(p); err != nil { continue }
+        alias := fmt.Sprintf("legacy%d", i)
+        if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+alias, "file:"+p+"?mode=ro"); err != nil { return nil, fmt.Errorf("attach %s: %w", p, err) }
+        attached = append(attached, alias)
+    }
+
+    tx, err := conn.BeginTx(ctx, nil)
+    if err != nil { return nil, err }
+    copied := map[string]int64{}
+    for i, lf := range legacyFiles {
+        alias := fmt.Sprintf("legacy%d", i)
+        if !contains(attached, alias) { continue }
+        for _, t := range lf.Tables {
+            src, err := tableColumns(tx, alias, t)
+            if err != nil { tx.Rollback(); return nil, err }
+            if len(src) == 0 { continue }
+            dst, err := tableColumns(tx, "main", t)
+            if err != nil { tx.Rollback(); return nil, err }
+            var cols []string
+            for _, c := range src {
+                if contains(dst, c) { cols = append(cols, c) }
+            }
+            list := strings.Join(cols, ", ")
+            res, err := tx.Exec("INSERT OR REPLACE INTO main." + t + " (" + list + ") SELECT " + list + " FROM " + alias + "." + t)
+            if err != nil { tx.Rollback(); return nil, fmt.Errorf("copy %s from %s: %w", t, lf.File, err) }
+            n, _ := res.RowsAffected()
+            copied[t] = n
+        }
+    }
+    if err := tx.Commit(); err != nil { return nil, err }
+    return copied, nil
+}
+
+func contains(list []string, v string) bool {
+    for _, x := range list {
+        if x == v { return true }
+    }
+    return false
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+    "database/sql"
+    "path/filepath"
+    "testing"
+)
+
+// writeLegacyFile creates one of the old per-entity database files with the given statements
+func writeLegacyFile(t *testing.T, path string, stmts ...string) {
+    t.Helper()
+    db, err := sql.Open("sqlite", "file:"+path)
+    if err != nil { t.Fatal(err) }
+    defer db.Close()
+    for _, q := range stmts {
+        if _, err := db.Exec(q); err != nil { t.Fatalf("%s: %v", q, err) }
+    }
+}
+
+func TestImportLegacy(t *testing.T) {
+    dir := t.TempDir()
+    // users.db of an older build carries a column the store no longer has
+    writeLegacyFile(t, filepath.Join(dir, "users.db"),
+        `CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, login TEXT NOT NULL UNIQUE, password_hash TEXT NOT NULL, email TEXT, phone TEXT, is_admin INTEGER NOT NULL DEFAULT 0, avatar TEXT)`,
+        `INSERT INTO users(id, login, password_hash, email, is_admin, avatar) VALUES(3, 'admin', 'h1', 'admin@example.ru', 1, 'a.png'), (7, 'ivan', 'h2', 'ivan@example.ru', 0, '')`,
+        `CREATE TABLE social_links (id INTEGER PRIMARY KEY CHECK (id=1), telegram_link TEXT, vk_link TEXT, wp_link TEXT)`,
+        `INSERT INTO social_links VALUES(1, 'https://t.me/metal', '', '')`)
+    // products.db from before skus and featured products
+    writeLegacyFile(t, filepath.Join(dir, "products.db"),
+        `CREATE TABLE products (id INTEGER PRIMARY KEY AUTOINCREMENT, type TEXT NOT NULL, name TEXT NOT NULL, size TEXT, price REAL NOT NULL DEFAULT 0, price_per_ton REAL, weight_kg REAL, length_m REAL, in_stock INTEGER NOT NULL DEFAULT 1, created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+        `INSERT INTO products(id, type, name, size, price_per_ton, weight_kg, length_m, created_at) VALUES(10, 'armatura', 'Арматура А500С', '12', 50000, 10.4, 11.7, '2023-05-01 10:00:00'), (11, 'armatura', 'Арматура А500С', '14', 51000, 14.2, 11.7, '2023-05-01 10:00:00')`,
+        `CREATE TABLE product_descriptions (type TEXT PRIMARY KEY, description TEXT)`,
+        `INSERT INTO product_descriptions VALUES('armatura', 'Арматура для бетона')`)
+    writeLegacyFile(t, filepath.Join(dir, "orders-item.db"),
+        `CREATE TABLE item_orders (id INTEGER PRIMARY KEY AUTOINCREMENT, item_id TEXT, title TEXT, qty INTEGER NOT NULL DEFAULT 1, price REAL NOT NULL DEFAULT 0, total REAL NOT NULL DEFAULT 0, phone TEXT, user_login TEXT, status TEXT NOT NULL DEFAULT 'Ожидает подтверждения', created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+        `INSERT INTO item_orders(item_id, title, qty, price, total, phone, user_login, created_at) VALUES('10', 'Арматура 12', 2, 607.5, 1215, '+7 999', 'ivan', '2024-03-01 10:00:00'), ('11', 'Арматура 14', 1, 847.3, 847.3, '+7 999', 'ivan', '2024-03-01 10:00:00')`)
+    if !HasLegacyFiles(dir) { t.Fatal("legacy files not detected") }
+    if HasLegacyFiles(t.TempDir()) { t.Error("an empty directory reported as legacy") }
+
+    s := openTestStore(t)
+    counts, err := s.ImportLegacy(dir)
+    if err != nil { t.Fatal(err) }
+    want := map[string]int64{"users": 2, "social_links": 1, "products": 2, "product_descriptions": 1, "item_orders": 2}
+    for table, n := range want {
+        if counts[table] != n { t.Errorf("copied %d rows of %s, want %d", counts[table], table, n) }
+    }
+    if len(counts) != len(want) { t.Errorf("counts = %v, want only %v", counts, want) }
+    if _, err := s.Migrate(); err != nil { t.Fatal(err) }
+
+    // ids survive, so sessions, carts and orders keep pointing at the same rows
+    u, err := s.Users.GetByLogin("ivan")
+    if err != nil { t.Fatal(err) }
+    if u.ID != 7 || u.Email != "ivan@example.ru" { t.Errorf("ivan = id %d, %q", u.ID, u.Email) }
+    p, err := s.Products.Get(11)
+    if err != nil { t.Fatal(err) }
+    if p.Size != "14" || p.PricePerTon != 51000 || p.SKU != "" { t.Errorf("product 11 = %+v", p) }
+    var orders, lines int
+    if err := s.DB.QueryRow("SELECT (SELECT COUNT(1) FROM orders), (SELECT COUNT(1) FROM order_lines)").Scan(&orders, &lines); err != nil { t.Fatal(err) }
+    if orders != 1 || lines != 2 { t.Errorf("%d orders with %d lines, want 1 with 2", orders, lines) }
+
+    // a second run refuses and leaves the data alone
+    if _, err := s.ImportLegacy(dir); err == nil { t.Error("a second import was accepted") }
+    var users, products int
+    if err := s.DB.QueryRow("SELECT (SELECT COUNT(1) FROM users), (SELECT COUNT(1) FROM products)").Scan(&users, &products); err != nil { t.Fatal(err) }
+    if users != 2 || products != 2 { t.Errorf("after the second run: %d users, %d products, want 2 and 2", users, products) }
+}
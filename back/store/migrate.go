@@ -0,0 +1,455 @@
+package store
+
+import (
+    "database/sql"
+    "fmt"
+    "math"
+    "strings"
+)
+
+// Migration is one numbered schema step. SQL runs first, then the optional Go step,
+// both inside the same transaction as the schema_migrations bookkeeping row.
+type Migration struct {
+    Version int
+    Name    string
+    SQL     string
+    Up      func(tx *sql.Tx) error
+}
+
+// MigrationState reports whether a migration has been applied
+type MigrationState struct {
+    Migration
+    AppliedAt string
+}
+
+// migrations is the ordered schema history of the database. Never edit an applied entry; append a new one.
+var migrations = []Migration{
+    {Version: 1, Name: "create orders", SQL: `
+        CREATE TABLE IF NOT EXISTS orders (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            service TEXT NOT NULL,
+            name TEXT NOT NULL,
+            phone TEXT NOT NULL,
+            email TEXT,
+            status TEXT NOT NULL DEFAULT 'active',
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+        );`},
+    {Version: 2, Name: "create item_orders", SQL: `
+        CREATE TABLE IF NOT EXISTS item_orders (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            item_id TEXT,
+            title TEXT,
+            qty INTEGER NOT NULL DEFAULT 1,
+            price REAL NOT NULL DEFAULT 0,
+            total REAL NOT NULL DEFAULT 0,
+            phone TEXT,
+            user_login TEXT,
+            status TEXT NOT NULL DEFAULT 'Ожидает подтверждения',
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS idx_item_orders_created ON item_orders(created_at DESC);`},
+    {Version: 3, Name: "create news", SQL: `
+        CREATE TABLE IF NOT EXISTS news (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            title TEXT NOT NULL,
+            short_text TEXT NOT NULL,
+            full_text TEXT NOT NULL,
+            published_at TEXT NOT NULL DEFAULT (date('now')),
+            image_url TEXT
+        );
+        CREATE INDEX IF NOT EXISTS idx_news_published_at ON news(published_at DESC);`},
+    {Version: 4, Name: "create articles", SQL: `
+        CREATE TABLE IF NOT EXISTS articles (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            title TEXT NOT NULL,
+            short_text TEXT NOT NULL,
+            full_text TEXT NOT NULL,
+            published_at TEXT NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_articles_published_at ON articles(published_at DESC);`},
+    {Version: 5, Name: "create users and social_links", SQL: `
+        CREATE TABLE IF NOT EXISTS users (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            login TEXT NOT NULL UNIQUE,
+            password_hash TEXT NOT NULL,
+            email TEXT,
+            phone TEXT,
+            is_admin INTEGER NOT NULL DEFAULT 0
+        );
+        CREATE TABLE IF NOT EXISTS social_links (
+            id INTEGER PRIMARY KEY CHECK (id=1),
+            telegram_link TEXT,
+            vk_link TEXT,
+            wp_link TEXT
+        );
+        INSERT OR IGNORE INTO social_links(id, telegram_link, vk_link, wp_link) VALUES(1, '', '', '');`},
+    {Version: 6, Name: "create sessions", SQL: `
+        CREATE TABLE IF NOT EXISTS sessions (
+            id TEXT PRIMARY KEY,
+            user_id INTEGER NOT NULL,
+            kind TEXT NOT NULL,
+            ip TEXT,
+            user_agent TEXT,
+            created_at TEXT NOT NULL,
+            last_seen_at TEXT NOT NULL,
+            expires_at TEXT NOT NULL
+        );
+        CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id);`},
+    {Version: 7, Name: "create products", SQL: `
+        CREATE TABLE IF NOT EXISTS products (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            type TEXT NOT NULL,
+            name TEXT NOT NULL,
+            size TEXT,
+            subtype TEXT,
+            img TEXT,
+            price REAL NOT NULL DEFAULT 0,
+            price_per_ton REAL,
+            thickness_mm REAL,
+            weight_kg REAL,
+            length_m REAL,
+            in_stock INTEGER NOT NULL DEFAULT 1,
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            featured INTEGER NOT NULL DEFAULT 0,
+            sku TEXT
+        );
+        CREATE INDEX IF NOT EXISTS idx_products_type ON products(type);
+        CREATE INDEX IF NOT EXISTS idx_products_price ON products(price);
+        CREATE INDEX IF NOT EXISTS idx_products_created ON products(created_at DESC);
+        CREATE INDEX IF NOT EXISTS idx_products_subtype ON products(subtype);
+        CREATE INDEX IF NOT EXISTS idx_products_featured ON products(featured);
+        CREATE TABLE IF NOT EXISTS product_descriptions (type TEXT PRIMARY KEY, description TEXT);`},
+    {Version: 8, Name: "create cart_items", SQL: `
+        CREATE TABLE IF NOT EXISTS cart_items (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            cart_id TEXT NOT NULL,
+            item_id TEXT NOT NULL,
+            title TEXT,
+            price REAL NOT NULL DEFAULT 0,
+            image TEXT,
+            qty INTEGER NOT NULL DEFAULT 1,
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS idx_cart_items_cart ON cart_items(cart_id);
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_cart_items_unique ON cart_items(cart_id, item_id);`},
+    // item_orders rows of one checkout share phone, login and created_at; they become one order with N lines
+    {Version: 9, Name: "order headers and lines", SQL: `
+        ALTER TABLE orders RENAME TO service_orders;
+        CREATE TABLE orders (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            customer_name TEXT NOT NULL DEFAULT '',
+            user_login TEXT NOT NULL DEFAULT '',
+            phone TEXT NOT NULL DEFAULT '',
+            email TEXT NOT NULL DEFAULT '',
+            address TEXT NOT NULL DEFAULT '',
+            comment TEXT NOT NULL DEFAULT '',
+            status TEXT NOT NULL DEFAULT 'Ожидает подтверждения',
+            total REAL NOT NULL DEFAULT 0,
+            created_at TEXT NOT NULL
+        );
+        CREATE INDEX idx_orders_created ON orders(created_at DESC);
+        CREATE INDEX idx_orders_user ON orders(user_login);
+        CREATE TABLE order_lines (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+            item_id TEXT NOT NULL DEFAULT '',
+            title TEXT NOT NULL DEFAULT '',
+            qty INTEGER NOT NULL DEFAULT 1,
+            price REAL NOT NULL DEFAULT 0,
+            total REAL NOT NULL DEFAULT 0
+        );
+        CREATE INDEX idx_order_lines_order ON order_lines(order_id);
+        -- lines of one checkout were written with one status, so any row of the group gives it
+        INSERT INTO orders(user_login, phone, status, total, created_at)
+            SELECT ifnull(user_login,''), ifnull(phone,''), status, round(sum(total), 2), created_at
+            FROM item_orders
+            GROUP BY ifnull(phone,''), ifnull(user_login,''), created_at
+            ORDER BY min(id);
+        INSERT INTO order_lines(order_id, item_id, title, qty, price, total)
+            SELECT o.id, ifnull(i.item_id,''), ifnull(i.title,''), i.qty, i.price, i.total
+            FROM item_orders i JOIN orders o
+              ON o.phone = ifnull(i.phone,'') AND o.user_login = ifnull(i.user_login,'') AND o.created_at = i.created_at
+            ORDER BY i.id;
+        DROP TABLE item_orders;`},
+    // free-text statuses become lifecycle codes; closed service requests were completed ones
+    {Version: 10, Name: "order status lifecycle and history", SQL: `
+        UPDATE orders SET status = CASE status
+            WHEN 'Подтверждена' THEN 'confirmed'
+            WHEN 'Доставляется' THEN 'shipped'
+            WHEN 'Доставлено' THEN 'delivered'
+            WHEN 'Отменена' THEN 'cancelled'
+            ELSE 'new' END;
+        UPDATE service_orders SET status = CASE status WHEN 'closed' THEN 'delivered' ELSE 'new' END;
+        CREATE TABLE order_status_history (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            order_kind TEXT NOT NULL,
+            order_id INTEGER NOT NULL,
+            from_status TEXT NOT NULL,
+            to_status TEXT NOT NULL,
+            changed_by TEXT NOT NULL DEFAULT '',
+            changed_at TEXT NOT NULL
+        );
+        CREATE INDEX idx_order_status_history_order ON order_status_history(order_kind, order_id);`},
+    // service requests remember who sent them; older requests stay anonymous rather than being matched by phone
+    {Version: 11, Name: "service order owner", SQL: `
+        ALTER TABLE service_orders ADD COLUMN user_login TEXT NOT NULL DEFAULT '';
+        CREATE INDEX idx_service_orders_user ON service_orders(user_login);`},
+    {Version: 12, Name: "user profile fields", SQL: `
+        ALTER TABLE users ADD COLUMN first_name TEXT NOT NULL DEFAULT '';
+        ALTER TABLE users ADD COLUMN last_name TEXT NOT NULL DEFAULT '';
+        ALTER TABLE users ADD COLUMN company_name TEXT NOT NULL DEFAULT '';
+        ALTER TABLE users ADD COLUMN inn TEXT NOT NULL DEFAULT '';
+        ALTER TABLE users ADD COLUMN kpp TEXT NOT NULL DEFAULT '';
+        ALTER TABLE users ADD COLUMN company_address TEXT NOT NULL DEFAULT '';`},
+    {Version: 13, Name: "password reset tokens", SQL: `
+        CREATE TABLE password_reset_tokens (
+            id TEXT PRIMARY KEY,
+            user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            created_at TEXT NOT NULL,
+            expires_at TEXT NOT NULL,
+            used_at TEXT NOT NULL DEFAULT ''
+        );
+        CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);`},
+    // filled from Go with analyzed text (see back/search.go); the server rebuilds it on start
+    {Version: 14, Name: "full-text search index", SQL: `
+        CREATE VIRTUAL TABLE search_index USING fts5(
+            entity UNINDEXED,
+            entity_id UNINDEXED,
+            title,
+            body,
+            tokenize = 'unicode61 remove_diacritics 2'
+        );`},
+    {Version: 15, Name: "category tree", SQL: `
+        CREATE TABLE categories (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            parent_id INTEGER REFERENCES categories(id),
+            slug TEXT NOT NULL,
+            title TEXT NOT NULL,
+            alias TEXT NOT NULL DEFAULT '',
+            sort_order INTEGER NOT NULL DEFAULT 0,
+            image TEXT NOT NULL DEFAULT '',
+            seo_title TEXT NOT NULL DEFAULT '',
+            seo_description TEXT NOT NULL DEFAULT '',
+            match_code TEXT NOT NULL DEFAULT '',
+            keywords TEXT NOT NULL DEFAULT '',
+            created_at TEXT NOT NULL,
+            updated_at TEXT NOT NULL
+        );
+        CREATE UNIQUE INDEX idx_categories_slug ON categories(ifnull(parent_id,0), slug);
+        CREATE INDEX idx_categories_parent ON categories(parent_id);`, Up: seedCategories},
+    {Version: 16, Name: "product attributes", SQL: `
+        CREATE TABLE attributes (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            category_id INTEGER NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+            code TEXT NOT NULL,
+            title TEXT NOT NULL,
+            kind TEXT NOT NULL DEFAULT 'text',
+            unit TEXT NOT NULL DEFAULT '',
+            filterable INTEGER NOT NULL DEFAULT 0,
+            sort_order INTEGER NOT NULL DEFAULT 0,
+            UNIQUE(category_id, code)
+        );
+        CREATE TABLE product_attributes (
+            product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+            attribute_id INTEGER NOT NULL REFERENCES attributes(id) ON DELETE CASCADE,
+            value_text TEXT NOT NULL,
+            value_num REAL,
+            source TEXT NOT NULL DEFAULT 'parsed',
+            PRIMARY KEY(product_id, attribute_id)
+        );
+        CREATE INDEX idx_product_attributes_value ON product_attributes(attribute_id, value_text);
+        CREATE INDEX idx_product_attributes_num ON product_attributes(attribute_id, value_num);`, Up: seedAttributes},
+    // not unique: generated SKUs of older rows may collide, imports report those as row errors
+    {Version: 17, Name: "product sku index", SQL: `
+        CREATE INDEX idx_products_sku ON products(sku);`},
+    {Version: 18, Name: "price history", SQL: `
+        CREATE TABLE price_history (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+            old_price REAL NOT NULL DEFAULT 0,
+            new_price REAL NOT NULL DEFAULT 0,
+            old_price_per_ton REAL NOT NULL DEFAULT 0,
+            new_price_per_ton REAL NOT NULL DEFAULT 0,
+            source TEXT NOT NULL DEFAULT '',
+            changed_at TEXT NOT NULL
+        );
+        CREATE INDEX idx_price_history_product ON price_history(product_id, changed_at);`},
+    {Version: 19, Name: "price history author", SQL: `
+        ALTER TABLE price_history ADD COLUMN changed_by TEXT NOT NULL DEFAULT '';`},
+    {Version: 20, Name: "quantity units", SQL: `
+        ALTER TABLE cart_items ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+        ALTER TABLE order_lines ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+        ALTER TABLE order_lines ADD COLUMN weight_kg REAL NOT NULL DEFAULT 0;`},
+    {Version: 21, Name: "pricing rules", SQL: `
+        CREATE TABLE price_rules (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            active INTEGER NOT NULL DEFAULT 1,
+            product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+            category_id INTEGER REFERENCES categories(id) ON DELETE CASCADE,
+            customer_group TEXT NOT NULL DEFAULT '',
+            min_qty REAL NOT NULL DEFAULT 0,
+            min_unit TEXT NOT NULL DEFAULT '',
+            discount_pct REAL NOT NULL DEFAULT 0,
+            price_per_ton REAL NOT NULL DEFAULT 0,
+            starts_at TEXT NOT NULL DEFAULT '',
+            ends_at TEXT NOT NULL DEFAULT '',
+            created_at TEXT NOT NULL,
+            updated_at TEXT NOT NULL
+        );
+        ALTER TABLE users ADD COLUMN price_group TEXT NOT NULL DEFAULT '';
+        ALTER TABLE order_lines ADD COLUMN list_price REAL NOT NULL DEFAULT 0;
+        ALTER TABLE order_lines ADD COLUMN price_rule_id INTEGER NOT NULL DEFAULT 0;
+        ALTER TABLE order_lines ADD COLUMN price_rule TEXT NOT NULL DEFAULT '';`},
+    {Version: 22, Name: "companies", SQL: `
+        CREATE TABLE companies (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            name TEXT NOT NULL,
+            inn TEXT NOT NULL DEFAULT '',
+            kpp TEXT NOT NULL DEFAULT '',
+            ogrn TEXT NOT NULL DEFAULT '',
+            legal_address TEXT NOT NULL DEFAULT '',
+            bank_name TEXT NOT NULL DEFAULT '',
+            bik TEXT NOT NULL DEFAULT '',
+            bank_account TEXT NOT NULL DEFAULT '',
+            corr_account TEXT NOT NULL DEFAULT '',
+            price_group TEXT NOT NULL DEFAULT '',
+            credit_limit REAL NOT NULL DEFAULT 0,
+            payment_days INTEGER NOT NULL DEFAULT 0,
+            created_at TEXT NOT NULL,
+            updated_at TEXT NOT NULL
+        );
+        CREATE UNIQUE INDEX idx_companies_inn ON companies(inn, kpp) WHERE inn <> '';
+        ALTER TABLE users ADD COLUMN company_id INTEGER REFERENCES companies(id) ON DELETE SET NULL;
+        CREATE INDEX idx_users_company ON users(company_id);
+        ALTER TABLE orders ADD COLUMN company_id INTEGER NOT NULL DEFAULT 0;
+        ALTER TABLE orders ADD COLUMN company_name TEXT NOT NULL DEFAULT '';
+        ALTER TABLE orders ADD COLUMN company_inn TEXT NOT NULL DEFAULT '';
+        ALTER TABLE orders ADD COLUMN company_kpp TEXT NOT NULL DEFAULT '';
+        ALTER TABLE orders ADD COLUMN company_address TEXT NOT NULL DEFAULT '';
+        ALTER TABLE orders ADD COLUMN payment_days INTEGER NOT NULL DEFAULT 0;`, Up: seedCompanies},
+    {Version: 23, Name: "documents", SQL: `
+        CREATE TABLE documents (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            kind TEXT NOT NULL,
+            year INTEGER NOT NULL,
+            number INTEGER NOT NULL,
+            order_id INTEGER NOT NULL DEFAULT 0,
+            cart_id TEXT NOT NULL DEFAULT '',
+            buyer_name TEXT NOT NULL DEFAULT '',
+            buyer_inn TEXT NOT NULL DEFAULT '',
+            buyer_kpp TEXT NOT NULL DEFAULT '',
+            buyer_address TEXT NOT NULL DEFAULT '',
+            payment_days INTEGER NOT NULL DEFAULT 0,
+            vat_rate REAL NOT NULL DEFAULT 0,
+            total REAL NOT NULL DEFAULT 0,
+            created_by TEXT NOT NULL DEFAULT '',
+            created_at TEXT NOT NULL
+        );
+        CREATE UNIQUE INDEX idx_documents_number ON documents(kind, year, number);
+        CREATE INDEX idx_documents_order ON documents(order_id);
+        CREATE TABLE document_lines (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+            title TEXT NOT NULL,
+            qty REAL NOT NULL,
+            unit TEXT NOT NULL DEFAULT '',
+            weight_kg REAL NOT NULL DEFAULT 0,
+            price REAL NOT NULL,
+            total REAL NOT NULL
+        );
+        CREATE INDEX idx_document_lines_document ON document_lines(document_id);`},
+    // the unit price is derived in Go (sheet weights come from the size); it is stored so catalog
+    // filters and sorting agree with the displayed price. The old formula is a first guess that
+    // the startup refresh corrects.
+    {Version: 24, Name: "product unit price", SQL: `
+        ALTER TABLE products ADD COLUMN unit_price REAL NOT NULL DEFAULT 0;
+        UPDATE products SET unit_price = CASE WHEN ifnull(price,0) > 0 THEN price WHEN ifnull(price_per_ton,0) > 0 AND ifnull(weight_kg,0) > 0 THEN round(price_per_ton * weight_kg / (CASE WHEN ifnull(length_m,0) > 0 THEN length_m ELSE 1 END) / 1000, 2) ELSE 0 END;
+        CREATE INDEX idx_products_unit_price ON products(unit_price);`},
+}
+
+// AddColumnIfMissing lets a migration add a column idempotently
+func AddColumnIfMissing(tx *sql.Tx, table, column, decl string) error {
+    cols, err := tableColumns(tx, "main", table)
+    if err != nil { return err }
+    for _, c := range cols {
+        if strings.EqualFold(c, column) { return nil }
+    }
+    _, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + decl)
+    return err
+}
+
+func tableColumns(q dbtx, schema, table string) ([]string, error) {
+    rows, err := q.Query("SELECT name FROM pragma_table_info(?, ?)", table, schema)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []string
+    for rows.Next() {
+        var name string
+        if err := rows.Scan(&name); err != nil { return nil, err }
+        out = append(out, name)
+    }
+    return out, rows.Err()
+}
+
+// appliedMigrations reads the bookkeeping table without creating it, so `migrate status` never
+// writes to the database; a missing table means nothing has been applied yet
+func (s *Store) appliedMigrations() (map[int]string, error) {
+    out := map[int]string{}
+    var n int
+    if err := s.DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='schema_migrations'").Scan(&n); err != nil { return nil, err }
+    if n == 0 { return out, nil }
+    rows, err := s.DB.Query("SELECT version, applied_at FROM schema_migrations")
+    if err != nil { return nil, err }
+    defer rows.Close()
+    for rows.Next() {
+        var v int
+        var at string
+        if err := rows.Scan(&v, &at); err != nil { return nil, err }
+        out[v] = at
+    }
+    return out, rows.Err()
+}
+
+// Migrate applies every pending migration in version order and returns how many ran
+func (s *Store) Migrate() (int, error) { return s.migrateTo(math.MaxInt) }
+
+// migrateTo applies pending migrations up to and including version
+func (s *Store) migrateTo(version int) (int, error) {
+    _, err := s.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at TEXT NOT NULL
+    )`)
+    if err != nil { return 0, err }
+    done, err := s.appliedMigrations()
+    if err != nil { return 0, err }
+    n := 0
+    for _, m := range migrations {
+        if m.Version > version { break }
+        if _, ok := done[m.Version]; ok { continue }
+        tx, err := s.DB.Begin()
+        if err != nil { return n, err }
+        if strings.TrimSpace(m.SQL) != "" {
+            if _, err := tx.Exec(m.SQL); err != nil { tx.Rollback(); return n, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err) }
+        }
+        if m.Up != nil {
+            if err := m.Up(tx); err != nil { tx.Rollback(); return n, fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err) }
+        }
+        if _, err := tx.Exec("INSERT INTO schema_migrations(version, name, applied_at) VALUES(?,?,?)", m.Version, m.Name, Now()); err != nil { tx.Rollback(); return n, err }
+        if err := tx.Commit(); err != nil { return n, err }
+        n++
+    }
+    return n, nil
+}
+
+// MigrationStatus lists every known migration with its applied time (empty when pending)
+func (s *Store) MigrationStatus() ([]MigrationState, error) {
+    done, err := s.appliedMigrations()
+    if err != nil { return nil, err }
+    out := make([]MigrationState, 0, len(migrations))
+    for _, m := range migrations {
+        out = append(out, MigrationState{Migration: m, AppliedAt: done[m.Version]})
+    }
+    return out, nil
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+    "path/filepath"
+    "testing"
+)
+
+func openTestStore(t *testing.T) *Store {
+    t.Helper()
+    s, err := Open(filepath.Join(t.TempDir(), "test.db"))
+    if err != nil { t.Fatal(err) }
+    t.Cleanup(func() { s.Close() })
+    return s
+}
+
+// v9 folds the item_orders rows of one checkout (same phone, login and time) into one order with lines
+func TestMigrationGroupsItemOrders(t *testing.T) {
+    s := openTestStore(t)
+    if _, err := s.migrateTo(8); err != nil { t.Fatal(err) }
+    rows := []struct {
+        item, title, phone, login, at string
+        qty                           int
+        price                         float64
+    }{
+        {"9", "Арматура", "+7 999", "ivan", "2024-03-01 10:00:00", 2, 100},
+        {"12", "Уголок", "+7 999", "ivan", "2024-03-01 10:00:00", 1, 50.5},
+        {"9", "Арматура", "+7 999", "ivan", "2024-03-02 09:00:00", 3, 100},
+        {"14", "Лист", "+7 111", "", "2024-03-01 10:00:00", 1, 7000},
+    }
+    for _, r := range rows {
+        login := any(r.login)
+        if r.login == "" { login = nil } // guests were stored with a NULL login
+        _, err := s.DB.Exec("INSERT INTO item_orders(item_id, title, qty, price, total, phone, user_login, created_at) VALUES(?,?,?,?,?,?,?,?)",
+            r.item, r.title, r.qty, r.price, float64(r.qty)*r.price, r.phone, login, r.at)
+        if err != nil { t.Fatal(err) }
+    }
+    if _, err := s.migrateTo(9); err != nil { t.Fatal(err) }
+
+    want := []struct {
+        phone, login, at string
+        total            float64
+        lines            int
+    }{
+        {"+7 999", "ivan", "2024-03-01 10:00:00", 250.5, 2},
+        {"+7 999", "ivan", "2024-03-02 09:00:00", 300, 1},
+        {"+7 111", "", "2024-03-01 10:00:00", 7000, 1},
+    }
+    got, err := s.DB.Query("SELECT o.phone, o.user_login, o.created_at, o.total, (SELECT COUNT(*) FROM order_lines l WHERE l.order_id=o.id) FROM orders o ORDER BY o.id")
+    if err != nil { t.Fatal(err) }
+    defer got.Close()
+    i := 0
+    for ; got.Next(); i++ {
+        var phone, login, at string
+        var total float64
+        var lines int
+        if err := got.Scan(&phone, &login, &at, &total, &lines); err != nil { t.Fatal(err) }
+        if i >= len(want) { continue }
+        w := want[i]
+        if phone != w.phone || login != w.login || at != w.at || total != w.total || lines != w.lines {
+            t.Errorf("order %d = %q %q %q %v with %d lines, want %q %q %q %v with %d", i+1, phone, login, at, total, lines, w.phone, w.login, w.at, w.total, w.lines)
+        }
+    }
+    if i != len(want) { t.Errorf("got %d orders, want %d", i, len(want)) }
+
+    var left int
+    if err := s.DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name='item_orders'").Scan(&left); err != nil { t.Fatal(err) }
+    if left != 0 { t.Error("item_orders was not dropped") }
+}
+
+func TestMigrationStatusDoesNotWrite(t *testing.T) {
+    s := openTestStore(t)
+    states, err := s.MigrationStatus()
+    if err != nil { t.Fatal(err) }
+    for _, m := range states {
+        if m.AppliedAt != "" { t.Errorf("migration %d reported applied on an empty database", m.Version) }
+    }
+    var n int
+    if err := s.DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name='schema_migrations'").Scan(&n); err != nil { t.Fatal(err) }
+    if n != 0 { t.Error("status created schema_migrations") }
+}
@@ -0,0 +1,268 @@
+package store
+
+import (
+    "math"
+    "time"
+)
+
+// ServiceOrder represents a service order submitted from services page
+type ServiceOrder struct {
+    ID        int64     `json:"id"`
+    Service   string    `json:"service"`
+    Name      string    `json:"name"`
+    Phone     string    `json:"phone"`
+    Email     string    `json:"email"`
+    UserLogin string    `json:"user_login"`
+    Status    string    `json:"status"`
+    CreatedAt time.Time `json:"createdAt"`
+}
+
+// Order is a catalog order: one header per checkout with its priced lines
+type Order struct {
+    ID           int64       `json:"id"`
+    CustomerName string      `json:"customer_name"`
+    UserLogin    string      `json:"user_login"`
+    Phone        string      `json:"phone"`
+    Email        string      `json:"email"`
+    Address      string      `json:"address"`
+    Comment      string      `json:"comment"`
+    Status       string      `json:"status"`
+    Total        float64     `json:"total"`
+    CreatedAt    string      `json:"created_at"`
+    // the buyer's requisites as they were when the order was placed, for the invoice;
+    // CompanyID is 0 when they come from a private account's profile or are absent
+    CompanyID      int64       `json:"company_id"`
+    CompanyName    string      `json:"company_name"`
+    CompanyINN     string      `json:"company_inn"`
+    CompanyKPP     string      `json:"company_kpp"`
+    CompanyAddress string      `json:"company_address"`
+    PaymentDays    int         `json:"payment_days"` // payment deferral granted to the company
+    Lines          []OrderLine `json:"lines"`
+}
+
+// OrderLine is one product of an order, priced when the order was placed
+type OrderLine struct {
+    ID       int64   `json:"id"`
+    OrderID  int64   `json:"order_id"`
+    ItemID   string  `json:"item_id"`
+    Title    string  `json:"title"`
+    Qty      float64 `json:"qty"`
+    Unit     string  `json:"unit"`
+    WeightKg float64 `json:"weight_kg"`
+    Price    float64 `json:"price"` // per Unit
+    Total    float64 `json:"total"`
+    // ListPrice is the price per Unit before the pricing rule PriceRuleID (named PriceRule) lowered
+    // it; all three are zero when no rule applied
+    ListPrice   float64 `json:"list_price,omitempty"`
+    PriceRuleID int64   `json:"price_rule_id,omitempty"`
+    PriceRule   string  `json:"price_rule,omitempty"`
+}
+
+// Order kinds sharing order_status_history
+const (
+    KindOrder   = "order"
+    KindService = "service"
+)
+
+// StatusChange is one row of an order's status history
+type StatusChange struct {
+    ID        int64  `json:"id"`
+    OrderKind string `json:"order_kind"`
+    OrderID   int64  `json:"order_id"`
+    From      string `json:"from_status"`
+    To        string `json:"to_status"`
+    ChangedBy string `json:"changed_by"`
+    ChangedAt string `json:"changed_at"`
+}
+
+// OrderRepo persists service orders and catalog orders
+type OrderRepo interface {
+    CreateServiceOrder(o *ServiceOrder) error
+    GetServiceOrder(id int64) (ServiceOrder, error)
+    ListServiceOrders() ([]ServiceOrder, error)
+    // ListServiceOrdersByLogin returns the requests a signed-in user submitted, newest first
+    ListServiceOrdersByLogin(login string) ([]ServiceOrder, error)
+    SetServiceOrderStatus(id int64, status string) error
+
+    // Create inserts the header and its lines; run it inside InTx
+    Create(o *Order) error
+    Get(id int64) (Order, error)
+    // List returns orders newest first, lines included
+    List() ([]Order, error)
+    ListByLogin(login string) ([]Order, error)
+    SetStatus(id int64, status string) error
+    // CreditUsed sums the deferred-payment orders of a company that are in one of statuses
+    CreditUsed(companyID int64, statuses []string) (float64, error)
+
+    AddStatusChange(c *StatusChange) error
+    StatusHistory(kind string, orderID int64) ([]StatusChange, error)
+}
+
+type orderRepo struct{ q dbtx }
+
+func (r *orderRepo) CreateServiceOrder(o *ServiceOrder) error {
+    res, err := r.q.Exec("INSERT INTO service_orders (service, name, phone, email, user_login, status) VALUES (?,?,?,?,?,?)", o.Service, o.Name, o.Phone, o.Email, o.UserLogin, o.Status)
+    if err != nil { return err }
+    o.ID, err = res.LastInsertId()
+    return err
+}
+
+const serviceOrderColumns = "id, service, name, phone, IFNULL(email,''), user_login, status, created_at"
+
+func scanServiceOrder(sc scanner) (ServiceOrder, error) {
+    var o ServiceOrder
+    err := sc.Scan(&o.ID, &o.Service, &o.Name, &o.Phone, &o.Email, &o.UserLogin, &o.Status, &o.CreatedAt)
+    return o, err
+}
+
+func (r *orderRepo) GetServiceOrder(id int64) (ServiceOrder, error) {
+    o, err := scanServiceOrder(r.q.QueryRow("SELECT "+serviceOrderColumns+" FROM service_orders WHERE id=?", id))
+    return o, notFound(err)
+}
+
+func (r *orderRepo) ListServiceOrders() ([]ServiceOrder, error) {
+    return r.listServiceOrders("")
+}
+
+func (r *orderRepo) ListServiceOrdersByLogin(login string) ([]ServiceOrder, error) {
+    if login == "" { return nil, nil }
+    return r.listServiceOrders("WHERE user_login=?", login)
+}
+
+func (r *orderRepo) listServiceOrders(where string, args ...any) ([]ServiceOrder, error) {
+    rows, err := r.q.Query("SELECT "+serviceOrderColumns+" FROM service_orders "+where+" ORDER BY created_at DESC, id DESC", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []ServiceOrder
+    for rows.Next() {
+        o, err := scanServiceOrder(rows)
+        if err != nil { return nil, err }
+        out = append(out, o)
+    }
+    return out, rows.Err()
+}
+
+func (r *orderRepo) SetServiceOrderStatus(id int64, status string) error {
+    _, err := r.q.Exec("UPDATE service_orders SET status=? WHERE id=?", status, id)
+    return err
+}
+
+func (r *orderRepo) Create(o *Order) error {
+    if o.CreatedAt == "" { o.CreatedAt = Now() }
+    o.Total = 0
+    for _, l := range o.Lines { o.Total += l.Total }
+    o.Total = math.Round(o.Total*100) / 100
+    res, err := r.q.Exec(`INSERT INTO orders(customer_name, user_login, phone, email, address, comment, status, total, created_at,
+        company_id, company_name, company_inn, company_kpp, company_address, payment_days) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+        o.CustomerName, o.UserLogin, o.Phone, o.Email, o.Address, o.Comment, o.Status, o.Total, o.CreatedAt,
+        o.CompanyID, o.CompanyName, o.CompanyINN, o.CompanyKPP, o.CompanyAddress, o.PaymentDays)
+    if err != nil { return err }
+    if o.ID, err = res.LastInsertId(); err != nil { return err }
+    for i := range o.Lines {
+        l := &o.Lines[i]
+        l.OrderID = o.ID
+        res, err := r.q.Exec("INSERT INTO order_lines(order_id, item_id, title, qty, unit, weight_kg, price, total, list_price, price_rule_id, price_rule) VALUES(?,?,?,?,?,?,?,?,?,?,?)",
+            l.OrderID, l.ItemID, l.Title, l.Qty, l.Unit, l.WeightKg, l.Price, l.Total, l.ListPrice, l.PriceRuleID, l.PriceRule)
+        if err != nil { return err }
+        if l.ID, err = res.LastInsertId(); err != nil { return err }
+    }
+    return nil
+}
+
+const orderColumns = "id, customer_name, user_login, phone, email, address, comment, status, total, created_at, company_id, company_name, company_inn, company_kpp, company_address, payment_days"
+
+func scanOrder(sc scanner) (Order, error) {
+    var o Order
+    err := sc.Scan(&o.ID, &o.CustomerName, &o.UserLogin, &o.Phone, &o.Email, &o.Address, &o.Comment, &o.Status, &o.Total, &o.CreatedAt,
+        &o.CompanyID, &o.CompanyName, &o.CompanyINN, &o.CompanyKPP, &o.CompanyAddress, &o.PaymentDays)
+    return o, err
+}
+
+func (r *orderRepo) Get(id int64) (Order, error) {
+    o, err := scanOrder(r.q.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id=?", id))
+    if err != nil { return o, notFound(err) }
+    byID, err := r.lines([]int64{id})
+    o.Lines = byID[id]
+    return o, err
+}
+
+func (r *orderRepo) List() ([]Order, error) {
+    return r.list("")
+}
+
+func (r *orderRepo) ListByLogin(login string) ([]Order, error) {
+    if login == "" { return nil, nil }
+    return r.list("WHERE user_login=?", login)
+}
+
+func (r *orderRepo) list(where string, args ...any) ([]Order, error) {
+    rows, err := r.q.Query("SELECT "+orderColumns+" FROM orders "+where+" ORDER BY created_at DESC, id DESC", args...)
+    if err != nil { return nil, err }
+    var out []Order
+    var ids []int64
+    for rows.Next() {
+        o, err := scanOrder(rows)
+        if err != nil { rows.Close(); return nil, err }
+        out = append(out, o)
+        ids = append(ids, o.ID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil { return nil, err }
+    byID, err := r.lines(ids)
+    if err != nil { return nil, err }
+    for i := range out { out[i].Lines = byID[out[i].ID] }
+    return out, nil
+}
+
+func (r *orderRepo) CreditUsed(companyID int64, statuses []string) (float64, error) {
+    if len(statuses) == 0 { return 0, nil }
+    args := []any{companyID}
+    for _, s := range statuses { args = append(args, s) }
+    var sum float64
+    err := r.q.QueryRow("SELECT COALESCE(SUM(total), 0) FROM orders WHERE company_id=? AND payment_days>0 AND status IN ("+placeholders(len(statuses))+")", args...).Scan(&sum)
+    return sum, err
+}
+
+// lines loads the lines of the given orders keyed by order id
+func (r *orderRepo) lines(ids []int64) (map[int64][]OrderLine, error) {
+    out := map[int64][]OrderLine{}
+    if len(ids) == 0 { return out, nil }
+    q, args := "SELECT id, order_id, item_id, title, qty, unit, weight_kg, price, total, list_price, price_rule_id, price_rule FROM order_lines WHERE order_id IN ("+placeholders(len(ids))+") ORDER BY id", make([]any, len(ids))
+    for i, id := range ids { args[i] = id }
+    rows, err := r.q.Query(q, args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    for rows.Next() {
+        var l OrderLine
+        if err := rows.Scan(&l.ID, &l.OrderID, &l.ItemID, &l.Title, &l.Qty, &l.Unit, &l.WeightKg, &l.Price, &l.Total, &l.ListPrice, &l.PriceRuleID, &l.PriceRule); err != nil { return nil, err }
+        out[l.OrderID] = append(out[l.OrderID], l)
+    }
+    return out, rows.Err()
+}
+
+func (r *orderRepo) SetStatus(id int64, status string) error {
+    _, err := r.q.Exec("UPDATE orders SET status=? WHERE id=?", status, id)
+    return err
+}
+
+func (r *orderRepo) AddStatusChange(c *StatusChange) error {
+    if c.ChangedAt == "" { c.ChangedAt = Now() }
+    res, err := r.q.Exec("INSERT INTO order_status_history(order_kind, order_id, from_status, to_status, changed_by, changed_at) VALUES(?,?,?,?,?,?)",
+        c.OrderKind, c.OrderID, c.From, c.To, c.ChangedBy, c.ChangedAt)
+    if err != nil { return err }
+    c.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *orderRepo) StatusHistory(kind string, orderID int64) ([]StatusChange, error) {
+    rows, err := r.q.Query("SELECT id, order_kind, order_id, from_status, to_status, changed_by, changed_at FROM order_status_history WHERE order_kind=? AND order_id=? ORDER BY id", kind, orderID)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []StatusChange{}
+    for rows.Next() {
+        var c StatusChange
+        if err := rows.Scan(&c.ID, &c.OrderKind, &c.OrderID, &c.From, &c.To, &c.ChangedBy, &c.ChangedAt); err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
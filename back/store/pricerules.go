@@ -0,0 +1,100 @@
+package store
+
+// PriceRule lowers the price of a catalog line. A rule is scoped to one product, one category
+// (its products and, for a top-level category, all of its subcategories) or the whole catalog,
+// optionally to one customer group, to a period and to lines of at least MinQty in MinUnit.
+// It either takes DiscountPct off the list price or sets a fixed PricePerTon.
+type PriceRule struct {
+    ID            int64   `json:"id"`
+    Name          string  `json:"name"`
+    Active        bool    `json:"active"`
+    ProductID     int64   `json:"product_id"`  // 0 for any product
+    CategoryID    int64   `json:"category_id"` // 0 for any category
+    CustomerGroup string  `json:"customer_group"` // empty for every customer
+    MinQty        float64 `json:"min_qty"`
+    MinUnit       string  `json:"min_unit"` // pcs, m, m2, t or kg
+    DiscountPct   float64 `json:"discount_pct"`
+    PricePerTon   float64 `json:"price_per_ton"`
+    StartsAt      string  `json:"starts_at"` // inclusive, empty for no start
+    EndsAt        string  `json:"ends_at"`   // exclusive, empty for no end
+    CreatedAt     string  `json:"created_at"`
+    UpdatedAt     string  `json:"updated_at"`
+}
+
+// PriceRuleRepo persists pricing rules
+type PriceRuleRepo interface {
+    // List returns every rule, newest first
+    List() ([]PriceRule, error)
+    // Current returns the active rules whose period contains now
+    Current(now string) ([]PriceRule, error)
+    Get(id int64) (PriceRule, error)
+    Create(r *PriceRule) error
+    Update(r PriceRule) error
+    Delete(id int64) error
+}
+
+type priceRuleRepo struct{ q dbtx }
+
+const priceRuleColumns = "id, name, active, ifnull(product_id,0), ifnull(category_id,0), customer_group, min_qty, min_unit, discount_pct, price_per_ton, starts_at, ends_at, created_at, updated_at"
+
+func scanPriceRule(sc scanner) (PriceRule, error) {
+    var r PriceRule
+    var active int
+    err := sc.Scan(&r.ID, &r.Name, &active, &r.ProductID, &r.CategoryID, &r.CustomerGroup, &r.MinQty, &r.MinUnit,
+        &r.DiscountPct, &r.PricePerTon, &r.StartsAt, &r.EndsAt, &r.CreatedAt, &r.UpdatedAt)
+    r.Active = active == 1
+    return r, err
+}
+
+func (r *priceRuleRepo) query(where string, args ...any) ([]PriceRule, error) {
+    rows, err := r.q.Query("SELECT "+priceRuleColumns+" FROM price_rules "+where+" ORDER BY id DESC", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []PriceRule{}
+    for rows.Next() {
+        pr, err := scanPriceRule(rows)
+        if err != nil { return nil, err }
+        out = append(out, pr)
+    }
+    return out, rows.Err()
+}
+
+func (r *priceRuleRepo) List() ([]PriceRule, error) { return r.query("") }
+
+func (r *priceRuleRepo) Current(now string) ([]PriceRule, error) {
+    return r.query("WHERE active=1 AND (starts_at='' OR starts_at<=?) AND (ends_at='' OR ends_at>?)", now, now)
+}
+
+func (r *priceRuleRepo) Get(id int64) (PriceRule, error) {
+    pr, err := scanPriceRule(r.q.QueryRow("SELECT "+priceRuleColumns+" FROM price_rules WHERE id=?", id))
+    return pr, notFound(err)
+}
+
+func (r *priceRuleRepo) Create(pr *PriceRule) error {
+    pr.CreatedAt = Now()
+    pr.UpdatedAt = pr.CreatedAt
+    res, err := r.q.Exec(`INSERT INTO price_rules(name, active, product_id, category_id, customer_group, min_qty, min_unit, discount_pct, price_per_ton, starts_at, ends_at, created_at, updated_at)
+        VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+        pr.Name, boolInt(pr.Active), nullID(pr.ProductID), nullID(pr.CategoryID), pr.CustomerGroup, pr.MinQty, pr.MinUnit,
+        pr.DiscountPct, pr.PricePerTon, pr.StartsAt, pr.EndsAt, pr.CreatedAt, pr.UpdatedAt)
+    if err != nil { return err }
+    pr.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *priceRuleRepo) Update(pr PriceRule) error {
+    res, err := r.q.Exec(`UPDATE price_rules SET name=?, active=?, product_id=?, category_id=?, customer_group=?, min_qty=?, min_unit=?,
+        discount_pct=?, price_per_ton=?, starts_at=?, ends_at=?, updated_at=? WHERE id=?`,
+        pr.Name, boolInt(pr.Active), nullID(pr.ProductID), nullID(pr.CategoryID), pr.CustomerGroup, pr.MinQty, pr.MinUnit,
+        pr.DiscountPct, pr.PricePerTon, pr.StartsAt, pr.EndsAt, Now(), pr.ID)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
+
+func (r *priceRuleRepo) Delete(id int64) error {
+    res, err := r.q.Exec("DELETE FROM price_rules WHERE id=?", id)
+    if err != nil { return err }
+    if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+    return nil
+}
@@ -0,0 +1,232 @@
+package store
+
+import "strings"
+
+// Product is a DB-backed catalog position
+type Product struct {
+    ID          int64   `json:"id"`
+    Type        string  `json:"type"`
+    Name        string  `json:"name"`
+    Size        string  `json:"size"`
+    Subtype     string  `json:"subtype"`
+    Img         string  `json:"img"`
+    Price       float64 `json:"price"`
+    PricePerTon float64 `json:"price_per_ton"`
+    ThicknessMM float64 `json:"thickness_mm"`
+    WeightKg    float64 `json:"weight_kg"`
+    LengthM     float64 `json:"length_m"`
+    InStock     bool    `json:"in_stock"`
+    Featured    bool    `json:"featured"`
+    SKU         string  `json:"sku"`
+    CreatedAt   string  `json:"created_at"`
+    // UnitPrice is derived from the fields above by unitPrice in package main; whoever saves a
+    // product sets it, catalog filters and sorting read it
+    UnitPrice float64 `json:"-"`
+}
+
+// TypeDescription is the shared description text of a product type
+type TypeDescription struct {
+    Type        string `json:"type"`
+    Description string `json:"description"`
+}
+
+// PriceChange is one recorded change of a product's price or price per ton
+type PriceChange struct {
+    ID             int64   `json:"id"`
+    ProductID      int64   `json:"product_id"`
+    OldPrice       float64 `json:"old_price"`
+    NewPrice       float64 `json:"new_price"`
+    OldPricePerTon float64 `json:"old_price_per_ton"`
+    NewPricePerTon float64 `json:"new_price_per_ton"`
+    Source         string  `json:"source"` // admin, import or feed:<file>
+    ChangedBy      string  `json:"changed_by"`
+    ChangedAt      string  `json:"changed_at"`
+}
+
+// ProductRepo persists catalog products and per-type descriptions
+type ProductRepo interface {
+    // List returns products of productType (case-insensitive), or all when empty
+    List(productType string) ([]Product, error)
+    // Filter returns one page of the products matching f and their total count
+    Filter(f ProductFilter) ([]Product, int, error)
+    Facets(f ProductFilter) (ProductFacets, error)
+    // AttributeFacets counts the values of the filterable attributes among defs
+    AttributeFacets(f ProductFilter, defs []AttributeDef) ([]AttributeFacet, error)
+    Get(id int64) (Product, error)
+    // FindBySKU returns the products carrying sku; imports upsert by it
+    FindBySKU(sku string) ([]Product, error)
+    // FindByName returns the products of productType named name, the way catalog URLs address them
+    FindByName(productType, name string) ([]Product, error)
+    // Related returns up to limit other products of productType (p's type slug), same subtype
+    // and nearest price first
+    Related(productType string, p Product, limit int) ([]Product, error)
+    Count() (int, error)
+    Create(p *Product) error
+    Update(p Product) error
+    // SetUnitPrice rewrites the stored unit price alone, after the rule deriving it changed
+    SetUnitPrice(id int64, price float64) error
+    Delete(id int64) error
+    FeaturedIDs() ([]int64, error)
+    SetFeatured(id int64, featured bool) error
+    // RecordPriceChange appends c to the price history, stamping ChangedAt when it is empty
+    RecordPriceChange(c *PriceChange) error
+    // PriceHistory returns the price changes of productID, newest first
+    PriceHistory(productID int64) ([]PriceChange, error)
+    TypeDescriptions() ([]TypeDescription, error)
+    TypeDescription(productType string) (string, error)
+    SaveTypeDescription(d TypeDescription) error
+    DeleteTypeDescription(productType string) error
+}
+
+type productRepo struct{ q dbtx }
+
+// productColumns is the select list matching scanProduct
+const productColumns = "id, ifnull(type,''), ifnull(name,''), ifnull(size,''), ifnull(subtype,''), ifnull(img,''), ifnull(price,0), ifnull(price_per_ton,0), ifnull(thickness_mm,0), ifnull(weight_kg,0), ifnull(length_m,0), ifnull(in_stock,1), ifnull(created_at,''), ifnull(featured,0), ifnull(sku,''), ifnull(unit_price,0)"
+
+type scanner interface{ Scan(dest ...any) error }
+
+func scanProduct(sc scanner) (Product, error) {
+    var p Product
+    var inStock, featured int
+    err := sc.Scan(&p.ID, &p.Type, &p.Name, &p.Size, &p.Subtype, &p.Img, &p.Price, &p.PricePerTon, &p.ThicknessMM, &p.WeightKg, &p.LengthM, &inStock, &p.CreatedAt, &featured, &p.SKU, &p.UnitPrice)
+    p.InStock = inStock == 1
+    p.Featured = featured == 1
+    return p, err
+}
+
+func (r *productRepo) List(productType string) ([]Product, error) {
+    q := "SELECT " + productColumns + " FROM products"
+    var args []any
+    if strings.TrimSpace(productType) != "" {
+        q += " WHERE lower(type) = lower(?)"
+        args = append(args, productType)
+    }
+    rows, err := r.q.Query(q, args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []Product
+    for rows.Next() {
+        p, err := scanProduct(rows)
+        if err != nil { return nil, err }
+        out = append(out, p)
+    }
+    return out, rows.Err()
+}
+
+func (r *productRepo) Get(id int64) (Product, error) {
+    p, err := scanProduct(r.q.QueryRow("SELECT "+productColumns+" FROM products WHERE id=?", id))
+    return p, notFound(err)
+}
+
+func (r *productRepo) FindBySKU(sku string) ([]Product, error) {
+    rows, err := r.q.Query("SELECT "+productColumns+" FROM products WHERE sku = ? ORDER BY id", strings.TrimSpace(sku))
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Product{}
+    for rows.Next() {
+        p, err := scanProduct(rows)
+        if err != nil { return nil, err }
+        out = append(out, p)
+    }
+    return out, rows.Err()
+}
+
+func (r *productRepo) Count() (int, error) {
+    var n int
+    err := r.q.QueryRow("SELECT COUNT(1) FROM products").Scan(&n)
+    return n, err
+}
+
+func (r *productRepo) Create(p *Product) error {
+    res, err := r.q.Exec("INSERT INTO products(type, name, size, subtype, img, price, price_per_ton, thickness_mm, weight_kg, length_m, in_stock, featured, sku, unit_price) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
+        p.Type, p.Name, p.Size, p.Subtype, p.Img, p.Price, p.PricePerTon, p.ThicknessMM, p.WeightKg, p.LengthM, boolInt(p.InStock), boolInt(p.Featured), p.SKU, p.UnitPrice)
+    if err != nil { return err }
+    p.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *productRepo) Update(p Product) error {
+    _, err := r.q.Exec("UPDATE products SET type=?, name=?, size=?, subtype=?, img=?, price=?, price_per_ton=?, thickness_mm=?, weight_kg=?, length_m=?, in_stock=?, featured=?, sku=?, unit_price=? WHERE id=?",
+        p.Type, p.Name, p.Size, p.Subtype, p.Img, p.Price, p.PricePerTon, p.ThicknessMM, p.WeightKg, p.LengthM, boolInt(p.InStock), boolInt(p.Featured), p.SKU, p.UnitPrice, p.ID)
+    return err
+}
+
+func (r *productRepo) SetUnitPrice(id int64, price float64) error {
+    _, err := r.q.Exec("UPDATE products SET unit_price=? WHERE id=?", price, id)
+    return err
+}
+
+func (r *productRepo) Delete(id int64) error {
+    _, err := r.q.Exec("DELETE FROM products WHERE id=?", id)
+    return err
+}
+
+func (r *productRepo) FeaturedIDs() ([]int64, error) {
+    rows, err := r.q.Query("SELECT id FROM products WHERE featured=1 ORDER BY id DESC")
+    if err != nil { return nil, err }
+    defer rows.Close()
+    ids := []int64{}
+    for rows.Next() {
+        var id int64
+        if err := rows.Scan(&id); err != nil { return nil, err }
+        ids = append(ids, id)
+    }
+    return ids, rows.Err()
+}
+
+func (r *productRepo) SetFeatured(id int64, featured bool) error {
+    _, err := r.q.Exec("UPDATE products SET featured=? WHERE id=?", boolInt(featured), id)
+    return err
+}
+
+func (r *productRepo) RecordPriceChange(c *PriceChange) error {
+    if c.ChangedAt == "" { c.ChangedAt = Now() }
+    res, err := r.q.Exec("INSERT INTO price_history(product_id, old_price, new_price, old_price_per_ton, new_price_per_ton, source, changed_by, changed_at) VALUES(?,?,?,?,?,?,?,?)",
+        c.ProductID, c.OldPrice, c.NewPrice, c.OldPricePerTon, c.NewPricePerTon, c.Source, c.ChangedBy, c.ChangedAt)
+    if err != nil { return err }
+    c.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *productRepo) PriceHistory(productID int64) ([]PriceChange, error) {
+    rows, err := r.q.Query("SELECT id, product_id, old_price, new_price, old_price_per_ton, new_price_per_ton, source, changed_by, changed_at FROM price_history WHERE product_id=? ORDER BY changed_at DESC, id DESC", productID)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []PriceChange{}
+    for rows.Next() {
+        var c PriceChange
+        if err := rows.Scan(&c.ID, &c.ProductID, &c.OldPrice, &c.NewPrice, &c.OldPricePerTon, &c.NewPricePerTon, &c.Source, &c.ChangedBy, &c.ChangedAt); err != nil { return nil, err }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+func (r *productRepo) TypeDescriptions() ([]TypeDescription, error) {
+    rows, err := r.q.Query("SELECT type, IFNULL(description,'') FROM product_descriptions")
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []TypeDescription
+    for rows.Next() {
+        var d TypeDescription
+        if err := rows.Scan(&d.Type, &d.Description); err != nil { return nil, err }
+        out = append(out, d)
+    }
+    return out, rows.Err()
+}
+
+func (r *productRepo) TypeDescription(productType string) (string, error) {
+    var d string
+    err := r.q.QueryRow("SELECT IFNULL(description,'') FROM product_descriptions WHERE type=?", productType).Scan(&d)
+    return d, notFound(err)
+}
+
+func (r *productRepo) SaveTypeDescription(d TypeDescription) error {
+    // Use INSERT OR REPLACE for broader SQLite compatibility
+    _, err := r.q.Exec("INSERT OR REPLACE INTO product_descriptions(type, description) VALUES(?, ?)", d.Type, d.Description)
+    return err
+}
+
+func (r *productRepo) DeleteTypeDescription(productType string) error {
+    _, err := r.q.Exec("DELETE FROM product_descriptions WHERE type=?", productType)
+    return err
+}
@@ -0,0 +1,74 @@
+package store
+
+// Search entities
+const (
+    EntityProduct = "product"
+    EntityArticle = "article"
+    EntityNews    = "news"
+)
+
+// SearchDoc is one indexed record. Title and Body hold analyzed text: the caller normalizes
+// and stems it, and queries must go through the same analyzer.
+type SearchDoc struct {
+    Entity   string
+    EntityID int64
+    Title    string
+    Body     string
+}
+
+// SearchHit is a matching record; lower Rank is more relevant (FTS5 bm25)
+type SearchHit struct {
+    Entity   string
+    EntityID int64
+    Rank     float64
+}
+
+// SearchRepo maintains the FTS5 index over products, articles and news
+type SearchRepo interface {
+    // Put replaces the document of one record
+    Put(d SearchDoc) error
+    Delete(entity string, id int64) error
+    // Rebuild replaces the whole index; run it inside InTx
+    Rebuild(docs []SearchDoc) error
+    // Query returns one page of hits of entity for an FTS5 MATCH expression and the total count
+    Query(match, entity string, limit, offset int) ([]SearchHit, int, error)
+}
+
+type searchRepo struct{ q dbtx }
+
+func (r *searchRepo) Put(d SearchDoc) error {
+    if err := r.Delete(d.Entity, d.EntityID); err != nil { return err }
+    _, err := r.q.Exec("INSERT INTO search_index(entity, entity_id, title, body) VALUES(?,?,?,?)", d.Entity, d.EntityID, d.Title, d.Body)
+    return err
+}
+
+func (r *searchRepo) Delete(entity string, id int64) error {
+    _, err := r.q.Exec("DELETE FROM search_index WHERE entity=? AND entity_id=?", entity, id)
+    return err
+}
+
+func (r *searchRepo) Rebuild(docs []SearchDoc) error {
+    if _, err := r.q.Exec("DELETE FROM search_index"); err != nil { return err }
+    for _, d := range docs {
+        if _, err := r.q.Exec("INSERT INTO search_index(entity, entity_id, title, body) VALUES(?,?,?,?)", d.Entity, d.EntityID, d.Title, d.Body); err != nil { return err }
+    }
+    return nil
+}
+
+func (r *searchRepo) Query(match, entity string, limit, offset int) ([]SearchHit, int, error) {
+    var total int
+    if err := r.q.QueryRow("SELECT COUNT(*) FROM search_index WHERE search_index MATCH ? AND entity=?", match, entity).Scan(&total); err != nil { return nil, 0, err }
+    if total == 0 { return []SearchHit{}, 0, nil }
+    // title matches weigh more than body matches
+    rows, err := r.q.Query("SELECT entity, entity_id, bm25(search_index, 0, 0, 10.0, 1.0) AS rank FROM search_index WHERE search_index MATCH ? AND entity=? ORDER BY rank LIMIT ? OFFSET ?",
+        match, entity, limit, offset)
+    if err != nil { return nil, 0, err }
+    defer rows.Close()
+    out := []SearchHit{}
+    for rows.Next() {
+        var h SearchHit
+        if err := rows.Scan(&h.Entity, &h.EntityID, &h.Rank); err != nil { return nil, 0, err }
+        out = append(out, h)
+    }
+    return out, total, rows.Err()
+}
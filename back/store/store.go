@@ -0,0 +1,114 @@
+// Package store keeps all persistent data of the site in a single SQLite database
+// and exposes it through typed repositories.
+package store
+
+import (
+    "database/sql"
+    "errors"
+    "os"
+    "strings"
+    "time"
+
+    _ "modernc.org/sqlite"
+)
+
+// ErrNotFound is returned by Get-style lookups when no row matches
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when a write would break a uniqueness or tree constraint
+var ErrConflict = errors.New("conflict")
+
+// TimeLayout is the text format used for timestamps written by Go code
+const TimeLayout = "2006-01-02 15:04:05"
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx so repositories can run inside a transaction
+type dbtx interface {
+    Exec(query string, args ...any) (sql.Result, error)
+    Query(query string, args ...any) (*sql.Rows, error)
+    QueryRow(query string, args ...any) *sql.Row
+}
+
+// Store bundles the repositories over one database handle
+type Store struct {
+    DB         *sql.DB
+    Products   ProductRepo
+    Orders     OrderRepo
+    Users      UserRepo
+    Cart       CartRepo
+    Content    ContentRepo
+    Search     SearchRepo
+    Categories CategoryRepo
+    Attributes AttributeRepo
+    PriceRules PriceRuleRepo
+    Companies  CompanyRepo
+    Documents  DocumentRepo
+}
+
+func newStore(dbh *sql.DB, q dbtx) *Store {
+    return &Store{
+        DB:         dbh,
+        Products:   &productRepo{q: q},
+        Orders:     &orderRepo{q: q},
+        Users:      &userRepo{q: q},
+        Cart:       &cartRepo{q: q},
+        Content:    &contentRepo{q: q},
+        Search:     &searchRepo{q: q},
+        Categories: &categoryRepo{q: q},
+        Attributes: &attributeRepo{q: q},
+        PriceRules: &priceRuleRepo{q: q},
+        Companies:  &companyRepo{q: q},
+        Documents:  &documentRepo{q: q},
+    }
+}
+
+// Open opens (creating if needed) the database file without touching its schema
+func Open(path string) (*Store, error) {
+    dbh, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+    if err != nil { return nil, err }
+    if err := dbh.Ping(); err != nil { dbh.Close(); return nil, err }
+    return newStore(dbh, dbh), nil
+}
+
+// OpenReadOnly opens an existing database file for inspection; nothing can be written through it
+func OpenReadOnly(path string) (*Store, error) {
+    // sqlite reports a missing file in read-only mode as "out of memory"
+    if _, err := os.Stat(path); err != nil { return nil, err }
+    dbh, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+    if err != nil { return nil, err }
+    if err := dbh.Ping(); err != nil { dbh.Close(); return nil, err }
+    return newStore(dbh, dbh), nil
+}
+
+// Close releases the database handle
+func (s *Store) Close() error { return s.DB.Close() }
+
+// InTx runs fn with repositories bound to a single transaction; any error rolls everything back
+func (s *Store) InTx(fn func(tx *Store) error) error {
+    tx, err := s.DB.Begin()
+    if err != nil { return err }
+    if err := fn(newStore(s.DB, tx)); err != nil {
+        _ = tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+// Now returns the current UTC time formatted for TEXT timestamp columns
+func Now() string { return time.Now().UTC().Format(TimeLayout) }
+
+func boolInt(b bool) int {
+    if b { return 1 }
+    return 0
+}
+
+// placeholders returns "?,?,…" for an IN list of n values
+func placeholders(n int) string {
+    if n <= 0 { return "" }
+    return strings.Repeat("?,", n-1) + "?"
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound
+func notFound(err error) error {
+    if errors.Is(err, sql.ErrNoRows) { return ErrNotFound }
+    return err
+}
@@ -0,0 +1,241 @@
+package store
+
+// User is a site account; PasswordHash never leaves the server
+type User struct {
+    ID           int64  `json:"id"`
+    Login        string `json:"login"`
+    Email        string `json:"email"`
+    Phone        string `json:"phone"`
+    IsAdmin      bool   `json:"is_admin"`
+    PriceGroup   string `json:"price_group"` // customer group matched by pricing rules, set by an admin
+    CompanyID    int64  `json:"company_id"`  // 0 for a private customer
+    PasswordHash string `json:"-"`
+    Profile
+}
+
+// Profile is the part of an account the user edits in the cabinet
+type Profile struct {
+    FirstName      string `json:"first_name"`
+    LastName       string `json:"last_name"`
+    CompanyName    string `json:"company_name"`
+    INN            string `json:"inn"`
+    KPP            string `json:"kpp"`
+    CompanyAddress string `json:"company_address"`
+}
+
+// Session is a server-side login session. The cookie carries a random opaque token;
+// only its SHA-256 hash is stored as ID, so listed IDs cannot be replayed as cookies.
+type Session struct {
+    ID         string `json:"id"`
+    UserID     int64  `json:"user_id"`
+    Login      string `json:"login"`
+    Kind       string `json:"kind"` // admin/user
+    IsAdmin    bool   `json:"is_admin"`
+    IP         string `json:"ip"`
+    UserAgent  string `json:"user_agent"`
+    CreatedAt  string `json:"created_at"`
+    LastSeenAt string `json:"last_seen_at"`
+    ExpiresAt  string `json:"expires_at"`
+}
+
+// ResetToken is a single-use password reset token; ID is the SHA-256 of the emailed token
+type ResetToken struct {
+    ID        string
+    UserID    int64
+    CreatedAt string
+    ExpiresAt string
+}
+
+// UserRepo persists accounts and their login sessions
+type UserRepo interface {
+    List() ([]User, error)
+    Get(id int64) (User, error)
+    GetByLogin(login string) (User, error)
+    // FindByIdentity matches login, email or phone
+    FindByIdentity(login, email, phone string) (User, error)
+    // CountByIdentity counts accounts clashing with any of login, email or phone
+    CountByIdentity(login, email, phone string) (int, error)
+    // CountOthersByContact counts accounts other than id using a non-empty email or phone
+    CountOthersByContact(id int64, email, phone string) (int, error)
+    Create(u *User) error
+    // Update writes login, email, phone, is_admin, price_group and company_id
+    Update(u User) error
+    // UpdateProfile writes email, phone and the profile fields; login stays as registered
+    UpdateProfile(u User) error
+    SetPassword(id int64, hash string) error
+    Delete(id int64) error
+
+    CreateSession(s Session) error
+    // LiveSession returns an unexpired session of the given kind joined with its user
+    LiveSession(id, kind, now string) (Session, error)
+    TouchSession(id, lastSeen, expires string) error
+    ListSessions(userID int64, now string) ([]Session, error)
+    DeleteSession(id string) error
+    DeleteUserSessions(userID int64) error
+    DeleteExpiredSessions(now string) error
+
+    // CreateResetToken stores a password reset token and drops the user's earlier unused ones
+    CreateResetToken(t ResetToken) error
+    // ConsumeResetToken marks an unexpired, unused token as used and returns its user id
+    ConsumeResetToken(id, now string) (int64, error)
+}
+
+type userRepo struct{ q dbtx }
+
+const userColumns = "id, login, IFNULL(email,''), IFNULL(phone,''), is_admin, price_group, ifnull(company_id,0), password_hash, first_name, last_name, company_name, inn, kpp, company_address"
+
+func scanUser(sc scanner) (User, error) {
+    var u User
+    var isAdmin int
+    err := sc.Scan(&u.ID, &u.Login, &u.Email, &u.Phone, &isAdmin, &u.PriceGroup, &u.CompanyID, &u.PasswordHash,
+        &u.FirstName, &u.LastName, &u.CompanyName, &u.INN, &u.KPP, &u.CompanyAddress)
+    u.IsAdmin = isAdmin == 1
+    return u, err
+}
+
+func (r *userRepo) List() ([]User, error) {
+    rows, err := r.q.Query("SELECT " + userColumns + " FROM users ORDER BY id DESC")
+    if err != nil { return nil, err }
+    defer rows.Close()
+    var out []User
+    for rows.Next() {
+        u, err := scanUser(rows)
+        if err != nil { return nil, err }
+        out = append(out, u)
+    }
+    return out, rows.Err()
+}
+
+func (r *userRepo) Get(id int64) (User, error) {
+    u, err := scanUser(r.q.QueryRow("SELECT "+userColumns+" FROM users WHERE id=?", id))
+    return u, notFound(err)
+}
+
+func (r *userRepo) GetByLogin(login string) (User, error) {
+    u, err := scanUser(r.q.QueryRow("SELECT "+userColumns+" FROM users WHERE login=?", login))
+    return u, notFound(err)
+}
+
+func (r *userRepo) FindByIdentity(login, email, phone string) (User, error) {
+    u, err := scanUser(r.q.QueryRow("SELECT "+userColumns+" FROM users WHERE login=? OR email=? OR phone=? ORDER BY id LIMIT 1", login, email, phone))
+    return u, notFound(err)
+}
+
+func (r *userRepo) CountByIdentity(login, email, phone string) (int, error) {
+    var n int
+    err := r.q.QueryRow("SELECT COUNT(1) FROM users WHERE login=? OR email=? OR phone=?", login, email, phone).Scan(&n)
+    return n, err
+}
+
+func (r *userRepo) CountOthersByContact(id int64, email, phone string) (int, error) {
+    var n int
+    err := r.q.QueryRow("SELECT COUNT(1) FROM users WHERE id<>? AND ((?<>'' AND (email=? OR login=?)) OR (?<>'' AND (phone=? OR login=?)))",
+        id, email, email, email, phone, phone, phone).Scan(&n)
+    return n, err
+}
+
+func (r *userRepo) Create(u *User) error {
+    res, err := r.q.Exec("INSERT INTO users (login, password_hash, email, phone, is_admin, price_group, company_id) VALUES (?,?,?,?,?,?,?)",
+        u.Login, u.PasswordHash, u.Email, u.Phone, boolInt(u.IsAdmin), u.PriceGroup, nullID(u.CompanyID))
+    if err != nil { return err }
+    u.ID, err = res.LastInsertId()
+    return err
+}
+
+func (r *userRepo) Update(u User) error {
+    _, err := r.q.Exec("UPDATE users SET login=?, email=?, phone=?, is_admin=?, price_group=?, company_id=? WHERE id=?",
+        u.Login, u.Email, u.Phone, boolInt(u.IsAdmin), u.PriceGroup, nullID(u.CompanyID), u.ID)
+    return err
+}
+
+func (r *userRepo) UpdateProfile(u User) error {
+    _, err := r.q.Exec("UPDATE users SET email=?, phone=?, first_name=?, last_name=?, company_name=?, inn=?, kpp=?, company_address=? WHERE id=?",
+        u.Email, u.Phone, u.FirstName, u.LastName, u.CompanyName, u.INN, u.KPP, u.CompanyAddress, u.ID)
+    return err
+}
+
+func (r *userRepo) SetPassword(id int64, hash string) error {
+    _, err := r.q.Exec("UPDATE users SET password_hash=? WHERE id=?", hash, id)
+    return err
+}
+
+func (r *userRepo) Delete(id int64) error {
+    _, err := r.q.Exec("DELETE FROM users WHERE id=?", id)
+    return err
+}
+
+func (r *userRepo) CreateSession(s Session) error {
+    _, err := r.q.Exec("INSERT INTO sessions(id, user_id, kind, ip, user_agent, created_at, last_seen_at, expires_at) VALUES(?,?,?,?,?,?,?,?)",
+        s.ID, s.UserID, s.Kind, s.IP, s.UserAgent, s.CreatedAt, s.LastSeenAt, s.ExpiresAt)
+    return err
+}
+
+const sessionSelect = `SELECT s.id, s.user_id, u.login, s.kind, u.is_admin, IFNULL(s.ip,''), IFNULL(s.user_agent,''), s.created_at, s.last_seen_at, s.expires_at
+    FROM sessions s JOIN users u ON u.id = s.user_id`
+
+func scanSession(sc scanner) (Session, error) {
+    var s Session
+    var isAdmin int
+    err := sc.Scan(&s.ID, &s.UserID, &s.Login, &s.Kind, &isAdmin, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt)
+    s.IsAdmin = isAdmin == 1
+    return s, err
+}
+
+func (r *userRepo) LiveSession(id, kind, now string) (Session, error) {
+    s, err := scanSession(r.q.QueryRow(sessionSelect+" WHERE s.id=? AND s.kind=? AND s.expires_at > ?", id, kind, now))
+    return s, notFound(err)
+}
+
+func (r *userRepo) TouchSession(id, lastSeen, expires string) error {
+    _, err := r.q.Exec("UPDATE sessions SET last_seen_at=?, expires_at=? WHERE id=?", lastSeen, expires, id)
+    return err
+}
+
+func (r *userRepo) ListSessions(userID int64, now string) ([]Session, error) {
+    q := sessionSelect + " WHERE s.expires_at > ?"
+    args := []any{now}
+    if userID > 0 { q += " AND s.user_id=?"; args = append(args, userID) }
+    rows, err := r.q.Query(q+" ORDER BY s.last_seen_at DESC", args...)
+    if err != nil { return nil, err }
+    defer rows.Close()
+    out := []Session{}
+    for rows.Next() {
+        s, err := scanSession(rows)
+        if err != nil { return nil, err }
+        out = append(out, s)
+    }
+    return out, rows.Err()
+}
+
+func (r *userRepo) DeleteSession(id string) error {
+    _, err := r.q.Exec("DELETE FROM sessions WHERE id=?", id)
+    return err
+}
+
+func (r *userRepo) DeleteUserSessions(userID int64) error {
+    _, err := r.q.Exec("DELETE FROM sessions WHERE user_id=?", userID)
+    return err
+}
+
+func (r *userRepo) DeleteExpiredSessions(now string) error {
+    _, err := r.q.Exec("DELETE FROM sessions WHERE expires_at <= ?", now)
+    return err
+}
+
+func (r *userRepo) CreateResetToken(t ResetToken) error {
+    if _, err := r.q.Exec("DELETE FROM password_reset_tokens WHERE user_id=? AND used_at=''", t.UserID); err != nil { return err }
+    _, err := r.q.Exec("INSERT INTO password_reset_tokens(id, user_id, created_at, expires_at) VALUES(?,?,?,?)", t.ID, t.UserID, t.CreatedAt, t.ExpiresAt)
+    return err
+}
+
+func (r *userRepo) ConsumeResetToken(id, now string) (int64, error) {
+    // the conditional update makes a token usable once even under concurrent requests
+    res, err := r.q.Exec("UPDATE password_reset_tokens SET used_at=? WHERE id=? AND used_at='' AND expires_at > ?", now, id, now)
+    if err != nil { return 0, err }
+    n, err := res.RowsAffected()
+    if err != nil { return 0, err }
+    if n == 0 { return 0, ErrNotFound }
+    var userID int64
+    err = r.q.QueryRow("SELECT user_id FROM password_reset_tokens WHERE id=?", id).Scan(&userID)
+    return userID, notFound(err)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "unicode"
+)
+
+// Search-as-you-type: an in-memory prefix index over product names, categories and sizes.
+// Keys fold lookalike letters to one alphabet, so "а500с", "A500C" and "a500c" are the same key.
+
+// suggestion is one entry the index can return
+type suggestion struct {
+    Kind string `json:"kind"` // category, product or size
+    ID   int64  `json:"id,omitempty"`
+    Text string `json:"text"`
+    URL  string `json:"url"`
+    toks []string
+}
+
+// suggestToken is a key token pointing at the entry it came from
+type suggestToken struct {
+    key   string
+    entry int
+}
+
+type suggestIndex struct {
+    entries []suggestion
+    tokens  []suggestToken // sorted by key
+}
+
+var (
+    suggestMu  sync.RWMutex
+    suggestCur = &suggestIndex{}
+)
+
+// suggestKeys lower-cases s, folds ё and Cyrillic lookalikes (а, с, х...) to Latin and splits it into words
+func suggestKeys(s string) []string {
+    s = strings.ReplaceAll(strings.ToLower(s), "ё", "е")
+    s = strings.Map(func(r rune) rune {
+        if lat, ok := cyrillicLookalikes[r]; ok { return lat }
+        return r
+    }, s)
+    return strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+}
+
+func buildSuggestIndex(categories []categoryNode, products []ProductRow) *suggestIndex {
+    idx := &suggestIndex{}
+    add := func(s suggestion) {
+        s.toks = suggestKeys(s.Text)
+        i := len(idx.entries)
+        idx.entries = append(idx.entries, s)
+        for _, t := range s.toks { idx.tokens = append(idx.tokens, suggestToken{key: t, entry: i}) }
+    }
+    for _, c := range categories {
+        add(suggestion{Kind: "category", Text: c.Title, URL: c.URL})
+        for _, sc := range c.Children { add(suggestion{Kind: "category", Text: sc.Title, URL: sc.URL}) }
+    }
+
+    seenSize := map[string]bool{}
+    for _, p := range products {
+        add(suggestion{Kind: "product", ID: p.ID, Text: productTitle(p), URL: productURL(p)})
+        size := strings.TrimSpace(p.Size)
+        typeSlug := normalizeTypeSlug(p.Type)
+        if size == "" { continue }
+        // a size is offered once per product type, e.g. "Труба профильная 40х20х2"
+        text := strings.TrimSpace(typeLabel(typeSlug) + " " + size)
+        if seenSize[text] { continue }
+        seenSize[text] = true
+        add(suggestion{Kind: "size", Text: text, URL: "/catalog/" + typeSlug + "/"})
+    }
+    sort.Slice(idx.tokens, func(i, j int) bool { return idx.tokens[i].key < idx.tokens[j].key })
+    return idx
+}
+
+// rebuildSuggestIndex reloads the index from the category tree and the products table;
+// called at startup and after admin product or category changes
+func rebuildSuggestIndex() {
+    products, err := st.Products.List("")
+    if err != nil { log.Printf("suggest index rebuild: %v", err); return }
+    idx := buildSuggestIndex(catalogTree().nodes(0, "/catalog/"), products)
+    suggestMu.Lock()
+    suggestCur = idx
+    suggestMu.Unlock()
+}
+
+var suggestKindRank = map[string]int{"category": 0, "product": 1, "size": 2}
+
+// lookup returns entries where every query word is a prefix of some word of the entry
+func (idx *suggestIndex) lookup(query string) []suggestion {
+    q := suggestKeys(query)
+    if len(q) == 0 { return nil }
+    // candidates come from the first word via binary search over the sorted keys
+    first := q[0]
+    i := sort.Search(len(idx.tokens), func(i int) bool { return idx.tokens[i].key >= first })
+    seen := map[int]bool{}
+    var out []suggestion
+    for ; i < len(idx.tokens) && strings.HasPrefix(idx.tokens[i].key, first); i++ {
+        e := idx.tokens[i].entry
+        if seen[e] { continue }
+        seen[e] = true
+        if matchesAllPrefixes(idx.entries[e].toks, q[1:]) { out = append(out, idx.entries[e]) }
+    }
+    // categories come first, then products and sizes; within a kind shorter texts are closer to what was typed
+    sort.SliceStable(out, func(a, b int) bool {
+        if ka, kb := suggestKindRank[out[a].Kind], suggestKindRank[out[b].Kind]; ka != kb { return ka < kb }
+        if len(out[a].toks) != len(out[b].toks) { return len(out[a].toks) < len(out[b].toks) }
+        return out[a].Text < out[b].Text
+    })
+    return out
+}
+
+func matchesAllPrefixes(toks, prefixes []string) bool {
+    for _, p := range prefixes {
+        found := false
+        for _, t := range toks {
+            if strings.HasPrefix(t, p) { found = true; break }
+        }
+        if !found { return false }
+    }
+    return true
+}
+
+// GET /api/search/suggest?q=&limit= returns up to limit categories, products and sizes
+func handleSearchSuggest(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
+    query := strings.TrimSpace(r.URL.Query().Get("q"))
+    limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+    if limit <= 0 || limit > 20 { limit = 5 }
+    suggestMu.RLock()
+    idx := suggestCur
+    suggestMu.RUnlock()
+    out := map[string][]suggestion{"categories": {}, "products": {}, "sizes": {}}
+    group := map[string]string{"category": "categories", "product": "products", "size": "sizes"}
+    for _, s := range idx.lookup(query) {
+        g := group[s.Kind]
+        if len(out[g]) < limit { out[g] = append(out[g], s) }
+    }
+    writeJSON(w, map[string]any{"query": query, "categories": out["categories"], "products": out["products"], "sizes": out["sizes"]})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "testing"
+
+    "metal-main/back/store"
+)
+
+func testSuggestIndex(t *testing.T) *suggestIndex {
+    t.Helper()
+    saved := categoriesCur
+    categoriesCur = &categoryTree{children: map[int64][]store.Category{0: {{ID: 1, Slug: "armatura", Title: "Арматура"}, {ID: 2, Slug: "truba-profilnaya", Title: "Труба профильная"}}}}
+    t.Cleanup(func() { categoriesCur = saved })
+    categories := []categoryNode{
+        {Category: store.Category{Title: "Арматура"}, URL: "/catalog/armatura/", Children: []categoryNode{{Category: store.Category{Title: "А500С"}, URL: "/catalog/armatura/a500c/"}}},
+        {Category: store.Category{Title: "Труба профильная"}, URL: "/catalog/truba-profilnaya/"},
+    }
+    products := []ProductRow{
+        {ID: 1, Type: "armatura", Name: "Арматура А500С", Size: "14"},
+        {ID: 2, Type: "armatura", Name: "Арматура А500С", Size: "12"},
+        // typed with Latin letters, as supplier files often are
+        {ID: 3, Type: "truba-profilnaya", Name: "Труба профильная", Size: "40x20x2"},
+        {ID: 4, Type: "truba-profilnaya", Name: "Труба профильная", Size: "40x20x2"},
+    }
+    return buildSuggestIndex(categories, products)
+}
+
+func TestSuggestLookup(t *testing.T) {
+    idx := testSuggestIndex(t)
+    cases := []struct {
+        query string
+        want  []string
+    }{
+        // categories rank before products and sizes, shorter texts first within a kind
+        {"арм", []string{"Арматура", "Арматура А500С 12", "Арматура А500С 14", "Арматура 12", "Арматура 14"}},
+        // every word must be a prefix of some word, in any order
+        {"а500 12", []string{"Арматура А500С 12"}},
+        {"12 арматура", []string{"Арматура А500С 12", "Арматура 12"}},
+        // Latin and Cyrillic lookalikes are the same letters
+        {"A500C", []string{"А500С", "Арматура А500С 12", "Арматура А500С 14"}},
+        // a size shared by two products is suggested once
+        {"труба 40х20", []string{"Труба профильная 40x20x2", "Труба профильная 40x20x2", "Труба профильная 40x20x2"}},
+        {"арм 16", nil},
+        {"  ", nil},
+    }
+    for _, c := range cases {
+        var got []string
+        for _, s := range idx.lookup(c.query) { got = append(got, s.Text) }
+        if !reflect.DeepEqual(got, c.want) { t.Errorf("lookup(%q) = %q, want %q", c.query, got, c.want) }
+    }
+    if got := idx.lookup("труба 40х20"); got[0].Kind != "product" || got[2].Kind != "size" { t.Errorf("kinds = %s, %s, %s", got[0].Kind, got[1].Kind, got[2].Kind) }
+}
+
+func TestMatchesAllPrefixes(t *testing.T) {
+    toks := suggestKeys("Труба профильная 40х20х2")
+    cases := []struct {
+        query string
+        want  bool
+    }{
+        {"", true},
+        {"проф", true},
+        {"40x20 тру", true},
+        {"профили", false},
+        {"проф 60", false},
+    }
+    for _, c := range cases {
+        if got := matchesAllPrefixes(toks, suggestKeys(c.query)); got != c.want { t.Errorf("matchesAllPrefixes(%q) = %v, want %v", c.query, got, c.want) }
+    }
+}
+
+func TestHandleSearchSuggestLimit(t *testing.T) {
+    idx := testSuggestIndex(t)
+    suggestMu.Lock()
+    saved := suggestCur
+    suggestCur = idx
+    suggestMu.Unlock()
+    t.Cleanup(func() { suggestMu.Lock(); suggestCur = saved; suggestMu.Unlock() })
+
+    cases := []struct {
+        limit                       string
+        categories, products, sizes int
+    }{
+        {"1", 1, 1, 1},
+        {"", 1, 2, 2},
+        // out of range falls back to the default of 5
+        {"100", 1, 2, 2},
+    }
+    for _, c := range cases {
+        w := httptest.NewRecorder()
+        handleSearchSuggest(w, httptest.NewRequest(http.MethodGet, "/api/search/suggest?q=%D0%B0%D1%80%D0%BC&limit="+c.limit, nil))
+        var res struct{ Categories, Products, Sizes []suggestion }
+        if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil { t.Fatal(err) }
+        if len(res.Categories) != c.categories || len(res.Products) != c.products || len(res.Sizes) != c.sizes {
+            t.Errorf("limit %q: %d categories, %d products, %d sizes; want %d, %d, %d", c.limit, len(res.Categories), len(res.Products), len(res.Sizes), c.categories, c.products, c.sizes)
+        }
+    }
+    // the best product of each group survives the limit
+    w := httptest.NewRecorder()
+    handleSearchSuggest(w, httptest.NewRequest(http.MethodGet, "/api/search/suggest?q=%D0%B0%D1%80%D0%BC&limit=1", nil))
+    var res struct{ Products []suggestion }
+    if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil { t.Fatal(err) }
+    if res.Products[0].ID != 2 || res.Products[0].URL == "" { t.Errorf("top product = %+v", res.Products[0]) }
+}
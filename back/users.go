@@ -4,7 +4,10 @@ import (
     "encoding/json"
     "golang.org/x/crypto/bcrypt"
     "net/http"
+    "strconv"
     "strings"
+
+    "metal-main/back/store"
 )
 
 type User struct {
@@ -13,59 +16,61 @@ type User struct {
     Email string `json:"email"`
     Phone string `json:"phone"`
     IsAdmin bool `json:"is_admin"`
+    PriceGroup string `json:"price_group"`
+    CompanyID int64 `json:"company_id"`
     Password string `json:"password,omitempty"`
 }
 
+// validCompanyID accepts 0 (no company) or an existing company
+func validCompanyID(id int64) bool {
+    if id == 0 { return true }
+    _, err := st.Companies.Get(id)
+    return err == nil
+}
+
 func adminUsersHandler(w http.ResponseWriter, r *http.Request) {
     switch r.Method {
     case http.MethodGet:
-        rows, err := userDB.Query("SELECT id, login, email, phone, is_admin FROM users ORDER BY id DESC")
+        out, err := st.Users.List()
         if err != nil { http.Error(w, err.Error(), 500); return }
-        defer rows.Close()
-        var out []User
-        for rows.Next() {
-            var u User
-            var adminInt int
-            if err := rows.Scan(&u.ID, &u.Login, &u.Email, &u.Phone, &adminInt); err != nil { http.Error(w, err.Error(), 500); return }
-            u.IsAdmin = adminInt==1
-            out = append(out, u)
-        }
         writeJSON(w, out)
     case http.MethodPost:
         var u User
         if err := json.NewDecoder(r.Body).Decode(&u); err != nil { http.Error(w, err.Error(), 400); return }
         if strings.TrimSpace(u.Login)=="" || strings.TrimSpace(u.Password)=="" { http.Error(w, "login and password required", 400); return }
+        if !validCompanyID(u.CompanyID) { http.Error(w, "unknown company_id", 400); return }
         hash, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-        adminInt := 0
-        if u.IsAdmin { adminInt = 1 }
-        res, err := userDB.Exec("INSERT INTO users (login, password_hash, email, phone, is_admin) VALUES (?,?,?,?,?)", u.Login, string(hash), u.Email, u.Phone, adminInt)
-        if err != nil { http.Error(w, err.Error(), 500); return }
-        id, _ := res.LastInsertId()
-        writeJSON(w, map[string]any{"id": id, "status":"ok"})
+        nu := store.User{Login: u.Login, Email: u.Email, Phone: u.Phone, IsAdmin: u.IsAdmin, PriceGroup: normalizePriceGroup(u.PriceGroup), CompanyID: u.CompanyID, PasswordHash: string(hash)}
+        if err := st.Users.Create(&nu); err != nil { http.Error(w, err.Error(), 500); return }
+        writeJSON(w, map[string]any{"id": nu.ID, "status":"ok"})
     case http.MethodPatch:
         var u User
         if err := json.NewDecoder(r.Body).Decode(&u); err != nil { http.Error(w, err.Error(), 400); return }
         if u.ID == 0 { http.Error(w, "id required", 400); return }
-        // Build dynamic update
-        fields := []string{}
-        args := []any{}
-        if u.Login != "" { fields = append(fields, "login=?"); args = append(args, u.Login) }
-        if u.Email != "" || u.Email == "" { fields = append(fields, "email=?"); args = append(args, u.Email) }
-        if u.Phone != "" || u.Phone == "" { fields = append(fields, "phone=?"); args = append(args, u.Phone) }
-        if u.Password != "" { hash, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost); fields = append(fields, "password_hash=?"); args = append(args, string(hash)) }
-        adminInt := 0
-        if u.IsAdmin { adminInt = 1 }
-        fields = append(fields, "is_admin=?")
-        args = append(args, adminInt)
-        if len(fields)==0 { writeJSON(w, map[string]string{"status":"ok"}); return }
-        args = append(args, u.ID)
-        q := "UPDATE users SET " + strings.Join(fields, ",") + " WHERE id=?"
-        if _, err := userDB.Exec(q, args...); err != nil { http.Error(w, err.Error(), 500); return }
+        if !validCompanyID(u.CompanyID) { http.Error(w, "unknown company_id", 400); return }
+        cur, err := st.Users.Get(u.ID)
+        if err == store.ErrNotFound { http.Error(w, "not found", 404); return }
+        if err != nil { http.Error(w, err.Error(), 500); return }
+        // login is kept when empty; email and phone may be cleared
+        if u.Login != "" { cur.Login = u.Login }
+        cur.Email = u.Email
+        cur.Phone = u.Phone
+        cur.IsAdmin = u.IsAdmin
+        cur.PriceGroup = normalizePriceGroup(u.PriceGroup)
+        cur.CompanyID = u.CompanyID
+        if err := st.Users.Update(cur); err != nil { http.Error(w, err.Error(), 500); return }
+        if u.Password != "" {
+            hash, _ := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+            if err := st.Users.SetPassword(u.ID, string(hash)); err != nil { http.Error(w, err.Error(), 500); return }
+            // a new password invalidates every existing login
+            _ = revokeUserSessions(u.ID)
+        }
         writeJSON(w, map[string]string{"status":"ok"})
     case http.MethodDelete:
-        idStr := r.URL.Query().Get("id")
-        if idStr == "" { http.Error(w, "id required", 400); return }
-        if _, err := userDB.Exec("DELETE FROM users WHERE id=?", idStr); err != nil { http.Error(w, err.Error(), 500); return }
+        id, _ := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+        if id == 0 { http.Error(w, "id required", 400); return }
+        if err := st.Users.Delete(id); err != nil { http.Error(w, err.Error(), 500); return }
+        _ = revokeUserSessions(id)
         writeJSON(w, map[string]string{"status":"ok"})
     default:
         http.Error(w, "method not allowed", 405)
@@ -86,14 +91,12 @@ func publicRegister(w http.ResponseWriter, r *http.Request) {
     login := in.Email
     if login=="" { login = in.Phone }
     // Check duplicates
-    var c int
-    _ = userDB.QueryRow("SELECT COUNT(1) FROM users WHERE login=? OR email=? OR phone=?", login, in.Email, in.Phone).Scan(&c)
+    c, _ := st.Users.CountByIdentity(login, in.Email, in.Phone)
     if c>0 { http.Error(w, "user already exists", 409); return }
     hash, _ := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
-    res, err := userDB.Exec("INSERT INTO users (login, password_hash, email, phone, is_admin) VALUES (?,?,?,?,0)", login, string(hash), in.Email, in.Phone)
-    if err != nil { http.Error(w, err.Error(), 500); return }
-    _, _ = res.LastInsertId()
-    setUserSession(w, login)
+    nu := store.User{Login: login, Email: in.Email, Phone: in.Phone, PasswordHash: string(hash)}
+    if err := st.Users.Create(&nu); err != nil { http.Error(w, err.Error(), 500); return }
+    if err := setUserSession(w, r, nu.ID); err != nil { http.Error(w, err.Error(), 500); return }
     writeJSON(w, map[string]any{"status":"ok"})
 }
 
@@ -109,11 +112,16 @@ func publicLogin(w http.ResponseWriter, r *http.Request) {
     if strings.TrimSpace(in.Password)=="" { http.Error(w, "password required", 400); return }
     var login string
     if strings.TrimSpace(in.Email) != "" { login = in.Email } else { login = in.Phone }
-    var hash string
-    err := userDB.QueryRow("SELECT password_hash FROM users WHERE login=? OR email=? OR phone=?", login, in.Email, in.Phone).Scan(&hash)
-    if err != nil { http.Error(w, "invalid credentials", 401); return }
-    if bcrypt.CompareHashAndPassword([]byte(hash), []byte(in.Password)) != nil { http.Error(w, "invalid credentials", 401); return }
-    setUserSession(w, login)
+    // the lock belongs to the account, whichever of its email, phone or login was typed,
+    // so it is the same one the password reset clears
+    u, err := st.Users.FindByIdentity(login, in.Email, in.Phone)
+    key := lockoutKey("user", login)
+    if err == nil { key = lockoutKey("user", u.Login) }
+    if !checkLockout(w, key) { return }
+    if err != nil { loginLockout.fail(key); http.Error(w, "invalid credentials", 401); return }
+    if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(in.Password)) != nil { loginLockout.fail(key); http.Error(w, "invalid credentials", 401); return }
+    loginLockout.reset(key)
+    if err := setUserSession(w, r, u.ID); err != nil { http.Error(w, err.Error(), 500); return }
     writeJSON(w, map[string]any{"status":"ok"})
 }
 
@@ -0,0 +1,191 @@
+package main
+
+import (
+    "archive/zip"
+    "bytes"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "io"
+    "path"
+    "strconv"
+    "strings"
+)
+
+// A minimal XLSX (Office Open XML spreadsheet) reader and writer for product price lists: the
+// reader takes the cell text of the first worksheet, the writer produces one sheet of strings
+// and numbers. Formulas, styles and dates are out of scope; cells keep their cached value.
+
+var errNotXLSX = errors.New("not an xlsx file")
+
+type xlsxRel struct {
+    ID     string `xml:"Id,attr"`
+    Target string `xml:"Target,attr"`
+}
+
+type xlsxCell struct {
+    Ref    string `xml:"r,attr"`
+    Type   string `xml:"t,attr"`
+    Value  string `xml:"v"`
+    Inline struct {
+        Text string `xml:"t"`
+        Runs []struct {
+            Text string `xml:"t"`
+        } `xml:"r"`
+    } `xml:"is"`
+}
+
+type xlsxRow struct {
+    Cells []xlsxCell `xml:"c"`
+}
+
+// readXLSX returns the rows of the first worksheet as text; missing cells are empty strings
+func readXLSX(data []byte) ([][]string, error) {
+    zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+    if err != nil { return nil, errNotXLSX }
+    files := map[string]*zip.File{}
+    for _, f := range zr.File { files[f.Name] = f }
+    decode := func(name string, v any) error {
+        f, ok := files[name]
+        if !ok { return fmt.Errorf("xlsx: missing %s", name) }
+        rc, err := f.Open()
+        if err != nil { return err }
+        defer rc.Close()
+        return xml.NewDecoder(rc).Decode(v)
+    }
+
+    var wb struct {
+        Sheets []struct {
+            RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+        } `xml:"sheets>sheet"`
+    }
+    if err := decode("xl/workbook.xml", &wb); err != nil { return nil, err }
+    sheet := "xl/worksheets/sheet1.xml"
+    var rels struct {
+        Rels []xlsxRel `xml:"Relationship"`
+    }
+    if len(wb.Sheets) > 0 && decode("xl/_rels/workbook.xml.rels", &rels) == nil {
+        for _, r := range rels.Rels {
+            if r.ID != wb.Sheets[0].RID { continue }
+            if strings.HasPrefix(r.Target, "/") { sheet = strings.TrimPrefix(r.Target, "/") } else { sheet = path.Join("xl", r.Target) }
+        }
+    }
+
+    var shared []string
+    if _, ok := files["xl/sharedStrings.xml"]; ok {
+        var sst struct {
+            Items []struct {
+                Text string `xml:"t"`
+                Runs []struct {
+                    Text string `xml:"t"`
+                } `xml:"r"`
+            } `xml:"si"`
+        }
+        if err := decode("xl/sharedStrings.xml", &sst); err != nil { return nil, err }
+        for _, si := range sst.Items {
+            s := si.Text
+            for _, r := range si.Runs { s += r.Text }
+            shared = append(shared, s)
+        }
+    }
+
+    var ws struct {
+        Rows []xlsxRow `xml:"sheetData>row"`
+    }
+    if err := decode(sheet, &ws); err != nil { return nil, err }
+    out := make([][]string, 0, len(ws.Rows))
+    for _, row := range ws.Rows {
+        var cells []string
+        for _, c := range row.Cells {
+            col := len(cells)
+            if c.Ref != "" { col = xlsxColumn(c.Ref) }
+            for len(cells) < col { cells = append(cells, "") }
+            var v string
+            switch c.Type {
+            case "s":
+                n, err := strconv.Atoi(strings.TrimSpace(c.Value))
+                if err != nil || n < 0 || n >= len(shared) { return nil, fmt.Errorf("xlsx: bad shared string in %s", c.Ref) }
+                v = shared[n]
+            case "inlineStr":
+                v = c.Inline.Text
+                for _, r := range c.Inline.Runs { v += r.Text }
+            case "b":
+                v = "false"
+                if c.Value == "1" { v = "true" }
+            default:
+                v = c.Value
+            }
+            if col < len(cells) { cells[col] = v } else { cells = append(cells, v) }
+        }
+        out = append(out, cells)
+    }
+    return out, nil
+}
+
+// xlsxColumn turns the letters of a cell reference ("AB12") into a zero-based column index
+func xlsxColumn(ref string) int {
+    n := 0
+    for _, c := range ref {
+        if c < 'A' || c > 'Z' { break }
+        n = n*26 + int(c-'A') + 1
+    }
+    return n - 1
+}
+
+func xlsxColumnName(i int) string {
+    name := ""
+    for i++; i > 0; i = (i - 1) / 26 { name = string(rune('A'+(i-1)%26)) + name }
+    return name
+}
+
+// writeXLSX writes rows as the only sheet of a workbook; float64 and int cells become numbers,
+// everything else inline strings
+func writeXLSX(w io.Writer, sheetName string, rows [][]any) error {
+    var sheet bytes.Buffer
+    sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+    for r, row := range rows {
+        fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+        for c, v := range row {
+            ref := xlsxColumnName(c) + strconv.Itoa(r+1)
+            switch x := v.(type) {
+            case float64:
+                fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(x, 'f', -1, 64))
+            case int:
+                fmt.Fprintf(&sheet, `<c r="%s"><v>%d</v></c>`, ref, x)
+            default:
+                fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+                if err := xml.EscapeText(&sheet, []byte(fmt.Sprint(v))); err != nil { return err }
+                sheet.WriteString(`</t></is></c>`)
+            }
+        }
+        sheet.WriteString(`</row>`)
+    }
+    sheet.WriteString(`</sheetData></worksheet>`)
+
+    var name bytes.Buffer
+    if err := xml.EscapeText(&name, []byte(sheetName)); err != nil { return err }
+    parts := []struct{ name, body string }{
+        {"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+            `<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+            `<Default Extension="xml" ContentType="application/xml"/>` +
+            `<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+            `<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+            `</Types>`},
+        {"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+            `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+            `</Relationships>`},
+        {"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+            `<sheets><sheet name="` + name.String() + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+        {"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+            `<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+            `</Relationships>`},
+        {"xl/worksheets/sheet1.xml", sheet.String()},
+    }
+    zw := zip.NewWriter(w)
+    for _, p := range parts {
+        f, err := zw.Create(p.name)
+        if err != nil { return err }
+        if _, err := io.WriteString(f, p.body); err != nil { return err }
+    }
+    return zw.Close()
+}
@@ -152,9 +152,25 @@ document.addEventListener('DOMContentLoaded', () => {
     });
 
     // Обработка "Забыли пароль?"
-    forgotPasswordLink.addEventListener('click', (e) => {
+    forgotPasswordLink.addEventListener('click', async (e) => {
         e.preventDefault();
-        alert('Функция восстановления пароля будет доступна в ближайшее время!');
+        const email = (prompt('Введите email, указанный при регистрации:', loginEmailInput.value.includes('@') ? loginEmailInput.value : '') || '').trim();
+        if (!email) return;
+        if (!isValidEmail(email)) {
+            alert('Пожалуйста, введите корректный email адрес');
+            return;
+        }
+        try {
+            const res = await fetch('/api/password/forgot', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ email })
+            });
+            if (!res.ok) throw new Error(await res.text());
+            alert('Если аккаунт с таким email существует, мы отправили на него ссылку для восстановления пароля.');
+        } catch (err) {
+            alert('Ошибка: ' + err.message);
+        }
     });
 
     // Обработка формы регистрации
@@ -2,6 +2,9 @@
 document.addEventListener('DOMContentLoaded', function() {
     // Загрузка данных пользователя
     fetchUserData();
+
+    // История заказов
+    fetchOrders();
     
     // Навигация по вкладкам
     setupTabs();
@@ -15,7 +18,7 @@ document.addEventListener('DOMContentLoaded', function() {
 
 async function fetchUserData() {
     try {
-        const response = await fetch('/api/me');
+        const response = await fetch('/api/profile');
         if (!response.ok) {
             window.location.href = '/front/HTML/main.html';
             return;
@@ -45,10 +48,31 @@ function displayUserData(userData) {
     }
     
     // Заполнение формы
-    if (userData.firstName) document.getElementById('firstName').value = userData.firstName;
-    if (userData.lastName) document.getElementById('lastName').value = userData.lastName;
-    if (userData.email) document.getElementById('email').value = userData.email;
-    if (userData.phone) document.getElementById('phone').value = userData.phone;
+    document.getElementById('firstName').value = userData.first_name || '';
+    document.getElementById('lastName').value = userData.last_name || '';
+    document.getElementById('email').value = userData.email || '';
+    document.getElementById('phone').value = userData.phone || '';
+    document.getElementById('companyName').value = userData.company_name || '';
+    document.getElementById('inn').value = userData.inn || '';
+    document.getElementById('kpp').value = userData.kpp || '';
+    document.getElementById('companyAddress').value = userData.company_address || '';
+
+    // an account linked to a company orders with the company's requisites, kept by the manager
+    const linked = document.getElementById('companyLinked');
+    const c = userData.company;
+    linked.style.display = c ? '' : 'none';
+    document.getElementById('companyFields').style.display = c ? 'none' : '';
+    if (c) {
+        const rows = [
+            c.name,
+            [c.inn && ('ИНН ' + c.inn), c.kpp && ('КПП ' + c.kpp)].filter(Boolean).join(', '),
+            c.legal_address,
+            c.payment_days ? ('Отсрочка платежа: ' + c.payment_days + ' дн.') : 'Предоплата',
+            c.credit_limit ? ('Кредитный лимит: ' + Number(c.credit_limit).toLocaleString('ru-RU') + ' ₽') : ''
+        ].filter(Boolean);
+        linked.innerHTML = rows.map(r => `<div>${escapeHTML(r)}</div>`).join('') +
+            '<div style="opacity:.7; margin-top:6px;">Заказы оформляются на эту компанию. Чтобы изменить реквизиты, обратитесь к менеджеру.</div>';
+    }
 }
 
 function setupTabs() {
@@ -96,9 +120,30 @@ function setupPasswordModal() {
     
     form.addEventListener('submit', async (e) => {
         e.preventDefault();
-        // Здесь будет логика смены пароля
-        alert('Пароль успешно изменен!');
-        modal.style.display = 'none';
+        const current = document.getElementById('currentPassword').value;
+        const next = document.getElementById('newPassword').value;
+        if (next !== document.getElementById('confirmPassword').value) {
+            alert('Пароли не совпадают');
+            return;
+        }
+        try {
+            const response = await fetch('/api/profile/password', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ current_password: current, new_password: next })
+            });
+            if (response.status === 403) {
+                alert('Текущий пароль указан неверно');
+                return;
+            }
+            if (!response.ok) throw new Error(await response.text());
+            alert('Пароль успешно изменен!');
+            form.reset();
+            modal.style.display = 'none';
+        } catch (error) {
+            console.error('Ошибка смены пароля:', error);
+            alert('Ошибка смены пароля');
+        }
     });
 }
 
@@ -109,15 +154,19 @@ function setupForms() {
         e.preventDefault();
         
         const formData = {
-            firstName: document.getElementById('firstName').value,
-            lastName: document.getElementById('lastName').value,
+            first_name: document.getElementById('firstName').value,
+            last_name: document.getElementById('lastName').value,
             email: document.getElementById('email').value,
-            phone: document.getElementById('phone').value
+            phone: document.getElementById('phone').value,
+            company_name: document.getElementById('companyName').value,
+            inn: document.getElementById('inn').value,
+            kpp: document.getElementById('kpp').value,
+            company_address: document.getElementById('companyAddress').value
         };
         
         try {
             const response = await fetch('/api/profile', {
-                method: 'POST',
+                method: 'PATCH',
                 headers: {
                     'Content-Type': 'application/json'
                 },
@@ -125,9 +174,12 @@ function setupForms() {
             });
             
             if (response.ok) {
+                displayUserData(await response.json());
                 alert('Данные успешно сохранены!');
+            } else if (response.status === 409) {
+                alert('Этот email или телефон уже используется другим аккаунтом');
             } else {
-                alert('Ошибка сохранения данных');
+                alert('Ошибка сохранения данных: ' + (await response.text()));
             }
         } catch (error) {
             console.error('Ошибка:', error);
@@ -137,6 +189,119 @@ function setupForms() {
 }
 
 
+// История заказов: заказы из каталога и заявки на услуги
+async function fetchOrders() {
+    const list = document.getElementById('ordersList');
+    try {
+        const response = await fetch('/api/my/orders');
+        if (!response.ok) throw new Error('HTTP ' + response.status);
+        const data = await response.json();
+        renderOrders(list, data.orders || [], data.service_orders || []);
+    } catch (error) {
+        console.error('Ошибка загрузки заказов:', error);
+        list.innerHTML = '<div class="order-date">Не удалось загрузить заказы</div>';
+    }
+}
+
+function escapeHTML(s) {
+    return String(s == null ? '' : s).replace(/[&<>"']/g, c => ({'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c]));
+}
+
+// unitName is the short name of an order line's quantity unit; old lines have none and are pieces
+function unitName(unit) {
+    return ({ pcs: 'шт.', m: 'м', m2: 'м²', t: 'т', kg: 'кг' })[unit] || 'шт.';
+}
+
+function orderStatusClass(status) {
+    if (status === 'delivered') return 'status-completed';
+    if (status === 'cancelled') return 'status-cancelled';
+    return 'status-processing';
+}
+
+function formatOrderDate(value) {
+    const d = new Date(String(value).replace(' ', 'T') + (String(value).includes('T') ? '' : 'Z'));
+    if (isNaN(d)) return escapeHTML(value);
+    return d.toLocaleDateString('ru-RU', { day: 'numeric', month: 'long', year: 'numeric' });
+}
+
+function formatRub(v) {
+    return Number(v || 0).toLocaleString('ru-RU', { maximumFractionDigits: 2 }) + ' ₽';
+}
+
+// orderDocumentLinks offers the invoice once a manager has confirmed the order, and the
+// commercial offer while the order is not cancelled
+function orderDocumentLinks(o) {
+    if (o.status === 'cancelled') return '';
+    const links = [`<a class="btn btn-secondary" href="/api/my/orders/${o.id}/offer.pdf">КП (PDF)</a>`];
+    if (o.status !== 'new') links.unshift(`<a class="btn btn-secondary" href="/api/my/orders/${o.id}/invoice.pdf">Счёт (PDF)</a>`);
+    return links.join(' ');
+}
+
+function renderOrders(list, orders, services) {
+    if (!orders.length && !services.length) {
+        list.innerHTML = '<div class="order-date">Вы ещё не оформляли заказов</div>';
+        return;
+    }
+    const cards = orders.map(o => `
+        <div class="order-card">
+            <div class="order-header">
+                <div>
+                    <div class="order-number">Заказ #${o.id}</div>
+                    <div class="order-date">${formatOrderDate(o.created_at)}</div>
+                </div>
+                <span class="order-status ${orderStatusClass(o.status)}">${escapeHTML(o.status_label)}</span>
+            </div>
+            <div class="order-details">
+                <div class="order-items">${(o.lines || []).map(l => `${escapeHTML(l.title)} (${l.qty} ${unitName(l.unit)})`).join(', ')}${o.company_name ? `<div class="order-date">Покупатель: ${escapeHTML(o.company_name)}</div>` : ''}</div>
+                <div class="order-total">${formatRub(o.total)}</div>
+            </div>
+            <div style="margin-top: 15px;">
+                <button class="btn btn-secondary" data-repeat="${o.id}">Повторить заказ</button>
+                ${orderDocumentLinks(o)}
+            </div>
+        </div>`);
+    services.forEach(o => cards.push(`
+        <div class="order-card">
+            <div class="order-header">
+                <div>
+                    <div class="order-number">Заявка #${o.id}</div>
+                    <div class="order-date">${formatOrderDate(o.createdAt)}</div>
+                </div>
+                <span class="order-status ${orderStatusClass(o.status)}">${escapeHTML(o.status_label)}</span>
+            </div>
+            <div class="order-details">
+                <div class="order-items">${escapeHTML(o.service)}</div>
+            </div>
+        </div>`));
+    list.innerHTML = cards.join('');
+    list.querySelectorAll('[data-repeat]').forEach(btn => {
+        btn.addEventListener('click', () => repeatOrder(btn.dataset.repeat));
+    });
+}
+
+async function repeatOrder(id) {
+    try {
+        const response = await fetch(`/api/my/orders/${id}/repeat`, { method: 'POST' });
+        if (!response.ok) throw new Error(await response.text());
+        const res = await response.json();
+        // корзина на странице хранится в localStorage — дублируем туда добавленные позиции
+        let items = [];
+        try { items = JSON.parse(localStorage.getItem('cartItems') || '[]'); } catch { items = []; }
+        (res.added || []).forEach(it => {
+            const cur = items.find(i => String(i.id) === String(it.ID) && (i.unit || '') === (it.Unit || ''));
+            if (cur) cur.qty = +((cur.qty || 1) + it.Qty).toFixed(3);
+            else items.push({ id: it.ID, title: it.Title, price: it.Price, image: it.Image, qty: it.Qty, unit: it.Unit });
+        });
+        localStorage.setItem('cartItems', JSON.stringify(items));
+        if (res.skipped && res.skipped.length) {
+            alert('Некоторые товары недоступны и не добавлены в корзину:\n' + res.skipped.join('\n'));
+        }
+        window.location.href = '/cart/';
+    } catch (error) {
+        console.error('Ошибка повтора заказа:', error);
+        alert('Не удалось повторить заказ');
+    }
+}
 
 // Выход из аккаунта
 document.getElementById('logoutBtn').addEventListener('click', async () => {
@@ -12,19 +12,29 @@ function saveCart(items) {
     localStorage.setItem('cartItems', JSON.stringify(items));
 }
 
-function updateQuantity(id, newQty) {
+// short names of the quantity units lines are ordered in
+const cartUnitNames = { pcs: 'шт', m: 'м', m2: 'м²', t: 'т', kg: 'кг' };
+
+function cartUnitName(unit) { return cartUnitNames[unit] || 'шт'; }
+
+// lineKey tells lines apart: the same product may be in the cart in metres and in tonnes
+function lineKey(item) { return String(item.id) + '|' + (item.unit || ''); }
+
+function qtyStep(item) { return item.unit === 't' ? 0.1 : 1; }
+
+function updateQuantity(key, newQty) {
     const items = readCart();
-    const item = items.find(i => String(i.id) === String(id));
+    const item = items.find(i => lineKey(i) === String(key));
     if (item) {
-        item.qty = Math.max(1, newQty);
+        item.qty = Math.max(qtyStep(item), +Number(newQty).toFixed(3) || qtyStep(item));
         saveCart(items);
         renderCart();
         if (typeof updateCartCounter === 'function') { try { updateCartCounter(); } catch{} }
     }
 }
 
-function removeFromCart(id) {
-    const items = readCart().filter(i => String(i.id) !== String(id));
+function removeFromCart(key) {
+    const items = readCart().filter(i => lineKey(i) !== String(key));
     saveCart(items);
     renderCart();
     showNotification('Товар удален из корзины');
@@ -46,7 +56,32 @@ function showNotification(message) {
     }, 3000);
 }
 
-function renderCart() {
+// requoteCart re-prices every line on the server, so volume tiers and discounts follow the quantity
+let cartQuoteSeq = 0;
+async function requoteCart() {
+    const seq = ++cartQuoteSeq;
+    const items = readCart();
+    const quotes = await Promise.all(items.map(i => fetch('/api/catalog/quote', {
+        method: 'POST', headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ item_id: String(i.id), qty: i.qty || 1, unit: i.unit || '' })
+    }).then(r => r.ok ? r.json() : null).catch(() => null)));
+    if (seq !== cartQuoteSeq) return; // the cart changed meanwhile; a newer requote is running
+    let changed = false;
+    items.forEach((item, n) => {
+        const q = quotes[n];
+        if (!q) return;
+        const rule = q.rule ? q.rule.name : '';
+        if (item.price !== q.unit_price || (item.rule || '') !== rule) {
+            item.price = q.unit_price;
+            item.list_price = q.list_price || 0;
+            item.rule = rule;
+            changed = true;
+        }
+    });
+    if (changed) { saveCart(items); renderCart(false); }
+}
+
+function renderCart(requote = true) {
     const items = readCart();
     const list = document.getElementById('cartList');
     const summary = document.getElementById('cartSummary');
@@ -70,22 +105,25 @@ function renderCart() {
     
     let total = 0;
     list.innerHTML = items.map(item => {
-        const itemTotal = (item.price || 0) * (item.qty || 1);
+        const itemTotal = Math.round((item.price || 0) * (item.qty || 1) * 100) / 100;
         total += itemTotal;
-        const qid = String(item.id||'').replace(/'/g, "\\'");
+        const qid = lineKey(item).replace(/'/g, "\\'");
+        const step = qtyStep(item);
         
         return `
             <div class="cart-item" data-id="${item.id}">
                 <img src="${item.image}" alt="${item.title}" class="cart-item-image">
                 <div class="cart-item-info">
                     <h3 class="cart-item-title">${item.title}</h3>
-                    <div class="cart-item-price">${item.price} ₽ / шт</div>
+                    <div class="cart-item-price">${item.rule ? `<s style="opacity:.6">${item.list_price} ₽</s> ` : ''}${item.price} ₽ / ${cartUnitName(item.unit)}</div>
+                    ${item.rule ? `<div class="cart-item-meta" style="color:#15803d">Скидка: ${item.rule}</div>` : ''}
                     <div class="cart-item-meta">Артикул: ${item.id}</div>
                     <div class="quantity-controls">
-                        <button class="quantity-btn" onclick="updateQuantity('${qid}', ${(item.qty || 1) - 1})">-</button>
+                        <button class="quantity-btn" onclick="updateQuantity('${qid}', ${(item.qty || 1) - step})">-</button>
                         <input type="number" class="quantity-input" value="${item.qty || 1}" 
-                               min="1" onchange="updateQuantity('${qid}', parseInt(this.value)||1)">
-                        <button class="quantity-btn" onclick="updateQuantity('${qid}', ${(item.qty || 1) + 1})">+</button>
+                               min="${step}" step="${step}" onchange="updateQuantity('${qid}', parseFloat(String(this.value).replace(',', '.'))||${step})">
+                        <button class="quantity-btn" onclick="updateQuantity('${qid}', ${(item.qty || 1) + step})">+</button>
+                        <span class="quantity-unit">${cartUnitName(item.unit)}</span>
                     </div>
                 </div>
                 <div class="cart-item-controls">
@@ -102,7 +140,7 @@ function renderCart() {
         <h3 class="summary-title">Итог заказа</h3>
         <div class="summary-row">
             <span class="summary-label">Товары (${items.length})</span>
-            <span class="summary-value">${total} ₽</span>
+            <span class="summary-value">${Math.round(total * 100) / 100} ₽</span>
         </div>
         <div class="summary-row">
             <span class="summary-label">Доставка</span>
@@ -110,13 +148,43 @@ function renderCart() {
         </div>
         <div class="summary-row">
             <span class="summary-label">Итого</span>
-            <span class="summary-value">${total} ₽</span>
+            <span class="summary-value">${Math.round(total * 100) / 100} ₽</span>
         </div>
         <button class="checkout-btn" onclick="checkout()">
             <i class="fas fa-credit-card"></i>
             Оформить заказ
         </button>
+        <button class="offer-btn" onclick="downloadOffer()">
+            <i class="fas fa-file-pdf"></i>
+            Скачать коммерческое предложение
+        </button>
     `;
+    if (requote) requoteCart();
+}
+
+// downloadOffer asks the server for a commercial offer (PDF) on the lines in the cart
+async function downloadOffer() {
+    const items = readCart();
+    if (!items.length) { alert('Корзина пуста'); return; }
+    try {
+        const response = await fetch('/api/cart/offer.pdf', {
+            method: 'POST', headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ items: items.map(it => ({ item_id: String(it.id || ''), qty: it.qty || 1, unit: it.unit || '' })) })
+        });
+        if (!response.ok) throw new Error(await response.text());
+        const name = (/filename="([^"]+)"/.exec(response.headers.get('Content-Disposition') || '') || [])[1] || 'kp.pdf';
+        const url = URL.createObjectURL(await response.blob());
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = name;
+        document.body.appendChild(a);
+        a.click();
+        a.remove();
+        setTimeout(() => URL.revokeObjectURL(url), 1000);
+    } catch (error) {
+        console.error('Ошибка формирования КП:', error);
+        alert('Не удалось сформировать коммерческое предложение');
+    }
 }
 
 function checkout() {
@@ -132,7 +200,7 @@ function checkout() {
     }
     async function isAuth(){ try{ const r=await fetch('/api/me', { credentials:'include' }); return r.ok; }catch{ return false; } }
     const total = items.reduce((s,i)=> s + (Number(i.price)||0)*(Number(i.qty)||1), 0);
-    const summaryLines = items.slice(0,5).map(i=>`${i.title} — ${i.qty} шт.`).join('<br>');
+    const summaryLines = items.slice(0,5).map(i=>`${i.title} — ${i.qty} ${cartUnitName(i.unit)}`).join('<br>');
     if (!window.__cart_oneclick_busy) window.__cart_oneclick_busy = false;
     if (window.__cart_oneclick_busy) return; // prevent double click
     (async function(){
@@ -142,19 +210,26 @@ function checkout() {
                 +'<div class="modal-summary">'+ summaryLines + (items.length>5?'…':'') +'</div>'
                 +'<div class="modal-total">Итого: '+ Math.round(total).toLocaleString('ru-RU') +' ₽</div>'
                 +'<input id="cartOneClickPhone" class="modal-input" placeholder="+7 (___) ___-__-__"/>'
+                +'<input id="cartOneClickName" class="modal-input" placeholder="Имя"/>'
+                +'<input id="cartOneClickAddress" class="modal-input" placeholder="Адрес доставки (необязательно)"/>'
+                +'<textarea id="cartOneClickComment" class="modal-input" placeholder="Комментарий к заказу"></textarea>'
                 +'<div class="modal-actions"><button id="cocCancel" class="btn secondary">Отмена</button><button id="cocSubmit" class="btn">Подтвердить</button></div>');
             document.getElementById('cocCancel').onclick = function(){ m.close(); };
             document.getElementById('cocSubmit').onclick = async function(){
                 const phone = (document.getElementById('cartOneClickPhone').value||'').trim(); if(!phone){ alert('Укажите номер телефона'); return; }
                 try{
                     window.__cart_oneclick_busy = true;
-                    const resp = await fetch('/api/item-order/batch', { method:'POST', headers:{'Content-Type':'application/json'}, body: JSON.stringify({ items: items.map(it=>({ item_id: (it.id||''), title: it.title||'', qty: it.qty||1, price: it.price||0 })), phone }) });
+                    const resp = await fetch('/api/item-order/batch', { method:'POST', headers:{'Content-Type':'application/json'}, body: JSON.stringify({ items: items.map(it=>({ item_id: (it.id||''), qty: it.qty||1, unit: it.unit||'' })), phone,
+                        name: (document.getElementById('cartOneClickName').value||'').trim(),
+                        address: (document.getElementById('cartOneClickAddress').value||'').trim(),
+                        comment: (document.getElementById('cartOneClickComment').value||'').trim() }) });
                     if(!resp.ok){ const t=await resp.text(); throw new Error(t||'Ошибка оформления'); }
+                    const res = await resp.json().catch(()=>({}));
                     // clear server cart (best-effort)
                     try{ await fetch('/api/cart?all=1', { method:'DELETE' }); }catch(_){ }
                     // clear local cart
                     saveCart([]); renderCart(); if (typeof updateCartCounter==='function'){ try{ updateCartCounter(); }catch(_){} }
-                    m.close(); alert('Спасибо! В течение 5 минут вам позвонит менеджер.');
+                    m.close(); alert('Спасибо! Сумма заказа: '+ Math.round(Number(res.total)||total).toLocaleString('ru-RU') +' ₽. В течение 5 минут вам позвонит менеджер.');
                 } catch(err){ alert('Ошибка: '+ (err&&err.message?err.message:String(err))); }
                 finally{ window.__cart_oneclick_busy = false; }
             };
@@ -162,18 +237,23 @@ function checkout() {
             const m2 = showModal('<div class="modal-title">Подтверждение заказа</div>'
                 +'<div class="modal-summary">'+ summaryLines + (items.length>5?'…':'') +'</div>'
                 +'<div class="modal-total">Итого: '+ Math.round(total).toLocaleString('ru-RU') +' ₽</div>'
+                +'<input id="cartOrderAddress" class="modal-input" placeholder="Адрес доставки (необязательно)"/>'
+                +'<textarea id="cartOrderComment" class="modal-input" placeholder="Комментарий к заказу"></textarea>'
                 +'<div class="modal-actions"><button id="cocCancel2" class="btn secondary">Отмена</button><button id="cocSubmit2" class="btn">Подтвердить</button></div>'
                 +'<div class="modal-note">В течение 5 минут вам позвонит наш менеджер, чтобы уточнить детали.</div>');
             document.getElementById('cocCancel2').onclick = function(){ m2.close(); };
             document.getElementById('cocSubmit2').onclick = async function(){
                 try{
                     window.__cart_oneclick_busy = true;
-                    const resp = await fetch('/api/item-order/batch', { method:'POST', headers:{'Content-Type':'application/json'}, body: JSON.stringify({ items: items.map(it=>({ item_id: (it.id||''), title: it.title||'', qty: it.qty||1, price: it.price||0 })), phone: '' }) });
+                    const resp = await fetch('/api/item-order/batch', { method:'POST', headers:{'Content-Type':'application/json'}, body: JSON.stringify({ items: items.map(it=>({ item_id: (it.id||''), qty: it.qty||1, unit: it.unit||'' })), phone: '',
+                        address: (document.getElementById('cartOrderAddress').value||'').trim(),
+                        comment: (document.getElementById('cartOrderComment').value||'').trim() }) });
                     if(!resp.ok){ const t=await resp.text(); throw new Error(t||'Ошибка оформления'); }
+                    const res = await resp.json().catch(()=>({}));
                     // clear server cart and local cart after successful order
                     try{ await fetch('/api/cart?all=1', { method:'DELETE' }); }catch(_){ }
                     saveCart([]); renderCart(); if (typeof updateCartCounter==='function'){ try{ updateCartCounter(); }catch(_){} }
-                    m2.close(); alert('Заказ оформлен! С вами свяжется менеджер.');
+                    m2.close(); alert('Заказ оформлен на сумму '+ Math.round(Number(res.total)||total).toLocaleString('ru-RU') +' ₽! С вами свяжется менеджер.');
                 } catch(err){ alert('Ошибка: '+ (err&&err.message?err.message:String(err))); }
                 finally{ window.__cart_oneclick_busy = false; }
             };
@@ -193,11 +193,12 @@ function writeCart(items){
   localStorage.setItem('cartItems', JSON.stringify(items));
 }
 
+// a product ordered in two units (metres and tonnes) keeps two lines
 function addToCart(newItem){
   const items = readCart();
-  const idx = items.findIndex(i => i.id === newItem.id);
+  const idx = items.findIndex(i => i.id === newItem.id && (i.unit||'') === (newItem.unit||''));
   if(idx >= 0){
-    items[idx].qty = (items[idx].qty||1) + (newItem.qty||1);
+    items[idx].qty = +((items[idx].qty||1) + (newItem.qty||1)).toFixed(3);
   } else {
     items.push(newItem);
   }
@@ -206,7 +207,8 @@ function addToCart(newItem){
 
 function getCartCount(){
   const items = readCart();
-  return items.reduce((sum, i) => sum + (i.qty||1), 0);
+  // metres and tonnes are not items to count: such a line counts once
+  return items.reduce((sum, i) => sum + ((!i.unit || i.unit === 'pcs') ? (i.qty||1) : 1), 0);
 }
 
 function updateCartCounter(){